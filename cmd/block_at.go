@@ -0,0 +1,116 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/node"
+)
+
+// blockAtCmd represents the block-at command
+var blockAtCmd = &cobra.Command{
+	Use:   "block-at <unix time or RFC3339 date>",
+	Short: "Prints the synced block at a point in time",
+	Long: `Prints the synced header nearest to a point in time as JSON, the time is
+either a unix timestamp or an RFC3339 date.
+
+./eth-header-sync block-at 2020-01-01T00:00:00Z --match before --config public.toml
+
+--match selects the header returned:
+  closest  the header with the nearest timestamp, the earlier one on a tie (default)
+  before   the last header with a timestamp at or before the time
+  after    the first header with a timestamp at or after the time
+
+Only the headers synced for the [ethereum] node in the config are searched,
+no connection to an ethereum node is needed.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		blockAt(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(blockAtCmd)
+	blockAtCmd.Flags().String("match", "closest", "header to return: closest, before or after")
+
+	viper.BindPFlag("blockAt.match", blockAtCmd.Flags().Lookup("match"))
+}
+
+func blockAt(at string) {
+	timestamp, err := parseTime(at)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	headerRepository := openHeaderStore(node.MakeNode()).headerRepository()
+
+	var header core.Header
+	switch match := viper.GetString("blockAt.match"); match {
+	case "closest":
+		header, err = headerRepository.GetHeaderClosestToTimestamp(timestamp)
+	case "before":
+		header, err = headerRepository.GetHeaderAtOrBeforeTimestamp(timestamp)
+	case "after":
+		header, err = headerRepository.GetHeaderAtOrAfterTimestamp(timestamp)
+	default:
+		logWithCommand.Fatalf("unknown match %q, expected closest, before or after", match)
+	}
+	if err == sql.ErrNoRows {
+		logWithCommand.Fatalf("no synced header matches %s", at)
+	}
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+
+	headerTimestamp, err := header.UnixTimestamp()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	err = json.NewEncoder(os.Stdout).Encode(struct {
+		Number    int64  `json:"number"`
+		Hash      string `json:"hash"`
+		Timestamp int64  `json:"timestamp"`
+	}{header.BlockNumber, header.Hash, headerTimestamp})
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+}
+
+// parseTime parses a unix timestamp or an RFC3339 date into a unix time
+func parseTime(value string) (int64, error) {
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return timestamp, nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected a unix timestamp or an RFC3339 date", value)
+	}
+	return date.Unix(), nil
+}
@@ -0,0 +1,137 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"github.com/vulcanize/eth-header-sync/pkg/config"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/health"
+	"github.com/vulcanize/eth-header-sync/pkg/kvstore"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/sqlite"
+)
+
+// headerStore is the storage the commands read and write headers with, only one of its fields is set
+// Features built on Postgres, such as partitioning, publishing and leader election, are only available with postgres set
+type headerStore struct {
+	postgres *postgres.DB
+	sqlite   *sqlite.DB
+	kv       *kvstore.DB
+	memory   *repository.MemoryStore
+	node     core.Node
+}
+
+// openHeaderStore connects to the database of the configured driver for the node
+func openHeaderStore(node core.Node) headerStore {
+	return openHeaderStoreWithConfig(databaseConfig, node)
+}
+
+// openHeaderStoreWithConfig connects to the database of the provided config for the node
+func openHeaderStoreWithConfig(dbConfig config.Database, node core.Node) headerStore {
+	switch dbConfig.Driver {
+	case config.SQLiteDriver:
+		db, err := sqlite.NewDB(dbConfig.Name, node)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		return headerStore{sqlite: db, node: node}
+	case config.PebbleDriver:
+		db, err := kvstore.NewDB(dbConfig.Name)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		return headerStore{kv: db, node: node}
+	case config.PostgresDriver, "":
+		db, err := postgres.NewDB(dbConfig, node)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		return headerStore{postgres: db, node: node}
+	default:
+		logWithCommand.Fatalf("unknown database driver %q, expected %s, %s or %s", dbConfig.Driver,
+			config.PostgresDriver, config.SQLiteDriver, config.PebbleDriver)
+	}
+	return headerStore{}
+}
+
+// openReadOnlyHeaderStore opens the database of the provided config for reading headers, without migrating it or
+// recording a node in it
+func openReadOnlyHeaderStore(dbConfig config.Database) headerStore {
+	switch dbConfig.Driver {
+	case config.SQLiteDriver:
+		db, err := sqlite.NewReadOnlyDB(dbConfig.Name)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		return headerStore{sqlite: db}
+	case config.PebbleDriver:
+		db, err := kvstore.NewReadOnlyDB(dbConfig.Name)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		return headerStore{kv: db}
+	case config.PostgresDriver, "":
+		db, err := postgres.NewReadOnlyDB(dbConfig)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		return headerStore{postgres: db}
+	default:
+		logWithCommand.Fatalf("unknown database driver %q, expected %s, %s or %s", dbConfig.Driver,
+			config.PostgresDriver, config.SQLiteDriver, config.PebbleDriver)
+	}
+	return headerStore{}
+}
+
+// newMemoryHeaderStore returns a headerStore which keeps headers in memory for the node
+func newMemoryHeaderStore(node core.Node) headerStore {
+	return headerStore{memory: repository.NewMemoryStore(), node: node}
+}
+
+// headerRepository returns the repository of the node's headers
+func (store headerStore) headerRepository() core.HeaderRepository {
+	return store.headerRepositoryForFingerprint(store.node.ID)
+}
+
+// headerRepositoryForFingerprint returns the repository of the headers synced by the node with the provided fingerprint
+func (store headerStore) headerRepositoryForFingerprint(fingerprint string) core.HeaderRepository {
+	switch {
+	case store.postgres != nil:
+		return repository.NewHeaderRepositoryForFingerprint(store.postgres, fingerprint)
+	case store.sqlite != nil:
+		return sqlite.NewHeaderRepositoryForFingerprint(store.sqlite, fingerprint)
+	case store.kv != nil:
+		return kvstore.NewHeaderRepository(store.kv, fingerprint)
+	default:
+		return repository.NewMemoryHeaderRepository(store.memory, fingerprint)
+	}
+}
+
+// healthChecks returns the readiness checks of the database, there are none for headers kept in memory
+func (store headerStore) healthChecks() []health.Check {
+	switch {
+	case store.postgres != nil:
+		return []health.Check{health.DatabaseCheck(store.postgres)}
+	case store.sqlite != nil:
+		return []health.Check{health.DatabaseCheck(store.sqlite)}
+	case store.kv != nil:
+		return []health.Check{health.DatabaseCheck(store.kv)}
+	default:
+		return nil
+	}
+}
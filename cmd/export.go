@@ -0,0 +1,116 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/eth-header-sync/pkg/export"
+	"github.com/vulcanize/eth-header-sync/pkg/node"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports synced headers to CSV, NDJSON or Parquet files",
+	Long: `Exports the synced headers of a block or time range to CSV, newline
+delimited JSON or Parquet files, with the fields of each header decoded
+from its raw header.
+
+./eth-header-sync export --from 9000000 --to 9999999 --format parquet --split-size 100000 --out ./headers --config public.toml
+
+The range is either block numbers (--from and --to, which defaults to the
+highest synced block) or times (--from-time and --to-time, unix
+timestamps or RFC3339 dates). Files are named headers_<from>_<to>.<format>
+after the block range they hold, --split-size starts a new file every
+that many blocks, and block ranges without headers get no file.
+
+Only the headers synced for the [ethereum] node in the config are exported,
+no connection to an ethereum node is needed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		exportHeaders()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().Int64("from", 0, "first block number to export")
+	exportCmd.Flags().Int64("to", -1, "last block number to export, defaults to the highest synced block")
+	exportCmd.Flags().String("from-time", "", "export headers from this time instead of block number")
+	exportCmd.Flags().String("to-time", "", "export headers up to this time instead of block number")
+	exportCmd.Flags().String("format", string(export.NDJSON), "file format: csv, ndjson or parquet")
+	exportCmd.Flags().String("out", ".", "directory to write the files to")
+	exportCmd.Flags().Int64("split-size", 0, "number of blocks per file, 0 writes a single file")
+
+	viper.BindPFlag("export.from", exportCmd.Flags().Lookup("from"))
+	viper.BindPFlag("export.to", exportCmd.Flags().Lookup("to"))
+	viper.BindPFlag("export.fromTime", exportCmd.Flags().Lookup("from-time"))
+	viper.BindPFlag("export.toTime", exportCmd.Flags().Lookup("to-time"))
+	viper.BindPFlag("export.format", exportCmd.Flags().Lookup("format"))
+	viper.BindPFlag("export.out", exportCmd.Flags().Lookup("out"))
+	viper.BindPFlag("export.splitSize", exportCmd.Flags().Lookup("split-size"))
+}
+
+func exportHeaders() {
+	format, err := export.ParseFormat(viper.GetString("export.format"))
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	out := viper.GetString("export.out")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		logWithCommand.Fatal(err)
+	}
+	headerRepository := openHeaderStore(node.MakeNode()).headerRepository()
+	exporter := export.NewExporter(headerRepository, format, out, viper.GetInt64("export.splitSize"))
+
+	var (
+		paths    []string
+		from, to int64
+	)
+	fromTime, toTime := viper.GetString("export.fromTime"), viper.GetString("export.toTime")
+	if fromTime != "" || toTime != "" {
+		if fromTime == "" || toTime == "" {
+			logWithCommand.Fatal("--from-time and --to-time must be set together")
+		}
+		if from, err = parseTime(fromTime); err != nil {
+			logWithCommand.Fatal(err)
+		}
+		if to, err = parseTime(toTime); err != nil {
+			logWithCommand.Fatal(err)
+		}
+		paths, err = exporter.ExportTimeRange(from, to)
+	} else {
+		from, to = viper.GetInt64("export.from"), viper.GetInt64("export.to")
+		if to < 0 {
+			if to, err = headerRepository.GetLastBlockNumber(); err != nil {
+				logWithCommand.Fatal("export: unable to get the highest synced block: ", err)
+			}
+		}
+		paths, err = exporter.ExportRange(from, to)
+	}
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("exported %d files to %s", len(paths), out)
+}
@@ -0,0 +1,228 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/eth-header-sync/pkg/config"
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/era"
+	"github.com/vulcanize/eth-header-sync/pkg/importer"
+	"github.com/vulcanize/eth-header-sync/pkg/node"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/sqlite"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import [file...]",
+	Short: "Imports headers from NDJSON, RLP or Era1 files, or from another database",
+	Long: `Imports headers from newline delimited JSON, RLP or Era1 files, or from the
+database of another eth-header-sync deployment, into the configured database.
+
+./eth-header-sync import mainnet.rlp.gz --config public.toml
+./eth-header-sync import --source-driver sqlite --source-name headers.db --from 9000000 --config public.toml
+
+Files hold either one header per line in the JSON form eth_getBlockByNumber
+returns it, or RLP encoded blocks or headers such as those written by
+geth export, optionally gzipped, or are Era1 archives of pre-Merge
+history, whose accumulator root is verified against the trusted root of
+its epoch in client.eraAccumulators (or --client-era-accumulators) before
+any header is imported. --format picks the format, by default files ending in .ndjson,
+.jsonl or .json are read as NDJSON, files ending in .era1 as Era1 and any
+other file as RLP.
+
+With --source-driver the headers between --from and --to (which defaults
+to the highest stored block) are read from that database instead, from
+the headers synced by the node with --source-fingerprint, by default the
+[ethereum] node in the config.
+
+With --source-driver the source database is opened read only, and the
+stored headers are copied as they are, with their encodings, uncles and
+transaction hashes.
+
+Every header must link to the header before it by its parent hash, or to
+the stored header when the input skips the block before it, and any hash
+the input claims for a header must match the hash computed from its
+consensus encoding. Headers keep the fields added after go-ethereum's
+header type, such as the base fee, so post-London headers synced over
+JSON-RPC verify, but POA headers stored from JSON-RPC lack their seal
+fields, so import them with --verify-hashes=false. Without verification
+the claimed hashes are trusted, and each one which does not match its
+header is logged as a warning. The import stops at the first header
+failing verification, after storing the headers before it. Headers are
+written in batches of 1000.
+
+The headers are stored for the [ethereum] node in the config, no
+connection to an ethereum node is needed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		importHeaders(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().String("format", "", "file format: ndjson, rlp or era1, by default chosen by file extension")
+	importCmd.Flags().Bool("verify-hashes", true, "verify the hashes claimed for headers, turn off only for POA chains")
+	importCmd.Flags().String("source-driver", "", "database driver of the database to import from (postgres, sqlite or pebble)")
+	importCmd.Flags().String("source-name", "", "name, or path for sqlite and pebble, of the database to import from")
+	importCmd.Flags().String("source-hostname", "localhost", "hostname of the database to import from")
+	importCmd.Flags().Int("source-port", 5432, "port of the database to import from")
+	importCmd.Flags().String("source-user", "", "user of the database to import from")
+	importCmd.Flags().String("source-password", "", "password of the database to import from")
+	importCmd.Flags().String("source-fingerprint", "", "fingerprint of the node whose headers are imported, defaults to the configured node")
+	importCmd.Flags().Int64("from", 0, "first block number to import from the database")
+	importCmd.Flags().Int64("to", -1, "last block number to import from the database, defaults to its highest stored block")
+
+	viper.BindPFlag("import.format", importCmd.Flags().Lookup("format"))
+	viper.BindPFlag("import.verifyHashes", importCmd.Flags().Lookup("verify-hashes"))
+	viper.BindPFlag("import.source.driver", importCmd.Flags().Lookup("source-driver"))
+	viper.BindPFlag("import.source.name", importCmd.Flags().Lookup("source-name"))
+	viper.BindPFlag("import.source.hostname", importCmd.Flags().Lookup("source-hostname"))
+	viper.BindPFlag("import.source.port", importCmd.Flags().Lookup("source-port"))
+	viper.BindPFlag("import.source.user", importCmd.Flags().Lookup("source-user"))
+	viper.BindPFlag("import.source.password", importCmd.Flags().Lookup("source-password"))
+	viper.BindPFlag("import.source.fingerprint", importCmd.Flags().Lookup("source-fingerprint"))
+	viper.BindPFlag("import.from", importCmd.Flags().Lookup("from"))
+	viper.BindPFlag("import.to", importCmd.Flags().Lookup("to"))
+}
+
+func importHeaders(paths []string) {
+	sourceDriver := viper.GetString("import.source.driver")
+	if (len(paths) == 0) == (sourceDriver == "") {
+		logWithCommand.Fatal("pass either files to import or --source-driver")
+	}
+	encoding, err := converter.ParseRawEncoding(viper.GetString("database.rawEncoding"))
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	vdbNode := node.MakeNode()
+	headerRepository := openHeaderStore(vdbNode).headerRepository()
+	headerImporter := importer.NewImporter(headerRepository, converter.HeaderConverter{Encoding: encoding},
+		viper.GetBool("import.verifyHashes"))
+
+	if sourceDriver != "" {
+		importDatabase(headerImporter, vdbNode)
+		return
+	}
+	for _, path := range paths {
+		importFile(headerImporter, path)
+	}
+}
+
+func importDatabase(headerImporter *importer.Importer, vdbNode core.Node) {
+	sourceConfig := config.Database{
+		Driver:   viper.GetString("import.source.driver"),
+		Name:     viper.GetString("import.source.name"),
+		Hostname: viper.GetString("import.source.hostname"),
+		Port:     viper.GetInt("import.source.port"),
+		User:     viper.GetString("import.source.user"),
+		Password: viper.GetString("import.source.password"),
+	}
+	fingerprint := viper.GetString("import.source.fingerprint")
+	if fingerprint == "" {
+		fingerprint = vdbNode.ID
+	}
+	sourceStore := openReadOnlyHeaderStore(sourceConfig)
+	sourceRepository := sourceStore.headerRepositoryForFingerprint(fingerprint)
+
+	from, to := viper.GetInt64("import.from"), viper.GetInt64("import.to")
+	if to < 0 {
+		var err error
+		if to, err = sourceRepository.GetLastBlockNumber(); err != nil {
+			logWithCommand.Fatal("import: unable to get the highest block of the source database: ", err)
+		}
+	}
+	source := importer.NewRepositorySource(sourceRepository, from, to)
+	// The key-value store keeps uncles and transaction hashes in the header, the SQL databases in their own tables
+	switch {
+	case sourceStore.postgres != nil:
+		nodeDatabase := *sourceStore.postgres
+		nodeDatabase.Node.ID = fingerprint
+		source.SetUncleReader(repository.NewUncleRepository(&nodeDatabase))
+		source.SetTransactionHashReader(repository.NewHeaderTransactionRepository(&nodeDatabase))
+	case sourceStore.sqlite != nil:
+		sqliteRepository := sqlite.NewHeaderRepositoryForFingerprint(sourceStore.sqlite, fingerprint)
+		source.SetUncleReader(sqliteRepository)
+		source.SetTransactionHashReader(sqliteRepository)
+	}
+	result, err := headerImporter.Import(source)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("imported %d headers from %s, %d were already stored", result.Imported, sourceConfig.Name, result.Existing)
+}
+
+func importFile(headerImporter *importer.Importer, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer file.Close()
+
+	var source importer.Source
+	switch format := importFormat(path); format {
+	case "ndjson":
+		if source, err = importer.NewNDJSONSource(file); err != nil {
+			logWithCommand.Fatal(err)
+		}
+	case "rlp":
+		if source, err = importer.NewRLPSource(file); err != nil {
+			logWithCommand.Fatal(err)
+		}
+	case "era1":
+		eraFile, err := era.Open(path)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		defer eraFile.Close()
+		source = era.NewSource(eraFile, readEraAccumulators())
+	default:
+		logWithCommand.Fatalf("unknown format %q, expected ndjson, rlp or era1", format)
+	}
+	result, err := headerImporter.Import(source)
+	if err != nil {
+		logWithCommand.Fatalf("%s: %s", path, err.Error())
+	}
+	logWithCommand.Infof("imported %d headers from %s, %d were already stored", result.Imported, path, result.Existing)
+}
+
+// importFormat returns the configured format, or the format of the file's extension
+func importFormat(path string) string {
+	if format := viper.GetString("import.format"); format != "" {
+		return strings.ToLower(format)
+	}
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz"))) {
+	case ".ndjson", ".jsonl", ".json":
+		return "ndjson"
+	case ".era1":
+		return "era1"
+	default:
+		return "rlp"
+	}
+}
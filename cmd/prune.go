@@ -0,0 +1,87 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/eth-header-sync/pkg/history"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Deletes headers which fall outside of the retention policy",
+	Long: `Deletes headers which fall outside of the retention policy.
+Pruned blocks are not treated as missing by later syncs. The retention
+timestamp is resolved to the first block of the chain at or after it
+through the node, so unsynced blocks after it are still backfilled.
+
+./eth-header-sync prune --retention-blocks 100000 --config public.toml
+
+The retention policy can also be set in the .toml config:
+
+  [retention]
+  blocks = 100000         # keep the last N blocks
+  timestamp = 1577836800  # keep headers at or after this unix time
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		bindRetentionFlags(cmd)
+		prune()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	addRetentionFlags(pruneCmd)
+}
+
+func prune() {
+	policy := getRetentionPolicy()
+	if !policy.Enabled() {
+		logWithCommand.Fatal("no retention policy set, see --retention-blocks and --retention-timestamp")
+	}
+	f := getFetcher()
+	headerRepository := openHeaderStore(f.Node()).headerRepository()
+	pruned, err := history.PruneHeaders(f, headerRepository, policy)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("pruned %d headers", pruned)
+}
+
+func addRetentionFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64("retention-blocks", 0, "number of most recent blocks to keep headers for")
+	cmd.Flags().Int64("retention-timestamp", 0, "unix time from which headers are kept")
+}
+
+// bindRetentionFlags binds the retention flags of the running command, since they are shared by several commands
+func bindRetentionFlags(cmd *cobra.Command) {
+	viper.BindPFlag("retention.blocks", cmd.Flags().Lookup("retention-blocks"))
+	viper.BindPFlag("retention.timestamp", cmd.Flags().Lookup("retention-timestamp"))
+}
+
+func getRetentionPolicy() history.RetentionPolicy {
+	return history.RetentionPolicy{
+		Blocks:    viper.GetInt64("retention.blocks"),
+		Timestamp: viper.GetInt64("retention.timestamp"),
+	}
+}
@@ -0,0 +1,57 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/publisher"
+)
+
+func addPublisherFlags(cmd *cobra.Command) {
+	cmd.Flags().String("publisher-nats-url", "", "url of the NATS server to publish header events to")
+	cmd.Flags().String("publisher-nats-subject", "headers", "NATS subject to publish header events on")
+	cmd.Flags().StringSlice("publisher-kafka-brokers", nil, "addresses of the Kafka brokers to publish header events to")
+	cmd.Flags().String("publisher-kafka-topic", "headers", "Kafka topic to publish header events on")
+
+	viper.BindPFlag("publisher.natsURL", cmd.Flags().Lookup("publisher-nats-url"))
+	viper.BindPFlag("publisher.natsSubject", cmd.Flags().Lookup("publisher-nats-subject"))
+	viper.BindPFlag("publisher.kafkaBrokers", cmd.Flags().Lookup("publisher-kafka-brokers"))
+	viper.BindPFlag("publisher.kafkaTopic", cmd.Flags().Lookup("publisher-kafka-topic"))
+}
+
+// getPublisher returns the configured message queue publisher, or nil if none is configured
+func getPublisher() core.HeaderPublisher {
+	natsURL := viper.GetString("publisher.natsURL")
+	kafkaBrokers := viper.GetStringSlice("publisher.kafkaBrokers")
+	if natsURL != "" && len(kafkaBrokers) > 0 {
+		logWithCommand.Fatal("only one of publisher.natsURL and publisher.kafkaBrokers can be set")
+	}
+	if natsURL != "" {
+		natsPublisher, err := publisher.NewNATSPublisher(natsURL, viper.GetString("publisher.natsSubject"))
+		if err != nil {
+			logWithCommand.Fatal("unable to connect to NATS: ", err)
+		}
+		return natsPublisher
+	}
+	if len(kafkaBrokers) > 0 {
+		return publisher.NewKafkaPublisher(kafkaBrokers, viper.GetString("publisher.kafkaTopic"))
+	}
+	return nil
+}
@@ -22,14 +22,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/vulcanize/eth-header-sync/pkg/chaindata"
 	"github.com/vulcanize/eth-header-sync/pkg/client"
 	"github.com/vulcanize/eth-header-sync/pkg/config"
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/era"
 	"github.com/vulcanize/eth-header-sync/pkg/fetcher"
 	"github.com/vulcanize/eth-header-sync/pkg/node"
 )
@@ -45,6 +50,8 @@ var (
 
 const (
 	pollingInterval  = 7 * time.Second
+	outboxInterval   = time.Second
+	leaderInterval   = time.Second
 	validationWindow = 15
 )
 
@@ -85,6 +92,7 @@ func initFuncs(cmd *cobra.Command, args []string) {
 func setViperConfigs() {
 	ipc = viper.GetString("client.rpcPath")
 	databaseConfig = config.Database{
+		Driver:   viper.GetString("database.driver"),
 		Name:     viper.GetString("database.name"),
 		Hostname: viper.GetString("database.hostname"),
 		Port:     viper.GetInt("database.port"),
@@ -115,21 +123,37 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file location")
 	rootCmd.PersistentFlags().String("logfile", "", "file path for logging")
-	rootCmd.PersistentFlags().String("database-name", "vulcanize_public", "database name")
+	rootCmd.PersistentFlags().String("database-driver", config.PostgresDriver, "database driver (postgres, sqlite or pebble)")
+	rootCmd.PersistentFlags().String("database-name", "vulcanize_public", "database name, or database path for sqlite and pebble")
 	rootCmd.PersistentFlags().Int("database-port", 5432, "database port")
 	rootCmd.PersistentFlags().String("database-hostname", "localhost", "database hostname")
 	rootCmd.PersistentFlags().String("database-user", "", "database user")
 	rootCmd.PersistentFlags().String("database-password", "", "database password")
+	rootCmd.PersistentFlags().String("database-raw-encoding", "json", "encoding of the stored raw headers (json, rlp or both)")
 	rootCmd.PersistentFlags().String("client-rpcPath", "", "path for calling eth http rpc endpoints")
+	rootCmd.PersistentFlags().String("client-record", "", "fixture file to record every rpc request and response to")
+	rootCmd.PersistentFlags().String("client-replay", "", "fixture file to replay rpc responses from instead of calling the node")
+	rootCmd.PersistentFlags().String("client-chaindata", "", "chaindata directory of a stopped geth node to read headers from instead of calling the node")
+	rootCmd.PersistentFlags().String("client-ancient", "", "ancient freezer directory of the chaindata, defaults to its ancient subdirectory")
+	rootCmd.PersistentFlags().String("client-era", "", "directory of Era1 files to read the headers they cover from")
+	rootCmd.PersistentFlags().String("client-era-accumulators", "", "file of the trusted Era1 accumulator roots, one per line in epoch order, required with --client-era")
 	rootCmd.PersistentFlags().String("log-level", log.InfoLevel.String(), "Log level (trace, debug, info, warn, error, fatal, panic")
 
 	viper.BindPFlag("logfile", rootCmd.PersistentFlags().Lookup("logfile"))
+	viper.BindPFlag("database.driver", rootCmd.PersistentFlags().Lookup("database-driver"))
 	viper.BindPFlag("database.name", rootCmd.PersistentFlags().Lookup("database-name"))
 	viper.BindPFlag("database.port", rootCmd.PersistentFlags().Lookup("database-port"))
 	viper.BindPFlag("database.hostname", rootCmd.PersistentFlags().Lookup("database-hostname"))
 	viper.BindPFlag("database.user", rootCmd.PersistentFlags().Lookup("database-user"))
 	viper.BindPFlag("database.password", rootCmd.PersistentFlags().Lookup("database-password"))
+	viper.BindPFlag("database.rawEncoding", rootCmd.PersistentFlags().Lookup("database-raw-encoding"))
 	viper.BindPFlag("client.rpcPath", rootCmd.PersistentFlags().Lookup("client-rpcPath"))
+	viper.BindPFlag("client.recordPath", rootCmd.PersistentFlags().Lookup("client-record"))
+	viper.BindPFlag("client.replayPath", rootCmd.PersistentFlags().Lookup("client-replay"))
+	viper.BindPFlag("client.chaindataPath", rootCmd.PersistentFlags().Lookup("client-chaindata"))
+	viper.BindPFlag("client.ancientPath", rootCmd.PersistentFlags().Lookup("client-ancient"))
+	viper.BindPFlag("client.eraPath", rootCmd.PersistentFlags().Lookup("client-era"))
+	viper.BindPFlag("client.eraAccumulators", rootCmd.PersistentFlags().Lookup("client-era-accumulators"))
 	viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log-level"))
 }
 
@@ -146,19 +170,112 @@ func initConfig() {
 	}
 }
 
-func getFetcher() *fetcher.Fetcher {
-	rpcClient, ethClient := getClients()
+// configurableFetcher is a core.Fetcher with the settings of the sync command
+type configurableFetcher interface {
+	core.Fetcher
+	SetRawEncoding(encoding converter.RawEncoding)
+	SetFetchUncles(fetchUncles bool)
+	SetFetchTransactionHashes(fetchTxHashes bool)
+}
+
+// getFetcher returns a fetcher reading from the configured chaindata directory, or from the node over rpc otherwise
+// With an Era1 directory configured the blocks covered by its files are read from them instead, and without a node or
+// chaindata to fall back to only those blocks are
+func getFetcher() core.Fetcher {
 	vdbNode := node.MakeNode()
-	return fetcher.NewFetcher(ethClient, rpcClient, vdbNode)
+	var f configurableFetcher
+	chaindataPath, eraPath := viper.GetString("client.chaindataPath"), viper.GetString("client.eraPath")
+	switch {
+	case chaindataPath != "":
+		db, err := chaindata.NewDB(chaindataPath, viper.GetString("client.ancientPath"))
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		logWithCommand.Infof("reading headers from the chaindata at %s", chaindataPath)
+		if f, err = chaindata.NewFetcher(db, vdbNode); err != nil {
+			logWithCommand.Fatal(err)
+		}
+	case eraPath == "" || ipc != "" || viper.GetString("client.replayPath") != "":
+		rpcClient, ethClient := getClients()
+		f = fetcher.NewFetcher(ethClient, rpcClient, vdbNode)
+	}
+	if f != nil {
+		configureFetcher(f)
+	}
+	if eraPath == "" {
+		return f
+	}
+
+	store, err := era.OpenStore(eraPath, readEraAccumulators())
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("reading headers covered by the %d Era1 files in %s from them", len(store.Files()), eraPath)
+	// A nil fallback must be a nil interface rather than one holding a nil fetcher
+	var fallback core.Fetcher
+	if f != nil {
+		fallback = f
+	}
+	eraFetcher := era.NewFetcher(store, fallback, vdbNode)
+	configureFetcher(eraFetcher)
+	return eraFetcher
+}
+
+// readEraAccumulators reads the trusted Era1 accumulator roots from the configured file, which is required since the
+// roots stored in the files are not to be trusted on their own
+func readEraAccumulators() []common.Hash {
+	accumulatorsPath := viper.GetString("client.eraAccumulators")
+	if accumulatorsPath == "" {
+		logWithCommand.Fatal("reading Era1 files requires the trusted accumulator roots of their epochs, set client.eraAccumulators (or --client-era-accumulators)")
+	}
+	accumulators, err := os.Open(accumulatorsPath)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer accumulators.Close()
+	roots, err := era.ReadAccumulators(accumulators)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	return roots
+}
+
+// configureFetcher applies the configured raw encoding and sync settings to the fetcher
+func configureFetcher(f configurableFetcher) {
+	encoding, err := converter.ParseRawEncoding(viper.GetString("database.rawEncoding"))
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	f.SetRawEncoding(encoding)
+	f.SetFetchUncles(viper.GetBool("sync.uncles"))
+	f.SetFetchTransactionHashes(viper.GetBool("sync.transactions"))
 }
 
-func getClients() (client.RPCClient, *ethclient.Client) {
+func getClients() (core.RPCClient, core.EthClient) {
+	if replayPath := viper.GetString("client.replayPath"); replayPath != "" {
+		replayClient, err := client.NewReplayClient(replayPath)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		return replayClient, replayClient
+	}
+
 	rawRPCClient, err := rpc.Dial(ipc)
 
 	if err != nil {
 		logWithCommand.Fatal(err)
 	}
 	rpcClient := client.NewRPCClient(rawRPCClient, ipc)
+
+	if recordPath := viper.GetString("client.recordPath"); recordPath != "" {
+		fixture, err := os.OpenFile(recordPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+		logWithCommand.Infof("recording rpc requests to %s", recordPath)
+		recorder := client.NewRecordingRPCClient(rpcClient, fixture)
+		return recorder, client.NewEthClient(recorder)
+	}
 	ethClient := ethclient.NewClient(rawRPCClient)
 
 	return rpcClient, ethClient
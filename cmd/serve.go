@@ -0,0 +1,132 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/eth-header-sync/pkg/api"
+	"github.com/vulcanize/eth-header-sync/pkg/graphql"
+	"github.com/vulcanize/eth-header-sync/pkg/listener"
+	"github.com/vulcanize/eth-header-sync/pkg/node"
+	"github.com/vulcanize/eth-header-sync/pkg/rest"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves the synced headers over JSON-RPC, GraphQL and REST",
+	Long: `Serves the synced headers over HTTP and websocket JSON-RPC, answering
+eth_blockNumber, eth_getBlockByNumber, eth_getBlockByHash and
+eth_getHeaderByNumber from the headers table. Blocks are returned with
+their header fields only.
+
+A GraphQL API is served on /graphql, over HTTP for queries and over
+websockets (graphql-ws) for queries and the newHeads and reorgs
+subscriptions.
+
+A REST API is served on /headers: /headers/{number}, /headers/by-hash/{hash},
+/headers/at-time/{unix} and paginated ranges on /headers?from=&to=&limit=.
+When client.rpcPath is set, responses for headers deeper than
+server.finalityDepth (or --server-finality-depth) blocks below the head of
+the node's chain carry an ETag and may be cached, pages only once they
+hold every header of their range.
+
+./eth-header-sync serve --config public.toml
+
+The headers served are those synced for the [ethereum] node in the config,
+no connection to an ethereum node is needed otherwise:
+
+  [server]
+  httpAddr = "127.0.0.1:8545"
+  wsOrigins = ["*"]
+  finalityDepth = 15
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		serve()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("server-http-addr", "127.0.0.1:8545", "address to serve JSON-RPC over HTTP and websockets on")
+	serveCmd.Flags().StringSlice("server-ws-origins", []string{"*"}, "origins accepted for websocket connections")
+	serveCmd.Flags().Int64("server-finality-depth", validationWindow, "number of blocks below the head after which REST responses are cacheable")
+
+	viper.BindPFlag("server.httpAddr", serveCmd.Flags().Lookup("server-http-addr"))
+	viper.BindPFlag("server.wsOrigins", serveCmd.Flags().Lookup("server-ws-origins"))
+	viper.BindPFlag("server.finalityDepth", serveCmd.Flags().Lookup("server-finality-depth"))
+}
+
+func serve() {
+	store := openHeaderStore(node.MakeNode())
+	headerRepository := store.headerRepository()
+	rpcServer, err := api.NewServer(headerRepository)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer rpcServer.Stop()
+
+	graphqlHandler, err := getGraphQLHandler(store)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", api.NewHandler(rpcServer, viper.GetStringSlice("server.wsOrigins")))
+	mux.Handle("/graphql", graphqlHandler)
+	restHandler := rest.NewHandler(headerRepository, getChainHead(), viper.GetInt64("server.finalityDepth"))
+	mux.Handle(rest.PathPrefix, restHandler)
+	mux.Handle(rest.PathPrefix+"/", restHandler)
+
+	addr := viper.GetString("server.httpAddr")
+	logWithCommand.Infof("serving JSON-RPC on %s", addr)
+	logWithCommand.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// getChainHead returns the node's fetcher to tell finalized headers by, or nil if no node is configured
+func getChainHead() rest.ChainHead {
+	if ipc == "" && viper.GetString("client.replayPath") == "" {
+		return nil
+	}
+	return getFetcher()
+}
+
+// getGraphQLHandler returns the GraphQL handler, its subscriptions are fed by the header events published by syncing nodes
+// Header events are only published by Postgres, with other databases the subscriptions are disabled
+func getGraphQLHandler(store headerStore) (http.Handler, error) {
+	var events *listener.HeaderBroadcaster
+	if store.postgres != nil {
+		headerListener, err := listener.NewHeaderListener(databaseConfig, "")
+		if err != nil {
+			logWithCommand.Warn("unable to listen for header events, GraphQL subscriptions are disabled: ", err)
+		} else {
+			events = listener.NewHeaderBroadcaster(headerListener.Events())
+		}
+	}
+	schema, err := graphql.NewSchema(graphql.NewResolver(store.headerRepositoryForFingerprint, store.node.ID, events))
+	if err != nil {
+		return nil, err
+	}
+	return graphql.NewHandler(schema, viper.GetStringSlice("server.wsOrigins")), nil
+}
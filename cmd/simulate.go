@@ -0,0 +1,112 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+// simulateCmd represents the simulate command
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Serves a simulated chain over JSON-RPC for testing",
+	Long: `Serves a deterministic simulated chain over HTTP and websocket JSON-RPC,
+answering eth_blockNumber, eth_getBlockByNumber, batch requests and
+eth_subscribe("newHeads") as a node would, so that sync can be run
+end-to-end without a real node.
+
+./eth-header-sync simulate --simulate-head 100 --simulate-block-interval 1s
+
+The chain starts with headers up to --simulate-head and grows by a header
+every --simulate-block-interval. Setting --simulate-reorg-interval reorgs
+the last --simulate-reorg-depth headers every that many new headers.
+
+  [simulate]
+  httpAddr = "127.0.0.1:8545"
+  head = 100
+  blockInterval = "1s"
+  reorgInterval = 0
+  reorgDepth = 3
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		simulate()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+	simulateCmd.Flags().String("simulate-http-addr", "127.0.0.1:8545", "address to serve the simulated chain on")
+	simulateCmd.Flags().Int64("simulate-head", 100, "block number of the head of the chain when starting")
+	simulateCmd.Flags().Duration("simulate-block-interval", time.Second, "interval between new headers, 0 stops the chain from growing")
+	simulateCmd.Flags().Int64("simulate-reorg-interval", 0, "number of new headers between reorgs, 0 disables reorgs")
+	simulateCmd.Flags().Int64("simulate-reorg-depth", 3, "number of headers replaced by each reorg")
+
+	viper.BindPFlag("simulate.httpAddr", simulateCmd.Flags().Lookup("simulate-http-addr"))
+	viper.BindPFlag("simulate.head", simulateCmd.Flags().Lookup("simulate-head"))
+	viper.BindPFlag("simulate.blockInterval", simulateCmd.Flags().Lookup("simulate-block-interval"))
+	viper.BindPFlag("simulate.reorgInterval", simulateCmd.Flags().Lookup("simulate-reorg-interval"))
+	viper.BindPFlag("simulate.reorgDepth", simulateCmd.Flags().Lookup("simulate-reorg-depth"))
+}
+
+func simulate() {
+	chain := simulated.NewChain(viper.GetInt64("simulate.head"))
+	server, err := simulated.NewServer(chain, viper.GetString("simulate.httpAddr"))
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer server.Close()
+	logWithCommand.Infof("serving a simulated chain on %s and %s", server.URL(), server.WSURL())
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	var blocks <-chan time.Time
+	if interval := viper.GetDuration("simulate.blockInterval"); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		blocks = ticker.C
+	}
+	reorgInterval := viper.GetInt64("simulate.reorgInterval")
+	reorgDepth := viper.GetInt64("simulate.reorgDepth")
+	var mined int64
+	for {
+		select {
+		case <-blocks:
+			mined++
+			if reorgInterval > 0 && mined%reorgInterval == 0 {
+				if err := chain.Reorg(reorgDepth, reorgDepth+1); err != nil {
+					logWithCommand.Error("simulate: error reorging chain: ", err)
+				}
+				logWithCommand.Infof("reorged the last %d headers, head is %d", reorgDepth, chain.Head())
+				continue
+			}
+			chain.Extend(1)
+			logWithCommand.Debugf("head is %d", chain.Head())
+		case <-interrupt:
+			return
+		}
+	}
+}
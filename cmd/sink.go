@@ -0,0 +1,65 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/sink"
+)
+
+func addSinkFlags(cmd *cobra.Command) {
+	cmd.Flags().String("sink-webhook", "", "URL to POST header events to")
+	cmd.Flags().String("sink-webhook-secret", "", "secret used to sign header events posted to the webhook")
+	cmd.Flags().Int("sink-webhook-retries", 3, "number of times a failed webhook request is retried")
+	cmd.Flags().String("sink-file", "", "file to append header events to as NDJSON")
+	cmd.Flags().Bool("sink-stdout", false, "write header events to stdout as NDJSON")
+
+	viper.BindPFlag("sink.webhook", cmd.Flags().Lookup("sink-webhook"))
+	viper.BindPFlag("sink.webhookSecret", cmd.Flags().Lookup("sink-webhook-secret"))
+	viper.BindPFlag("sink.webhookRetries", cmd.Flags().Lookup("sink-webhook-retries"))
+	viper.BindPFlag("sink.file", cmd.Flags().Lookup("sink-file"))
+	viper.BindPFlag("sink.stdout", cmd.Flags().Lookup("sink-stdout"))
+}
+
+// getSink returns the configured header sinks, or nil if none are configured
+func getSink() core.HeaderSink {
+	var sinks sink.MultiSink
+	if url := viper.GetString("sink.webhook"); url != "" {
+		sinks = append(sinks, sink.NewWebhookSink(url, viper.GetString("sink.webhookSecret"), viper.GetInt("sink.webhookRetries")))
+	}
+	if path := viper.GetString("sink.file"); path != "" {
+		fileSink, err := sink.NewFileSink(path)
+		if err != nil {
+			logWithCommand.Fatal("unable to open sink file: ", err)
+		}
+		sinks = append(sinks, fileSink)
+	}
+	if viper.GetBool("sink.stdout") {
+		sinks = append(sinks, sink.NewStdoutSink())
+	}
+	switch len(sinks) {
+	case 0:
+		return nil
+	case 1:
+		return sinks[0]
+	default:
+		return sinks
+	}
+}
@@ -17,15 +17,20 @@
 package cmd
 
 import (
+	"net/http"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/vulcanize/eth-header-sync/pkg/core"
-	"github.com/vulcanize/eth-header-sync/pkg/fetcher"
+	"github.com/vulcanize/eth-header-sync/pkg/health"
 	"github.com/vulcanize/eth-header-sync/pkg/history"
+	"github.com/vulcanize/eth-header-sync/pkg/leader"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
 	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+	"github.com/vulcanize/eth-header-sync/pkg/publisher"
 	"github.com/vulcanize/eth-header-sync/pkg/repository"
 )
 
@@ -47,10 +52,73 @@ Expects ethereum node to be running and requires a .toml config:
 
   [client]
   rpcPath = "/Users/user/Library/Ethereum/geth.ipc"
+
+Setting database.partitionSize (or --partition-size) converts the headers
+table into a table partitioned by block number ranges of that size, new
+partitions are created as the chain grows. Range partitions start from the
+partition containing --starting-block-number, lower blocks are kept in the
+default partition, and a size needing more than 1000 partitions is rejected.
+
+Setting a [retention] policy (or --retention-blocks/--retention-timestamp)
+prunes headers which fall outside of it between backfill rounds.
+
+Setting sync.uncles (or --sync-uncles) also stores the uncles included
+by each header in the uncles table, and sync.transactions (or
+--sync-transactions) stores the transaction hashes of each header in the
+header_transactions table.
+
+Setting a [sink] (or --sink-webhook/--sink-file/--sink-stdout) delivers an
+event for every header inserted, replaced by a reorg, or confirmed by
+leaving the validation window.
+
+Setting a [publisher] (or --publisher-nats-url/--publisher-kafka-brokers)
+records every header insert and replace in the header_outbox table, in
+the same transaction as the header, and relays the outbox to the NATS
+subject or Kafka topic with at-least-once delivery.
+
+Setting sync.httpAddr (or --http-addr) serves, at that address:
+  /metrics  Prometheus metrics: the chain head, highest synced block, lag,
+            missing header count and validation window, and counters of
+            the RPC requests, database writes and reorgs
+  /healthz  liveness, 200 while the process is serving
+  /readyz   readiness, 200 when the database and node are reachable, the
+            node is synced and the highest synced header is at most
+            health.maxLag (or --health-max-lag) blocks behind the chain head
+
+Setting sync.leaderElection (or --leader-election) lets several replicas
+sync for the same node: only the replica holding a Postgres advisory lock
+on the node fingerprint syncs, the others stand by and take over once the
+leader's database session ends. A leader which loses its session exits,
+and each of its writes first checks that its session still holds the lock,
+so that it cannot write once a standby has taken over.
+
+Setting client.chaindataPath (or --client-chaindata) reads the headers
+from the LevelDB or Pebble chaindata directory of a stopped geth node and
+its ancient freezer (client.ancientPath or --client-ancient, by default
+the ancient subdirectory) instead of calling a node, for a fast initial
+backfill from a local snapshot. The chaindata is opened read-only, its
+genesis block must be the configured one and its head header is the
+head of the chain.
+
+Setting client.eraPath (or --client-era) reads the headers covered by the
+Era1 archives of pre-Merge history in that directory from them, and the
+rest from the node or chaindata if one is configured. Each file's
+accumulator root is verified before its headers are read against the
+trusted roots listed in client.eraAccumulators (or
+--client-era-accumulators), one per line in epoch order, which is
+required along with client.eraPath.
+
+Setting database.driver (or --database-driver) to sqlite syncs into the
+SQLite database file at database.name instead of Postgres, setting it to
+pebble syncs into an embedded Pebble store in that directory. Setting
+sync.dryRun (or --dry-run) syncs without a database, keeping the headers
+in memory until the process exits. Partitioning, publishing and leader
+election need Postgres and are disabled otherwise.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		subCommand = cmd.CalledAs()
 		logWithCommand = *log.WithField("SubCommand", subCommand)
+		bindRetentionFlags(cmd)
 		sync()
 	},
 }
@@ -58,10 +126,29 @@ Expects ethereum node to be running and requires a .toml config:
 func init() {
 	rootCmd.AddCommand(syncCmd)
 	syncCmd.Flags().Int64VarP(&startingBlockNumber, "starting-block-number", "s", 0, "Block number to start syncing from")
+	syncCmd.Flags().Int64("partition-size", 0, "number of blocks per headers table partition, 0 disables partitioning")
+	syncCmd.Flags().Bool("sync-uncles", false, "fetch and store the uncles included by each header")
+	syncCmd.Flags().Bool("sync-transactions", false, "store the transaction hashes of each header")
+	syncCmd.Flags().String("http-addr", "", "address to serve metrics and health endpoints on, empty disables them")
+	syncCmd.Flags().Int64("health-max-lag", 50, "number of blocks the synced headers may lag behind the chain head while ready")
+	syncCmd.Flags().Bool("leader-election", false, "only sync while holding the leader lock for the node, standing by otherwise")
+	syncCmd.Flags().Bool("dry-run", false, "sync headers into memory instead of the database")
+
+	addRetentionFlags(syncCmd)
+	addSinkFlags(syncCmd)
+	addPublisherFlags(syncCmd)
+
+	viper.BindPFlag("database.partitionSize", syncCmd.Flags().Lookup("partition-size"))
+	viper.BindPFlag("sync.uncles", syncCmd.Flags().Lookup("sync-uncles"))
+	viper.BindPFlag("sync.transactions", syncCmd.Flags().Lookup("sync-transactions"))
+	viper.BindPFlag("sync.httpAddr", syncCmd.Flags().Lookup("http-addr"))
+	viper.BindPFlag("health.maxLag", syncCmd.Flags().Lookup("health-max-lag"))
+	viper.BindPFlag("sync.leaderElection", syncCmd.Flags().Lookup("leader-election"))
+	viper.BindPFlag("sync.dryRun", syncCmd.Flags().Lookup("dry-run"))
 }
 
-func backFillAllHeaders(fetcher core.Fetcher, headerRepository core.HeaderRepository, missingBlocksPopulated chan int, startingBlockNumber int64) {
-	populated, err := history.PopulateMissingHeaders(fetcher, headerRepository, startingBlockNumber)
+func backFillAllHeaders(fetcher core.Fetcher, headerRepository core.HeaderRepository, sink core.HeaderSink, missingBlocksPopulated chan int, startingBlockNumber int64) {
+	populated, err := history.PopulateMissingHeaders(fetcher, headerRepository, startingBlockNumber, sink)
 	if err != nil {
 		// TODO Lots of possible errors in the call stack above. If errors occur, we still put
 		// 0 in the channel, triggering another round
@@ -75,34 +162,172 @@ func sync() {
 	defer ticker.Stop()
 	f := getFetcher()
 	validateArgs(f)
-	db, err := postgres.NewDB(databaseConfig, f.Node())
-	if err != nil {
-		logWithCommand.Fatal(err)
+	store := getSyncStore(f)
+	headerRepository := store.headerRepository()
+	serveHTTP(store, f, headerRepository)
+	elector := awaitLeadership(store.postgres)
+	partitioner := getPartitioner(store.postgres, f)
+	headerPublisher := getSyncPublisher(store.postgres)
+	if headerPublisher != nil || elector != nil {
+		postgresRepository := repository.NewHeaderRepository(store.postgres)
+		postgresRepository.SetOutbox(headerPublisher != nil)
+		if elector != nil {
+			postgresRepository.SetLeaderCheck(elector.CheckTx)
+		}
+		headerRepository = postgresRepository
 	}
-
-	headerRepository := repository.NewHeaderRepository(db)
-	validator := history.NewHeaderValidator(f, headerRepository, validationWindow)
+	if headerPublisher != nil {
+		relay := publisher.NewRelay(repository.NewHeaderOutboxRepository(store.postgres), headerPublisher)
+		go relay.Run(outboxInterval, nil)
+	}
+	var leadershipLost <-chan struct{}
+	if elector != nil {
+		leadershipLost = elector.Monitor(leaderInterval)
+	}
+	policy := getRetentionPolicy()
+	sink := getSink()
+	validator := history.NewHeaderValidator(f, headerRepository, validationWindow, sink)
 	missingBlocksPopulated := make(chan int)
-	go backFillAllHeaders(f, headerRepository, missingBlocksPopulated, startingBlockNumber)
+	go backFillAllHeaders(f, headerRepository, sink, missingBlocksPopulated, startingBlockNumber)
 
 	for {
 		select {
+		case <-leadershipLost:
+			logWithCommand.Fatal("sync: lost leadership, exiting so that a standby takes over")
 		case <-ticker.C:
+			ensurePartitions(f, partitioner)
 			window, err := validator.ValidateHeaders()
 			if err != nil {
 				logWithCommand.Error("sync: ValidateHeaders failed: ", err)
+			} else {
+				recordHeads(window.UpperBound, headerRepository)
 			}
 			logWithCommand.Debug(window.GetString())
 		case n := <-missingBlocksPopulated:
+			// Prune while no backfill is running so that the two do not race over the same range
+			if policy.Enabled() {
+				pruneHeaders(f, headerRepository, policy)
+			}
 			if n == 0 {
 				time.Sleep(3 * time.Second)
 			}
-			go backFillAllHeaders(f, headerRepository, missingBlocksPopulated, startingBlockNumber)
+			go backFillAllHeaders(f, headerRepository, sink, missingBlocksPopulated, startingBlockNumber)
 		}
 	}
 }
 
-func validateArgs(f *fetcher.Fetcher) {
+// getSyncStore connects to the database the headers are synced into
+// For a dry run there is no database and headers are kept in memory
+func getSyncStore(f core.Fetcher) headerStore {
+	if viper.GetBool("sync.dryRun") {
+		logWithCommand.Info("dry run: headers are kept in memory and not written to the database")
+		return newMemoryHeaderStore(f.Node())
+	}
+	return openHeaderStore(f.Node())
+}
+
+// getSyncPublisher returns the configured publisher, there is none without a Postgres database to hold the outbox
+func getSyncPublisher(db *postgres.DB) core.HeaderPublisher {
+	if db == nil {
+		return nil
+	}
+	return getPublisher()
+}
+
+// awaitLeadership blocks until this process is the leader for the node, if leader election is enabled
+// It returns the elector holding leadership, or nil if leader election is disabled
+func awaitLeadership(db *postgres.DB) *leader.Elector {
+	if db == nil || !viper.GetBool("sync.leaderElection") {
+		return nil
+	}
+	elector := leader.NewElector(db, db.Node.ID)
+	logWithCommand.Info("waiting for leadership")
+	elector.Acquire(leaderInterval, nil)
+	logWithCommand.Info("acquired leadership")
+	return elector
+}
+
+// serveHTTP serves the metrics and health endpoints in the background, if an address is configured
+func serveHTTP(store headerStore, f core.Fetcher, headerRepository core.HeaderRepository) {
+	addr := viper.GetString("sync.httpAddr")
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.NewHandler())
+	checks := append(store.healthChecks(),
+		health.NodeCheck(f),
+		health.LagCheck(f, headerRepository, viper.GetInt64("health.maxLag")),
+	)
+	mux.Handle("/readyz", health.NewHandler(checks...))
+	logWithCommand.Infof("serving metrics and health endpoints on %s", addr)
+	go func() {
+		logWithCommand.Fatal(http.ListenAndServe(addr, mux))
+	}()
+}
+
+// recordHeads records the head of the chain and the highest stored header in the metrics
+func recordHeads(chainHead int64, headerRepository core.HeaderRepository) {
+	syncedHead, err := headerRepository.GetLastBlockNumber()
+	if err != nil {
+		logWithCommand.Error("recordHeads: Error getting last block number: ", err)
+		return
+	}
+	metrics.SetHeads(chainHead, syncedHead)
+}
+
+func pruneHeaders(f core.Fetcher, headerRepository core.HeaderRepository, policy history.RetentionPolicy) {
+	pruned, err := history.PruneHeaders(f, headerRepository, policy)
+	if err != nil {
+		logWithCommand.Error("pruneHeaders: Error pruning headers: ", err)
+		return
+	}
+	if pruned > 0 {
+		logWithCommand.Infof("pruned %d headers", pruned)
+	}
+}
+
+// getPartitioner partitions the headers table, if a partition size is configured, and creates the partitions needed for
+// the current head of the chain from the starting block number
+func getPartitioner(db *postgres.DB, f core.Fetcher) *repository.HeaderPartitioner {
+	partitionSize := viper.GetInt64("database.partitionSize")
+	if db == nil || partitionSize <= 0 {
+		return nil
+	}
+	partitioner, err := repository.NewHeaderPartitioner(db, partitionSize, startingBlockNumber)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	if err := partitioner.PartitionHeaders(); err != nil {
+		logWithCommand.Fatal("sync: unable to partition headers table: ", err)
+	}
+	lastBlock, err := f.LastBlock()
+	if err != nil {
+		logWithCommand.Fatal("sync: unable to get last block for partitioning: ", err)
+	}
+	if err := partitioner.EnsurePartitions(lastBlock.Int64()); err != nil {
+		logWithCommand.Fatal("sync: unable to create headers table partitions: ", err)
+	}
+	return partitioner
+}
+
+// ensurePartitions creates the headers table partitions needed for the current head of the chain
+func ensurePartitions(f core.Fetcher, partitioner *repository.HeaderPartitioner) {
+	if partitioner == nil {
+		return
+	}
+	lastBlock, err := f.LastBlock()
+	if err != nil {
+		logWithCommand.Error("ensurePartitions: Error getting last block: ", err)
+		return
+	}
+	if err := partitioner.EnsurePartitions(lastBlock.Int64()); err != nil {
+		logWithCommand.Error("ensurePartitions: Error creating partitions: ", err)
+	}
+}
+
+func validateArgs(f core.Fetcher) {
 	lastBlock, err := f.LastBlock()
 	if err != nil {
 		logWithCommand.Error("validateArgs: Error getting last block: ", err)
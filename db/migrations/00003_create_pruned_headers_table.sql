@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE public.pruned_headers
+(
+    eth_node_fingerprint VARCHAR(128) PRIMARY KEY,
+    block_number         BIGINT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE public.pruned_headers;
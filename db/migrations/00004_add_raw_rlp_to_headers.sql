@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE public.headers
+    ADD COLUMN raw_rlp BYTEA;
+
+-- +goose Down
+ALTER TABLE public.headers
+    DROP COLUMN raw_rlp;
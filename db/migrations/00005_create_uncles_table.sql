@@ -0,0 +1,24 @@
+-- +goose Up
+-- header_id is not a foreign key so that the headers table can be partitioned,
+-- uncles are deleted alongside their header by the header repository
+CREATE TABLE public.uncles
+(
+    id              SERIAL PRIMARY KEY,
+    header_id       INTEGER NOT NULL,
+    block_number    BIGINT NOT NULL,
+    hash            VARCHAR(66) NOT NULL,
+    uncle_index     INTEGER NOT NULL,
+    miner           VARCHAR(42) NOT NULL,
+    raw             JSONB,
+    raw_rlp         BYTEA,
+    block_timestamp NUMERIC,
+    UNIQUE (header_id, uncle_index)
+);
+
+CREATE INDEX uncles_miner
+    ON public.uncles (miner);
+
+-- +goose Down
+DROP INDEX public.uncles_miner;
+
+DROP TABLE public.uncles;
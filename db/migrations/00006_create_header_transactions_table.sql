@@ -0,0 +1,19 @@
+-- +goose Up
+-- header_id is not a foreign key so that the headers table can be partitioned,
+-- transaction hashes are deleted alongside their header by the header repository
+CREATE TABLE public.header_transactions
+(
+    id        SERIAL PRIMARY KEY,
+    header_id INTEGER NOT NULL,
+    tx_hash   VARCHAR(66) NOT NULL,
+    tx_index  INTEGER NOT NULL,
+    UNIQUE (header_id, tx_index)
+);
+
+CREATE INDEX header_transactions_tx_hash
+    ON public.header_transactions (tx_hash);
+
+-- +goose Down
+DROP INDEX public.header_transactions_tx_hash;
+
+DROP TABLE public.header_transactions;
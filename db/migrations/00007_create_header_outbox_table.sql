@@ -0,0 +1,13 @@
+-- +goose Up
+-- Header events waiting to be published to a message queue, rows are written in the same
+-- transaction as the header they describe and deleted once the broker has acknowledged them
+CREATE TABLE public.header_outbox
+(
+    id                   BIGSERIAL PRIMARY KEY,
+    eth_node_fingerprint VARCHAR(128) NOT NULL,
+    payload              JSONB NOT NULL,
+    created_at           TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE public.header_outbox;
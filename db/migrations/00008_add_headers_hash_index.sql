@@ -0,0 +1,6 @@
+-- +goose Up
+-- Headers are looked up by hash for a node, such as by the serve command's eth_getBlockByHash
+CREATE INDEX headers_hash_fingerprint ON public.headers (hash, eth_node_fingerprint);
+
+-- +goose Down
+DROP INDEX public.headers_hash_fingerprint;
@@ -52,6 +52,69 @@ CREATE SEQUENCE public.goose_db_version_id_seq
 ALTER SEQUENCE public.goose_db_version_id_seq OWNED BY public.goose_db_version.id;
 
 
+--
+-- Name: header_outbox; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.header_outbox (
+    id bigint NOT NULL,
+    eth_node_fingerprint character varying(128) NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: header_outbox_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE public.header_outbox_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: header_outbox_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE public.header_outbox_id_seq OWNED BY public.header_outbox.id;
+
+
+--
+-- Name: header_transactions; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.header_transactions (
+    id integer NOT NULL,
+    header_id integer NOT NULL,
+    tx_hash character varying(66) NOT NULL,
+    tx_index integer NOT NULL
+);
+
+
+--
+-- Name: header_transactions_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE public.header_transactions_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: header_transactions_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE public.header_transactions_id_seq OWNED BY public.header_transactions.id;
+
+
 --
 -- Name: headers; Type: TABLE; Schema: public; Owner: -
 --
@@ -64,7 +127,8 @@ CREATE TABLE public.headers (
     block_timestamp numeric,
     check_count integer DEFAULT 0 NOT NULL,
     node_id integer NOT NULL,
-    eth_node_fingerprint character varying(128)
+    eth_node_fingerprint character varying(128),
+    raw_rlp bytea
 );
 
 
@@ -122,6 +186,53 @@ CREATE SEQUENCE public.nodes_id_seq
 ALTER SEQUENCE public.nodes_id_seq OWNED BY public.nodes.id;
 
 
+--
+-- Name: pruned_headers; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.pruned_headers (
+    eth_node_fingerprint character varying(128) NOT NULL,
+    block_number bigint NOT NULL
+);
+
+
+--
+-- Name: uncles; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.uncles (
+    id integer NOT NULL,
+    header_id integer NOT NULL,
+    block_number bigint NOT NULL,
+    hash character varying(66) NOT NULL,
+    uncle_index integer NOT NULL,
+    miner character varying(42) NOT NULL,
+    raw jsonb,
+    raw_rlp bytea,
+    block_timestamp numeric
+);
+
+
+--
+-- Name: uncles_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE public.uncles_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: uncles_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE public.uncles_id_seq OWNED BY public.uncles.id;
+
+
 --
 -- Name: goose_db_version id; Type: DEFAULT; Schema: public; Owner: -
 --
@@ -129,6 +240,20 @@ ALTER SEQUENCE public.nodes_id_seq OWNED BY public.nodes.id;
 ALTER TABLE ONLY public.goose_db_version ALTER COLUMN id SET DEFAULT nextval('public.goose_db_version_id_seq'::regclass);
 
 
+--
+-- Name: header_outbox id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.header_outbox ALTER COLUMN id SET DEFAULT nextval('public.header_outbox_id_seq'::regclass);
+
+
+--
+-- Name: header_transactions id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.header_transactions ALTER COLUMN id SET DEFAULT nextval('public.header_transactions_id_seq'::regclass);
+
+
 --
 -- Name: headers id; Type: DEFAULT; Schema: public; Owner: -
 --
@@ -143,6 +268,13 @@ ALTER TABLE ONLY public.headers ALTER COLUMN id SET DEFAULT nextval('public.head
 ALTER TABLE ONLY public.nodes ALTER COLUMN id SET DEFAULT nextval('public.nodes_id_seq'::regclass);
 
 
+--
+-- Name: uncles id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.uncles ALTER COLUMN id SET DEFAULT nextval('public.uncles_id_seq'::regclass);
+
+
 --
 -- Name: goose_db_version goose_db_version_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -151,6 +283,30 @@ ALTER TABLE ONLY public.goose_db_version
     ADD CONSTRAINT goose_db_version_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: header_outbox header_outbox_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.header_outbox
+    ADD CONSTRAINT header_outbox_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: header_transactions header_transactions_header_id_tx_index_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.header_transactions
+    ADD CONSTRAINT header_transactions_header_id_tx_index_key UNIQUE (header_id, tx_index);
+
+
+--
+-- Name: header_transactions header_transactions_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.header_transactions
+    ADD CONSTRAINT header_transactions_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: headers headers_block_number_hash_eth_node_fingerprint_key; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -183,6 +339,37 @@ ALTER TABLE ONLY public.nodes
     ADD CONSTRAINT nodes_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: pruned_headers pruned_headers_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.pruned_headers
+    ADD CONSTRAINT pruned_headers_pkey PRIMARY KEY (eth_node_fingerprint);
+
+
+--
+-- Name: uncles uncles_header_id_uncle_index_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.uncles
+    ADD CONSTRAINT uncles_header_id_uncle_index_key UNIQUE (header_id, uncle_index);
+
+
+--
+-- Name: uncles uncles_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY public.uncles
+    ADD CONSTRAINT uncles_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: header_transactions_tx_hash; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX header_transactions_tx_hash ON public.header_transactions USING btree (tx_hash);
+
+
 --
 -- Name: headers_block_number; Type: INDEX; Schema: public; Owner: -
 --
@@ -197,6 +384,20 @@ CREATE INDEX headers_block_number ON public.headers USING btree (block_number);
 CREATE INDEX headers_block_timestamp ON public.headers USING btree (block_timestamp);
 
 
+--
+-- Name: headers_hash_fingerprint; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX headers_hash_fingerprint ON public.headers USING btree (hash, eth_node_fingerprint);
+
+
+--
+-- Name: uncles_miner; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX uncles_miner ON public.uncles USING btree (miner);
+
+
 --
 -- Name: headers headers_node_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
 --
@@ -0,0 +1,118 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package integration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/vulcanize/eth-header-sync/pkg/config"
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/node"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+	"github.com/vulcanize/eth-header-sync/pkg/sqlite"
+)
+
+var _ = Describe("Exporting synced headers", func() {
+	var (
+		chain  *simulated.Chain
+		dir    string
+		path   string
+		out    string
+		binary string
+	)
+
+	BeforeEach(func() {
+		var err error
+		chain = simulated.NewChain(10)
+		dir, err = ioutil.TempDir("", "export")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "headers.db")
+		out = filepath.Join(dir, "out")
+		db, err := sqlite.NewDB(path, testNode)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		repo := sqlite.NewHeaderRepositoryForFingerprint(db, testNode.ID)
+		for number := int64(0); number <= 5; number++ {
+			_, err = repo.CreateOrUpdateHeader(converter.HeaderConverter{}.Convert(chain.Header(number), chain.Header(number).Hash().Hex()))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		// A header which cannot be decoded, so that exporting it fails
+		_, err = repo.CreateOrUpdateHeader(core.Header{
+			BlockNumber: 6,
+			Hash:        chain.Header(6).Hash().Hex(),
+			Timestamp:   strconv.FormatUint(chain.Header(6).Time, 10),
+			Raw:         []byte(`{"number":"0x6"}`),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		binary, err = gexec.Build("github.com/vulcanize/eth-header-sync")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		gexec.CleanupBuildArtifacts()
+		os.RemoveAll(dir)
+	})
+
+	exportTimeRange := func(from, to int64) *gexec.Session {
+		command := exec.Command(binary, "export",
+			"--database-driver", config.SQLiteDriver,
+			"--database-name", path,
+			"--from-time", strconv.FormatInt(from, 10),
+			"--to-time", strconv.FormatInt(to, 10),
+			"--out", out,
+		)
+		command.Env = append(os.Environ(),
+			node.ETH_NODE_ID+"="+testNode.ID,
+			node.ETH_CLIENT_NAME+"="+testNode.ClientName,
+			node.ETH_GENESIS_BLOCK+"="+testNode.GenesisBlock,
+			node.ETH_NETWORK_ID+"="+testNode.NetworkID,
+		)
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		return session.Wait(30 * time.Second)
+	}
+
+	It("exports the headers of a time range", func() {
+		session := exportTimeRange(int64(chain.Header(1).Time), int64(chain.Header(5).Time))
+
+		Expect(session).To(gexec.Exit(0))
+		files, err := ioutil.ReadDir(out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+		Expect(files[0].Name()).To(Equal("headers_1_5.ndjson"))
+	})
+
+	It("fails when the headers of a time range cannot be exported", func() {
+		session := exportTimeRange(int64(chain.Header(1).Time), int64(chain.Header(6).Time))
+
+		Expect(session.ExitCode()).NotTo(Equal(0))
+		files, err := ioutil.ReadDir(out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+})
@@ -25,20 +25,34 @@ import (
 	"github.com/vulcanize/eth-header-sync/pkg/client"
 	"github.com/vulcanize/eth-header-sync/pkg/core"
 	"github.com/vulcanize/eth-header-sync/pkg/fetcher"
-	"github.com/vulcanize/eth-header-sync/pkg/node"
-	"github.com/vulcanize/eth-header-sync/test_config"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
 )
 
 var _ = Describe("Reading from the Geth blockchain", func() {
-	var fetch *fetcher.Fetcher
+	var (
+		chain        *simulated.Chain
+		server       *simulated.Server
+		rawRPCClient *rpc.Client
+		ethNode      core.Node
+		fetch        *fetcher.Fetcher
+	)
 
 	BeforeEach(func() {
-		rawRPCClient, err := rpc.Dial(test_config.TestClient.RPCPath)
+		var err error
+		chain = simulated.NewChain(10)
+		server, err = simulated.NewServer(chain, "127.0.0.1:0")
 		Expect(err).NotTo(HaveOccurred())
-		rpcClient := client.NewRPCClient(rawRPCClient, test_config.TestClient.RPCPath)
+		rawRPCClient, err = rpc.Dial(server.URL())
+		Expect(err).NotTo(HaveOccurred())
+		rpcClient := client.NewRPCClient(rawRPCClient, server.URL())
 		ethClient := ethclient.NewClient(rawRPCClient)
-		n := node.MakeNode()
-		fetch = fetcher.NewFetcher(ethClient, rpcClient, n)
+		ethNode = testNode
+		fetch = fetcher.NewFetcher(ethClient, rpcClient, ethNode)
+	})
+
+	AfterEach(func() {
+		rawRPCClient.Close()
+		Expect(server.Close()).To(Succeed())
 	})
 
 	It("retrieves the genesis header and first header", func(done Done) {
@@ -50,18 +64,18 @@ var _ = Describe("Reading from the Geth blockchain", func() {
 
 		Expect(err).NotTo(HaveOccurred())
 		Expect(genesisBlock.BlockNumber).To(Equal(int64(0)))
+		Expect(genesisBlock.Hash).To(Equal(chain.Header(0).Hash().Hex()))
 		Expect(firstBlock.BlockNumber).To(Equal(int64(1)))
-		Expect(lastBlockNumber.Int64()).To(BeNumerically(">", 0))
+		Expect(firstBlock.Hash).To(Equal(chain.Header(1).Hash().Hex()))
+		Expect(lastBlockNumber.Int64()).To(Equal(chain.Head()))
 		close(done)
 	}, 15)
 
 	It("retrieves the node info", func(done Done) {
 		node := fetch.Node()
 
-		Expect(node.GenesisBlock).ToNot(BeNil())
-		Expect(node.NetworkID).To(Equal("1.000000"))
-		Expect(len(node.ID)).ToNot(BeZero())
-		Expect(node.ClientName).ToNot(BeZero())
+		Expect(node).To(Equal(ethNode))
+		Expect(node.NetworkID).To(Equal(simulated.NetworkID))
 
 		close(done)
 	}, 15)
@@ -71,8 +85,8 @@ var _ = Describe("Reading from the Geth blockchain", func() {
 		b.Time("runtime", func() {
 			var headers []core.Header
 			n := 10
-			for i := 5327459; i > 5327459-n; i-- {
-				header, err := fetch.GetHeaderByNumber(int64(i))
+			for i := chain.Head(); i > chain.Head()-int64(n); i-- {
+				header, err := fetch.GetHeaderByNumber(i)
 				Expect(err).ToNot(HaveOccurred())
 				headers = append(headers, header)
 			}
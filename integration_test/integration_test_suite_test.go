@@ -24,8 +24,18 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
 )
 
+// testNode is the node the simulated chain is synced as
+var testNode = core.Node{
+	GenesisBlock: "GENESIS",
+	NetworkID:    "1",
+	ID:           "b6f90c0fdd8ec9607aed8ee45c69322e47b7063f0bfb7a29c8ecafab24d0a22d24dd2329b5ee6ed4125a03cb14e57fd584e67f9e53e6c631055cbbd82f080845",
+	ClientName:   "Geth/v1.7.2-stable-1db4ecdc/darwin-amd64/go1.9",
+}
+
 func TestIntegrationTest(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "IntegrationTest Suite")
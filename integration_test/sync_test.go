@@ -0,0 +1,140 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package integration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/vulcanize/eth-header-sync/pkg/config"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/node"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+	"github.com/vulcanize/eth-header-sync/pkg/sqlite"
+)
+
+// The sync writes to a SQLite database, so that the suite runs without the Postgres test database
+var _ = Describe("Syncing from a simulated node", func() {
+	var (
+		chain   *simulated.Chain
+		server  *simulated.Server
+		dir     string
+		db      *sqlite.DB
+		repo    sqlite.HeaderRepository
+		session *gexec.Session
+		ethNode core.Node
+	)
+
+	BeforeEach(func() {
+		var err error
+		chain = simulated.NewChain(30)
+		server, err = simulated.NewServer(chain, "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		ethNode = testNode
+		dir, err = ioutil.TempDir("", "sync")
+		Expect(err).NotTo(HaveOccurred())
+		path := filepath.Join(dir, "headers.db")
+
+		binary, err := gexec.Build("github.com/vulcanize/eth-header-sync")
+		Expect(err).NotTo(HaveOccurred())
+		command := exec.Command(binary, "sync",
+			"--client-rpcPath", server.URL(),
+			"--database-driver", config.SQLiteDriver,
+			"--database-name", path,
+			"--sync-uncles",
+			"--sync-transactions",
+		)
+		command.Env = append(os.Environ(),
+			node.ETH_NODE_ID+"="+ethNode.ID,
+			node.ETH_CLIENT_NAME+"="+ethNode.ClientName,
+			node.ETH_GENESIS_BLOCK+"="+ethNode.GenesisBlock,
+			node.ETH_NETWORK_ID+"="+ethNode.NetworkID,
+		)
+		session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		// The database is created by the sync
+		Eventually(func() error {
+			db, err = sqlite.NewReadOnlyDB(path)
+			return err
+		}, 30*time.Second, 100*time.Millisecond).Should(Succeed())
+		repo = sqlite.NewHeaderRepositoryForFingerprint(db, ethNode.ID)
+	})
+
+	AfterEach(func() {
+		session.Kill().Wait()
+		gexec.CleanupBuildArtifacts()
+		Expect(server.Close()).To(Succeed())
+		if db != nil {
+			db.Close()
+		}
+		os.RemoveAll(dir)
+	})
+
+	storedHash := func(blockNumber int64) func() string {
+		return func() string {
+			header, _ := repo.GetHeader(blockNumber)
+			return header.Hash
+		}
+	}
+
+	It("backfills the chain and replaces the headers of a reorg", func() {
+		Eventually(func() int {
+			headers, _ := repo.GetHeadersInRange(0, 30)
+			return len(headers)
+		}, 30*time.Second, 100*time.Millisecond).Should(Equal(31))
+		for blockNumber := int64(0); blockNumber <= 30; blockNumber++ {
+			Expect(storedHash(blockNumber)()).To(Equal(chain.Header(blockNumber).Hash().Hex()))
+		}
+
+		Expect(chain.Reorg(3, 4)).To(Succeed())
+
+		for blockNumber := int64(28); blockNumber <= 31; blockNumber++ {
+			Eventually(storedHash(blockNumber), 30*time.Second, 100*time.Millisecond).Should(Equal(chain.Header(blockNumber).Hash().Hex()))
+		}
+		Expect(storedHash(27)()).To(Equal(chain.Header(27).Hash().Hex()))
+		Expect(session).NotTo(gexec.Exit())
+	})
+
+	It("stores the uncles and transaction hashes of the synced blocks", func() {
+		Eventually(storedHash(30), 30*time.Second, 100*time.Millisecond).Should(Equal(chain.Header(30).Hash().Hex()))
+
+		for blockNumber := int64(1); blockNumber <= 30; blockNumber++ {
+			uncles, err := repo.GetUncles(blockNumber)
+			Expect(err).NotTo(HaveOccurred())
+			expectedUncles := chain.Uncles(blockNumber)
+			Expect(uncles).To(HaveLen(len(expectedUncles)), "uncles of block %d", blockNumber)
+			for i, uncle := range uncles {
+				Expect(uncle.Hash).To(Equal(expectedUncles[i].Hash().Hex()))
+				Expect(uncle.BlockNumber).To(Equal(blockNumber - 1))
+			}
+			hashes, err := repo.GetTransactionHashes(blockNumber)
+			Expect(err).NotTo(HaveOccurred())
+			expectedHashes := make([]string, 0)
+			for _, tx := range chain.Transactions(blockNumber) {
+				expectedHashes = append(expectedHashes, tx.Hash().Hex())
+			}
+			Expect(hashes).To(Equal(expectedHashes), "transactions of block %d", blockNumber)
+		}
+	})
+})
@@ -0,0 +1,128 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// APIName is the namespace the header API is served under
+const APIName = "eth"
+
+// PublicHeaderAPI answers the header related eth_ JSON-RPC methods from the header repository
+// Blocks are returned with their header fields only
+type PublicHeaderAPI struct {
+	headerRepository core.HeaderRepository
+}
+
+// NewPublicHeaderAPI returns a new PublicHeaderAPI
+func NewPublicHeaderAPI(headerRepository core.HeaderRepository) *PublicHeaderAPI {
+	return &PublicHeaderAPI{headerRepository: headerRepository}
+}
+
+// BlockNumber returns the number of the highest stored header
+func (api *PublicHeaderAPI) BlockNumber() (hexutil.Uint64, error) {
+	blockNumber, err := api.headerRepository.GetLastBlockNumber()
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return hexutil.Uint64(blockNumber), err
+}
+
+// GetBlockByNumber returns the header fields of the block at the provided height, fullTx is ignored
+func (api *PublicHeaderAPI) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	return api.GetHeaderByNumber(ctx, number)
+}
+
+// GetBlockByHash returns the header fields of the block with the provided hash, fullTx is ignored
+func (api *PublicHeaderAPI) GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	header, err := api.headerRepository.GetHeaderByHash(hash.Hex())
+	return marshalStoredHeader(header, err)
+}
+
+// GetHeaderByNumber returns the header at the provided height, the latest and pending tags resolve to the highest stored header
+func (api *PublicHeaderAPI) GetHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (map[string]interface{}, error) {
+	blockNumber := number.Int64()
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		var err error
+		blockNumber, err = api.headerRepository.GetLastBlockNumber()
+		if err != nil {
+			return marshalStoredHeader(core.Header{}, err)
+		}
+	}
+	header, err := api.headerRepository.GetHeader(blockNumber)
+	return marshalStoredHeader(header, err)
+}
+
+// marshalStoredHeader returns the RPC representation of a header read from the repository
+// A header which is not stored is returned as nil, matching the behaviour of an ethereum node
+func marshalStoredHeader(header core.Header, err error) (map[string]interface{}, error) {
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return MarshalHeader(header)
+}
+
+// MarshalHeader returns the RPC representation of a stored header, including the fields added after go-ethereum's
+// header type, such as the base fee, which the header has
+// The stored hash is used, rather than the hash of the decoded header, so that non-standard headers keep their hash
+// The block size is left out since it covers the block body, which is not stored
+func MarshalHeader(header core.Header) (map[string]interface{}, error) {
+	gethHeader, err := converter.DecodeHeader(header)
+	if err != nil {
+		log.Errorf("MarshalHeader: error decoding header %d: %s", header.BlockNumber, err.Error())
+		return nil, err
+	}
+	fields, err := converter.HeaderExtensions(header)
+	if err != nil {
+		log.Errorf("MarshalHeader: error decoding the fields of header %d: %s", header.BlockNumber, err.Error())
+		return nil, err
+	}
+	for name, value := range map[string]interface{}{
+		"number":           (*hexutil.Big)(gethHeader.Number),
+		"hash":             common.HexToHash(header.Hash),
+		"parentHash":       gethHeader.ParentHash,
+		"nonce":            gethHeader.Nonce,
+		"mixHash":          gethHeader.MixDigest,
+		"sha3Uncles":       gethHeader.UncleHash,
+		"logsBloom":        gethHeader.Bloom,
+		"stateRoot":        gethHeader.Root,
+		"miner":            gethHeader.Coinbase,
+		"difficulty":       (*hexutil.Big)(gethHeader.Difficulty),
+		"extraData":        hexutil.Bytes(gethHeader.Extra),
+		"gasLimit":         hexutil.Uint64(gethHeader.GasLimit),
+		"gasUsed":          hexutil.Uint64(gethHeader.GasUsed),
+		"timestamp":        hexutil.Uint64(gethHeader.Time),
+		"transactionsRoot": gethHeader.TxHash,
+		"receiptsRoot":     gethHeader.ReceiptHash,
+	} {
+		fields[name] = value
+	}
+	return fields, nil
+}
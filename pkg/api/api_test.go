@@ -0,0 +1,187 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/api"
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+)
+
+func storedHeader(gethHeader *types.Header) core.Header {
+	raw, err := json.Marshal(gethHeader)
+	Expect(err).NotTo(HaveOccurred())
+	return core.Header{
+		BlockNumber: gethHeader.Number.Int64(),
+		Hash:        gethHeader.Hash().Hex(),
+		Raw:         raw,
+	}
+}
+
+var _ = Describe("Header API", func() {
+	var (
+		headerOne  = &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(10), Time: 1000, Extra: []byte{}}
+		headerTwo  = &types.Header{Number: big.NewInt(2), Difficulty: big.NewInt(10), Time: 1015, ParentHash: headerOne.Hash(), Extra: []byte{}}
+		repository *fakes.MockHeaderRepository
+		server     *rpc.Server
+		client     *rpc.Client
+	)
+
+	BeforeEach(func() {
+		repository = fakes.NewMockHeaderRepository()
+		repository.SetStoredHeaders(storedHeader(headerOne), storedHeader(headerTwo))
+		var err error
+		server, err = api.NewServer(repository)
+		Expect(err).NotTo(HaveOccurred())
+		client = rpc.DialInProc(server)
+	})
+
+	AfterEach(func() {
+		client.Close()
+		server.Stop()
+	})
+
+	It("returns the highest stored block number", func() {
+		var blockNumber hexutil.Uint64
+		err := client.Call(&blockNumber, "eth_blockNumber")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blockNumber).To(Equal(hexutil.Uint64(2)))
+	})
+
+	It("returns zero when no headers are stored", func() {
+		repository.SetStoredHeaders()
+		var blockNumber hexutil.Uint64
+		err := client.Call(&blockNumber, "eth_blockNumber")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blockNumber).To(BeZero())
+	})
+
+	It("returns blocks by number with header fields", func() {
+		var block map[string]interface{}
+		err := client.Call(&block, "eth_getBlockByNumber", "0x1", false)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block["hash"]).To(Equal(headerOne.Hash().Hex()))
+		Expect(block["number"]).To(Equal("0x1"))
+		Expect(block["timestamp"]).To(Equal("0x3e8"))
+		Expect(block).NotTo(HaveKey("transactions"))
+	})
+
+	It("returns the fields added after go-ethereum's header type without the block size", func() {
+		holesky, err := converter.HeaderConverter{}.ConvertJSON(fakes.HoleskyGenesisJSON)
+		Expect(err).NotTo(HaveOccurred())
+		repository.SetStoredHeaders(holesky)
+		var block map[string]interface{}
+
+		err = client.Call(&block, "eth_getBlockByNumber", "0x0", false)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block["hash"]).To(Equal(fakes.HoleskyGenesisHash.Hex()))
+		Expect(block["baseFeePerGas"]).To(Equal("0x3b9aca00"))
+		Expect(block["nonce"]).To(Equal("0x0000000000001234"))
+		Expect(block).NotTo(HaveKey("size"))
+		Expect(block).NotTo(HaveKey("withdrawalsRoot"))
+	})
+
+	It("resolves the latest block tag", func() {
+		var header types.Header
+		err := client.Call(&header, "eth_getHeaderByNumber", "latest")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash()).To(Equal(headerTwo.Hash()))
+		Expect(header.ParentHash).To(Equal(headerOne.Hash()))
+	})
+
+	It("returns blocks by hash", func() {
+		var header types.Header
+		err := client.Call(&header, "eth_getBlockByHash", headerTwo.Hash(), false)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Number.Int64()).To(Equal(int64(2)))
+	})
+
+	It("returns null for headers which are not stored", func() {
+		var block map[string]interface{}
+		err := client.Call(&block, "eth_getBlockByNumber", "0x3", false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block).To(BeNil())
+
+		err = client.Call(&block, "eth_getBlockByHash", common.Hash{}, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block).To(BeNil())
+	})
+
+	It("propagates repository errors", func() {
+		repository.SetGetHeaderError(fakes.FakeError)
+		var block map[string]interface{}
+
+		err := client.Call(&block, "eth_getBlockByNumber", "0x1", false)
+
+		Expect(err).To(MatchError(fakes.FakeError.Error()))
+	})
+
+	Describe("over HTTP and websockets", func() {
+		var httpServer *httptest.Server
+
+		BeforeEach(func() {
+			httpServer = httptest.NewServer(api.NewHandler(server, []string{"*"}))
+		})
+
+		AfterEach(func() {
+			httpServer.Close()
+		})
+
+		It("serves ethclient requests over HTTP", func() {
+			ethClient, err := ethclient.Dial(httpServer.URL)
+			Expect(err).NotTo(HaveOccurred())
+			defer ethClient.Close()
+
+			header, err := ethClient.HeaderByNumber(context.Background(), big.NewInt(1))
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Hash()).To(Equal(headerOne.Hash()))
+		})
+
+		It("serves ethclient requests over websockets", func() {
+			ethClient, err := ethclient.Dial("ws" + strings.TrimPrefix(httpServer.URL, "http"))
+			Expect(err).NotTo(HaveOccurred())
+			defer ethClient.Close()
+
+			header, err := ethClient.HeaderByHash(context.Background(), headerTwo.Hash())
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Number.Int64()).To(Equal(int64(2)))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// NewServer returns a JSON-RPC server serving the header API from the header repository
+func NewServer(headerRepository core.HeaderRepository) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName(APIName, NewPublicHeaderAPI(headerRepository)); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// NewHandler returns an http.Handler serving the JSON-RPC server over HTTP and, for upgrade requests, websockets
+// allowedOrigins are the websocket origins accepted, "*" accepts any
+func NewHandler(server *rpc.Server, allowedOrigins []string) http.Handler {
+	wsHandler := server.WebsocketHandler(allowedOrigins)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			wsHandler.ServeHTTP(w, r)
+			return
+		}
+		server.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,185 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package chaindata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+// indexEntrySize is the size of an entry of a freezer table's index, a 2 byte data file number and a 4 byte offset
+const indexEntrySize = 6
+
+var errOutOfBounds = errors.New("item out of bounds of the ancient table")
+
+// ancientTable reads a table of geth's ancient freezer without modifying it
+// The index holds an entry per item pointing at the end of its data, after a first entry holding the number of the
+// earliest data file and the number of items removed from the tail
+type ancientTable struct {
+	dir        string
+	name       string
+	compressed bool
+	index      *os.File
+	items      uint64
+	itemOffset uint64
+
+	mutex sync.Mutex
+	files map[uint32]*os.File
+}
+
+// openAncientTable opens the table in the freezer directory, its data is snappy compressed if compressed is set
+// It returns an error satisfying os.IsNotExist if the freezer has no such table
+func openAncientTable(dir, name string, compressed bool) (*ancientTable, error) {
+	extension := "ridx"
+	if compressed {
+		extension = "cidx"
+	}
+	index, err := os.Open(filepath.Join(dir, fmt.Sprintf("%s.%s", name, extension)))
+	if err != nil {
+		return nil, err
+	}
+	stat, err := index.Stat()
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	table := &ancientTable{
+		dir:        dir,
+		name:       name,
+		compressed: compressed,
+		index:      index,
+		files:      make(map[uint32]*os.File),
+	}
+	entries := uint64(stat.Size() / indexEntrySize)
+	if entries == 0 {
+		return table, nil
+	}
+	first, err := table.readEntry(0)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	table.itemOffset = uint64(first.offset)
+	table.items = table.itemOffset + entries - 1
+	return table, nil
+}
+
+type indexEntry struct {
+	filenum uint32
+	offset  uint32
+}
+
+func (table *ancientTable) readEntry(position uint64) (indexEntry, error) {
+	buffer := make([]byte, indexEntrySize)
+	if _, err := table.index.ReadAt(buffer, int64(position*indexEntrySize)); err != nil {
+		return indexEntry{}, err
+	}
+	return indexEntry{
+		filenum: uint32(binary.BigEndian.Uint16(buffer[:2])),
+		offset:  binary.BigEndian.Uint32(buffer[2:]),
+	}, nil
+}
+
+// has returns whether the table holds the item
+func (table *ancientTable) has(item uint64) bool {
+	return item >= table.itemOffset && item < table.items
+}
+
+// retrieve returns the data of the item
+func (table *ancientTable) retrieve(item uint64) ([]byte, error) {
+	if !table.has(item) {
+		return nil, errOutOfBounds
+	}
+	position := item - table.itemOffset
+	start, err := table.readEntry(position)
+	if err != nil {
+		return nil, err
+	}
+	end, err := table.readEntry(position + 1)
+	if err != nil {
+		return nil, err
+	}
+	// The first entry holds the number of items removed from the tail rather than an offset, the first item starts at
+	// the beginning of its data file, as does an item which does not fit in the rest of the previous data file
+	if position == 0 || start.filenum != end.filenum {
+		start.offset = 0
+	}
+	file, err := table.dataFile(end.filenum)
+	if err != nil {
+		return nil, err
+	}
+	blob := make([]byte, end.offset-start.offset)
+	if _, err := file.ReadAt(blob, int64(start.offset)); err != nil {
+		return nil, err
+	}
+	if !table.compressed {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// dataFile returns the data file with the number, opening it on first use
+func (table *ancientTable) dataFile(filenum uint32) (*os.File, error) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	if file, ok := table.files[filenum]; ok {
+		return file, nil
+	}
+	extension := "rdat"
+	if table.compressed {
+		extension = "cdat"
+	}
+	file, err := os.Open(filepath.Join(table.dir, fmt.Sprintf("%s.%04d.%s", table.name, filenum, extension)))
+	if err != nil {
+		return nil, err
+	}
+	table.files[filenum] = file
+	return file, nil
+}
+
+// size returns the size of the table's index and data files
+func (table *ancientTable) size() (uint64, error) {
+	pattern := filepath.Join(table.dir, table.name+".*")
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		size += uint64(stat.Size())
+	}
+	return size, nil
+}
+
+func (table *ancientTable) close() error {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	for _, file := range table.files {
+		file.Close()
+	}
+	return table.index.Close()
+}
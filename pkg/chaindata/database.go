@@ -0,0 +1,209 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package chaindata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+var ErrUnknownTable = errors.New("unknown ancient table")
+
+// ancientTables are the freezer tables read, with whether their data is snappy compressed
+var ancientTables = map[string]bool{
+	"headers": true,
+	"hashes":  false,
+	"bodies":  true,
+}
+
+// DB reads the chaindata of a stopped geth node, its LevelDB or Pebble key-value store and its ancient freezer, without
+// modifying either of them
+// It satisfies go-ethereum's ethdb.Reader, so that the rawdb accessors can read through it
+type DB struct {
+	kv       keyValueStore
+	ancients map[string]*ancientTable
+	frozen   uint64
+}
+
+// keyValueStore is the read-only key-value store of the chaindata
+type keyValueStore interface {
+	Has(key []byte) (bool, error)
+	Get(key []byte) ([]byte, error)
+	Close() error
+}
+
+// NewDB opens the chaindata directory read-only, with the freezer in the ancient directory
+// The key-value store is read with Pebble if the directory holds Pebble's options file, and with LevelDB otherwise
+// An empty ancient path defaults to the ancient directory within the chaindata directory, and a missing freezer is
+// treated as one holding no blocks
+func NewDB(path, ancientPath string) (*DB, error) {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
+		return nil, fmt.Errorf("%s is not a chaindata directory: %s", path, err.Error())
+	}
+	kv, err := openKeyValueStore(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open chaindata, is the node still running? %s", err.Error())
+	}
+	db := &DB{kv: kv, ancients: make(map[string]*ancientTable)}
+
+	if ancientPath == "" {
+		ancientPath = filepath.Join(path, "ancient")
+	}
+	// Newer geth versions keep the chain's tables in a subdirectory of the freezer
+	if _, err := os.Stat(filepath.Join(ancientPath, "chain")); err == nil {
+		ancientPath = filepath.Join(ancientPath, "chain")
+	}
+	for name, compressed := range ancientTables {
+		table, err := openAncientTable(ancientPath, name, compressed)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.ancients[name] = table
+	}
+	// The headers and hashes are frozen together, the frozen blocks are the ones both tables hold
+	if headers, hashes := db.ancients["headers"], db.ancients["hashes"]; headers != nil && hashes != nil {
+		db.frozen = headers.items
+		if hashes.items < db.frozen {
+			db.frozen = hashes.items
+		}
+	}
+	return db, nil
+}
+
+// openKeyValueStore opens the LevelDB or Pebble key-value store in the directory read-only
+func openKeyValueStore(path string) (keyValueStore, error) {
+	if pebbleOptions, _ := filepath.Glob(filepath.Join(path, "OPTIONS-*")); len(pebbleOptions) > 0 {
+		kv, err := pebble.Open(path, &pebble.Options{ReadOnly: true, ErrorIfNotExists: true})
+		if err != nil {
+			return nil, err
+		}
+		return pebbleStore{kv}, nil
+	}
+	kv, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, err
+	}
+	return levelDBStore{kv}, nil
+}
+
+// Has returns whether the key-value store holds the key
+func (db *DB) Has(key []byte) (bool, error) {
+	return db.kv.Has(key)
+}
+
+// Get returns the value of the key from the key-value store
+func (db *DB) Get(key []byte) ([]byte, error) {
+	return db.kv.Get(key)
+}
+
+// HasAncient returns whether the ancient table holds the block number
+func (db *DB) HasAncient(kind string, number uint64) (bool, error) {
+	table, ok := db.ancients[kind]
+	if !ok {
+		return false, ErrUnknownTable
+	}
+	return number < db.frozen && table.has(number), nil
+}
+
+// Ancient returns the data of the block number from the ancient table
+func (db *DB) Ancient(kind string, number uint64) ([]byte, error) {
+	table, ok := db.ancients[kind]
+	if !ok {
+		return nil, ErrUnknownTable
+	}
+	if number >= db.frozen {
+		return nil, errOutOfBounds
+	}
+	return table.retrieve(number)
+}
+
+// Ancients returns the number of frozen blocks
+func (db *DB) Ancients() (uint64, error) {
+	return db.frozen, nil
+}
+
+// AncientSize returns the size of the ancient table's files
+func (db *DB) AncientSize(kind string) (uint64, error) {
+	table, ok := db.ancients[kind]
+	if !ok {
+		return 0, ErrUnknownTable
+	}
+	return table.size()
+}
+
+// Close closes the key-value store and the ancient tables
+func (db *DB) Close() error {
+	for _, table := range db.ancients {
+		table.close()
+	}
+	return db.kv.Close()
+}
+
+type levelDBStore struct {
+	db *leveldb.DB
+}
+
+func (store levelDBStore) Has(key []byte) (bool, error) {
+	return store.db.Has(key, nil)
+}
+
+func (store levelDBStore) Get(key []byte) ([]byte, error) {
+	return store.db.Get(key, nil)
+}
+
+func (store levelDBStore) Close() error {
+	return store.db.Close()
+}
+
+type pebbleStore struct {
+	db *pebble.DB
+}
+
+func (store pebbleStore) Has(key []byte) (bool, error) {
+	_, closer, err := store.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, closer.Close()
+}
+
+// Get returns a copy of the value, Pebble's is only valid until its closer is called
+func (store pebbleStore) Get(key []byte) ([]byte, error) {
+	value, closer, err := store.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return append([]byte{}, value...), nil
+}
+
+func (store pebbleStore) Close() error {
+	return store.db.Close()
+}
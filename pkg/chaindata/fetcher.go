@@ -0,0 +1,182 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package chaindata
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+var (
+	ErrNoHead          = errors.New("chaindata has no head header")
+	ErrNoGenesis       = errors.New("chaindata has no genesis block")
+	ErrHeaderNotFound  = errors.New("chaindata has no canonical header for the block")
+	ErrGenesisMismatch = errors.New("chaindata genesis block does not match the node's")
+)
+
+// MaxBatchSize is the most headers returned by a call to GetHeadersByNumbers, the rest are left for later calls
+const MaxBatchSize = 1000
+
+// Fetcher satisfies the core.Fetcher interface by reading the canonical headers from a geth node's chaindata
+// The chain does not grow while the node is stopped, so the head of the chain is the head header of the chaindata
+type Fetcher struct {
+	db              *DB
+	headerConverter converter.HeaderConverter
+	node            core.Node
+	fetchUncles     bool
+	fetchTxHashes   bool
+}
+
+// NewFetcher returns a Fetcher reading the chaindata for the node
+// The chaindata's genesis block must be the node's, a node without a genesis block takes the chaindata's
+func NewFetcher(db *DB, node core.Node) (*Fetcher, error) {
+	genesis := rawdb.ReadCanonicalHash(db, 0)
+	if genesis == (common.Hash{}) {
+		return nil, ErrNoGenesis
+	}
+	if node.GenesisBlock == "" {
+		node.GenesisBlock = genesis.Hex()
+	} else if common.HexToHash(node.GenesisBlock) != genesis {
+		logrus.Errorf("NewFetcher: chaindata genesis block %s, node genesis block %s", genesis.Hex(), node.GenesisBlock)
+		return nil, ErrGenesisMismatch
+	}
+	return &Fetcher{
+		db:              db,
+		headerConverter: converter.HeaderConverter{},
+		node:            node,
+	}, nil
+}
+
+// GetHeaderByNumber reads the canonical header of the block number
+func (fetcher *Fetcher) GetHeaderByNumber(blockNumber int64) (core.Header, error) {
+	logrus.Debugf("GetHeaderByNumber called with block %d", blockNumber)
+	header, found, err := fetcher.readHeader(blockNumber)
+	if err == nil && !found {
+		err = ErrHeaderNotFound
+	}
+	return header, err
+}
+
+// GetHeadersByNumbers reads the canonical headers of the block numbers, leaving out those the chaindata does not have
+// Only the first MaxBatchSize block numbers are read
+func (fetcher *Fetcher) GetHeadersByNumbers(blockNumbers []int64) ([]core.Header, error) {
+	logrus.Debug("GetHeadersByNumbers called")
+	if len(blockNumbers) > MaxBatchSize {
+		blockNumbers = blockNumbers[:MaxBatchSize]
+	}
+	var headers []core.Header
+	for _, blockNumber := range blockNumbers {
+		header, found, err := fetcher.readHeader(blockNumber)
+		if err != nil {
+			return headers, err
+		}
+		if found {
+			headers = append(headers, header)
+		}
+	}
+	return headers, nil
+}
+
+// LastBlock returns the block number of the chaindata's head header
+func (fetcher *Fetcher) LastBlock() (*big.Int, error) {
+	number := rawdb.ReadHeaderNumber(fetcher.db, rawdb.ReadHeadHeaderHash(fetcher.db))
+	if number == nil {
+		return big.NewInt(0), ErrNoHead
+	}
+	return new(big.Int).SetUint64(*number), nil
+}
+
+// SetRawEncoding sets which raw encodings are produced for the headers
+func (fetcher *Fetcher) SetRawEncoding(encoding converter.RawEncoding) {
+	fetcher.headerConverter.Encoding = encoding
+}
+
+// SetFetchUncles sets whether the uncles included by each header are read from its block body alongside it
+func (fetcher *Fetcher) SetFetchUncles(fetchUncles bool) {
+	fetcher.fetchUncles = fetchUncles
+}
+
+// SetFetchTransactionHashes sets whether the transaction hashes of each block are read from its body alongside its header
+func (fetcher *Fetcher) SetFetchTransactionHashes(fetchTxHashes bool) {
+	fetcher.fetchTxHashes = fetchTxHashes
+}
+
+// Node returns the node info associated with this Fetcher
+func (fetcher *Fetcher) Node() core.Node {
+	return fetcher.node
+}
+
+// readHeader reads the canonical header of the block number and, if configured, its uncles and transaction hashes
+// found is false if the chaindata has no canonical header for the block number
+func (fetcher *Fetcher) readHeader(blockNumber int64) (header core.Header, found bool, err error) {
+	if blockNumber < 0 {
+		return header, false, nil
+	}
+	number := uint64(blockNumber)
+	hash := rawdb.ReadCanonicalHash(fetcher.db, number)
+	if hash == (common.Hash{}) {
+		return header, false, nil
+	}
+	data := rawdb.ReadHeaderRLP(fetcher.db, hash, number)
+	if len(data) == 0 {
+		return header, false, nil
+	}
+	// The header is converted from its encoding as is, go-ethereum's header type lacks the fields added since London
+	header, err = fetcher.headerConverter.ConvertRLP(data)
+	if err != nil {
+		return header, false, fmt.Errorf("block %d: invalid header: %s", blockNumber, err.Error())
+	}
+	if header.Hash != hash.Hex() {
+		return header, false, fmt.Errorf("block %d: header hashes to %s rather than the canonical hash %s", blockNumber, header.Hash, hash.Hex())
+	}
+	if !fetcher.fetchUncles && !fetcher.fetchTxHashes {
+		return header, true, nil
+	}
+
+	body := rawdb.ReadBodyRLP(fetcher.db, hash, number)
+	if len(body) == 0 {
+		return header, false, fmt.Errorf("block %d: chaindata has no body for block %s", blockNumber, hash.Hex())
+	}
+	uncles, transactionHashes, err := converter.DecodeBodyRLP(body)
+	if err != nil {
+		return header, false, fmt.Errorf("block %d: invalid body: %s", blockNumber, err.Error())
+	}
+	if fetcher.fetchUncles {
+		for index, rawUncle := range uncles {
+			uncle, err := fetcher.headerConverter.ConvertUncleRLP(rawUncle, index)
+			if err != nil {
+				return header, false, fmt.Errorf("block %d: invalid uncle %d: %s", blockNumber, index, err.Error())
+			}
+			header.Uncles = append(header.Uncles, uncle)
+		}
+	}
+	if fetcher.fetchTxHashes {
+		header.TransactionHashes = make([]string, len(transactionHashes))
+		for i, transactionHash := range transactionHashes {
+			header.TransactionHashes[i] = transactionHash.Hex()
+		}
+	}
+	return header, true, nil
+}
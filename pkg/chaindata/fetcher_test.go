@@ -0,0 +1,420 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package chaindata_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/syndtr/goleveldb/leveldb"
+
+	"github.com/vulcanize/eth-header-sync/pkg/chaindata"
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/history"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+const (
+	head   = 20
+	frozen = 12
+)
+
+// makeBlocks returns the blocks of a simulated chain, every third one with a transaction and an uncle
+func makeBlocks() []*types.Block {
+	chain := simulated.NewChain(head)
+	blocks := make([]*types.Block, head+1)
+	for number := int64(0); number <= head; number++ {
+		if number%3 != 0 || number == 0 {
+			blocks[number] = types.NewBlockWithHeader(chain.Header(number))
+			continue
+		}
+		transaction := types.NewTransaction(uint64(number), common.BigToAddress(big.NewInt(number)), big.NewInt(1), 21000, big.NewInt(1), nil)
+		blocks[number] = types.NewBlock(chain.Header(number), []*types.Transaction{transaction}, []*types.Header{chain.Header(number - 1)}, nil)
+	}
+	return blocks
+}
+
+// pebbleWriter writes the chaindata's key-value entries to a Pebble store, as newer geth versions do
+type pebbleWriter struct {
+	db *pebble.DB
+}
+
+func (writer pebbleWriter) Put(key []byte, value []byte) error {
+	return writer.db.Set(key, value, pebble.Sync)
+}
+
+func (writer pebbleWriter) Delete(key []byte) error {
+	return writer.db.Delete(key, pebble.Sync)
+}
+
+// writeChaindata writes the blocks to chaindata as geth does, the first frozen blocks in the freezer and the rest in
+// the key-value store, which is a LevelDB store unless usePebble is set
+func writeChaindata(dir, ancientDir string, blocks []*types.Block, usePebble bool) {
+	levelDBDir := dir
+	if usePebble {
+		// geth's freezer is written through a LevelDB database, which is then left out of the chaindata
+		var err error
+		levelDBDir, err = ioutil.TempDir("", "leveldb")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(levelDBDir)
+	}
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(levelDBDir, 16, 16, ancientDir, "")
+	Expect(err).NotTo(HaveOccurred())
+	defer db.Close()
+	var kv ethdb.KeyValueWriter = db
+	if usePebble {
+		pebbleDB, err := pebble.Open(dir, &pebble.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		defer pebbleDB.Close()
+		kv = pebbleWriter{pebbleDB}
+	}
+	for _, block := range blocks {
+		number := block.NumberU64()
+		if number < frozen {
+			header, err := rlp.EncodeToBytes(block.Header())
+			Expect(err).NotTo(HaveOccurred())
+			body, err := rlp.EncodeToBytes(block.Body())
+			Expect(err).NotTo(HaveOccurred())
+			receipts, err := rlp.EncodeToBytes([]*types.ReceiptForStorage{})
+			Expect(err).NotTo(HaveOccurred())
+			td, err := rlp.EncodeToBytes(block.Difficulty())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(db.AppendAncient(number, block.Hash().Bytes(), header, body, receipts, td)).To(Succeed())
+			rawdb.WriteHeaderNumber(kv, block.Hash(), number)
+			continue
+		}
+		rawdb.WriteBlock(kv, block)
+		rawdb.WriteCanonicalHash(kv, block.Hash(), number)
+	}
+	rawdb.WriteHeadHeaderHash(kv, blocks[len(blocks)-1].Hash())
+}
+
+// writeLondonBlock writes a block with a base fee, a typed transaction and an uncle with a base fee on top of the
+// chaindata's head block, returning its hash and the hashes of its uncle and transactions
+func writeLondonBlock(dir string, parent *types.Block) (common.Hash, common.Hash, []common.Hash) {
+	db, err := rawdb.NewLevelDBDatabase(dir, 16, 16, "")
+	Expect(err).NotTo(HaveOccurred())
+	defer db.Close()
+	number := parent.NumberU64() + 1
+	uncle := fakes.LondonHeaderRLP(&types.Header{ParentHash: parent.ParentHash(), Number: parent.Number(), Difficulty: big.NewInt(1)}, big.NewInt(7))
+	header := fakes.LondonHeaderRLP(&types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).SetUint64(number),
+		Difficulty: big.NewInt(1),
+		GasLimit:   30000000,
+	}, big.NewInt(1000000000))
+	hash := crypto.Keccak256Hash(header)
+	legacy := types.NewTransaction(1, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	legacyRLP, err := rlp.EncodeToBytes(legacy)
+	Expect(err).NotTo(HaveOccurred())
+	typed, typedHash := fakes.DynamicFeeTransactionRLP(2)
+	body, err := rlp.EncodeToBytes([]interface{}{[]rlp.RawValue{legacyRLP, typed}, []rlp.RawValue{uncle}})
+	Expect(err).NotTo(HaveOccurred())
+
+	headerKey := make([]byte, 9, 9+common.HashLength)
+	headerKey[0] = 'h'
+	binary.BigEndian.PutUint64(headerKey[1:], number)
+	Expect(db.Put(append(headerKey, hash.Bytes()...), header)).To(Succeed())
+	rawdb.WriteBodyRLP(db, hash, number, body)
+	rawdb.WriteHeaderNumber(db, hash, number)
+	rawdb.WriteCanonicalHash(db, hash, number)
+	rawdb.WriteHeadHeaderHash(db, hash)
+	return hash, crypto.Keccak256Hash(uncle), []common.Hash{legacy.Hash(), typedHash}
+}
+
+// checksums returns the checksums of the files in the directory tree
+func checksums(dir string) map[string][32]byte {
+	sums := make(map[string][32]byte)
+	Expect(filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		contents, err := ioutil.ReadFile(path)
+		sums[path] = sha256.Sum256(contents)
+		return err
+	})).To(Succeed())
+	return sums
+}
+
+var _ = Describe("Chaindata fetcher", func() {
+	var blocks []*types.Block
+
+	BeforeEach(func() {
+		blocks = makeBlocks()
+	})
+
+	expectHeader := func(header core.Header, number int64) {
+		Expect(header.BlockNumber).To(Equal(number))
+		Expect(header.Hash).To(Equal(blocks[number].Hash().Hex()))
+		gethHeader, err := converter.DecodeHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gethHeader.Hash()).To(Equal(blocks[number].Hash()))
+	}
+
+	for _, usePebble := range []bool{false, true} {
+		usePebble := usePebble
+		store := "LevelDB"
+		if usePebble {
+			store = "Pebble"
+		}
+
+		Context("with a "+store+" key-value store", func() {
+			var (
+				dir     string
+				db      *chaindata.DB
+				fetcher *chaindata.Fetcher
+			)
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "chaindata")
+				Expect(err).NotTo(HaveOccurred())
+				writeChaindata(dir, filepath.Join(dir, "ancient"), blocks, usePebble)
+				db, err = chaindata.NewDB(dir, "")
+				Expect(err).NotTo(HaveOccurred())
+				fetcher, err = chaindata.NewFetcher(db, core.Node{ID: "fingerprint"})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				if db != nil {
+					db.Close()
+				}
+				os.RemoveAll(dir)
+			})
+
+			It("reads headers from the freezer and the key-value store", func() {
+				frozenBlocks, err := db.Ancients()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(frozenBlocks).To(Equal(uint64(frozen)))
+
+				for number := int64(0); number <= head; number++ {
+					header, err := fetcher.GetHeaderByNumber(number)
+					Expect(err).NotTo(HaveOccurred())
+					expectHeader(header, number)
+				}
+			})
+
+			It("returns the head header as the last block", func() {
+				lastBlock, err := fetcher.LastBlock()
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(lastBlock.Int64()).To(Equal(int64(head)))
+			})
+
+			It("leaves out the block numbers the chaindata does not have", func() {
+				headers, err := fetcher.GetHeadersByNumbers([]int64{5, 15, head + 1, head + 2})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(headers).To(HaveLen(2))
+				expectHeader(headers[0], 5)
+				expectHeader(headers[1], 15)
+				_, err = fetcher.GetHeaderByNumber(head + 1)
+				Expect(err).To(Equal(chaindata.ErrHeaderNotFound))
+			})
+
+			It("reads the uncles and transaction hashes from the block bodies", func() {
+				fetcher.SetFetchUncles(true)
+				fetcher.SetFetchTransactionHashes(true)
+
+				headers, err := fetcher.GetHeadersByNumbers([]int64{3, 4, 18})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(headers).To(HaveLen(3))
+				for _, header := range headers {
+					block := blocks[header.BlockNumber]
+					Expect(header.Uncles).To(HaveLen(len(block.Uncles())))
+					Expect(header.TransactionHashes).To(HaveLen(len(block.Transactions())))
+				}
+				Expect(headers[0].Uncles[0].Hash).To(Equal(blocks[3].Uncles()[0].Hash().Hex()))
+				Expect(headers[0].TransactionHashes).To(Equal([]string{blocks[3].Transactions()[0].Hash().Hex()}))
+				Expect(headers[2].Uncles[0].Hash).To(Equal(blocks[18].Uncles()[0].Hash().Hex()))
+				Expect(headers[2].TransactionHashes).To(Equal([]string{blocks[18].Transactions()[0].Hash().Hex()}))
+			})
+
+			It("populates the missing headers of a repository", func() {
+				repo := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+
+				populated, err := history.PopulateMissingHeaders(fetcher, repo, 0, nil)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(populated).To(Equal(head + 1))
+				for number := int64(0); number <= head; number++ {
+					header, err := repo.GetHeader(number)
+					Expect(err).NotTo(HaveOccurred())
+					expectHeader(header, number)
+				}
+			})
+
+			It("does not modify the chaindata", func() {
+				db.Close()
+				db = nil
+				before := checksums(dir)
+
+				reopened, err := chaindata.NewDB(dir, "")
+				Expect(err).NotTo(HaveOccurred())
+				readFetcher, err := chaindata.NewFetcher(reopened, core.Node{})
+				Expect(err).NotTo(HaveOccurred())
+				readFetcher.SetFetchUncles(true)
+				_, err = readFetcher.GetHeadersByNumbers([]int64{0, 3, 12, head})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reopened.Close()).To(Succeed())
+
+				Expect(checksums(dir)).To(Equal(before))
+			})
+
+			It("takes the genesis block of the chaindata for a node without one", func() {
+				Expect(fetcher.Node().GenesisBlock).To(Equal(blocks[0].Hash().Hex()))
+				Expect(fetcher.Node().ID).To(Equal("fingerprint"))
+			})
+
+			It("rejects a node with another genesis block", func() {
+				_, err := chaindata.NewFetcher(db, core.Node{GenesisBlock: common.HexToHash("0x1234").Hex()})
+				Expect(err).To(Equal(chaindata.ErrGenesisMismatch))
+
+				_, err = chaindata.NewFetcher(db, core.Node{GenesisBlock: blocks[0].Hash().Hex()})
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	}
+
+	It("reads the freezer layout of newer geth versions", func() {
+		newerDir, err := ioutil.TempDir("", "chaindata")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(newerDir)
+		writeChaindata(newerDir, filepath.Join(newerDir, "ancient", "chain"), blocks, false)
+
+		newerDB, err := chaindata.NewDB(newerDir, "")
+		Expect(err).NotTo(HaveOccurred())
+		defer newerDB.Close()
+		newerFetcher, err := chaindata.NewFetcher(newerDB, core.Node{})
+		Expect(err).NotTo(HaveOccurred())
+		header, err := newerFetcher.GetHeaderByNumber(2)
+
+		Expect(err).NotTo(HaveOccurred())
+		expectHeader(header, 2)
+	})
+
+	It("reads headers and bodies with the fields added since London", func() {
+		londonDir, err := ioutil.TempDir("", "chaindata")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(londonDir)
+		writeChaindata(londonDir, filepath.Join(londonDir, "ancient"), blocks, false)
+		hash, uncleHash, transactionHashes := writeLondonBlock(londonDir, blocks[head])
+
+		londonDB, err := chaindata.NewDB(londonDir, "")
+		Expect(err).NotTo(HaveOccurred())
+		defer londonDB.Close()
+		londonFetcher, err := chaindata.NewFetcher(londonDB, core.Node{})
+		Expect(err).NotTo(HaveOccurred())
+		londonFetcher.SetRawEncoding(converter.RLP)
+		londonFetcher.SetFetchUncles(true)
+		londonFetcher.SetFetchTransactionHashes(true)
+		header, err := londonFetcher.GetHeaderByNumber(head + 1)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal(hash.Hex()))
+		Expect(crypto.Keccak256Hash(header.RLP)).To(Equal(hash))
+		Expect(header.Uncles).To(HaveLen(1))
+		Expect(header.Uncles[0].Hash).To(Equal(uncleHash.Hex()))
+		Expect(header.TransactionHashes).To(Equal([]string{transactionHashes[0].Hex(), transactionHashes[1].Hex()}))
+	})
+
+	It("reads the first item of a freezer table whose tail was removed", func() {
+		tailDir, err := ioutil.TempDir("", "chaindata")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tailDir)
+		kv, err := leveldb.OpenFile(tailDir, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kv.Close()).To(Succeed())
+		// Items 0 to 4 were removed along with data file 0, the first index entry points at data file 1 and holds the
+		// number of items removed
+		ancientDir := filepath.Join(tailDir, "ancient")
+		Expect(os.Mkdir(ancientDir, 0755)).To(Succeed())
+		first, second := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+		for table, compressed := range map[string]bool{"headers": true, "hashes": false} {
+			data := [][]byte{first, second}
+			indexExtension, dataExtension := "ridx", "rdat"
+			if compressed {
+				data = [][]byte{snappy.Encode(nil, first), snappy.Encode(nil, second)}
+				indexExtension, dataExtension = "cidx", "cdat"
+			}
+			index := []byte{0, 1, 0, 0, 0, 5}
+			var offset uint32
+			for _, item := range data {
+				offset += uint32(len(item))
+				index = append(index, 0, 1, byte(offset>>24), byte(offset>>16), byte(offset>>8), byte(offset))
+			}
+			Expect(ioutil.WriteFile(filepath.Join(ancientDir, table+"."+indexExtension), index, 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(ancientDir, table+".0001."+dataExtension), bytes.Join(data, nil), 0644)).To(Succeed())
+		}
+
+		tailDB, err := chaindata.NewDB(tailDir, "")
+		Expect(err).NotTo(HaveOccurred())
+		defer tailDB.Close()
+
+		Expect(tailDB.Ancients()).To(Equal(uint64(7)))
+		Expect(tailDB.HasAncient("hashes", 4)).To(BeFalse())
+		for _, table := range []string{"headers", "hashes"} {
+			Expect(tailDB.Ancient(table, 5)).To(Equal(first))
+			Expect(tailDB.Ancient(table, 6)).To(Equal(second))
+		}
+	})
+
+	It("leaves the block numbers past a batch for the next call", func() {
+		batchDir, err := ioutil.TempDir("", "chaindata")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(batchDir)
+		chain := simulated.NewChain(chaindata.MaxBatchSize + 10)
+		batchBlocks := make([]*types.Block, chaindata.MaxBatchSize+11)
+		for number := range batchBlocks {
+			batchBlocks[number] = types.NewBlockWithHeader(chain.Header(int64(number)))
+		}
+		writeChaindata(batchDir, filepath.Join(batchDir, "ancient"), batchBlocks, false)
+		batchDB, err := chaindata.NewDB(batchDir, "")
+		Expect(err).NotTo(HaveOccurred())
+		defer batchDB.Close()
+		batchFetcher, err := chaindata.NewFetcher(batchDB, core.Node{ID: "fingerprint"})
+		Expect(err).NotTo(HaveOccurred())
+		repo := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+
+		populated, err := history.PopulateMissingHeaders(batchFetcher, repo, 0, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(populated).To(Equal(chaindata.MaxBatchSize))
+		populated, err = history.PopulateMissingHeaders(batchFetcher, repo, 0, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(populated).To(Equal(11))
+	})
+})
@@ -0,0 +1,101 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var ErrNotSupported = errors.New("not supported by this client")
+
+// Caller makes JSON-RPC calls, it is satisfied by RPCClient and the recording and replay clients
+type Caller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// EthClient serves the header and block lookups of an ethereum client through a Caller,
+// so that their requests can be recorded or replayed like any other
+type EthClient struct {
+	caller Caller
+}
+
+// NewEthClient returns a new EthClient making its requests through the caller
+func NewEthClient(caller Caller) EthClient {
+	return EthClient{caller: caller}
+}
+
+// HeaderByNumber returns the header at the block number, or the latest header if it is nil
+func (client EthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var header *types.Header
+	err := client.caller.CallContext(ctx, &header, "eth_getBlockByNumber", toBlockNumberArg(number), false)
+	if err == nil && header == nil {
+		err = ethereum.NotFound
+	}
+	return header, err
+}
+
+// BlockByNumber returns the block at the block number with its header only, its transactions and uncles are not fetched
+func (client EthClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	header, err := client.HeaderByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewBlockWithHeader(header), nil
+}
+
+// BalanceAt returns the balance of the account at the block number, or at the latest block if it is nil
+func (client EthClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	var balance hexutil.Big
+	err := client.caller.CallContext(ctx, &balance, "eth_getBalance", account, toBlockNumberArg(blockNumber))
+	return (*big.Int)(&balance), err
+}
+
+// TransactionReceipt returns the receipt of the transaction
+func (client EthClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var receipt *types.Receipt
+	err := client.caller.CallContext(ctx, &receipt, "eth_getTransactionReceipt", txHash)
+	if err == nil && receipt == nil {
+		err = ethereum.NotFound
+	}
+	return receipt, err
+}
+
+func (client EthClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+func (client EthClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return nil, ErrNotSupported
+}
+
+func (client EthClient) TransactionSender(ctx context.Context, tx *types.Transaction, block common.Hash, index uint) (common.Address, error) {
+	return common.Address{}, ErrNotSupported
+}
+
+func toBlockNumberArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return hexutil.EncodeBig(number)
+}
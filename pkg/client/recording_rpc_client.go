@@ -0,0 +1,139 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Exchange is a recorded request and its response, or a recorded batch of them
+// Fixture files hold one JSON encoded Exchange per line
+type Exchange struct {
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Batch  []Exchange      `json:"batch,omitempty"`
+}
+
+// RecordingRPCClient is an RPCClient which writes every request and its response, including batches, to a fixture
+// Subscriptions are not recorded
+type RecordingRPCClient struct {
+	RPCClient
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewRecordingRPCClient returns a new RecordingRPCClient making its requests through the client and recording them to the writer
+func NewRecordingRPCClient(client RPCClient, fixture io.Writer) *RecordingRPCClient {
+	return &RecordingRPCClient{RPCClient: client, encoder: json.NewEncoder(fixture)}
+}
+
+// CallContext makes the request and records it along with its response
+func (client *RecordingRPCClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	var response json.RawMessage
+	err := client.RPCClient.CallContext(ctx, &response, method, args...)
+	exchange, recordErr := newExchange(method, args, response, err)
+	if recordErr != nil {
+		return recordErr
+	}
+	if recordErr = client.record(exchange); recordErr != nil {
+		return recordErr
+	}
+	if err != nil {
+		return err
+	}
+	return decodeResponse(response, result)
+}
+
+// BatchCall makes the batch of requests and records it along with the responses, and the errors of requests which
+// failed on their own
+func (client *RecordingRPCClient) BatchCall(batch []BatchElem) error {
+	responses := make([]json.RawMessage, len(batch))
+	recorded := make([]BatchElem, len(batch))
+	for i, elem := range batch {
+		recorded[i] = BatchElem{Method: elem.Method, Args: elem.Args, Result: &responses[i]}
+	}
+	err := client.RPCClient.BatchCall(recorded)
+	exchange := Exchange{Batch: make([]Exchange, len(batch))}
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+	for i, elem := range batch {
+		var recordErr error
+		exchange.Batch[i], recordErr = newExchange(elem.Method, elem.Args, responses[i], recorded[i].Error)
+		if recordErr != nil {
+			return recordErr
+		}
+	}
+	if recordErr := client.record(exchange); recordErr != nil {
+		return recordErr
+	}
+	if err != nil {
+		return err
+	}
+	for i := range batch {
+		batch[i].Error = recorded[i].Error
+		if batch[i].Error == nil {
+			batch[i].Error = decodeResponse(responses[i], batch[i].Result)
+		}
+	}
+	return nil
+}
+
+// SupportedModules makes the rpc_modules request and records it along with its response
+func (client *RecordingRPCClient) SupportedModules() (map[string]string, error) {
+	var modules map[string]string
+	err := client.CallContext(context.Background(), &modules, "rpc_modules")
+	return modules, err
+}
+
+func (client *RecordingRPCClient) record(exchange Exchange) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.encoder.Encode(exchange)
+}
+
+func newExchange(method string, args []interface{}, response json.RawMessage, err error) (Exchange, error) {
+	params, marshalErr := marshalParams(args)
+	if marshalErr != nil {
+		return Exchange{}, marshalErr
+	}
+	exchange := Exchange{Method: method, Params: params, Result: response}
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+	return exchange, nil
+}
+
+// marshalParams encodes the arguments of a request, requests without arguments have empty params
+func marshalParams(args []interface{}) (json.RawMessage, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return json.Marshal(args)
+}
+
+func decodeResponse(response json.RawMessage, result interface{}) error {
+	if result == nil || len(response) == 0 {
+		return nil
+	}
+	return json.Unmarshal(response, result)
+}
@@ -0,0 +1,177 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxFixtureLine is the longest line read from a fixture, batches of full blocks make for long lines
+const maxFixtureLine = 64 * 1024 * 1024
+
+var ErrNotRecorded = errors.New("request was not recorded")
+
+// ReplayClient serves the requests recorded by a RecordingRPCClient, as both an RPC and an ethereum client
+// Requests are matched on their method and params, whether they were recorded alone or in a batch
+// A request recorded several times is answered with each recorded response in turn, repeating the last one
+type ReplayClient struct {
+	EthClient
+	fixture   string
+	mutex     sync.Mutex
+	responses map[string][]Exchange
+	served    map[string]int
+}
+
+// NewReplayClient returns a ReplayClient serving the exchanges of the fixture file
+func NewReplayClient(fixture string) (*ReplayClient, error) {
+	file, err := os.Open(fixture)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	client, err := ReadReplayClient(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fixture, err.Error())
+	}
+	client.fixture = fixture
+	return client, nil
+}
+
+// ReadReplayClient returns a ReplayClient serving the exchanges read from the reader
+func ReadReplayClient(reader io.Reader) (*ReplayClient, error) {
+	client := &ReplayClient{responses: make(map[string][]Exchange), served: make(map[string]int)}
+	client.EthClient = NewEthClient(client)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxFixtureLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var exchange Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		if exchange.Batch == nil {
+			client.add(exchange)
+			continue
+		}
+		for _, elem := range exchange.Batch {
+			// A failed batch fails each of its requests, as a batch and alone
+			if exchange.Error != "" {
+				elem.Error = exchange.Error
+				elem.Batch = []Exchange{}
+			}
+			client.add(elem)
+		}
+	}
+	return client, scanner.Err()
+}
+
+func (client *ReplayClient) add(exchange Exchange) {
+	key := exchangeKey(exchange.Method, exchange.Params)
+	client.responses[key] = append(client.responses[key], exchange)
+}
+
+// CallContext answers the request with its recorded response
+func (client *ReplayClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	exchange, err := client.respond(method, args)
+	if err != nil {
+		return err
+	}
+	if exchange.Error != "" {
+		return errors.New(exchange.Error)
+	}
+	return decodeResponse(exchange.Result, result)
+}
+
+// BatchCall answers each request of the batch with its recorded response or error, failing the batch if one was not
+// recorded or was recorded in a failed batch
+func (client *ReplayClient) BatchCall(batch []BatchElem) error {
+	for i := range batch {
+		exchange, err := client.respond(batch[i].Method, batch[i].Args)
+		if err != nil {
+			return err
+		}
+		if exchange.Batch != nil {
+			return errors.New(exchange.Error)
+		}
+		if exchange.Error != "" {
+			batch[i].Error = errors.New(exchange.Error)
+			continue
+		}
+		batch[i].Error = decodeResponse(exchange.Result, batch[i].Result)
+	}
+	return nil
+}
+
+// RPCPath returns the fixture the client was loaded from
+func (client *ReplayClient) RPCPath() string {
+	return client.fixture
+}
+
+// SupportedModules answers with the recorded rpc_modules response
+func (client *ReplayClient) SupportedModules() (map[string]string, error) {
+	var modules map[string]string
+	err := client.CallContext(context.Background(), &modules, "rpc_modules")
+	return modules, err
+}
+
+// Subscribe is not supported, subscriptions are not recorded
+func (client *ReplayClient) Subscribe(namespace string, payloadChan interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	return nil, ErrNotSupported
+}
+
+// respond returns the recorded exchange of the request, an exchange recorded in a failed batch has an empty batch
+func (client *ReplayClient) respond(method string, args []interface{}) (Exchange, error) {
+	params, err := marshalParams(args)
+	if err != nil {
+		return Exchange{}, err
+	}
+	key := exchangeKey(method, params)
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	responses := client.responses[key]
+	if len(responses) == 0 {
+		log.Debugf("ReplayClient: %s was not recorded with params %s", method, params)
+		return Exchange{}, ErrNotRecorded
+	}
+	served := client.served[key]
+	if served < len(responses)-1 {
+		client.served[key] = served + 1
+	}
+	return responses[served], nil
+}
+
+// exchangeKey identifies a request by its method and params, compacting the params so that formatting does not matter
+func exchangeKey(method string, params json.RawMessage) string {
+	var compacted bytes.Buffer
+	if len(params) == 0 || json.Compact(&compacted, params) != nil {
+		return method + "[]"
+	}
+	return method + compacted.String()
+}
@@ -0,0 +1,175 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/client"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/fetcher"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+var (
+	_ core.RPCClient = (*client.RecordingRPCClient)(nil)
+	_ core.RPCClient = (*client.ReplayClient)(nil)
+	_ core.EthClient = (*client.ReplayClient)(nil)
+	_ core.EthClient = client.EthClient{}
+)
+
+var _ = Describe("Recording and replaying RPC requests", func() {
+	var (
+		chain     *simulated.Chain
+		server    *simulated.Server
+		rawClient *rpc.Client
+		fixture   *bytes.Buffer
+		recorder  *client.RecordingRPCClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		chain = simulated.NewChain(10)
+		server, err = simulated.NewServer(chain, "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		rawClient, err = rpc.Dial(server.URL())
+		Expect(err).NotTo(HaveOccurred())
+		fixture = new(bytes.Buffer)
+		recorder = client.NewRecordingRPCClient(client.NewRPCClient(rawClient, server.URL()), fixture)
+	})
+
+	AfterEach(func() {
+		rawClient.Close()
+		Expect(server.Close()).To(Succeed())
+	})
+
+	replay := func() *client.ReplayClient {
+		replayClient, err := client.ReadReplayClient(bytes.NewReader(fixture.Bytes()))
+		Expect(err).NotTo(HaveOccurred())
+		return replayClient
+	}
+
+	It("replays the headers fetched while recording", func() {
+		recordingFetcher := fetcher.NewFetcher(client.NewEthClient(recorder), recorder, core.Node{})
+		lastBlock, err := recordingFetcher.LastBlock()
+		Expect(err).NotTo(HaveOccurred())
+		header, err := recordingFetcher.GetHeaderByNumber(3)
+		Expect(err).NotTo(HaveOccurred())
+		headers, err := recordingFetcher.GetHeadersByNumbers([]int64{5, 6, 7, 11})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(3))
+		Expect(strings.Count(fixture.String(), "\n")).To(Equal(3))
+
+		replayClient := replay()
+		replayFetcher := fetcher.NewFetcher(replayClient, replayClient, core.Node{})
+
+		replayedLastBlock, err := replayFetcher.LastBlock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replayedLastBlock).To(Equal(lastBlock))
+		replayedHeader, err := replayFetcher.GetHeaderByNumber(3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replayedHeader).To(Equal(header))
+		replayedHeaders, err := replayFetcher.GetHeadersByNumbers([]int64{5, 6, 7, 11})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replayedHeaders).To(Equal(headers))
+	})
+
+	It("matches requests recorded in a batch when they are replayed alone", func() {
+		_, err := fetcher.NewFetcher(client.NewEthClient(recorder), recorder, core.Node{}).GetHeadersByNumbers([]int64{4, 5})
+		Expect(err).NotTo(HaveOccurred())
+
+		replayClient := replay()
+		header, err := fetcher.NewFetcher(replayClient, replayClient, core.Node{}).GetHeaderByNumber(5)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal(chain.Header(5).Hash().Hex()))
+	})
+
+	It("answers a request recorded several times with each response in turn", func() {
+		var blockNumber hexutil.Uint64
+		Expect(recorder.CallContext(context.Background(), &blockNumber, "eth_blockNumber")).To(Succeed())
+		chain.Extend(1)
+		Expect(recorder.CallContext(context.Background(), &blockNumber, "eth_blockNumber")).To(Succeed())
+
+		replayClient := replay()
+		for _, expected := range []uint64{10, 11, 11} {
+			Expect(replayClient.CallContext(context.Background(), &blockNumber, "eth_blockNumber")).To(Succeed())
+			Expect(uint64(blockNumber)).To(Equal(expected))
+		}
+	})
+
+	It("replays recorded errors", func() {
+		chain.SetError("eth_blockNumber", fakes.FakeError)
+		var blockNumber hexutil.Uint64
+		err := recorder.CallContext(context.Background(), &blockNumber, "eth_blockNumber")
+		Expect(err).To(MatchError(fakes.FakeError.Error()))
+
+		err = replay().CallContext(context.Background(), &blockNumber, "eth_blockNumber")
+
+		Expect(err).To(MatchError(fakes.FakeError.Error()))
+	})
+
+	It("replays the errors of requests which failed on their own in a batch", func() {
+		chain.SetError("eth_getBlockByNumber", fakes.FakeError)
+		batch := func() []client.BatchElem {
+			return []client.BatchElem{
+				{Method: "eth_getBlockByNumber", Args: []interface{}{"0x1", false}, Result: &json.RawMessage{}},
+				{Method: "eth_getBlockByNumber", Args: []interface{}{"0x2", false}, Result: &json.RawMessage{}},
+			}
+		}
+		recorded := batch()
+		Expect(recorder.BatchCall(recorded)).To(Succeed())
+		Expect(recorded[0].Error).To(MatchError(fakes.FakeError.Error()))
+
+		replayed := batch()
+		Expect(replay().BatchCall(replayed)).To(Succeed())
+
+		Expect(replayed[0].Error).To(MatchError(fakes.FakeError.Error()))
+		Expect(replayed[1].Error).To(MatchError(fakes.FakeError.Error()))
+	})
+
+	It("records the supported modules", func() {
+		modules, err := recorder.SupportedModules()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(modules).To(HaveKey("eth"))
+
+		Expect(replay().SupportedModules()).To(Equal(modules))
+	})
+
+	It("fails requests which were not recorded", func() {
+		replayClient := replay()
+
+		_, err := fetcher.NewFetcher(replayClient, replayClient, core.Node{}).GetHeaderByNumber(1)
+
+		Expect(err).To(MatchError(client.ErrNotRecorded))
+	})
+
+	It("rejects malformed fixtures", func() {
+		_, err := client.ReadReplayClient(strings.NewReader("{\"method\":\"eth_blockNumber\"}\nnot json\n"))
+
+		Expect(err).To(MatchError(ContainSubstring("line 2")))
+	})
+})
@@ -79,7 +79,14 @@ func (client RPCClient) BatchCall(batch []BatchElem) error {
 		}
 		rpcBatch = append(rpcBatch, newBatchElem)
 	}
-	return client.client.BatchCall(rpcBatch)
+	if err := client.client.BatchCall(rpcBatch); err != nil {
+		return err
+	}
+	// Requests of the batch fail on their own
+	for i := range batch {
+		batch[i].Error = rpcBatch[i].Error
+	}
+	return nil
 }
 
 // Subscribe subscribes to an rpc "namespace_subscribe" subscription with the given channel
@@ -24,6 +24,7 @@ import (
 
 // Env variables
 const (
+	DATABASE_DRIVER               = "DATABASE_DRIVER"
 	DATABASE_NAME                 = "DATABASE_NAME"
 	DATABASE_HOSTNAME             = "DATABASE_HOSTNAME"
 	DATABASE_PORT                 = "DATABASE_PORT"
@@ -34,8 +35,18 @@ const (
 	DATABASE_MAX_CONN_LIFETIME    = "DATABASE_MAX_CONN_LIFETIME"
 )
 
-// Database is the config struct for the Postgres database
+// Database drivers
+const (
+	PostgresDriver = "postgres"
+	SQLiteDriver   = "sqlite"
+	PebbleDriver   = "pebble"
+)
+
+// Database is the config struct for the database
+// With the SQLite driver Name is the path of the database file, with the Pebble driver it is the path of the store's
+// directory, the connection settings are unused by both
 type Database struct {
+	Driver      string
 	Hostname    string
 	Name        string
 	User        string
@@ -62,6 +73,7 @@ func DbConnectionString(dbConfig Database) string {
 // Init inits the database config from env/config values
 // Precedence is env variables > cli flags > toml config values
 func (d *Database) Init() {
+	viper.BindEnv("database.driver", DATABASE_DRIVER)
 	viper.BindEnv("database.name", DATABASE_NAME)
 	viper.BindEnv("database.hostname", DATABASE_HOSTNAME)
 	viper.BindEnv("database.port", DATABASE_PORT)
@@ -71,6 +83,7 @@ func (d *Database) Init() {
 	viper.BindEnv("database.maxOpen", DATABASE_MAX_OPEN_CONNECTIONS)
 	viper.BindEnv("database.maxLifetime", DATABASE_MAX_CONN_LIFETIME)
 
+	d.Driver = viper.GetString("database.driver")
 	d.Name = viper.GetString("database.name")
 	d.Hostname = viper.GetString("database.hostname")
 	d.Port = viper.GetInt("database.port")
@@ -18,26 +18,85 @@ package converter
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
 
 	"github.com/vulcanize/eth-header-sync/pkg/core"
 )
 
-type HeaderConverter struct{}
+var (
+	ErrNoRawHeader  = errors.New("header has neither a JSON nor an RLP raw encoding")
+	ErrHashMismatch = errors.New("header hash does not match the keccak of its RLP encoding")
+	ErrBodyMismatch = errors.New("block body does not match the uncle hash and transaction root of its header")
+)
+
+// RawEncoding determines which encodings of the header are stored alongside it
+type RawEncoding int
+
+const (
+	JSON RawEncoding = iota
+	RLP
+	JSONAndRLP
+)
+
+// ParseRawEncoding returns the RawEncoding for the provided config value
+func ParseRawEncoding(encoding string) (RawEncoding, error) {
+	switch strings.ToLower(encoding) {
+	case "", "json":
+		return JSON, nil
+	case "rlp":
+		return RLP, nil
+	case "both":
+		return JSONAndRLP, nil
+	}
+	return JSON, fmt.Errorf("unrecognized raw encoding %s, expected one of json, rlp or both", encoding)
+}
+
+type HeaderConverter struct {
+	Encoding RawEncoding
+}
 
 // Convert converts a go-ethereum header type to our internal header type
+// Only the fields go-ethereum's header type has are encoded, so keccak(RLP) is not the block hash for headers with
+// fields added after it, such as the base fee, which ConvertJSON keeps, or for POA headers, which carry seal fields
 func (converter HeaderConverter) Convert(gethHeader *types.Header, blockHash string) core.Header {
-	rawHeader, err := json.Marshal(gethHeader)
-	if err != nil {
-		panic(err)
-	}
 	coreHeader := core.Header{
 		Hash:        blockHash,
 		BlockNumber: gethHeader.Number.Int64(),
-		Raw:         rawHeader,
 		Timestamp:   strconv.FormatUint(gethHeader.Time, 10),
 	}
+	if converter.Encoding != RLP {
+		rawHeader, err := json.Marshal(gethHeader)
+		if err != nil {
+			panic(err)
+		}
+		coreHeader.Raw = rawHeader
+	}
+	if converter.Encoding != JSON {
+		rlpHeader, err := rlp.EncodeToBytes(gethHeader)
+		if err != nil {
+			panic(err)
+		}
+		coreHeader.RLP = rlpHeader
+	}
 	return coreHeader
 }
+
+// DecodeHeader decodes the stored raw header back into a go-ethereum header, preferring the RLP encoding
+// Fields added to the header after go-ethereum's header type are left out
+func DecodeHeader(header core.Header) (*types.Header, error) {
+	if len(header.RLP) > 0 {
+		gethHeader, _, err := DecodeHeaderRLP(header.RLP)
+		return gethHeader, err
+	}
+	gethHeader := new(types.Header)
+	if len(header.Raw) > 0 {
+		return gethHeader, json.Unmarshal(header.Raw, gethHeader)
+	}
+	return nil, ErrNoRawHeader
+}
@@ -23,10 +23,12 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	common2 "github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
 	"github.com/vulcanize/eth-header-sync/pkg/fakes"
 )
 
@@ -61,5 +63,76 @@ var _ = Describe("Block header converter", func() {
 		expectedJSON, err := json.Marshal(gethHeader)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(coreHeader.Raw).To(Equal(expectedJSON))
+		Expect(coreHeader.RLP).To(BeNil())
+	})
+
+	It("includes the consensus RLP encoding instead of JSON", func() {
+		gethHeader := types.Header{Number: big.NewInt(123), Difficulty: big.NewInt(1), Time: 456}
+		converter := common2.HeaderConverter{Encoding: common2.RLP}
+
+		coreHeader := converter.Convert(&gethHeader, gethHeader.Hash().Hex())
+
+		Expect(coreHeader.Raw).To(BeNil())
+		Expect(crypto.Keccak256Hash(coreHeader.RLP).Hex()).To(Equal(coreHeader.Hash))
+	})
+
+	It("includes both encodings", func() {
+		gethHeader := types.Header{Number: big.NewInt(123), Difficulty: big.NewInt(1)}
+		converter := common2.HeaderConverter{Encoding: common2.JSONAndRLP}
+
+		coreHeader := converter.Convert(&gethHeader, gethHeader.Hash().Hex())
+
+		Expect(coreHeader.Raw).NotTo(BeEmpty())
+		Expect(coreHeader.RLP).NotTo(BeEmpty())
+	})
+
+	Describe("parsing the raw encoding", func() {
+		It("defaults to JSON", func() {
+			encoding, err := common2.ParseRawEncoding("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(encoding).To(Equal(common2.JSON))
+		})
+
+		It("parses the config values", func() {
+			encoding, err := common2.ParseRawEncoding("RLP")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(encoding).To(Equal(common2.RLP))
+			encoding, err = common2.ParseRawEncoding("both")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(encoding).To(Equal(common2.JSONAndRLP))
+		})
+
+		It("rejects unknown values", func() {
+			_, err := common2.ParseRawEncoding("xml")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("decoding a header", func() {
+		gethHeader := types.Header{Number: big.NewInt(123), Difficulty: big.NewInt(1), Time: 456}
+
+		It("decodes the RLP encoding", func() {
+			coreHeader := common2.HeaderConverter{Encoding: common2.RLP}.Convert(&gethHeader, "")
+
+			decoded, err := common2.DecodeHeader(coreHeader)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.Hash()).To(Equal(gethHeader.Hash()))
+		})
+
+		It("decodes the JSON encoding", func() {
+			coreHeader := common2.HeaderConverter{}.Convert(&gethHeader, "")
+
+			decoded, err := common2.DecodeHeader(coreHeader)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.Hash()).To(Equal(gethHeader.Hash()))
+		})
+
+		It("returns an error without a raw encoding", func() {
+			_, err := common2.DecodeHeader(core.Header{BlockNumber: 123})
+
+			Expect(err).To(MatchError(common2.ErrNoRawHeader))
+		})
 	})
 })
@@ -0,0 +1,384 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// headerRLP is the encoding of go-ethereum's header type followed by the fields added to the header after it, such as
+// the base fee
+type headerRLP struct {
+	ParentHash  common.Hash
+	UncleHash   common.Hash
+	Coinbase    common.Address
+	Root        common.Hash
+	TxHash      common.Hash
+	ReceiptHash common.Hash
+	Bloom       types.Bloom
+	Difficulty  *big.Int
+	Number      *big.Int
+	GasLimit    uint64
+	GasUsed     uint64
+	Time        uint64
+	Extra       []byte
+	MixDigest   common.Hash
+	Nonce       types.BlockNonce
+	Extensions  []rlp.RawValue `rlp:"tail"`
+}
+
+// headerExtensions are the JSON names of the fields added to the header after go-ethereum's header type, in the order
+// they are encoded, and whether each is a quantity rather than a hash
+var headerExtensions = []struct {
+	name     string
+	quantity bool
+}{
+	{name: "baseFeePerGas", quantity: true},
+	{name: "withdrawalsRoot"},
+	{name: "blobGasUsed", quantity: true},
+	{name: "excessBlobGas", quantity: true},
+	{name: "parentBeaconBlockRoot"},
+	{name: "requestsHash"},
+}
+
+// bodyRLP is the encoding of a block body, its transactions and uncles, followed by any fields added after them
+type bodyRLP struct {
+	Transactions []rlp.RawValue
+	Uncles       []rlp.RawValue
+	Rest         []rlp.RawValue `rlp:"tail"`
+}
+
+// DecodeHeaderRLP decodes the RLP encoding of a header into go-ethereum's header type, returning the encodings of the
+// fields the type does not have alongside it
+func DecodeHeaderRLP(raw []byte) (*types.Header, []rlp.RawValue, error) {
+	var decoded headerRLP
+	if err := rlp.DecodeBytes(raw, &decoded); err != nil {
+		return nil, nil, err
+	}
+	return &types.Header{
+		ParentHash:  decoded.ParentHash,
+		UncleHash:   decoded.UncleHash,
+		Coinbase:    decoded.Coinbase,
+		Root:        decoded.Root,
+		TxHash:      decoded.TxHash,
+		ReceiptHash: decoded.ReceiptHash,
+		Bloom:       decoded.Bloom,
+		Difficulty:  decoded.Difficulty,
+		Number:      decoded.Number,
+		GasLimit:    decoded.GasLimit,
+		GasUsed:     decoded.GasUsed,
+		Time:        decoded.Time,
+		Extra:       decoded.Extra,
+		MixDigest:   decoded.MixDigest,
+		Nonce:       decoded.Nonce,
+	}, decoded.Extensions, nil
+}
+
+// EncodeHeaderJSON returns the RLP encoding of a header in the JSON form eth_getBlockByNumber returns it, including the
+// fields added to the header after go-ethereum's header type which the JSON has
+func EncodeHeaderJSON(raw []byte) ([]byte, error) {
+	gethHeader := new(types.Header)
+	if err := json.Unmarshal(raw, gethHeader); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	var extensions []rlp.RawValue
+	for _, extension := range headerExtensions {
+		field, ok := fields[extension.name]
+		if !ok || string(field) == "null" {
+			break
+		}
+		var (
+			quantity hexutil.Big
+			value    hexutil.Bytes
+			err      error
+		)
+		if extension.quantity {
+			err = json.Unmarshal(field, &quantity)
+		} else {
+			err = json.Unmarshal(field, &value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", extension.name, err.Error())
+		}
+		var encoded []byte
+		if extension.quantity {
+			encoded, err = rlp.EncodeToBytes(quantity.ToInt())
+		} else {
+			encoded, err = rlp.EncodeToBytes([]byte(value))
+		}
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, encoded)
+	}
+	return rlp.EncodeToBytes(headerRLP{
+		ParentHash:  gethHeader.ParentHash,
+		UncleHash:   gethHeader.UncleHash,
+		Coinbase:    gethHeader.Coinbase,
+		Root:        gethHeader.Root,
+		TxHash:      gethHeader.TxHash,
+		ReceiptHash: gethHeader.ReceiptHash,
+		Bloom:       gethHeader.Bloom,
+		Difficulty:  gethHeader.Difficulty,
+		Number:      gethHeader.Number,
+		GasLimit:    gethHeader.GasLimit,
+		GasUsed:     gethHeader.GasUsed,
+		Time:        gethHeader.Time,
+		Extra:       gethHeader.Extra,
+		MixDigest:   gethHeader.MixDigest,
+		Nonce:       gethHeader.Nonce,
+		Extensions:  extensions,
+	})
+}
+
+// HeaderRLP returns the RLP encoding of the stored header, encoding its JSON if it has no RLP
+func HeaderRLP(header core.Header) ([]byte, error) {
+	if len(header.RLP) > 0 {
+		return header.RLP, nil
+	}
+	if len(header.Raw) > 0 {
+		return EncodeHeaderJSON(header.Raw)
+	}
+	return nil, ErrNoRawHeader
+}
+
+// ConvertRLP converts the RLP encoding of a header to our internal header type, keeping the encoding as is
+// Unlike Convert it preserves the fields added to the header after go-ethereum's header type, the hash is keccak(RLP)
+// and the JSON encoding holds those fields too
+func (converter HeaderConverter) ConvertRLP(raw []byte) (core.Header, error) {
+	gethHeader, extensions, err := DecodeHeaderRLP(raw)
+	if err != nil {
+		return core.Header{}, err
+	}
+	hash := crypto.Keccak256Hash(raw)
+	coreHeader := core.Header{
+		Hash:        hash.Hex(),
+		BlockNumber: gethHeader.Number.Int64(),
+		Timestamp:   strconv.FormatUint(gethHeader.Time, 10),
+	}
+	if converter.Encoding != RLP {
+		if coreHeader.Raw, err = headerJSON(gethHeader, hash, extensions); err != nil {
+			return core.Header{}, err
+		}
+	}
+	if converter.Encoding != JSON {
+		coreHeader.RLP = common.CopyBytes(raw)
+	}
+	return coreHeader, nil
+}
+
+// ConvertJSON converts the JSON encoding of a header as eth_getBlockByNumber returns it to our internal header type
+// The RLP encoding is built from the JSON, so it keeps the fields added after go-ethereum's header type, and
+// keccak(RLP) must equal the hash returned with the header
+func (converter HeaderConverter) ConvertJSON(raw []byte) (core.Header, error) {
+	encoded, err := EncodeHeaderJSON(raw)
+	if err != nil {
+		return core.Header{}, err
+	}
+	header, err := converter.ConvertRLP(encoded)
+	if err != nil {
+		return core.Header{}, err
+	}
+	var returned struct {
+		Hash *common.Hash `json:"hash"`
+	}
+	if err := json.Unmarshal(raw, &returned); err != nil {
+		return core.Header{}, err
+	}
+	if returned.Hash != nil && returned.Hash.Hex() != header.Hash {
+		return core.Header{}, fmt.Errorf("%w: block %d was returned with hash %s but its encoding hashes to %s",
+			ErrHashMismatch, header.BlockNumber, returned.Hash.Hex(), header.Hash)
+	}
+	return header, nil
+}
+
+// ConvertUncleRLP converts the RLP encoding of an uncle header to our internal uncle type, keeping the encoding as is
+func (converter HeaderConverter) ConvertUncleRLP(raw []byte, index int) (core.Uncle, error) {
+	header, err := converter.ConvertRLP(raw)
+	if err != nil {
+		return core.Uncle{}, err
+	}
+	return newUncle(header, index)
+}
+
+// ConvertUncleJSON converts the JSON encoding of an uncle header as eth_getUncleByBlockHashAndIndex returns it to our
+// internal uncle type, index is its position in the including block
+// As with ConvertJSON the uncle must hash to the hash returned with it
+func (converter HeaderConverter) ConvertUncleJSON(raw []byte, index int) (core.Uncle, error) {
+	header, err := converter.ConvertJSON(raw)
+	if err != nil {
+		return core.Uncle{}, err
+	}
+	return newUncle(header, index)
+}
+
+// newUncle returns the uncle for the converted header
+func newUncle(header core.Header, index int) (core.Uncle, error) {
+	encoded, err := HeaderRLP(header)
+	if err != nil {
+		return core.Uncle{}, err
+	}
+	gethHeader, _, err := DecodeHeaderRLP(encoded)
+	if err != nil {
+		return core.Uncle{}, err
+	}
+	return core.Uncle{
+		BlockNumber: header.BlockNumber,
+		Hash:        header.Hash,
+		Index:       int64(index),
+		Miner:       gethHeader.Coinbase.Hex(),
+		Raw:         header.Raw,
+		RLP:         header.RLP,
+		Timestamp:   header.Timestamp,
+	}, nil
+}
+
+// DecodeBodyRLP decodes the RLP encoding of a block body into the encodings of its uncles and the hashes of its
+// transactions
+// Typed transactions are encoded as strings holding the type and the transaction, legacy transactions as lists
+func DecodeBodyRLP(raw []byte) ([]rlp.RawValue, []common.Hash, error) {
+	decoded, transactions, err := decodeBody(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]common.Hash, len(transactions))
+	for i, transaction := range transactions {
+		hashes[i] = crypto.Keccak256Hash(transaction)
+	}
+	return decoded.Uncles, hashes, nil
+}
+
+// VerifyBodyRLP checks that the RLP encoding of a block body derives the uncle hash and transaction root of its header,
+// returning ErrBodyMismatch if it does not
+func VerifyBodyRLP(raw []byte, header *types.Header) error {
+	decoded, transactions, err := decodeBody(raw)
+	if err != nil {
+		return err
+	}
+	uncles, err := rlp.EncodeToBytes(decoded.Uncles)
+	if err != nil {
+		return err
+	}
+	if uncleHash := crypto.Keccak256Hash(uncles); uncleHash != header.UncleHash {
+		return fmt.Errorf("%w: uncle hash %s, header has %s", ErrBodyMismatch, uncleHash.Hex(), header.UncleHash.Hex())
+	}
+	if txHash := types.DeriveSha(transactions); txHash != header.TxHash {
+		return fmt.Errorf("%w: transaction root %s, header has %s", ErrBodyMismatch, txHash.Hex(), header.TxHash.Hex())
+	}
+	return nil
+}
+
+// encodedTransactions are the consensus encodings of a body's transactions, the values of its transaction trie
+type encodedTransactions [][]byte
+
+func (transactions encodedTransactions) Len() int {
+	return len(transactions)
+}
+
+func (transactions encodedTransactions) GetRlp(i int) []byte {
+	return transactions[i]
+}
+
+// decodeBody decodes the RLP encoding of a block body along with the consensus encodings of its transactions, the
+// type and the transaction for typed transactions, which the body holds as strings, and the list for legacy ones
+func decodeBody(raw []byte) (bodyRLP, encodedTransactions, error) {
+	var decoded bodyRLP
+	if err := rlp.DecodeBytes(raw, &decoded); err != nil {
+		return decoded, nil, err
+	}
+	transactions := make(encodedTransactions, len(decoded.Transactions))
+	for i, rawTransaction := range decoded.Transactions {
+		kind, content, _, err := rlp.Split(rawTransaction)
+		if err != nil {
+			return decoded, nil, fmt.Errorf("transaction %d: %s", i, err.Error())
+		}
+		if kind == rlp.List {
+			transactions[i] = rawTransaction
+		} else {
+			transactions[i] = content
+		}
+	}
+	return decoded, transactions, nil
+}
+
+// headerJSON returns the JSON encoding of the header with the hash and the fields it was decoded with that
+// go-ethereum's header type does not have
+func headerJSON(gethHeader *types.Header, hash common.Hash, extensions []rlp.RawValue) ([]byte, error) {
+	raw, err := json.Marshal(gethHeader)
+	if err != nil || len(extensions) == 0 {
+		return raw, err
+	}
+	fields, err := extensionFields(extensions)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	// go-ethereum's header type hashes only the fields it has
+	fields["hash"] = hash
+	return json.Marshal(fields)
+}
+
+// HeaderExtensions returns the fields of the stored header added after go-ethereum's header type, keyed by their JSON
+// names, quantities are *hexutil.Big and hashes hexutil.Bytes
+func HeaderExtensions(header core.Header) (map[string]interface{}, error) {
+	encoded, err := HeaderRLP(header)
+	if err != nil {
+		return nil, err
+	}
+	_, extensions, err := DecodeHeaderRLP(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return extensionFields(extensions)
+}
+
+// extensionFields returns the decoded fields added after go-ethereum's header type keyed by their JSON names
+func extensionFields(extensions []rlp.RawValue) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for i, extension := range extensions {
+		if i == len(headerExtensions) {
+			break
+		}
+		content, _, err := rlp.SplitString(extension)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", headerExtensions[i].name, err.Error())
+		}
+		if headerExtensions[i].quantity {
+			fields[headerExtensions[i].name] = (*hexutil.Big)(new(big.Int).SetBytes(content))
+		} else {
+			fields[headerExtensions[i].name] = hexutil.Bytes(content)
+		}
+	}
+	return fields, nil
+}
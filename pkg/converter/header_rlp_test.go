@@ -0,0 +1,208 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package converter_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+)
+
+var _ = Describe("RLP header converter", func() {
+	gethHeader := &types.Header{
+		ParentHash: common.HexToHash("0xParent"),
+		Difficulty: big.NewInt(2),
+		Number:     big.NewInt(12965000),
+		GasLimit:   30000000,
+		Time:       1628166822,
+	}
+	londonRLP := fakes.LondonHeaderRLP(gethHeader, big.NewInt(1000000000))
+
+	It("converts a header go-ethereum's header type can hold as Convert does", func() {
+		legacyRLP, err := rlp.EncodeToBytes(gethHeader)
+		Expect(err).NotTo(HaveOccurred())
+		headerConverter := converter.HeaderConverter{Encoding: converter.JSONAndRLP}
+
+		coreHeader, err := headerConverter.ConvertRLP(legacyRLP)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(coreHeader).To(Equal(headerConverter.Convert(gethHeader, gethHeader.Hash().Hex())))
+	})
+
+	It("keeps the fields added after go-ethereum's header type", func() {
+		coreHeader, err := converter.HeaderConverter{Encoding: converter.JSONAndRLP}.ConvertRLP(londonRLP)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(coreHeader.BlockNumber).To(Equal(int64(12965000)))
+		Expect(coreHeader.Hash).To(Equal(crypto.Keccak256Hash(londonRLP).Hex()))
+		Expect(coreHeader.Hash).NotTo(Equal(gethHeader.Hash().Hex()))
+		Expect(coreHeader.RLP).To(Equal(londonRLP))
+		var fields map[string]interface{}
+		Expect(json.Unmarshal(coreHeader.Raw, &fields)).To(Succeed())
+		Expect(fields["hash"]).To(Equal(coreHeader.Hash))
+		Expect(fields["baseFeePerGas"]).To(Equal("0x3b9aca00"))
+		Expect(fields["number"]).To(Equal("0xc5d488"))
+	})
+
+	It("decodes the header without the added fields", func() {
+		decoded, extensions, err := converter.DecodeHeaderRLP(londonRLP)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded.Hash()).To(Equal(gethHeader.Hash()))
+		Expect(extensions).To(HaveLen(1))
+		stored, err := converter.DecodeHeader(converter.HeaderConverter{Encoding: converter.RLP}.Convert(gethHeader, ""))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Hash()).To(Equal(gethHeader.Hash()))
+	})
+
+	It("encodes the JSON of a header with the added fields back into its RLP", func() {
+		coreHeader, err := converter.HeaderConverter{Encoding: converter.JSON}.ConvertRLP(londonRLP)
+		Expect(err).NotTo(HaveOccurred())
+
+		encoded, err := converter.EncodeHeaderJSON(coreHeader.Raw)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(encoded).To(Equal(londonRLP))
+		stored, err := converter.HeaderRLP(coreHeader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(Equal(londonRLP))
+	})
+
+	It("encodes the JSON of a header go-ethereum's header type can hold as go-ethereum does", func() {
+		raw, err := json.Marshal(gethHeader)
+		Expect(err).NotTo(HaveOccurred())
+		legacyRLP, err := rlp.EncodeToBytes(gethHeader)
+		Expect(err).NotTo(HaveOccurred())
+
+		encoded, err := converter.EncodeHeaderJSON(raw)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(encoded).To(Equal(legacyRLP))
+	})
+
+	Describe("converting the JSON returned over RPC", func() {
+		It("keeps the hash of a post-London header", func() {
+			coreHeader, err := converter.HeaderConverter{Encoding: converter.JSONAndRLP}.ConvertJSON(fakes.HoleskyGenesisJSON)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(coreHeader.Hash).To(Equal(fakes.HoleskyGenesisHash.Hex()))
+			Expect(crypto.Keccak256Hash(coreHeader.RLP)).To(Equal(fakes.HoleskyGenesisHash))
+			var fields map[string]interface{}
+			Expect(json.Unmarshal(coreHeader.Raw, &fields)).To(Succeed())
+			Expect(fields["hash"]).To(Equal(fakes.HoleskyGenesisHash.Hex()))
+			Expect(fields["baseFeePerGas"]).To(Equal("0x3b9aca00"))
+		})
+
+		It("keeps the hash of a post-Shanghai header", func() {
+			withdrawalsRoot := common.HexToHash("0xWithdrawals")
+			raw, hash := fakes.ShanghaiHeaderJSON(gethHeader, big.NewInt(7), withdrawalsRoot)
+
+			coreHeader, err := converter.HeaderConverter{Encoding: converter.JSONAndRLP}.ConvertJSON(raw)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(coreHeader.Hash).To(Equal(hash.Hex()))
+			Expect(crypto.Keccak256Hash(coreHeader.RLP)).To(Equal(hash))
+			_, extensions, err := converter.DecodeHeaderRLP(coreHeader.RLP)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extensions).To(HaveLen(2))
+			var fields map[string]interface{}
+			Expect(json.Unmarshal(coreHeader.Raw, &fields)).To(Succeed())
+			Expect(fields["withdrawalsRoot"]).To(Equal(withdrawalsRoot.Hex()))
+		})
+
+		It("rejects a header which does not hash to the returned hash", func() {
+			raw := strings.Replace(string(fakes.HoleskyGenesisJSON), `"gasUsed":"0x0"`, `"gasUsed":"0x1"`, 1)
+
+			_, err := converter.HeaderConverter{}.ConvertJSON([]byte(raw))
+
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, converter.ErrHashMismatch)).To(BeTrue())
+		})
+	})
+
+	It("converts the JSON of a post-London uncle, keeping its hash", func() {
+		uncle, err := converter.HeaderConverter{Encoding: converter.RLP}.ConvertUncleJSON(fakes.HoleskyGenesisJSON, 1)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uncle.Hash).To(Equal(fakes.HoleskyGenesisHash.Hex()))
+		Expect(crypto.Keccak256Hash(uncle.RLP)).To(Equal(fakes.HoleskyGenesisHash))
+		Expect(uncle.Index).To(Equal(int64(1)))
+		Expect(uncle.Miner).To(Equal(common.Address{}.Hex()))
+	})
+
+	It("converts uncles", func() {
+		uncle, err := converter.HeaderConverter{Encoding: converter.RLP}.ConvertUncleRLP(londonRLP, 1)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uncle.Hash).To(Equal(crypto.Keccak256Hash(londonRLP).Hex()))
+		Expect(uncle.Index).To(Equal(int64(1)))
+		Expect(uncle.Miner).To(Equal(gethHeader.Coinbase.Hex()))
+		Expect(uncle.RLP).To(Equal(londonRLP))
+	})
+
+	It("hashes legacy and typed transactions of a block body", func() {
+		legacy := types.NewTransaction(1, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+		legacyRLP, err := rlp.EncodeToBytes(legacy)
+		Expect(err).NotTo(HaveOccurred())
+		typedRLP, typedHash := fakes.DynamicFeeTransactionRLP(2)
+		body, err := rlp.EncodeToBytes([]interface{}{
+			[]rlp.RawValue{legacyRLP, typedRLP},
+			[]rlp.RawValue{londonRLP},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		uncles, hashes, err := converter.DecodeBodyRLP(body)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uncles).To(Equal([]rlp.RawValue{londonRLP}))
+		Expect(hashes).To(Equal([]common.Hash{legacy.Hash(), typedHash}))
+	})
+
+	It("verifies a block body against the uncle hash and transaction root of its header", func() {
+		transactions := types.Transactions{
+			types.NewTransaction(1, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil),
+			types.NewTransaction(2, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil),
+		}
+		uncles := []*types.Header{{Number: big.NewInt(12964999), Difficulty: big.NewInt(2)}}
+		block := types.NewBlock(gethHeader, transactions, uncles, nil)
+		body, err := rlp.EncodeToBytes(block.Body())
+		Expect(err).NotTo(HaveOccurred())
+		withoutUncles, err := rlp.EncodeToBytes(&types.Body{Transactions: transactions})
+		Expect(err).NotTo(HaveOccurred())
+		reordered, err := rlp.EncodeToBytes(&types.Body{Transactions: types.Transactions{transactions[1], transactions[0]}, Uncles: uncles})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(converter.VerifyBodyRLP(body, block.Header())).To(Succeed())
+		err = converter.VerifyBodyRLP(withoutUncles, block.Header())
+		Expect(errors.Is(err, converter.ErrBodyMismatch)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("uncle hash")))
+		err = converter.VerifyBodyRLP(reordered, block.Header())
+		Expect(errors.Is(err, converter.ErrBodyMismatch)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("transaction root")))
+	})
+})
@@ -17,6 +17,8 @@
 package core
 
 import (
+	"strconv"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -24,11 +26,19 @@ import (
 
 // Header is the internal ethereum header type
 type Header struct {
-	ID          int64
-	BlockNumber int64 `db:"block_number"`
-	Hash        string
-	Raw         []byte
-	Timestamp   string `db:"block_timestamp"`
+	ID                int64
+	BlockNumber       int64 `db:"block_number"`
+	Hash              string
+	Raw               []byte
+	RLP               []byte   `db:"raw_rlp"`
+	Timestamp         string   `db:"block_timestamp"`
+	Uncles            []Uncle  `db:"-"`
+	TransactionHashes []string `db:"-"`
+}
+
+// UnixTimestamp returns the header's timestamp, which is stored as a decimal string, as a unix time
+func (header Header) UnixTimestamp() (int64, error) {
+	return strconv.ParseInt(header.Timestamp, 10, 64)
 }
 
 // POAHeader is the internal POA ethereum header type
@@ -47,4 +57,7 @@ type POAHeader struct {
 	Time        hexutil.Uint64 `json:"timestamp"        gencodec:"required"`
 	Extra       hexutil.Bytes  `json:"extraData"        gencodec:"required"`
 	Hash        common.Hash    `json:"hash"`
+	// Uncles and Transactions are the hashes of the block's uncles and transactions, returned alongside the header
+	Uncles       []common.Hash `json:"uncles"`
+	Transactions []common.Hash `json:"transactions"`
 }
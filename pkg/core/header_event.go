@@ -0,0 +1,64 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import "encoding/json"
+
+// HeaderEventsChannel is the Postgres notification channel header events are published on
+const HeaderEventsChannel = "header_events"
+
+// HeaderEventType describes what happened to a header
+type HeaderEventType string
+
+const (
+	// HeaderInserted is emitted when a header is stored at a height which held none
+	HeaderInserted HeaderEventType = "insert"
+	// HeaderReplaced is emitted when the header at a height is replaced by one with a different hash, i.e. on a reorg
+	HeaderReplaced HeaderEventType = "replace"
+	// HeaderConfirmed is emitted when a header leaves the validation window
+	HeaderConfirmed HeaderEventType = "confirm"
+)
+
+// HeaderEvent describes a change to the synced headers
+// PreviousHash is only set for replacements and Raw is only set for events delivered to a HeaderSink
+type HeaderEvent struct {
+	Type         HeaderEventType `json:"type"`
+	BlockNumber  int64           `json:"blockNumber"`
+	Hash         string          `json:"hash"`
+	PreviousHash string          `json:"previousHash,omitempty"`
+	Fingerprint  string          `json:"fingerprint"`
+	Raw          json.RawMessage `json:"raw,omitempty"`
+}
+
+// HeaderSink is notified of new, confirmed and replaced headers as they are synced
+type HeaderSink interface {
+	Send(event HeaderEvent) error
+}
+
+// OutboxEvent is a JSON encoded HeaderEvent recorded in the outbox until it is published
+type OutboxEvent struct {
+	ID          int64
+	Fingerprint string `db:"eth_node_fingerprint"`
+	Payload     []byte
+}
+
+// HeaderPublisher publishes outbox events to a message queue
+// Publish must only return once the broker has acknowledged every event
+type HeaderPublisher interface {
+	Publish(events []OutboxEvent) error
+	Close() error
+}
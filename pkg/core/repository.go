@@ -20,5 +20,19 @@ package core
 type HeaderRepository interface {
 	CreateOrUpdateHeader(header Header) (int64, error)
 	GetHeader(blockNumber int64) (Header, error)
+	GetHeaderByHash(hash string) (Header, error)
+	GetHeaderAtOrBeforeTimestamp(timestamp int64) (Header, error)
+	GetHeaderAtOrAfterTimestamp(timestamp int64) (Header, error)
+	GetHeaderClosestToTimestamp(timestamp int64) (Header, error)
+	GetLastBlockNumber() (int64, error)
+	GetHeadersInRange(startingBlockNumber, endingBlockNumber int64) ([]Header, error)
+	GetHeadersInTimeRange(startingTimestamp, endingTimestamp int64, limit int) ([]Header, error)
 	MissingBlockNumbers(startingBlockNumber, endingBlockNumber int64, nodeID string) ([]int64, error)
+	PruneHeaders(blockNumber int64) (int64, error)
+}
+
+// HeaderOutboxRepository holds the header events which have not been published yet
+type HeaderOutboxRepository interface {
+	GetOutboxEvents(limit int) ([]OutboxEvent, error)
+	DeleteOutboxEvents(ids []int64) error
 }
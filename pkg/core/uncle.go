@@ -0,0 +1,31 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+// Uncle is the internal ethereum ommer header type
+// BlockNumber is the uncle's own block number, HeaderID references the header which included it
+type Uncle struct {
+	ID          int64
+	HeaderID    int64 `db:"header_id"`
+	BlockNumber int64 `db:"block_number"`
+	Hash        string
+	Index       int64 `db:"uncle_index"`
+	Miner       string
+	Raw         []byte
+	RLP         []byte `db:"raw_rlp"`
+	Timestamp   string `db:"block_timestamp"`
+}
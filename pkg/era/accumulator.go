@@ -0,0 +1,94 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MaxEraSize is the most blocks an Era1 file holds, the blocks of one epoch
+const MaxEraSize = 8192
+
+// accumulatorDepth is the depth of the merkle tree of MaxEraSize header records
+const accumulatorDepth = 13
+
+// zeroHashes holds the root of an empty merkle tree of each depth
+var zeroHashes = func() [accumulatorDepth + 1][32]byte {
+	var hashes [accumulatorDepth + 1][32]byte
+	for depth := 1; depth <= accumulatorDepth; depth++ {
+		hashes[depth] = hashPair(hashes[depth-1], hashes[depth-1])
+	}
+	return hashes
+}()
+
+// ComputeAccumulator returns the accumulator root of the blocks with the hashes and total difficulties, the SSZ hash
+// tree root of a list, limited to MaxEraSize, of header records holding a block hash and its total difficulty
+func ComputeAccumulator(hashes []common.Hash, totalDifficulties []*big.Int) (common.Hash, error) {
+	if len(hashes) != len(totalDifficulties) {
+		return common.Hash{}, fmt.Errorf("%d hashes for %d total difficulties", len(hashes), len(totalDifficulties))
+	}
+	if len(hashes) > MaxEraSize {
+		return common.Hash{}, fmt.Errorf("%d blocks exceed the %d blocks of an epoch", len(hashes), MaxEraSize)
+	}
+	layer := make([][32]byte, len(hashes))
+	for i, hash := range hashes {
+		td, err := uint256LittleEndian(totalDifficulties[i])
+		if err != nil {
+			return common.Hash{}, err
+		}
+		layer[i] = hashPair(hash, td)
+	}
+	for depth := 0; depth < accumulatorDepth; depth++ {
+		if len(layer)%2 == 1 {
+			layer = append(layer, zeroHashes[depth])
+		}
+		next := make([][32]byte, len(layer)/2)
+		for i := range next {
+			next[i] = hashPair(layer[2*i], layer[2*i+1])
+		}
+		layer = next
+	}
+	root := zeroHashes[accumulatorDepth]
+	if len(layer) > 0 {
+		root = layer[0]
+	}
+	var length [32]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(hashes)))
+	return hashPair(root, length), nil
+}
+
+// uint256LittleEndian encodes the value as an SSZ uint256
+func uint256LittleEndian(value *big.Int) ([32]byte, error) {
+	var encoded [32]byte
+	if value == nil || value.Sign() < 0 || value.BitLen() > 256 {
+		return encoded, fmt.Errorf("total difficulty %v is not a uint256", value)
+	}
+	bigEndian := value.Bytes()
+	for i, b := range bigEndian {
+		encoded[len(bigEndian)-1-i] = b
+	}
+	return encoded, nil
+}
+
+func hashPair(left, right [32]byte) [32]byte {
+	return sha256.Sum256(append(left[:], right[:]...))
+}
@@ -0,0 +1,92 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package era_test
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/era"
+)
+
+// naiveAccumulator hashes the full tree of MaxEraSize leaves, padding the records with zero leaves
+func naiveAccumulator(hashes []common.Hash, totalDifficulties []*big.Int) common.Hash {
+	layer := make([][32]byte, era.MaxEraSize)
+	for i, hash := range hashes {
+		var td [32]byte
+		bigEndian := totalDifficulties[i].Bytes()
+		for j, b := range bigEndian {
+			td[len(bigEndian)-1-j] = b
+		}
+		layer[i] = sha256.Sum256(append(hash.Bytes(), td[:]...))
+	}
+	for len(layer) > 1 {
+		next := make([][32]byte, len(layer)/2)
+		for i := range next {
+			next[i] = sha256.Sum256(append(layer[2*i][:], layer[2*i+1][:]...))
+		}
+		layer = next
+	}
+	var length [32]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(hashes)))
+	return sha256.Sum256(append(layer[0][:], length[:]...))
+}
+
+var _ = Describe("Accumulator", func() {
+	records := func(count int) ([]common.Hash, []*big.Int) {
+		hashes := make([]common.Hash, count)
+		totalDifficulties := make([]*big.Int, count)
+		for i := range hashes {
+			hashes[i] = common.BigToHash(big.NewInt(int64(i + 1000)))
+			totalDifficulties[i] = new(big.Int).Mul(big.NewInt(int64(i+1)), big.NewInt(17179869184))
+		}
+		return hashes, totalDifficulties
+	}
+
+	It("is the hash tree root of the header records", func() {
+		for _, count := range []int{0, 1, 3, 1000, era.MaxEraSize} {
+			hashes, totalDifficulties := records(count)
+
+			root, err := era.ComputeAccumulator(hashes, totalDifficulties)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(root).To(Equal(naiveAccumulator(hashes, totalDifficulties)), "%d records", count)
+		}
+	})
+
+	It("rejects more records than an epoch has", func() {
+		hashes, totalDifficulties := records(era.MaxEraSize + 1)
+
+		_, err := era.ComputeAccumulator(hashes, totalDifficulties)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects total difficulties which are not uint256", func() {
+		hashes, totalDifficulties := records(2)
+		totalDifficulties[1] = new(big.Int).Lsh(big.NewInt(1), 256)
+
+		_, err := era.ComputeAccumulator(hashes, totalDifficulties)
+
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,99 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+)
+
+// Entry types of the e2store records of an Era1 file
+const (
+	TypeVersion            uint16 = 0x3265
+	TypeCompressedHeader   uint16 = 0x03
+	TypeCompressedBody     uint16 = 0x04
+	TypeCompressedReceipts uint16 = 0x05
+	TypeTotalDifficulty    uint16 = 0x06
+	TypeAccumulator        uint16 = 0x07
+	TypeBlockIndex         uint16 = 0x3266
+)
+
+// entryHeaderSize is the size of an e2store record's header: a 2 byte type, a 4 byte length and 2 reserved bytes,
+// little endian
+const entryHeaderSize = 8
+
+// entry is the position of an e2store record within a file
+type entry struct {
+	Type   uint16
+	offset int64
+	length int64
+}
+
+// next returns the offset of the record following the entry
+func (e entry) next() int64 {
+	return e.offset + entryHeaderSize + e.length
+}
+
+// readEntry reads the header of the e2store record at the offset
+func readEntry(reader io.ReaderAt, offset int64) (entry, error) {
+	header := make([]byte, entryHeaderSize)
+	if _, err := reader.ReadAt(header, offset); err != nil {
+		return entry{}, fmt.Errorf("e2store record at %d: %s", offset, err.Error())
+	}
+	if header[6] != 0 || header[7] != 0 {
+		return entry{}, fmt.Errorf("e2store record at %d: reserved bytes are not zero", offset)
+	}
+	return entry{
+		Type:   binary.LittleEndian.Uint16(header[:2]),
+		offset: offset,
+		length: int64(binary.LittleEndian.Uint32(header[2:6])),
+	}, nil
+}
+
+// readEntryOfType reads the header of the record at the offset, which must be of the type
+func readEntryOfType(reader io.ReaderAt, offset int64, recordType uint16) (entry, error) {
+	e, err := readEntry(reader, offset)
+	if err != nil {
+		return e, err
+	}
+	if e.Type != recordType {
+		return e, fmt.Errorf("e2store record at %d has type %#x, expected %#x", offset, e.Type, recordType)
+	}
+	return e, nil
+}
+
+// data reads the record's data
+func (e entry) data(reader io.ReaderAt) ([]byte, error) {
+	data := make([]byte, e.length)
+	if _, err := reader.ReadAt(data, e.offset+entryHeaderSize); err != nil {
+		return nil, fmt.Errorf("e2store record at %d: %s", e.offset, err.Error())
+	}
+	return data, nil
+}
+
+// decompressed reads the record's data, which is compressed in the snappy framing format
+func (e entry) decompressed(reader io.ReaderAt) ([]byte, error) {
+	data, err := ioutil.ReadAll(snappy.NewReader(io.NewSectionReader(reader, e.offset+entryHeaderSize, e.length)))
+	if err != nil {
+		return nil, fmt.Errorf("e2store record at %d: %s", e.offset, err.Error())
+	}
+	return data, nil
+}
@@ -0,0 +1,289 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+)
+
+var ErrBlockNotInFile = errors.New("block is not in the Era1 file")
+
+// fileNamePattern matches the standard <network>-<epoch>-<first 4 bytes of the accumulator root>.era1 file names
+var fileNamePattern = regexp.MustCompile(`^[a-z0-9-]+-(\d{5})-([0-9a-f]{8})\.era1$`)
+
+// File reads an Era1 file: a version record, a header, body, receipts and total difficulty record for each block of
+// an epoch, the accumulator root of the blocks and an index of the blocks' offsets
+type File struct {
+	path        string
+	file        *os.File
+	start       uint64
+	count       uint64
+	indexOffset int64
+}
+
+// Block is a block read from an Era1 file
+type Block struct {
+	Header *types.Header
+	// RawHeader is the header's encoding in the file, with the fields added after go-ethereum's header type
+	RawHeader       []byte
+	Hash            common.Hash
+	TotalDifficulty *big.Int
+	// Uncles, the encodings of the uncle headers, and TransactionHashes are only read along with the body
+	Uncles            []rlp.RawValue
+	TransactionHashes []common.Hash
+}
+
+// Open opens the Era1 file, reading the range of blocks it holds from its block index
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	era, err := readMetadata(path, file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return era, nil
+}
+
+func readMetadata(path string, file *os.File) (*File, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readEntryOfType(file, 0, TypeVersion); err != nil {
+		return nil, err
+	}
+	// The block index record ends the file: a start block number, an offset per block and the block count
+	buffer := make([]byte, 8)
+	if _, err := file.ReadAt(buffer, stat.Size()-8); err != nil {
+		return nil, err
+	}
+	count := binary.LittleEndian.Uint64(buffer)
+	if count == 0 || count > MaxEraSize {
+		return nil, fmt.Errorf("block index has %d blocks, expected 1 to %d", count, MaxEraSize)
+	}
+	indexOffset := stat.Size() - entryHeaderSize - 16 - int64(count)*8
+	index, err := readEntryOfType(file, indexOffset, TypeBlockIndex)
+	if err != nil {
+		return nil, err
+	}
+	if index.length != 16+int64(count)*8 {
+		return nil, fmt.Errorf("block index of %d bytes for %d blocks", index.length, count)
+	}
+	if _, err := file.ReadAt(buffer, indexOffset+entryHeaderSize); err != nil {
+		return nil, err
+	}
+	return &File{
+		path:        path,
+		file:        file,
+		start:       binary.LittleEndian.Uint64(buffer),
+		count:       count,
+		indexOffset: indexOffset,
+	}, nil
+}
+
+// Path returns the path the file was opened from
+func (file *File) Path() string {
+	return file.path
+}
+
+// Start returns the number of the first block of the file
+func (file *File) Start() uint64 {
+	return file.start
+}
+
+// Count returns the number of blocks in the file
+func (file *File) Count() uint64 {
+	return file.count
+}
+
+// Contains returns whether the file holds the block number
+func (file *File) Contains(number uint64) bool {
+	return number >= file.start && number < file.start+file.count
+}
+
+// Accumulator returns the accumulator root stored in the file, which precedes the block index
+func (file *File) Accumulator() (common.Hash, error) {
+	accumulator, err := readEntryOfType(file.file, file.indexOffset-entryHeaderSize-common.HashLength, TypeAccumulator)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	data, err := accumulator.data(file.file)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(data), nil
+}
+
+// ReadBlock reads the block's header and total difficulty, and with withBody set its uncles and transaction hashes
+// The body is checked against the uncle hash and transaction root of the header, which the accumulator commits to
+func (file *File) ReadBlock(number uint64, withBody bool) (Block, error) {
+	if !file.Contains(number) {
+		return Block{}, ErrBlockNotInFile
+	}
+	buffer := make([]byte, 8)
+	if _, err := file.file.ReadAt(buffer, file.indexOffset+entryHeaderSize+8+int64(number-file.start)*8); err != nil {
+		return Block{}, err
+	}
+	// Block offsets are relative to the start of the block index record
+	offset := file.indexOffset + int64(binary.LittleEndian.Uint64(buffer))
+
+	headerEntry, err := readEntryOfType(file.file, offset, TypeCompressedHeader)
+	if err != nil {
+		return Block{}, err
+	}
+	rawHeader, err := headerEntry.decompressed(file.file)
+	if err != nil {
+		return Block{}, err
+	}
+	block := Block{RawHeader: rawHeader, Hash: crypto.Keccak256Hash(rawHeader)}
+	if block.Header, _, err = converter.DecodeHeaderRLP(rawHeader); err != nil {
+		return Block{}, fmt.Errorf("block %d: %s", number, err.Error())
+	}
+	if block.Header.Number.Uint64() != number {
+		return Block{}, fmt.Errorf("block %d: index points at block %d", number, block.Header.Number.Uint64())
+	}
+
+	bodyEntry, err := readEntryOfType(file.file, headerEntry.next(), TypeCompressedBody)
+	if err != nil {
+		return Block{}, err
+	}
+	if withBody {
+		rawBody, err := bodyEntry.decompressed(file.file)
+		if err != nil {
+			return Block{}, err
+		}
+		if err := converter.VerifyBodyRLP(rawBody, block.Header); err != nil {
+			return Block{}, fmt.Errorf("block %d: %w", number, err)
+		}
+		if block.Uncles, block.TransactionHashes, err = converter.DecodeBodyRLP(rawBody); err != nil {
+			return Block{}, fmt.Errorf("block %d: %s", number, err.Error())
+		}
+	}
+	receiptsEntry, err := readEntryOfType(file.file, bodyEntry.next(), TypeCompressedReceipts)
+	if err != nil {
+		return Block{}, err
+	}
+	tdEntry, err := readEntryOfType(file.file, receiptsEntry.next(), TypeTotalDifficulty)
+	if err != nil {
+		return Block{}, err
+	}
+	td, err := tdEntry.data(file.file)
+	if err != nil {
+		return Block{}, err
+	}
+	if len(td) != 32 {
+		return Block{}, fmt.Errorf("block %d: total difficulty of %d bytes, expected 32", number, len(td))
+	}
+	// The total difficulty is a little endian uint256
+	for i, j := 0, len(td)-1; i < j; i, j = i+1, j-1 {
+		td[i], td[j] = td[j], td[i]
+	}
+	block.TotalDifficulty = new(big.Int).SetBytes(td)
+	return block, nil
+}
+
+// Verify checks that the blocks of the file form a chain and that their accumulator root matches the one stored in the
+// file and, for a standard file name, the epoch and root prefix of the name, and returns the root
+// Each block must be the parent of the next one, with its total difficulty growing by the next one's difficulty
+// A file passing Verify is consistent, VerifyAccumulator also checks that it holds the network's blocks
+func (file *File) Verify() (common.Hash, error) {
+	hashes := make([]common.Hash, file.count)
+	totalDifficulties := make([]*big.Int, file.count)
+	var previous Block
+	for i := uint64(0); i < file.count; i++ {
+		block, err := file.ReadBlock(file.start+i, false)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if i > 0 {
+			if block.Header.ParentHash != previous.Hash {
+				return common.Hash{}, fmt.Errorf("block %d: parent hash %s does not match the previous block's hash %s",
+					file.start+i, block.Header.ParentHash.Hex(), previous.Hash.Hex())
+			}
+			if new(big.Int).Add(previous.TotalDifficulty, block.Header.Difficulty).Cmp(block.TotalDifficulty) != 0 {
+				return common.Hash{}, fmt.Errorf("block %d: total difficulty %s is not the previous one plus the block's difficulty",
+					file.start+i, block.TotalDifficulty.String())
+			}
+		}
+		hashes[i], totalDifficulties[i] = block.Hash, block.TotalDifficulty
+		previous = block
+	}
+
+	root, err := ComputeAccumulator(hashes, totalDifficulties)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	stored, err := file.Accumulator()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if root != stored {
+		return common.Hash{}, fmt.Errorf("accumulator root %s of the blocks does not match the stored root %s", root.Hex(), stored.Hex())
+	}
+	if match := fileNamePattern.FindStringSubmatch(filepath.Base(file.path)); match != nil {
+		epoch, _ := strconv.ParseUint(match[1], 10, 64)
+		if epoch != file.start/MaxEraSize {
+			return common.Hash{}, fmt.Errorf("file name is for epoch %d but the file starts at block %d", epoch, file.start)
+		}
+		if match[2] != common.Bytes2Hex(root[:4]) {
+			return common.Hash{}, fmt.Errorf("file name does not match the accumulator root %s", root.Hex())
+		}
+	}
+	return root, nil
+}
+
+// VerifyAccumulator verifies the file and checks its accumulator root against the trusted root of its epoch, such as
+// the published root of a network's pre-Merge epoch, and returns the root
+// The root stored in the file and its name are written by whoever wrote the file, so only the trusted root
+// establishes that its blocks are those of the network
+func (file *File) VerifyAccumulator(accumulators []common.Hash) (common.Hash, error) {
+	epoch := file.start / MaxEraSize
+	if epoch >= uint64(len(accumulators)) {
+		return common.Hash{}, fmt.Errorf("no trusted accumulator root for epoch %d", epoch)
+	}
+	root, err := file.Verify()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if root != accumulators[epoch] {
+		return common.Hash{}, fmt.Errorf("accumulator root %s does not match the trusted root %s of epoch %d",
+			root.Hex(), accumulators[epoch].Hex(), epoch)
+	}
+	return root, nil
+}
+
+// Close closes the file
+func (file *File) Close() error {
+	return file.file.Close()
+}
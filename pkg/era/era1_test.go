@@ -0,0 +1,404 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package era_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/golang/snappy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/era"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+// eraBlock is a block as written to an Era1 file
+type eraBlock struct {
+	header []byte
+	body   []byte
+	td     *big.Int
+}
+
+// chainBlocks returns the blocks of the chain between the block numbers (inclusive) with their bodies
+func chainBlocks(chain *simulated.Chain, from, to int64) []eraBlock {
+	td := big.NewInt(0)
+	for number := int64(0); number < from; number++ {
+		td.Add(td, chain.Header(number).Difficulty)
+	}
+	var blocks []eraBlock
+	for number := from; number <= to; number++ {
+		header, err := rlp.EncodeToBytes(chain.Header(number))
+		Expect(err).NotTo(HaveOccurred())
+		body, err := rlp.EncodeToBytes(&types.Body{Transactions: chain.Transactions(number), Uncles: chain.Uncles(number)})
+		Expect(err).NotTo(HaveOccurred())
+		td = new(big.Int).Add(td, chain.Header(number).Difficulty)
+		blocks = append(blocks, eraBlock{header: header, body: body, td: td})
+	}
+	return blocks
+}
+
+// accumulatorOf computes the accumulator root of the blocks
+func accumulatorOf(blocks []eraBlock) common.Hash {
+	hashes := make([]common.Hash, len(blocks))
+	totalDifficulties := make([]*big.Int, len(blocks))
+	for i, block := range blocks {
+		hashes[i] = crypto.Keccak256Hash(block.header)
+		totalDifficulties[i] = block.td
+	}
+	root, err := era.ComputeAccumulator(hashes, totalDifficulties)
+	Expect(err).NotTo(HaveOccurred())
+	return root
+}
+
+func writeRecord(buffer *bytes.Buffer, recordType uint16, data []byte) {
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint16(header[:2], recordType)
+	binary.LittleEndian.PutUint32(header[2:6], uint32(len(data)))
+	buffer.Write(header)
+	buffer.Write(data)
+}
+
+func compress(data []byte) []byte {
+	var compressed bytes.Buffer
+	writer := snappy.NewBufferedWriter(&compressed)
+	_, err := writer.Write(data)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(writer.Close()).To(Succeed())
+	return compressed.Bytes()
+}
+
+// writeEra1 writes the blocks to an Era1 file with the accumulator root
+func writeEra1(path string, blocks []eraBlock, root common.Hash) {
+	var buffer bytes.Buffer
+	writeRecord(&buffer, era.TypeVersion, nil)
+	offsets := make([]int64, len(blocks))
+	for i, block := range blocks {
+		offsets[i] = int64(buffer.Len())
+		writeRecord(&buffer, era.TypeCompressedHeader, compress(block.header))
+		writeRecord(&buffer, era.TypeCompressedBody, compress(block.body))
+		writeRecord(&buffer, era.TypeCompressedReceipts, compress([]byte{0xc0}))
+		td := make([]byte, 32)
+		bigEndian := block.td.Bytes()
+		for j, b := range bigEndian {
+			td[len(bigEndian)-1-j] = b
+		}
+		writeRecord(&buffer, era.TypeTotalDifficulty, td)
+	}
+	writeRecord(&buffer, era.TypeAccumulator, root.Bytes())
+
+	indexOffset := int64(buffer.Len())
+	index := make([]byte, 16+8*len(blocks))
+	header := new(types.Header)
+	Expect(rlp.DecodeBytes(blocks[0].header, header)).To(Succeed())
+	binary.LittleEndian.PutUint64(index[:8], header.Number.Uint64())
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint64(index[8+8*i:], uint64(offset-indexOffset))
+	}
+	binary.LittleEndian.PutUint64(index[len(index)-8:], uint64(len(blocks)))
+	writeRecord(&buffer, era.TypeBlockIndex, index)
+	Expect(ioutil.WriteFile(path, buffer.Bytes(), 0644)).To(Succeed())
+}
+
+var _ = Describe("Era1 file", func() {
+	var (
+		dir    string
+		chain  *simulated.Chain
+		blocks []eraBlock
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "era")
+		Expect(err).NotTo(HaveOccurred())
+		chain = simulated.NewChain(20)
+		blocks = chainBlocks(chain, 0, 9)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	open := func(name string, blocks []eraBlock, root common.Hash) *era.File {
+		path := filepath.Join(dir, name)
+		writeEra1(path, blocks, root)
+		file, err := era.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		return file
+	}
+
+	It("reads the blocks and their total difficulties through the block index", func() {
+		file := open("blocks.era1", blocks, accumulatorOf(blocks))
+		defer file.Close()
+
+		Expect(file.Start()).To(Equal(uint64(0)))
+		Expect(file.Count()).To(Equal(uint64(10)))
+		for number := uint64(0); number < 10; number++ {
+			block, err := file.ReadBlock(number, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(block.Hash).To(Equal(chain.Header(int64(number)).Hash()))
+			Expect(block.Header.Hash()).To(Equal(block.Hash))
+			Expect(block.TotalDifficulty).To(Equal(blocks[number].td))
+		}
+		_, err := file.ReadBlock(10, false)
+		Expect(err).To(Equal(era.ErrBlockNotInFile))
+	})
+
+	It("reads files which start after genesis", func() {
+		later := chainBlocks(chain, 12, 20)
+		file := open("later.era1", later, accumulatorOf(later))
+		defer file.Close()
+
+		block, err := file.ReadBlock(15, false)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block.Hash).To(Equal(chain.Header(15).Hash()))
+		Expect(file.Verify()).To(Equal(accumulatorOf(later)))
+	})
+
+	It("reads the uncles and transaction hashes of the body", func() {
+		legacy := types.NewTransaction(1, common.HexToAddress("0x1"), big.NewInt(1), 21000, big.NewInt(1), nil)
+		legacyRLP, err := rlp.EncodeToBytes(legacy)
+		Expect(err).NotTo(HaveOccurred())
+		typed := append([]byte{0x02}, legacyRLP...)
+		typedRLP, err := rlp.EncodeToBytes(typed)
+		Expect(err).NotTo(HaveOccurred())
+		uncleRLP, err := rlp.EncodeToBytes(chain.Header(2))
+		Expect(err).NotTo(HaveOccurred())
+		blocks[3].body, err = rlp.EncodeToBytes([]interface{}{
+			[]rlp.RawValue{legacyRLP, typedRLP},
+			[]rlp.RawValue{uncleRLP},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		// The transaction trie holds typed transactions by their type and transaction, not their body encoding
+		transactions := new(trie.Trie)
+		for i, transaction := range [][]byte{legacyRLP, typed} {
+			key, err := rlp.EncodeToBytes(uint(i))
+			Expect(err).NotTo(HaveOccurred())
+			transactions.Update(key, transaction)
+		}
+		header := chain.Header(3)
+		header.TxHash = transactions.Hash()
+		header.UncleHash = types.CalcUncleHash([]*types.Header{chain.Header(2)})
+		blocks[3].header, err = rlp.EncodeToBytes(header)
+		Expect(err).NotTo(HaveOccurred())
+		file := open("bodies.era1", blocks, accumulatorOf(blocks))
+		defer file.Close()
+
+		block, err := file.ReadBlock(3, true)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block.TransactionHashes).To(Equal([]common.Hash{legacy.Hash(), crypto.Keccak256Hash(typed)}))
+		Expect(block.Uncles).To(Equal([]rlp.RawValue{uncleRLP}))
+	})
+
+	It("rejects bodies which do not match the uncle hash and transaction root of their header", func() {
+		// Blocks 4 and 5 have a transaction and an uncle, and two transactions and no uncle
+		swapped := blocks[4].body
+		blocks[4].body = blocks[5].body
+		blocks[5].body = swapped
+		withoutUncles, err := rlp.EncodeToBytes(&types.Body{Transactions: chain.Transactions(4)})
+		Expect(err).NotTo(HaveOccurred())
+		blocks[6].body = withoutUncles
+		file := open("tampered.era1", blocks, accumulatorOf(blocks))
+		defer file.Close()
+
+		_, err = file.ReadBlock(4, true)
+		Expect(errors.Is(err, converter.ErrBodyMismatch)).To(BeTrue())
+		_, err = file.ReadBlock(5, true)
+		Expect(errors.Is(err, converter.ErrBodyMismatch)).To(BeTrue())
+		_, err = file.ReadBlock(6, true)
+		Expect(errors.Is(err, converter.ErrBodyMismatch)).To(BeTrue())
+		block, err := file.ReadBlock(4, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block.Hash).To(Equal(chain.Header(4).Hash()))
+		block, err = file.ReadBlock(8, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block.Uncles).To(HaveLen(1))
+		Expect(block.TransactionHashes).To(Equal([]common.Hash{chain.Transactions(8)[0].Hash(), chain.Transactions(8)[1].Hash()}))
+	})
+
+	It("hashes headers with fields added by later forks from their encoding", func() {
+		header := chain.Header(9)
+		londonHeader, err := rlp.EncodeToBytes([]interface{}{
+			header.ParentHash, header.UncleHash, header.Coinbase, header.Root, header.TxHash, header.ReceiptHash,
+			header.Bloom, header.Difficulty, header.Number, header.GasLimit, header.GasUsed, header.Time, header.Extra,
+			header.MixDigest, header.Nonce, big.NewInt(1000000000),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		blocks[9].header = londonHeader
+		file := open("london.era1", blocks, accumulatorOf(blocks))
+		defer file.Close()
+
+		block, err := file.ReadBlock(9, false)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block.Hash).To(Equal(crypto.Keccak256Hash(londonHeader)))
+		Expect(block.RawHeader).To(Equal(londonHeader))
+		Expect(block.Header.Number.Int64()).To(Equal(int64(9)))
+		Expect(block.Header.ParentHash).To(Equal(header.ParentHash))
+		_, err = file.Verify()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("Verify", func() {
+		It("returns the accumulator root of a valid file", func() {
+			root := accumulatorOf(blocks)
+			file := open("blocks.era1", blocks, root)
+			defer file.Close()
+
+			Expect(file.Verify()).To(Equal(root))
+		})
+
+		It("checks the epoch and root prefix of standard file names", func() {
+			root := accumulatorOf(blocks)
+			valid := open("mainnet-00000-"+common.Bytes2Hex(root[:4])+".era1", blocks, root)
+			defer valid.Close()
+			wrongRoot := open("mainnet-00000-00000000.era1", blocks, root)
+			defer wrongRoot.Close()
+			wrongEpoch := open("mainnet-00001-"+common.Bytes2Hex(root[:4])+".era1", blocks, root)
+			defer wrongEpoch.Close()
+
+			Expect(valid.Verify()).To(Equal(root))
+			_, err := wrongRoot.Verify()
+			Expect(err).To(MatchError(ContainSubstring("file name does not match")))
+			_, err = wrongEpoch.Verify()
+			Expect(err).To(MatchError(ContainSubstring("epoch 1")))
+		})
+
+		It("rejects a stored accumulator root which does not match the blocks", func() {
+			file := open("blocks.era1", blocks, accumulatorOf(blocks[:9]))
+			defer file.Close()
+
+			_, err := file.Verify()
+
+			Expect(err).To(MatchError(ContainSubstring("does not match the stored root")))
+		})
+
+		It("rejects blocks which do not form a chain", func() {
+			fork := simulated.NewChain(20)
+			Expect(fork.Reorg(15, 15)).To(Succeed())
+			forked, err := rlp.EncodeToBytes(fork.Header(7))
+			Expect(err).NotTo(HaveOccurred())
+			blocks[7].header = forked
+			file := open("blocks.era1", blocks, accumulatorOf(blocks))
+			defer file.Close()
+
+			_, err = file.Verify()
+
+			Expect(err).To(MatchError(ContainSubstring("block 7: parent hash")))
+		})
+
+		It("rejects total difficulties which do not add up", func() {
+			blocks[5].td = new(big.Int).Add(blocks[5].td, big.NewInt(1))
+			file := open("blocks.era1", blocks, accumulatorOf(blocks))
+			defer file.Close()
+
+			_, err := file.Verify()
+
+			Expect(err).To(MatchError(ContainSubstring("block 5: total difficulty")))
+		})
+	})
+
+	Describe("VerifyAccumulator", func() {
+		It("returns the root of a file matching the trusted root of its epoch", func() {
+			root := accumulatorOf(blocks)
+			file := open("blocks.era1", blocks, root)
+			defer file.Close()
+
+			Expect(file.VerifyAccumulator([]common.Hash{root})).To(Equal(root))
+		})
+
+		It("rejects a consistent file of other blocks", func() {
+			fork := simulated.NewChain(20)
+			Expect(fork.Reorg(15, 15)).To(Succeed())
+			forged := chainBlocks(fork, 0, 9)
+			root := accumulatorOf(forged)
+			file := open("mainnet-00000-"+common.Bytes2Hex(root[:4])+".era1", forged, root)
+			defer file.Close()
+			Expect(file.Verify()).To(Equal(root))
+
+			_, err := file.VerifyAccumulator([]common.Hash{accumulatorOf(blocks)})
+
+			Expect(err).To(MatchError(ContainSubstring("does not match the trusted root")))
+		})
+
+		It("rejects a file of an epoch without a trusted root", func() {
+			file := open("blocks.era1", blocks, accumulatorOf(blocks))
+			defer file.Close()
+
+			_, err := file.VerifyAccumulator(nil)
+
+			Expect(err).To(MatchError("no trusted accumulator root for epoch 0"))
+		})
+	})
+
+	Describe("a Sepolia epoch", func() {
+		// The first Era1 file of Sepolia as published, whose blocks carry the base fee from genesis on
+		const sepoliaEpoch0 = "testdata/sepolia-00000-643a00f7.era1"
+		sepoliaRoot := common.HexToHash("0x643a00f78fd6a304a29c80b2f2f946e9e57494597600262b378b2754d34dff41")
+		sepoliaGenesis := common.HexToHash("0x25a5cc106eea7138acab33231d7160d69cb777ee0c2c553fcddf5138993e6dd9")
+
+		It("verifies against the published accumulator root", func() {
+			file, err := era.Open(sepoliaEpoch0)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+
+			Expect(file.Count()).To(Equal(uint64(era.MaxEraSize)))
+			Expect(file.VerifyAccumulator([]common.Hash{sepoliaRoot})).To(Equal(sepoliaRoot))
+		})
+
+		It("keeps the encoding of headers with a base fee", func() {
+			file, err := era.Open(sepoliaEpoch0)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+
+			genesis, err := file.ReadBlock(0, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(genesis.Hash).To(Equal(sepoliaGenesis))
+			Expect(genesis.Header.Hash()).NotTo(Equal(sepoliaGenesis))
+			block, err := file.ReadBlock(1, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(crypto.Keccak256Hash(block.RawHeader)).To(Equal(block.Hash))
+			Expect(block.Header.ParentHash).To(Equal(sepoliaGenesis))
+			_, extensions, err := converter.DecodeHeaderRLP(block.RawHeader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extensions).To(HaveLen(1))
+		})
+	})
+
+	It("rejects files which are not Era1 files", func() {
+		path := filepath.Join(dir, "headers.era1")
+		Expect(ioutil.WriteFile(path, []byte("not an era1 file at all"), 0644)).To(Succeed())
+
+		_, err := era.Open(path)
+
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,195 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+var ErrNotCovered = errors.New("block is not covered by the Era1 files and there is no fallback fetcher")
+
+// MaxBatchSize is the most headers read from the Era1 files by a call to GetHeadersByNumbers
+const MaxBatchSize = 1000
+
+// Fetcher satisfies the core.Fetcher interface by reading the headers covered by Era1 files from them, and the rest
+// from a fallback fetcher, if any
+// Headers keep their encoding in the file, so those from the London fork on keep their base fee and hash to their hash
+type Fetcher struct {
+	store           *Store
+	fallback        core.Fetcher
+	headerConverter converter.HeaderConverter
+	node            core.Node
+	fetchUncles     bool
+	fetchTxHashes   bool
+}
+
+// NewFetcher returns a Fetcher reading from the store, and the blocks it does not cover from the fallback
+// The fallback may be nil, for a Fetcher which only reads from the store
+func NewFetcher(store *Store, fallback core.Fetcher, node core.Node) *Fetcher {
+	return &Fetcher{
+		store:           store,
+		fallback:        fallback,
+		headerConverter: converter.HeaderConverter{},
+		node:            node,
+	}
+}
+
+// GetHeaderByNumber reads the header of the block number from the Era1 files, or fetches it from the fallback
+func (fetcher *Fetcher) GetHeaderByNumber(blockNumber int64) (core.Header, error) {
+	if blockNumber >= 0 && fetcher.store.Covers(uint64(blockNumber)) {
+		return fetcher.readHeader(uint64(blockNumber))
+	}
+	if fetcher.fallback == nil {
+		return core.Header{}, ErrNotCovered
+	}
+	return fetcher.fallback.GetHeaderByNumber(blockNumber)
+}
+
+// GetHeadersByNumbers reads the headers of up to MaxBatchSize block numbers covered by the Era1 files, or if none are
+// covered fetches the headers from the fallback
+func (fetcher *Fetcher) GetHeadersByNumbers(blockNumbers []int64) ([]core.Header, error) {
+	logrus.Debug("GetHeadersByNumbers called")
+	var headers []core.Header
+	var uncovered []int64
+	for _, blockNumber := range blockNumbers {
+		if blockNumber < 0 || !fetcher.store.Covers(uint64(blockNumber)) {
+			uncovered = append(uncovered, blockNumber)
+			continue
+		}
+		if len(headers) == MaxBatchSize {
+			continue
+		}
+		header, err := fetcher.readHeader(uint64(blockNumber))
+		if err != nil {
+			return headers, err
+		}
+		headers = append(headers, header)
+	}
+	if len(headers) > 0 || len(uncovered) == 0 || fetcher.fallback == nil {
+		return headers, nil
+	}
+	return fetcher.fallback.GetHeadersByNumbers(uncovered)
+}
+
+// LastBlock returns the head of the fallback's chain, or the last block of the Era1 files if it is higher or there is
+// no fallback
+func (fetcher *Fetcher) LastBlock() (*big.Int, error) {
+	lastBlock := big.NewInt(0)
+	if last, ok := fetcher.store.LastBlock(); ok {
+		lastBlock.SetUint64(last)
+	}
+	if fetcher.fallback == nil {
+		return lastBlock, nil
+	}
+	fallbackBlock, err := fetcher.fallback.LastBlock()
+	if err != nil {
+		return lastBlock, err
+	}
+	if fallbackBlock.Cmp(lastBlock) > 0 {
+		return fallbackBlock, nil
+	}
+	return lastBlock, nil
+}
+
+// SetRawEncoding sets which raw encodings are produced for the headers read from the Era1 files
+func (fetcher *Fetcher) SetRawEncoding(encoding converter.RawEncoding) {
+	fetcher.headerConverter.Encoding = encoding
+}
+
+// SetFetchUncles sets whether the uncles included by each header are read from its block body alongside it
+func (fetcher *Fetcher) SetFetchUncles(fetchUncles bool) {
+	fetcher.fetchUncles = fetchUncles
+}
+
+// SetFetchTransactionHashes sets whether the transaction hashes of each block are read from its body alongside its header
+func (fetcher *Fetcher) SetFetchTransactionHashes(fetchTxHashes bool) {
+	fetcher.fetchTxHashes = fetchTxHashes
+}
+
+// Node returns the node info associated with this Fetcher
+func (fetcher *Fetcher) Node() core.Node {
+	return fetcher.node
+}
+
+func (fetcher *Fetcher) readHeader(number uint64) (core.Header, error) {
+	block, err := fetcher.store.ReadBlock(number, fetcher.fetchUncles || fetcher.fetchTxHashes)
+	if err != nil {
+		return core.Header{}, err
+	}
+	header, err := fetcher.headerConverter.ConvertRLP(block.RawHeader)
+	if err != nil {
+		return core.Header{}, err
+	}
+	if fetcher.fetchUncles {
+		for index, rawUncle := range block.Uncles {
+			uncle, err := fetcher.headerConverter.ConvertUncleRLP(rawUncle, index)
+			if err != nil {
+				return core.Header{}, fmt.Errorf("block %d: uncle %d: %s", number, index, err.Error())
+			}
+			header.Uncles = append(header.Uncles, uncle)
+		}
+	}
+	if fetcher.fetchTxHashes {
+		header.TransactionHashes = make([]string, len(block.TransactionHashes))
+		for i, hash := range block.TransactionHashes {
+			header.TransactionHashes[i] = hash.Hex()
+		}
+	}
+	return header, nil
+}
+
+// Source yields the headers of an Era1 file for the importer, verifying the file against the trusted accumulator
+// root of its epoch before the first one
+type Source struct {
+	file         *File
+	accumulators []common.Hash
+	next         uint64
+	verified     bool
+}
+
+// NewSource returns a Source reading the headers of the file, with the trusted accumulator roots of the epochs
+func NewSource(file *File, accumulators []common.Hash) *Source {
+	return &Source{file: file, accumulators: accumulators, next: file.Start()}
+}
+
+// Next returns the next header of the file, keeping its encoding, with its hash
+func (source *Source) Next() (core.Header, error) {
+	if !source.verified {
+		if _, err := source.file.VerifyAccumulator(source.accumulators); err != nil {
+			return core.Header{}, fmt.Errorf("%s: %s", source.file.Path(), err.Error())
+		}
+		source.verified = true
+	}
+	if !source.file.Contains(source.next) {
+		return core.Header{}, io.EOF
+	}
+	block, err := source.file.ReadBlock(source.next, false)
+	if err != nil {
+		return core.Header{}, err
+	}
+	source.next++
+	return converter.HeaderConverter{Encoding: converter.JSONAndRLP}.ConvertRLP(block.RawHeader)
+}
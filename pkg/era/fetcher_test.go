@@ -0,0 +1,269 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package era_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/era"
+	"github.com/vulcanize/eth-header-sync/pkg/fetcher"
+	"github.com/vulcanize/eth-header-sync/pkg/history"
+	"github.com/vulcanize/eth-header-sync/pkg/importer"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+var _ = Describe("Era1 store and fetcher", func() {
+	var (
+		dir          string
+		chain        *simulated.Chain
+		accumulators []common.Hash
+		node         = core.Node{ID: "fingerprint"}
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "era")
+		Expect(err).NotTo(HaveOccurred())
+		chain = simulated.NewChain(30)
+		blocks := chainBlocks(chain, 0, 19)
+		writeEra1(filepath.Join(dir, "blocks.era1"), blocks, accumulatorOf(blocks))
+		accumulators = []common.Hash{accumulatorOf(blocks)}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	openStore := func() *era.Store {
+		store, err := era.OpenStore(dir, accumulators)
+		Expect(err).NotTo(HaveOccurred())
+		return store
+	}
+
+	expectHeader := func(header core.Header, number int64) {
+		Expect(header.BlockNumber).To(Equal(number))
+		Expect(header.Hash).To(Equal(chain.Header(number).Hash().Hex()))
+	}
+
+	// forge replaces the file with a consistent file of the blocks of a fork, with their own root
+	forge := func() {
+		fork := simulated.NewChain(30)
+		Expect(fork.Reorg(20, 20)).To(Succeed())
+		forged := chainBlocks(fork, 0, 19)
+		writeEra1(filepath.Join(dir, "blocks.era1"), forged, accumulatorOf(forged))
+	}
+
+	It("covers the blocks of the files", func() {
+		store := openStore()
+		defer store.Close()
+
+		Expect(store.Files()).To(HaveLen(1))
+		Expect(store.Covers(0)).To(BeTrue())
+		Expect(store.Covers(19)).To(BeTrue())
+		Expect(store.Covers(20)).To(BeFalse())
+		last, ok := store.LastBlock()
+		Expect(ok).To(BeTrue())
+		Expect(last).To(Equal(uint64(19)))
+	})
+
+	It("rejects overlapping files", func() {
+		overlapping := chainBlocks(chain, 5, 12)
+		writeEra1(filepath.Join(dir, "overlapping.era1"), overlapping, accumulatorOf(overlapping))
+
+		_, err := era.OpenStore(dir, accumulators)
+
+		Expect(err).To(MatchError(ContainSubstring("overlap")))
+	})
+
+	It("requires a trusted accumulator root for the epoch of each file", func() {
+		_, err := era.OpenStore(dir, nil)
+
+		Expect(err).To(MatchError(ContainSubstring("no trusted accumulator root for epoch 0")))
+	})
+
+	It("reads the trusted roots of the epochs", func() {
+		roots, err := era.ReadAccumulators(strings.NewReader("\n" + accumulators[0].Hex() + "\n"))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(roots).To(Equal(accumulators))
+	})
+
+	It("does not read blocks from a file which does not match the trusted root", func() {
+		forge()
+		store := openStore()
+		defer store.Close()
+
+		_, err := store.ReadBlock(3, false)
+
+		Expect(err).To(MatchError(ContainSubstring("does not match the trusted root")))
+	})
+
+	It("reads the covered headers and falls back for the rest", func() {
+		store := openStore()
+		defer store.Close()
+		eraFetcher := era.NewFetcher(store, fetcher.NewFetcher(chain, chain, node), node)
+		repo := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), node.ID)
+
+		lastBlock, err := eraFetcher.LastBlock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastBlock.Int64()).To(Equal(int64(30)))
+		for {
+			populated, err := history.PopulateMissingHeaders(eraFetcher, repo, 0, nil)
+			Expect(err).NotTo(HaveOccurred())
+			if populated == 0 {
+				break
+			}
+		}
+
+		for number := int64(0); number <= 30; number++ {
+			header, err := repo.GetHeader(number)
+			Expect(err).NotTo(HaveOccurred())
+			expectHeader(header, number)
+		}
+		header, err := eraFetcher.GetHeaderByNumber(25)
+		Expect(err).NotTo(HaveOccurred())
+		expectHeader(header, 25)
+	})
+
+	It("only reads the files without a fallback", func() {
+		store := openStore()
+		defer store.Close()
+		eraFetcher := era.NewFetcher(store, nil, node)
+
+		lastBlock, err := eraFetcher.LastBlock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastBlock.Int64()).To(Equal(int64(19)))
+		headers, err := eraFetcher.GetHeadersByNumbers([]int64{5, 18, 25})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(2))
+		expectHeader(headers[0], 5)
+		expectHeader(headers[1], 18)
+		_, err = eraFetcher.GetHeaderByNumber(25)
+		Expect(err).To(Equal(era.ErrNotCovered))
+	})
+
+	It("reads the uncles and transaction hashes of the covered blocks from their bodies", func() {
+		store := openStore()
+		defer store.Close()
+		eraFetcher := era.NewFetcher(store, nil, node)
+		eraFetcher.SetFetchUncles(true)
+		eraFetcher.SetFetchTransactionHashes(true)
+
+		header, err := eraFetcher.GetHeaderByNumber(8)
+
+		Expect(err).NotTo(HaveOccurred())
+		expectHeader(header, 8)
+		Expect(header.Uncles).To(HaveLen(1))
+		Expect(header.Uncles[0].Hash).To(Equal(chain.Uncles(8)[0].Hash().Hex()))
+		Expect(header.TransactionHashes).To(Equal([]string{chain.Transactions(8)[0].Hash().Hex(), chain.Transactions(8)[1].Hash().Hex()}))
+	})
+
+	It("rejects a block whose body does not match its header", func() {
+		// The accumulator only commits to the headers, so a file with another block's body still matches the root
+		blocks := chainBlocks(chain, 0, 19)
+		blocks[5].body = blocks[4].body
+		writeEra1(filepath.Join(dir, "blocks.era1"), blocks, accumulatorOf(blocks))
+		store := openStore()
+		defer store.Close()
+		eraFetcher := era.NewFetcher(store, nil, node)
+
+		header, err := eraFetcher.GetHeaderByNumber(5)
+		Expect(err).NotTo(HaveOccurred())
+		expectHeader(header, 5)
+
+		eraFetcher.SetFetchTransactionHashes(true)
+		_, err = eraFetcher.GetHeaderByNumber(5)
+		Expect(errors.Is(err, converter.ErrBodyMismatch)).To(BeTrue())
+	})
+
+	It("stores the headers of a Sepolia epoch with their encoding", func() {
+		sepoliaDir, err := ioutil.TempDir("", "era")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(sepoliaDir)
+		sepolia, err := ioutil.ReadFile("testdata/sepolia-00000-643a00f7.era1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(sepoliaDir, "sepolia-00000-643a00f7.era1"), sepolia, 0644)).To(Succeed())
+		store, err := era.OpenStore(sepoliaDir, []common.Hash{
+			common.HexToHash("0x643a00f78fd6a304a29c80b2f2f946e9e57494597600262b378b2754d34dff41")})
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+		eraFetcher := era.NewFetcher(store, nil, node)
+		eraFetcher.SetRawEncoding(converter.JSONAndRLP)
+
+		header, err := eraFetcher.GetHeaderByNumber(100)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(crypto.Keccak256Hash(header.RLP).Hex()).To(Equal(header.Hash))
+		var fields map[string]interface{}
+		Expect(json.Unmarshal(header.Raw, &fields)).To(Succeed())
+		Expect(fields).To(HaveKey("baseFeePerGas"))
+		Expect(fields["hash"]).To(Equal(header.Hash))
+	})
+
+	Describe("Source", func() {
+		var file *era.File
+
+		BeforeEach(func() {
+			var err error
+			file, err = era.Open(filepath.Join(dir, "blocks.era1"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			file.Close()
+		})
+
+		It("is a source for the importer", func() {
+			repo := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), node.ID)
+
+			result, err := importer.NewImporter(repo, converter.HeaderConverter{}, true).Import(era.NewSource(file, accumulators))
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Imported).To(Equal(int64(20)))
+			header, err := repo.GetHeader(12)
+			Expect(err).NotTo(HaveOccurred())
+			expectHeader(header, 12)
+		})
+
+		It("rejects a file which does not match the trusted root", func() {
+			file.Close()
+			forge()
+			var err error
+			file, err = era.Open(filepath.Join(dir, "blocks.era1"))
+			Expect(err).NotTo(HaveOccurred())
+			repo := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), node.ID)
+
+			result, err := importer.NewImporter(repo, converter.HeaderConverter{}, true).Import(era.NewSource(file, accumulators))
+
+			Expect(err).To(MatchError(ContainSubstring("does not match the trusted root")))
+			Expect(result.Imported).To(BeZero())
+		})
+	})
+})
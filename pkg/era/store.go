@@ -0,0 +1,156 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+// Store reads blocks from a directory of Era1 files
+// Each file is verified against the trusted accumulator root of its epoch the first time a block is read from it, and
+// none of its blocks are read if it fails
+type Store struct {
+	files        []*File
+	accumulators []common.Hash
+
+	mutex    sync.Mutex
+	verified map[*File]error
+}
+
+// OpenStore opens the Era1 files in the directory, which must not overlap, with the trusted accumulator roots of the
+// epochs, such as the published roots of a network's pre-Merge epochs, one of which each file must have
+func OpenStore(dir string, accumulators []common.Hash) (*Store, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.era1"))
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{accumulators: accumulators, verified: make(map[*File]error)}
+	for _, path := range paths {
+		file, err := Open(path)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		store.files = append(store.files, file)
+		if epoch := file.Start() / MaxEraSize; epoch >= uint64(len(accumulators)) {
+			store.Close()
+			return nil, fmt.Errorf("%s: no trusted accumulator root for epoch %d", path, epoch)
+		}
+	}
+	sort.Slice(store.files, func(i, j int) bool { return store.files[i].Start() < store.files[j].Start() })
+	for i := 1; i < len(store.files); i++ {
+		previous := store.files[i-1]
+		if previous.Start()+previous.Count() > store.files[i].Start() {
+			store.Close()
+			return nil, fmt.Errorf("Era1 files %s and %s overlap", previous.Path(), store.files[i].Path())
+		}
+	}
+	return store, nil
+}
+
+// ReadAccumulators reads the trusted accumulator roots of the epochs, one hex root per line in epoch order
+func ReadAccumulators(reader io.Reader) ([]common.Hash, error) {
+	var roots []common.Hash
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(strings.TrimPrefix(line, "0x")) != 2*common.HashLength {
+			return nil, fmt.Errorf("invalid accumulator root %q for epoch %d", line, len(roots))
+		}
+		roots = append(roots, common.HexToHash(line))
+	}
+	return roots, scanner.Err()
+}
+
+// Files returns the Era1 files of the store in block order
+func (store *Store) Files() []*File {
+	return store.files
+}
+
+// Covers returns whether a file of the store holds the block number
+func (store *Store) Covers(number uint64) bool {
+	return store.file(number) != nil
+}
+
+// LastBlock returns the highest block number held by the files, false if there are none
+func (store *Store) LastBlock() (uint64, bool) {
+	if len(store.files) == 0 {
+		return 0, false
+	}
+	last := store.files[len(store.files)-1]
+	return last.Start() + last.Count() - 1, true
+}
+
+// ReadBlock reads the block from the file holding it, verifying the file first if it has not been yet
+func (store *Store) ReadBlock(number uint64, withBody bool) (Block, error) {
+	file := store.file(number)
+	if file == nil {
+		return Block{}, ErrBlockNotInFile
+	}
+	if err := store.verify(file); err != nil {
+		return Block{}, err
+	}
+	return file.ReadBlock(number, withBody)
+}
+
+// Close closes the files
+func (store *Store) Close() error {
+	for _, file := range store.files {
+		file.Close()
+	}
+	return nil
+}
+
+func (store *Store) file(number uint64) *File {
+	i := sort.Search(len(store.files), func(i int) bool {
+		return store.files[i].Start()+store.files[i].Count() > number
+	})
+	if i < len(store.files) && store.files[i].Contains(number) {
+		return store.files[i]
+	}
+	return nil
+}
+
+// verify verifies the file once, returning the result of the verification on later calls
+func (store *Store) verify(file *File) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if err, ok := store.verified[file]; ok {
+		return err
+	}
+	root, err := file.VerifyAccumulator(store.accumulators)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", file.Path(), err.Error())
+		logrus.Error("verify: Era1 file failed verification: ", err)
+	} else {
+		logrus.Infof("verify: Era1 file %s verified with accumulator root %s", file.Path(), root.Hex())
+	}
+	store.verified[file] = err
+	return err
+}
@@ -0,0 +1,170 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package export
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// batchSize is the number of headers read from the repository at a time
+const batchSize = 1000
+
+// Exporter streams headers from a repository into files, split by block range
+type Exporter struct {
+	repository core.HeaderRepository
+	format     Format
+	dir        string
+	splitSize  int64
+}
+
+// NewExporter returns an Exporter writing files of the format into the directory
+// Each file holds the headers of splitSize blocks, aligned to multiples of it, or all of them if splitSize is not positive
+func NewExporter(repository core.HeaderRepository, format Format, dir string, splitSize int64) *Exporter {
+	return &Exporter{
+		repository: repository,
+		format:     format,
+		dir:        dir,
+		splitSize:  splitSize,
+	}
+}
+
+// ExportRange exports the headers between the provided block numbers (inclusive) and returns the paths of the files written
+// Block ranges without headers get no file
+func (exporter *Exporter) ExportRange(startingBlockNumber, endingBlockNumber int64) ([]string, error) {
+	var paths []string
+	for start := startingBlockNumber; start <= endingBlockNumber; {
+		end := endingBlockNumber
+		if exporter.splitSize > 0 && start-start%exporter.splitSize+exporter.splitSize-1 < end {
+			end = start - start%exporter.splitSize + exporter.splitSize - 1
+		}
+		path, err := exporter.exportFile(start, end)
+		if err != nil {
+			return paths, err
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+		start = end + 1
+	}
+	return paths, nil
+}
+
+// ExportTimeRange exports the headers with timestamps between the provided ones (inclusive) and returns the paths of the
+// files written, split by the block ranges of the headers
+func (exporter *Exporter) ExportTimeRange(startingTimestamp, endingTimestamp int64) ([]string, error) {
+	first, err := exporter.repository.GetHeaderAtOrAfterTimestamp(startingTimestamp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	last, err := exporter.repository.GetHeaderAtOrBeforeTimestamp(endingTimestamp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exporter.ExportRange(first.BlockNumber, last.BlockNumber)
+}
+
+// exportFile writes the headers between the block numbers to a file named after them and returns its path, or no path
+// if there are no headers to write
+// The headers are written to a temporary file in the same directory which is only renamed to the path once complete,
+// so a failed or interrupted export never leaves a partial file behind under the name of a complete one
+func (exporter *Exporter) exportFile(startingBlockNumber, endingBlockNumber int64) (string, error) {
+	path := filepath.Join(exporter.dir, fmt.Sprintf("headers_%d_%d.%s", startingBlockNumber, endingBlockNumber, exporter.format))
+	var file *os.File
+	written, err := exporter.writeHeaders(startingBlockNumber, endingBlockNumber, func() (io.Writer, error) {
+		var err error
+		file, err = ioutil.TempFile(exporter.dir, filepath.Base(path)+".*.tmp")
+		return file, err
+	})
+	if file == nil {
+		return "", err
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	log.Debugf("exportFile: exported %d headers of blocks %d to %d to %s", written, startingBlockNumber, endingBlockNumber, path)
+	return path, nil
+}
+
+// writeHeaders writes the headers between the block numbers as records to the writer returned by create, which is only
+// called once there is a header to write, and returns the number of headers written
+func (exporter *Exporter) writeHeaders(startingBlockNumber, endingBlockNumber int64, create func() (io.Writer, error)) (int, error) {
+	var (
+		buffer  *bufio.Writer
+		records RecordWriter
+		written int
+	)
+	for start := startingBlockNumber; start <= endingBlockNumber; start += batchSize {
+		end := start + batchSize - 1
+		if end > endingBlockNumber {
+			end = endingBlockNumber
+		}
+		headers, err := exporter.repository.GetHeadersInRange(start, end)
+		if err != nil {
+			return written, err
+		}
+		for _, header := range headers {
+			record, err := NewRecord(header)
+			if err != nil {
+				return written, err
+			}
+			if records == nil {
+				w, err := create()
+				if err != nil {
+					return written, err
+				}
+				buffer = bufio.NewWriter(w)
+				if records, err = NewRecordWriter(exporter.format, buffer); err != nil {
+					return written, err
+				}
+			}
+			if err = records.Write(record); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+	if records == nil {
+		return 0, nil
+	}
+	if err := records.Close(); err != nil {
+		return written, err
+	}
+	return written, buffer.Flush()
+}
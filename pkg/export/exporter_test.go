@@ -0,0 +1,240 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package export_test
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/export"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+var _ = Describe("Exporter", func() {
+	var (
+		dir        string
+		chain      *simulated.Chain
+		repo       core.HeaderRepository
+		headerHash = func(number int64) string { return chain.Header(number).Hash().Hex() }
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "export")
+		Expect(err).NotTo(HaveOccurred())
+		chain = simulated.NewChain(20)
+		repo = repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+		for number := int64(0); number <= 20; number++ {
+			if number == 7 {
+				continue
+			}
+			_, err = repo.CreateOrUpdateHeader(converter.HeaderConverter{}.Convert(chain.Header(number), headerHash(number)))
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	readNDJSON := func(path string) []export.Record {
+		file, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		var records []export.Record
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var record export.Record
+			Expect(json.Unmarshal(scanner.Bytes(), &record)).To(Succeed())
+			records = append(records, record)
+		}
+		return records
+	}
+
+	It("splits the block range into files aligned to the split size", func() {
+		paths, err := export.NewExporter(repo, export.NDJSON, dir, 5).ExportRange(3, 12)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{
+			filepath.Join(dir, "headers_3_4.ndjson"),
+			filepath.Join(dir, "headers_5_9.ndjson"),
+			filepath.Join(dir, "headers_10_12.ndjson"),
+		}))
+		records := readNDJSON(paths[1])
+		Expect(records).To(HaveLen(4))
+		Expect(records[0].Number).To(Equal(int64(5)))
+		Expect(records[0].Hash).To(Equal(headerHash(5)))
+		Expect(records[0].ParentHash).To(Equal(headerHash(4)))
+		Expect(records[0].Timestamp).To(Equal(int64(chain.Header(5).Time)))
+		Expect(records[0].Difficulty).To(Equal(chain.Header(5).Difficulty.String()))
+	})
+
+	It("does not write files for block ranges without headers", func() {
+		paths, err := export.NewExporter(repo, export.NDJSON, dir, 1).ExportRange(6, 8)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{filepath.Join(dir, "headers_6_6.ndjson"), filepath.Join(dir, "headers_8_8.ndjson")}))
+	})
+
+	It("exports the headers of a time range", func() {
+		paths, err := export.NewExporter(repo, export.NDJSON, dir, 0).ExportTimeRange(int64(chain.Header(15).Time), int64(chain.Header(17).Time))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{filepath.Join(dir, "headers_15_17.ndjson")}))
+		Expect(readNDJSON(paths[0])).To(HaveLen(3))
+	})
+
+	It("writes CSV with a header row", func() {
+		paths, err := export.NewExporter(repo, export.CSV, dir, 0).ExportRange(0, 2)
+		Expect(err).NotTo(HaveOccurred())
+
+		file, err := os.Open(paths[0])
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		rows, err := csv.NewReader(file).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows).To(HaveLen(4))
+		Expect(rows[0][:3]).To(Equal([]string{"number", "hash", "parent_hash"}))
+		Expect(rows[3][:3]).To(Equal([]string{"2", headerHash(2), headerHash(1)}))
+	})
+
+	It("writes Parquet", func() {
+		paths, err := export.NewExporter(repo, export.Parquet, dir, 0).ExportRange(10, 20)
+		Expect(err).NotTo(HaveOccurred())
+
+		file, err := local.NewLocalFileReader(paths[0])
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		parquetReader, err := reader.NewParquetReader(file, new(export.Record), 1)
+		Expect(err).NotTo(HaveOccurred())
+		defer parquetReader.ReadStop()
+		Expect(parquetReader.GetNumRows()).To(Equal(int64(11)))
+		records := make([]export.Record, 11)
+		Expect(parquetReader.Read(&records)).To(Succeed())
+		Expect(records[10].Number).To(Equal(int64(20)))
+		Expect(records[10].Hash).To(Equal(headerHash(20)))
+		Expect(records[10].ParentHash).To(Equal(headerHash(19)))
+	})
+
+	It("does not leave a file behind when the export fails", func() {
+		_, err := repo.CreateOrUpdateHeader(core.Header{BlockNumber: 21, Hash: "0x21", Timestamp: strconv.FormatUint(chain.Header(20).Time+15, 10)})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = export.NewExporter(repo, export.NDJSON, dir, 0).ExportRange(19, 21)
+
+		Expect(err).To(HaveOccurred())
+		files, err := ioutil.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+
+	Describe("headers with fields added by later forks", func() {
+		var (
+			baseFee         = big.NewInt(1000000000)
+			withdrawalsRoot = common.HexToHash("0x1234")
+		)
+
+		BeforeEach(func() {
+			header := chain.Header(20)
+			header.Number = big.NewInt(21)
+			header.Time += 15
+			london, err := converter.HeaderConverter{Encoding: converter.RLP}.ConvertRLP(fakes.LondonHeaderRLP(header, baseFee))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = repo.CreateOrUpdateHeader(london)
+			Expect(err).NotTo(HaveOccurred())
+			header.Number = big.NewInt(22)
+			header.Time += 15
+			shanghaiJSON, _ := fakes.ShanghaiHeaderJSON(header, baseFee, withdrawalsRoot)
+			shanghai, err := converter.HeaderConverter{}.ConvertJSON(shanghaiJSON)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = repo.CreateOrUpdateHeader(shanghai)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("exports the fields the headers have", func() {
+			paths, err := export.NewExporter(repo, export.NDJSON, dir, 0).ExportRange(20, 22)
+			Expect(err).NotTo(HaveOccurred())
+
+			records := readNDJSON(paths[0])
+			Expect(records).To(HaveLen(3))
+			Expect(records[0].BaseFeePerGas).To(BeNil())
+			Expect(records[0].WithdrawalsRoot).To(BeNil())
+			Expect(*records[1].BaseFeePerGas).To(Equal(baseFee.String()))
+			Expect(records[1].WithdrawalsRoot).To(BeNil())
+			Expect(*records[2].BaseFeePerGas).To(Equal(baseFee.String()))
+			Expect(*records[2].WithdrawalsRoot).To(Equal(withdrawalsRoot.Hex()))
+			Expect(records[2].BlobGasUsed).To(BeNil())
+		})
+
+		It("leaves the CSV columns of the fields a header does not have empty", func() {
+			paths, err := export.NewExporter(repo, export.CSV, dir, 0).ExportRange(20, 22)
+			Expect(err).NotTo(HaveOccurred())
+
+			file, err := os.Open(paths[0])
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+			rows, err := csv.NewReader(file).ReadAll()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rows).To(HaveLen(4))
+			Expect(rows[0][15:17]).To(Equal([]string{"base_fee_per_gas", "withdrawals_root"}))
+			Expect(rows[1][15:17]).To(Equal([]string{"", ""}))
+			Expect(rows[2][15:17]).To(Equal([]string{baseFee.String(), ""}))
+			Expect(rows[3][15:17]).To(Equal([]string{baseFee.String(), withdrawalsRoot.Hex()}))
+		})
+
+		It("writes the fields to Parquet as optional columns", func() {
+			paths, err := export.NewExporter(repo, export.Parquet, dir, 0).ExportRange(20, 22)
+			Expect(err).NotTo(HaveOccurred())
+
+			file, err := local.NewLocalFileReader(paths[0])
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+			parquetReader, err := reader.NewParquetReader(file, new(export.Record), 1)
+			Expect(err).NotTo(HaveOccurred())
+			defer parquetReader.ReadStop()
+			records := make([]export.Record, 3)
+			Expect(parquetReader.Read(&records)).To(Succeed())
+			Expect(records[0].BaseFeePerGas).To(BeNil())
+			Expect(*records[1].BaseFeePerGas).To(Equal(baseFee.String()))
+			Expect(*records[2].WithdrawalsRoot).To(Equal(withdrawalsRoot.Hex()))
+		})
+	})
+
+	It("rejects unknown formats", func() {
+		_, err := export.ParseFormat("xml")
+		Expect(err).To(HaveOccurred())
+		format, err := export.ParseFormat("Parquet")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(format).To(Equal(export.Parquet))
+	})
+})
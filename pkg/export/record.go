@@ -0,0 +1,229 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/xitongsys/parquet-go-source/writerfile"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// Record is a header flattened into the fields decoded from its raw header, as exported to files
+type Record struct {
+	Number           int64  `json:"number" parquet:"name=number, type=INT64"`
+	Hash             string `json:"hash" parquet:"name=hash, type=UTF8"`
+	ParentHash       string `json:"parentHash" parquet:"name=parent_hash, type=UTF8"`
+	Timestamp        int64  `json:"timestamp" parquet:"name=timestamp, type=INT64"`
+	Miner            string `json:"miner" parquet:"name=miner, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Difficulty       string `json:"difficulty" parquet:"name=difficulty, type=UTF8"`
+	GasLimit         int64  `json:"gasLimit" parquet:"name=gas_limit, type=INT64"`
+	GasUsed          int64  `json:"gasUsed" parquet:"name=gas_used, type=INT64"`
+	StateRoot        string `json:"stateRoot" parquet:"name=state_root, type=UTF8"`
+	TransactionsRoot string `json:"transactionsRoot" parquet:"name=transactions_root, type=UTF8"`
+	ReceiptsRoot     string `json:"receiptsRoot" parquet:"name=receipts_root, type=UTF8"`
+	UnclesHash       string `json:"sha3Uncles" parquet:"name=uncles_hash, type=UTF8"`
+	ExtraData        string `json:"extraData" parquet:"name=extra_data, type=UTF8"`
+	MixHash          string `json:"mixHash" parquet:"name=mix_hash, type=UTF8"`
+	Nonce            string `json:"nonce" parquet:"name=nonce, type=UTF8"`
+	// The fields added by later forks are only set for the headers which have them
+	BaseFeePerGas         *string `json:"baseFeePerGas,omitempty" parquet:"name=base_fee_per_gas, type=UTF8, repetitiontype=OPTIONAL"`
+	WithdrawalsRoot       *string `json:"withdrawalsRoot,omitempty" parquet:"name=withdrawals_root, type=UTF8, repetitiontype=OPTIONAL"`
+	BlobGasUsed           *int64  `json:"blobGasUsed,omitempty" parquet:"name=blob_gas_used, type=INT64, repetitiontype=OPTIONAL"`
+	ExcessBlobGas         *int64  `json:"excessBlobGas,omitempty" parquet:"name=excess_blob_gas, type=INT64, repetitiontype=OPTIONAL"`
+	ParentBeaconBlockRoot *string `json:"parentBeaconBlockRoot,omitempty" parquet:"name=parent_beacon_block_root, type=UTF8, repetitiontype=OPTIONAL"`
+	RequestsHash          *string `json:"requestsHash,omitempty" parquet:"name=requests_hash, type=UTF8, repetitiontype=OPTIONAL"`
+}
+
+// csvColumns are the CSV header row, in the order of Record's fields
+var csvColumns = []string{"number", "hash", "parent_hash", "timestamp", "miner", "difficulty", "gas_limit", "gas_used",
+	"state_root", "transactions_root", "receipts_root", "uncles_hash", "extra_data", "mix_hash", "nonce", "base_fee_per_gas",
+	"withdrawals_root", "blob_gas_used", "excess_blob_gas", "parent_beacon_block_root", "requests_hash"}
+
+// NewRecord decodes the header's raw header into a Record, including the fields added after go-ethereum's header type
+// The hash is the stored one, which for POA headers differs from the hash of the decoded header
+func NewRecord(header core.Header) (Record, error) {
+	gethHeader, err := converter.DecodeHeader(header)
+	if err != nil {
+		return Record{}, fmt.Errorf("block %d: %s", header.BlockNumber, err.Error())
+	}
+	extensions, err := converter.HeaderExtensions(header)
+	if err != nil {
+		return Record{}, fmt.Errorf("block %d: %s", header.BlockNumber, err.Error())
+	}
+	record := Record{
+		Number:           header.BlockNumber,
+		Hash:             header.Hash,
+		ParentHash:       gethHeader.ParentHash.Hex(),
+		Timestamp:        int64(gethHeader.Time),
+		Miner:            gethHeader.Coinbase.Hex(),
+		Difficulty:       gethHeader.Difficulty.String(),
+		GasLimit:         int64(gethHeader.GasLimit),
+		GasUsed:          int64(gethHeader.GasUsed),
+		StateRoot:        gethHeader.Root.Hex(),
+		TransactionsRoot: gethHeader.TxHash.Hex(),
+		ReceiptsRoot:     gethHeader.ReceiptHash.Hex(),
+		UnclesHash:       gethHeader.UncleHash.Hex(),
+		ExtraData:        hexutil.Encode(gethHeader.Extra),
+		MixHash:          gethHeader.MixDigest.Hex(),
+		Nonce:            hexutil.Encode(gethHeader.Nonce[:]),
+	}
+	if baseFee, ok := extensions["baseFeePerGas"].(*hexutil.Big); ok {
+		decimal := baseFee.ToInt().String()
+		record.BaseFeePerGas = &decimal
+	}
+	record.WithdrawalsRoot = hashField(extensions["withdrawalsRoot"])
+	record.BlobGasUsed = quantityField(extensions["blobGasUsed"])
+	record.ExcessBlobGas = quantityField(extensions["excessBlobGas"])
+	record.ParentBeaconBlockRoot = hashField(extensions["parentBeaconBlockRoot"])
+	record.RequestsHash = hashField(extensions["requestsHash"])
+	return record, nil
+}
+
+// hashField returns the hex encoding of a hash decoded by converter.HeaderExtensions, or nil if the header has none
+func hashField(value interface{}) *string {
+	hash, ok := value.(hexutil.Bytes)
+	if !ok {
+		return nil
+	}
+	encoded := hash.String()
+	return &encoded
+}
+
+// quantityField returns a quantity decoded by converter.HeaderExtensions, or nil if the header has none
+func quantityField(value interface{}) *int64 {
+	quantity, ok := value.(*hexutil.Big)
+	if !ok {
+		return nil
+	}
+	converted := quantity.ToInt().Int64()
+	return &converted
+}
+
+// csvRow returns the record's CSV columns, the fields the header does not have are empty
+func (record Record) csvRow() []string {
+	return []string{strconv.FormatInt(record.Number, 10), record.Hash, record.ParentHash, strconv.FormatInt(record.Timestamp, 10),
+		record.Miner, record.Difficulty, strconv.FormatInt(record.GasLimit, 10), strconv.FormatInt(record.GasUsed, 10),
+		record.StateRoot, record.TransactionsRoot, record.ReceiptsRoot, record.UnclesHash, record.ExtraData, record.MixHash, record.Nonce,
+		stringColumn(record.BaseFeePerGas), stringColumn(record.WithdrawalsRoot), intColumn(record.BlobGasUsed),
+		intColumn(record.ExcessBlobGas), stringColumn(record.ParentBeaconBlockRoot), stringColumn(record.RequestsHash)}
+}
+
+func stringColumn(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func intColumn(value *int64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatInt(*value, 10)
+}
+
+// Format is the file format headers are exported in
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+// ParseFormat returns the Format for the provided config value
+func ParseFormat(format string) (Format, error) {
+	switch parsed := Format(strings.ToLower(format)); parsed {
+	case CSV, NDJSON, Parquet:
+		return parsed, nil
+	}
+	return "", fmt.Errorf("unrecognized export format %s, expected one of csv, ndjson or parquet", format)
+}
+
+// RecordWriter writes records to a file in a Format
+// Close flushes the records, it does not close the underlying writer
+type RecordWriter interface {
+	Write(record Record) error
+	Close() error
+}
+
+// NewRecordWriter returns a RecordWriter writing the format to w
+func NewRecordWriter(format Format, w io.Writer) (RecordWriter, error) {
+	switch format {
+	case CSV:
+		csvWriter := csv.NewWriter(w)
+		return &csvRecordWriter{writer: csvWriter}, csvWriter.Write(csvColumns)
+	case NDJSON:
+		return ndjsonRecordWriter{encoder: json.NewEncoder(w)}, nil
+	case Parquet:
+		parquetWriter, err := writer.NewParquetWriter(writerfile.NewWriterFile(w), new(Record), 1)
+		if err != nil {
+			return nil, err
+		}
+		parquetWriter.CompressionType = parquet.CompressionCodec_SNAPPY
+		return parquetRecordWriter{writer: parquetWriter}, nil
+	}
+	return nil, fmt.Errorf("unrecognized export format %s", format)
+}
+
+type csvRecordWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvRecordWriter) Write(record Record) error {
+	return w.writer.Write(record.csvRow())
+}
+
+func (w *csvRecordWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type ndjsonRecordWriter struct {
+	encoder *json.Encoder
+}
+
+func (w ndjsonRecordWriter) Write(record Record) error {
+	return w.encoder.Encode(record)
+}
+
+func (w ndjsonRecordWriter) Close() error {
+	return nil
+}
+
+type parquetRecordWriter struct {
+	writer *writer.ParquetWriter
+}
+
+func (w parquetRecordWriter) Write(record Record) error {
+	return w.writer.Write(record)
+}
+
+func (w parquetRecordWriter) Close() error {
+	return w.writer.WriteStop()
+}
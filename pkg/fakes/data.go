@@ -19,11 +19,16 @@ package fakes
 import (
 	"encoding/json"
 	"errors"
+	"math/big"
 	"math/rand"
 	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 
 	"github.com/vulcanize/eth-header-sync/pkg/core"
 )
@@ -40,3 +45,74 @@ var FakeHeader = core.Header{
 	Raw:       rawFakeHeader,
 	Timestamp: strconv.FormatInt(fakeTimestamp, 10),
 }
+
+// HoleskyGenesisHash is the hash of the Holesky genesis header, a post-London header with a base fee
+var HoleskyGenesisHash = common.HexToHash("0xb5f7f912443c940f21fd611f12828d75b534364ed9e95ca4e307729a4661bde4")
+
+// HoleskyGenesisJSON is the Holesky genesis block as eth_getBlockByNumber returns it
+var HoleskyGenesisJSON = json.RawMessage(`{"baseFeePerGas":"0x3b9aca00","difficulty":"0x1","extraData":"0x","gasLimit":"0x17d7840","gasUsed":"0x0","hash":"0xb5f7f912443c940f21fd611f12828d75b534364ed9e95ca4e307729a4661bde4","logsBloom":"0x` + strings.Repeat("00", 256) + `","miner":"0x0000000000000000000000000000000000000000","mixHash":"0x0000000000000000000000000000000000000000000000000000000000000000","nonce":"0x0000000000001234","number":"0x0","parentHash":"0x0000000000000000000000000000000000000000000000000000000000000000","receiptsRoot":"0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421","sha3Uncles":"0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347","size":"0x21d","stateRoot":"0x69d8c9d72f6fa4ad42d4702b433707212f90db395eb54dc20bc85de253788783","timestamp":"0x65156994","totalDifficulty":"0x1","transactions":[],"transactionsRoot":"0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421","uncles":[]}`)
+
+// LondonHeaderRLP returns the RLP encoding of the header followed by the base fee, as headers are encoded since the
+// London fork, go-ethereum's header type has no base fee
+func LondonHeaderRLP(header *types.Header, baseFee *big.Int) []byte {
+	encoded, err := rlp.EncodeToBytes([]interface{}{
+		header.ParentHash, header.UncleHash, header.Coinbase, header.Root, header.TxHash, header.ReceiptHash,
+		header.Bloom, header.Difficulty, header.Number, header.GasLimit, header.GasUsed, header.Time, header.Extra,
+		header.MixDigest, header.Nonce, baseFee,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return encoded
+}
+
+// ShanghaiHeaderJSON returns the header as eth_getBlockByNumber returns it since the Shanghai fork, with the base fee
+// and withdrawals root, along with its hash, the keccak of its consensus encoding
+func ShanghaiHeaderJSON(header *types.Header, baseFee *big.Int, withdrawalsRoot common.Hash) (json.RawMessage, common.Hash) {
+	encoded, err := rlp.EncodeToBytes([]interface{}{
+		header.ParentHash, header.UncleHash, header.Coinbase, header.Root, header.TxHash, header.ReceiptHash,
+		header.Bloom, header.Difficulty, header.Number, header.GasLimit, header.GasUsed, header.Time, header.Extra,
+		header.MixDigest, header.Nonce, baseFee, withdrawalsRoot,
+	})
+	if err != nil {
+		panic(err)
+	}
+	hash := crypto.Keccak256Hash(encoded)
+	raw, err := json.Marshal(header)
+	if err != nil {
+		panic(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		panic(err)
+	}
+	fields["hash"] = hash
+	fields["baseFeePerGas"] = (*hexutil.Big)(baseFee)
+	fields["withdrawalsRoot"] = withdrawalsRoot
+	fields["withdrawals"] = []interface{}{}
+	fields["uncles"] = []common.Hash{}
+	fields["transactions"] = []common.Hash{}
+	if raw, err = json.Marshal(fields); err != nil {
+		panic(err)
+	}
+	return raw, hash
+}
+
+// DynamicFeeTransactionRLP returns the encoding of an EIP-1559 transaction as it is held in a block body, a string of
+// the transaction type followed by the transaction, along with the transaction's hash
+func DynamicFeeTransactionRLP(nonce uint64) (rlp.RawValue, common.Hash) {
+	payload, err := rlp.EncodeToBytes([]interface{}{
+		big.NewInt(1), nonce, big.NewInt(1), big.NewInt(2), uint64(21000), common.Address{}, big.NewInt(0), []byte{},
+		[]interface{}{}, uint64(0), big.NewInt(1), big.NewInt(1),
+	})
+	if err != nil {
+		panic(err)
+	}
+	// EIP-1559 transactions are of type 2
+	envelope := append([]byte{2}, payload...)
+	encoded, err := rlp.EncodeToBytes(envelope)
+	if err != nil {
+		panic(err)
+	}
+	return encoded, crypto.Keccak256Hash(envelope)
+}
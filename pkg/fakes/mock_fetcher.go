@@ -25,6 +25,7 @@ import (
 type MockFetcher struct {
 	getBlockByNumberErr error
 	lastBlock           *big.Int
+	lastBlockErr        error
 	node                core.Node
 }
 
@@ -38,6 +39,10 @@ func (fetcher *MockFetcher) SetLastBlock(blockNumber *big.Int) {
 	fetcher.lastBlock = blockNumber
 }
 
+func (fetcher *MockFetcher) SetLastBlockErr(err error) {
+	fetcher.lastBlockErr = err
+}
+
 func (fetcher *MockFetcher) GetHeaderByNumber(blockNumber int64) (core.Header, error) {
 	return core.Header{BlockNumber: blockNumber}, nil
 }
@@ -52,7 +57,7 @@ func (fetcher *MockFetcher) GetHeadersByNumbers(blockNumbers []int64) ([]core.He
 }
 
 func (fetcher *MockFetcher) LastBlock() (*big.Int, error) {
-	return fetcher.lastBlock, nil
+	return fetcher.lastBlock, fetcher.lastBlockErr
 }
 
 func (fetcher *MockFetcher) Node() core.Node {
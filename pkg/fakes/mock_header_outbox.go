@@ -0,0 +1,123 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fakes
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+type MockHeaderOutboxRepository struct {
+	Events          []core.OutboxEvent
+	getEventsErr    error
+	deleteEventsErr error
+}
+
+func NewMockHeaderOutboxRepository(events ...core.OutboxEvent) *MockHeaderOutboxRepository {
+	return &MockHeaderOutboxRepository{Events: events}
+}
+
+func (outbox *MockHeaderOutboxRepository) SetGetOutboxEventsErr(err error) {
+	outbox.getEventsErr = err
+}
+
+func (outbox *MockHeaderOutboxRepository) SetDeleteOutboxEventsErr(err error) {
+	outbox.deleteEventsErr = err
+}
+
+func (outbox *MockHeaderOutboxRepository) GetOutboxEvents(limit int) ([]core.OutboxEvent, error) {
+	if limit > len(outbox.Events) {
+		limit = len(outbox.Events)
+	}
+	return outbox.Events[:limit], outbox.getEventsErr
+}
+
+func (outbox *MockHeaderOutboxRepository) DeleteOutboxEvents(ids []int64) error {
+	if outbox.deleteEventsErr != nil {
+		return outbox.deleteEventsErr
+	}
+	deleted := make(map[int64]bool)
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	var remaining []core.OutboxEvent
+	for _, event := range outbox.Events {
+		if !deleted[event.ID] {
+			remaining = append(remaining, event)
+		}
+	}
+	outbox.Events = remaining
+	return nil
+}
+
+type MockHeaderPublisher struct {
+	Published  []core.OutboxEvent
+	publishErr error
+	Closed     bool
+}
+
+func NewMockHeaderPublisher() *MockHeaderPublisher {
+	return &MockHeaderPublisher{}
+}
+
+func (publisher *MockHeaderPublisher) SetPublishErr(err error) {
+	publisher.publishErr = err
+}
+
+func (publisher *MockHeaderPublisher) Publish(events []core.OutboxEvent) error {
+	if publisher.publishErr != nil {
+		return publisher.publishErr
+	}
+	publisher.Published = append(publisher.Published, events...)
+	return nil
+}
+
+func (publisher *MockHeaderPublisher) Close() error {
+	publisher.Closed = true
+	return nil
+}
+
+// MockKafkaWriter stands in for a Kafka broker, keeping the messages written to it in order
+type MockKafkaWriter struct {
+	Messages []kafka.Message
+	writeErr error
+	Closed   bool
+}
+
+func NewMockKafkaWriter() *MockKafkaWriter {
+	return &MockKafkaWriter{}
+}
+
+func (writer *MockKafkaWriter) SetWriteMessagesErr(err error) {
+	writer.writeErr = err
+}
+
+func (writer *MockKafkaWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	if writer.writeErr != nil {
+		return writer.writeErr
+	}
+	writer.Messages = append(writer.Messages, messages...)
+	return nil
+}
+
+func (writer *MockKafkaWriter) Close() error {
+	writer.Closed = true
+	return nil
+}
@@ -17,9 +17,13 @@
 package fakes
 
 import (
+	"database/sql"
+	"sort"
+
 	. "github.com/onsi/gomega"
 
 	"github.com/vulcanize/eth-header-sync/pkg/core"
+	repo "github.com/vulcanize/eth-header-sync/pkg/repository"
 )
 
 type MockHeaderRepository struct {
@@ -34,6 +38,12 @@ type MockHeaderRepository struct {
 	missingBlockNumbers                    []int64
 	headerExists                           bool
 	GetHeaderPassedBlockNumber             int64
+	PruneHeadersPassedBlockNumber          int64
+	pruneHeadersErr                        error
+	pruneHeadersReturnCount                int64
+	getHeadersInRangeReturnHeaders         []core.Header
+	GetHeadersInRangePassedRange           [2]int64
+	storedHeaders                          []core.Header
 }
 
 func NewMockHeaderRepository() *MockHeaderRepository {
@@ -55,18 +65,171 @@ func (repository *MockHeaderRepository) SetMissingBlockNumbers(blockNumbers []in
 func (repository *MockHeaderRepository) CreateOrUpdateHeader(header core.Header) (int64, error) {
 	repository.createOrUpdateHeaderCallCount++
 	repository.createOrUpdateHeaderPassedBlockNumbers = append(repository.createOrUpdateHeaderPassedBlockNumbers, header.BlockNumber)
+	if repository.storedHeaders != nil && repository.createOrUpdateHeaderErr == nil {
+		return repository.upsertStoredHeader(header)
+	}
 	return repository.createOrUpdateHeaderReturnID, repository.createOrUpdateHeaderErr
 }
 
+// upsertStoredHeader stores the header as the repository would, replacing a stored header at the height with a different hash
+func (repository *MockHeaderRepository) upsertStoredHeader(header core.Header) (int64, error) {
+	for i, stored := range repository.storedHeaders {
+		if stored.BlockNumber != header.BlockNumber {
+			continue
+		}
+		if stored.Hash == header.Hash {
+			return 0, repo.ErrValidHeaderExists
+		}
+		repository.storedHeaders[i] = header
+		return repository.createOrUpdateHeaderReturnID, nil
+	}
+	repository.storedHeaders = append(repository.storedHeaders, header)
+	return repository.createOrUpdateHeaderReturnID, nil
+}
+
 func (repository *MockHeaderRepository) GetHeader(blockNumber int64) (core.Header, error) {
 	repository.GetHeaderPassedBlockNumber = blockNumber
+	if repository.storedHeaders != nil {
+		return repository.findStoredHeader(func(header core.Header) bool { return header.BlockNumber == blockNumber })
+	}
 	return core.Header{BlockNumber: blockNumber, Hash: repository.getHeaderReturnBlockHash}, repository.getHeaderError
 }
 
+// SetStoredHeaders makes the header lookups (GetHeader, GetHeaderByHash, the timestamp and range lookups) and GetLastBlockNumber answer from the provided headers
+// CreateOrUpdateHeader then stores headers alongside them, returning ErrValidHeaderExists for headers already stored
+func (repository *MockHeaderRepository) SetStoredHeaders(headers ...core.Header) {
+	repository.storedHeaders = append([]core.Header{}, headers...)
+}
+
+func (repository *MockHeaderRepository) GetHeaderByHash(hash string) (core.Header, error) {
+	return repository.findStoredHeader(func(header core.Header) bool { return header.Hash == hash })
+}
+
+func (repository *MockHeaderRepository) GetHeaderAtOrBeforeTimestamp(timestamp int64) (core.Header, error) {
+	headers, err := repository.filterStoredHeaders(func(header core.Header) bool {
+		return storedTimestamp(header) <= timestamp
+	}, -1)
+	if err != nil || len(headers) == 0 {
+		return core.Header{}, notFound(err)
+	}
+	return headers[len(headers)-1], nil
+}
+
+func (repository *MockHeaderRepository) GetHeaderAtOrAfterTimestamp(timestamp int64) (core.Header, error) {
+	headers, err := repository.filterStoredHeaders(func(header core.Header) bool {
+		return storedTimestamp(header) >= timestamp
+	}, 1)
+	if err != nil || len(headers) == 0 {
+		return core.Header{}, notFound(err)
+	}
+	return headers[0], nil
+}
+
+func (repository *MockHeaderRepository) GetHeaderClosestToTimestamp(timestamp int64) (core.Header, error) {
+	before, beforeErr := repository.GetHeaderAtOrBeforeTimestamp(timestamp)
+	after, afterErr := repository.GetHeaderAtOrAfterTimestamp(timestamp)
+	if beforeErr != nil {
+		return after, afterErr
+	}
+	if afterErr == nil && storedTimestamp(after)-timestamp < timestamp-storedTimestamp(before) {
+		return after, nil
+	}
+	return before, nil
+}
+
+func storedTimestamp(header core.Header) int64 {
+	timestamp, _ := header.UnixTimestamp()
+	return timestamp
+}
+
+func notFound(err error) error {
+	if err != nil {
+		return err
+	}
+	return sql.ErrNoRows
+}
+
+func (repository *MockHeaderRepository) GetLastBlockNumber() (int64, error) {
+	if len(repository.storedHeaders) == 0 {
+		return 0, sql.ErrNoRows
+	}
+	last := repository.storedHeaders[0].BlockNumber
+	for _, header := range repository.storedHeaders {
+		if header.BlockNumber > last {
+			last = header.BlockNumber
+		}
+	}
+	return last, repository.getHeaderError
+}
+
+func (repository *MockHeaderRepository) findStoredHeader(matches func(core.Header) bool) (core.Header, error) {
+	if repository.getHeaderError != nil {
+		return core.Header{}, repository.getHeaderError
+	}
+	for _, header := range repository.storedHeaders {
+		if matches(header) {
+			return header, nil
+		}
+	}
+	return core.Header{}, sql.ErrNoRows
+}
+
+func (repository *MockHeaderRepository) GetHeadersInRange(startingBlockNumber, endingBlockNumber int64) ([]core.Header, error) {
+	repository.GetHeadersInRangePassedRange = [2]int64{startingBlockNumber, endingBlockNumber}
+	if repository.storedHeaders != nil {
+		return repository.filterStoredHeaders(func(header core.Header) bool {
+			return header.BlockNumber >= startingBlockNumber && header.BlockNumber <= endingBlockNumber
+		}, -1)
+	}
+	return repository.getHeadersInRangeReturnHeaders, repository.getHeaderError
+}
+
+func (repository *MockHeaderRepository) GetHeadersInTimeRange(startingTimestamp, endingTimestamp int64, limit int) ([]core.Header, error) {
+	return repository.filterStoredHeaders(func(header core.Header) bool {
+		timestamp := storedTimestamp(header)
+		return timestamp >= startingTimestamp && timestamp <= endingTimestamp
+	}, limit)
+}
+
+// filterStoredHeaders returns up to limit of the stored headers which match in block number order, a negative limit returns all of them
+func (repository *MockHeaderRepository) filterStoredHeaders(matches func(core.Header) bool, limit int) ([]core.Header, error) {
+	if repository.getHeaderError != nil {
+		return nil, repository.getHeaderError
+	}
+	var headers []core.Header
+	for _, header := range repository.storedHeaders {
+		if matches(header) {
+			headers = append(headers, header)
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].BlockNumber < headers[j].BlockNumber })
+	if limit >= 0 && len(headers) > limit {
+		headers = headers[:limit]
+	}
+	return headers, nil
+}
+
+func (repository *MockHeaderRepository) SetGetHeadersInRangeReturnHeaders(headers []core.Header) {
+	repository.getHeadersInRangeReturnHeaders = headers
+}
+
 func (repository *MockHeaderRepository) MissingBlockNumbers(startingBlockNumber, endingBlockNumber int64, nodeID string) ([]int64, error) {
 	return repository.missingBlockNumbers, nil
 }
 
+func (repository *MockHeaderRepository) PruneHeaders(blockNumber int64) (int64, error) {
+	repository.PruneHeadersPassedBlockNumber = blockNumber
+	return repository.pruneHeadersReturnCount, repository.pruneHeadersErr
+}
+
+func (repository *MockHeaderRepository) SetPruneHeadersReturnCount(count int64) {
+	repository.pruneHeadersReturnCount = count
+}
+
+func (repository *MockHeaderRepository) SetPruneHeadersErr(err error) {
+	repository.pruneHeadersErr = err
+}
+
 func (repository *MockHeaderRepository) SetGetHeaderError(err error) {
 	repository.getHeaderError = err
 }
@@ -18,8 +18,11 @@ package fakes
 
 import (
 	"context"
+	"encoding/json"
 	"math/big"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -44,7 +47,11 @@ type MockRPCClient struct {
 	returnPOAHeader     core.POAHeader
 	returnPOAHeaders    []core.POAHeader
 	returnPOWHeaders    []*types.Header
+	returnRawBlock      json.RawMessage
+	returnUncles        []*types.Header
+	returnTxHashes      []common.Hash
 	supportedModules    map[string]string
+	passedBatches       [][]client.BatchElem
 }
 
 func (client *MockRPCClient) Subscribe(namespace string, payloadChan interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
@@ -74,6 +81,7 @@ func (client *MockRPCClient) SetRPCPath(rpcPath string) {
 }
 
 func (client *MockRPCClient) BatchCall(batch []client.BatchElem) error {
+	client.passedBatches = append(client.passedBatches, batch)
 	client.passedBatch = batch
 	client.passedMethod = batch[0].Method
 	client.lengthOfBatch = len(batch)
@@ -85,6 +93,13 @@ func (client *MockRPCClient) BatchCall(batch []client.BatchElem) error {
 		if p, ok := batchElem.Result.(*types.Header); ok {
 			*p = types.Header{Number: big.NewInt(100)}
 		}
+		if p, ok := batchElem.Result.(*json.RawMessage); ok {
+			if batchElem.Method == "eth_getUncleByBlockHashAndIndex" {
+				*p = client.rawUncle(batchElem.Args)
+			} else {
+				*p = client.rawBlock(batchElem.Args)
+			}
+		}
 		if p, ok := batchElem.Result.(*core.POAHeader); ok {
 
 			*p = client.returnPOAHeader
@@ -108,6 +123,9 @@ func (client *MockRPCClient) CallContext(ctx context.Context, result interface{}
 		if p, ok := result.(*types.Header); ok {
 			*p = types.Header{Number: big.NewInt(100)}
 		}
+		if p, ok := result.(*json.RawMessage); ok {
+			*p = client.rawBlock(args)
+		}
 		if p, ok := result.(*core.POAHeader); ok {
 
 			*p = client.returnPOAHeader
@@ -151,16 +169,86 @@ func (client *MockRPCClient) SetReturnPOWHeaders(headers []*types.Header) {
 	client.returnPOWHeaders = headers
 }
 
+// SetReturnRawBlock sets the eth_getBlockByNumber response returned for any block number
+func (client *MockRPCClient) SetReturnRawBlock(rawBlock json.RawMessage) {
+	client.returnRawBlock = rawBlock
+}
+
 func (client *MockRPCClient) SetReturnPOAHeaders(headers []core.POAHeader) {
 	client.returnPOAHeaders = headers
 }
 
+// SetReturnUncles sets the uncles included by every returned block
+func (client *MockRPCClient) SetReturnUncles(uncles []*types.Header) {
+	client.returnUncles = uncles
+}
+
+func (client *MockRPCClient) SetReturnTransactionHashes(hashes []common.Hash) {
+	client.returnTxHashes = hashes
+}
+
+// rawBlock returns the eth_getBlockByNumber JSON response for the block number requested by the arguments, the
+// header comes from the POW headers set with that number if there is one
+func (client *MockRPCClient) rawBlock(args []interface{}) json.RawMessage {
+	if client.returnRawBlock != nil {
+		return client.returnRawBlock
+	}
+	Expect(args).NotTo(BeEmpty())
+	blockNumber, err := hexutil.DecodeBig(args[0].(string))
+	Expect(err).NotTo(HaveOccurred())
+	gethHeader := &types.Header{Number: blockNumber, Difficulty: big.NewInt(0)}
+	for _, returnHeader := range client.returnPOWHeaders {
+		if returnHeader.Number.Cmp(blockNumber) == 0 {
+			gethHeader = returnHeader
+		}
+	}
+	header, err := json.Marshal(gethHeader)
+	Expect(err).NotTo(HaveOccurred())
+	var block map[string]interface{}
+	Expect(json.Unmarshal(header, &block)).To(Succeed())
+	uncles := []common.Hash{}
+	for _, uncle := range client.returnUncles {
+		uncles = append(uncles, uncle.Hash())
+	}
+	block["uncles"] = uncles
+	txHashes := client.returnTxHashes
+	if txHashes == nil {
+		txHashes = []common.Hash{}
+	}
+	block["transactions"] = txHashes
+	raw, err := json.Marshal(block)
+	Expect(err).NotTo(HaveOccurred())
+	return raw
+}
+
+// rawUncle returns the eth_getUncleByBlockHashAndIndex JSON response for the index requested by the arguments
+func (client *MockRPCClient) rawUncle(args []interface{}) json.RawMessage {
+	Expect(args).To(HaveLen(2))
+	index := int(args[1].(hexutil.Uint))
+	if index >= len(client.returnUncles) {
+		return json.RawMessage("null")
+	}
+	raw, err := json.Marshal(client.returnUncles[index])
+	Expect(err).NotTo(HaveOccurred())
+	return raw
+}
+
 func (client *MockRPCClient) AssertCallContextCalledWith(ctx context.Context, result interface{}, method string) {
 	Expect(client.passedContext).To(Equal(ctx))
 	Expect(client.passedResult).To(BeAssignableToTypeOf(result))
 	Expect(client.passedMethod).To(Equal(method))
 }
 
+func (client *MockRPCClient) AssertBatchCallCount(count int) {
+	Expect(len(client.passedBatches)).To(Equal(count))
+}
+
+// AssertBatchElemCalledWith asserts the arguments of the request at the index of the last batch
+func (client *MockRPCClient) AssertBatchElemCalledWith(index int, args []interface{}) {
+	Expect(len(client.passedBatch)).To(BeNumerically(">", index))
+	Expect(client.passedBatch[index].Args).To(Equal(args))
+}
+
 func (client *MockRPCClient) AssertBatchCalledWith(method string, lengthOfBatch int) {
 	Expect(client.lengthOfBatch).To(Equal(lengthOfBatch))
 	for _, batch := range client.passedBatch {
@@ -0,0 +1,112 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fakes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NATSMessage is a message received by a NATSServer
+type NATSMessage struct {
+	Subject string
+	Data    []byte
+}
+
+// NATSServer is a local stand-in for a NATS server which speaks enough of the client protocol
+// to accept connections and record published messages
+type NATSServer struct {
+	listener net.Listener
+	lock     sync.Mutex
+	messages []NATSMessage
+}
+
+// NewNATSServer starts a NATSServer listening on a random local port
+func NewNATSServer() (*NATSServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &NATSServer{listener: listener}
+	go server.accept()
+	return server, nil
+}
+
+// URL returns the nats:// url of the server
+func (server *NATSServer) URL() string {
+	return "nats://" + server.listener.Addr().String()
+}
+
+// Messages returns the messages published so far
+func (server *NATSServer) Messages() []NATSMessage {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]NATSMessage(nil), server.messages...)
+}
+
+// Close stops accepting connections
+func (server *NATSServer) Close() error {
+	return server.listener.Close()
+}
+
+func (server *NATSServer) accept() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.serve(conn)
+	}
+}
+
+func (server *NATSServer) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.1.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			// PUB <subject> [reply-to] <#bytes>
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return
+			}
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return
+			}
+			server.lock.Lock()
+			server.messages = append(server.messages, NATSMessage{Subject: fields[1], Data: data[:size]})
+			server.lock.Unlock()
+		}
+	}
+}
@@ -17,10 +17,13 @@
 package fetcher
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"strconv"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/sirupsen/logrus"
@@ -29,9 +32,14 @@ import (
 	"github.com/vulcanize/eth-header-sync/pkg/client"
 	"github.com/vulcanize/eth-header-sync/pkg/converter"
 	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
 )
 
-var ErrEmptyHeader = errors.New("empty header returned over RPC")
+var (
+	ErrEmptyHeader   = errors.New("empty header returned over RPC")
+	ErrEmptyUncle    = errors.New("empty uncle returned over RPC")
+	ErrUncleMismatch = errors.New("uncle returned over RPC is not the one listed by its block")
+)
 
 const MAX_BATCH_SIZE = 100
 
@@ -41,6 +49,14 @@ type Fetcher struct {
 	headerConverter converter.HeaderConverter
 	node            core.Node
 	rpcClient       core.RPCClient
+	fetchUncles     bool
+	fetchTxHashes   bool
+}
+
+// rpcBlock holds the fields of an eth_getBlockByNumber response which are not part of the header
+type rpcBlock struct {
+	Uncles       []common.Hash `json:"uncles"`
+	Transactions []common.Hash `json:"transactions"`
 }
 
 // NewFetcher returns a new Fetcher
@@ -56,7 +72,7 @@ func NewFetcher(ethClient core.EthClient, rpcClient core.RPCClient, node core.No
 // GetHeaderByNumber fetches the header for the provided block number
 func (fetcher *Fetcher) GetHeaderByNumber(blockNumber int64) (header core.Header, err error) {
 	logrus.Debugf("GetHeaderByNumber called with block %d", blockNumber)
-	if fetcher.node.NetworkID == string(core.KOVAN_NETWORK_ID) {
+	if fetcher.node.NetworkID == strconv.Itoa(core.KOVAN_NETWORK_ID) {
 		return fetcher.getPOAHeader(blockNumber)
 	}
 	return fetcher.getPOWHeader(blockNumber)
@@ -65,7 +81,7 @@ func (fetcher *Fetcher) GetHeaderByNumber(blockNumber int64) (header core.Header
 // GetHeadersByNumbers batch fetches all of the headers for the provided block numbers
 func (fetcher *Fetcher) GetHeadersByNumbers(blockNumbers []int64) (header []core.Header, err error) {
 	logrus.Debug("GetHeadersByNumbers called")
-	if fetcher.node.NetworkID == string(core.KOVAN_NETWORK_ID) {
+	if fetcher.node.NetworkID == strconv.Itoa(core.KOVAN_NETWORK_ID) {
 		return fetcher.getPOAHeaders(blockNumbers)
 	}
 	return fetcher.getPOWHeaders(blockNumbers)
@@ -73,44 +89,73 @@ func (fetcher *Fetcher) GetHeadersByNumbers(blockNumbers []int64) (header []core
 
 // LastBlock determines and returns the latest block number
 func (fetcher *Fetcher) LastBlock() (*big.Int, error) {
-	block, err := fetcher.ethClient.HeaderByNumber(context.Background(), nil)
+	block, err := fetcher.headerByNumber(nil)
 	if err != nil {
 		return big.NewInt(0), err
 	}
 	return block.Number, err
 }
 
+// SetRawEncoding sets which raw encodings are produced for the fetched headers
+func (fetcher *Fetcher) SetRawEncoding(encoding converter.RawEncoding) {
+	fetcher.headerConverter.Encoding = encoding
+}
+
+// SetFetchUncles sets whether the uncles included by each header are fetched alongside it
+func (fetcher *Fetcher) SetFetchUncles(fetchUncles bool) {
+	fetcher.fetchUncles = fetchUncles
+}
+
+// SetFetchTransactionHashes sets whether the transaction hashes of each block are kept alongside its header
+func (fetcher *Fetcher) SetFetchTransactionHashes(fetchTxHashes bool) {
+	fetcher.fetchTxHashes = fetchTxHashes
+}
+
 // Node returns the node info associated with this Fetcher
 func (fetcher *Fetcher) Node() core.Node {
 	return fetcher.node
 }
 
+// headerByNumber fetches a header from the node, recording the request in the metrics
+func (fetcher *Fetcher) headerByNumber(number *big.Int) (*types.Header, error) {
+	header, err := fetcher.ethClient.HeaderByNumber(context.Background(), number)
+	metrics.ObserveRPCCall("eth_getBlockByNumber", err)
+	return header, err
+}
+
+// callContext makes a request to the node, recording it in the metrics
+func (fetcher *Fetcher) callContext(result interface{}, method string, args ...interface{}) error {
+	err := fetcher.rpcClient.CallContext(context.Background(), result, method, args...)
+	metrics.ObserveRPCCall(method, err)
+	return err
+}
+
+// batchCall sends a batch of requests to the node, recording each of them and the batch size in the metrics
+func (fetcher *Fetcher) batchCall(batch []client.BatchElem) error {
+	err := fetcher.rpcClient.BatchCall(batch)
+	metrics.RPCBatchSize.Observe(float64(len(batch)))
+	for _, elem := range batch {
+		metrics.ObserveRPCCall(elem.Method, err)
+	}
+	return err
+}
+
 func (fetcher *Fetcher) getPOAHeader(blockNumber int64) (header core.Header, err error) {
 	var POAHeader core.POAHeader
 	blockNumberArg := hexutil.EncodeBig(big.NewInt(blockNumber))
 	includeTransactions := false
-	err = fetcher.rpcClient.CallContext(context.Background(), &POAHeader, "eth_getBlockByNumber", blockNumberArg, includeTransactions)
+	err = fetcher.callContext(&POAHeader, "eth_getBlockByNumber", blockNumberArg, includeTransactions)
 	if err != nil {
 		return header, err
 	}
 	if POAHeader.Number == nil {
 		return header, ErrEmptyHeader
 	}
-	return fetcher.headerConverter.Convert(&types.Header{
-		ParentHash:  POAHeader.ParentHash,
-		UncleHash:   POAHeader.UncleHash,
-		Coinbase:    POAHeader.Coinbase,
-		Root:        POAHeader.Root,
-		TxHash:      POAHeader.TxHash,
-		ReceiptHash: POAHeader.ReceiptHash,
-		Bloom:       POAHeader.Bloom,
-		Difficulty:  POAHeader.Difficulty.ToInt(),
-		Number:      POAHeader.Number.ToInt(),
-		GasLimit:    uint64(POAHeader.GasLimit),
-		GasUsed:     uint64(POAHeader.GasUsed),
-		Time:        uint64(POAHeader.Time),
-		Extra:       POAHeader.Extra,
-	}, POAHeader.Hash.String()), nil
+	headers := []core.Header{fetcher.convertPOAHeader(POAHeader)}
+	if fetcher.fetchUncles {
+		err = fetcher.getUncles(headers, [][]common.Hash{POAHeader.Uncles})
+	}
+	return headers[0], err
 }
 
 func (blockChain *Fetcher) getPOAHeaders(blockNumbers []int64) (headers []core.Header, err error) {
@@ -136,49 +181,111 @@ func (blockChain *Fetcher) getPOAHeaders(blockNumbers []int64) (headers []core.H
 		batch = append(batch, batchElem)
 	}
 
-	err = blockChain.rpcClient.BatchCall(batch)
+	err = blockChain.batchCall(batch)
 	if err != nil {
 		return headers, err
 	}
 
+	var uncleHashes [][]common.Hash
 	for _, POAHeader := range POAHeaders {
-		var header core.Header
 		//Header.Number of the newest block will return nil.
 		if _, err := strconv.ParseUint(POAHeader.Number.ToInt().String(), 16, 64); err == nil {
-			header = blockChain.headerConverter.Convert(&types.Header{
-				ParentHash:  POAHeader.ParentHash,
-				UncleHash:   POAHeader.UncleHash,
-				Coinbase:    POAHeader.Coinbase,
-				Root:        POAHeader.Root,
-				TxHash:      POAHeader.TxHash,
-				ReceiptHash: POAHeader.ReceiptHash,
-				Bloom:       POAHeader.Bloom,
-				Difficulty:  POAHeader.Difficulty.ToInt(),
-				Number:      POAHeader.Number.ToInt(),
-				GasLimit:    uint64(POAHeader.GasLimit),
-				GasUsed:     uint64(POAHeader.GasUsed),
-				Time:        uint64(POAHeader.Time),
-				Extra:       POAHeader.Extra,
-			}, POAHeader.Hash.String())
-
-			headers = append(headers, header)
+			headers = append(headers, blockChain.convertPOAHeader(POAHeader))
+			uncleHashes = append(uncleHashes, POAHeader.Uncles)
 		}
 	}
 
+	if blockChain.fetchUncles {
+		err = blockChain.getUncles(headers, uncleHashes)
+	}
 	return headers, err
 }
 
+// convertPOAHeader converts the POA header, keeping the transaction hashes returned alongside it if enabled
+func (fetcher *Fetcher) convertPOAHeader(POAHeader core.POAHeader) core.Header {
+	header := fetcher.headerConverter.Convert(&types.Header{
+		ParentHash:  POAHeader.ParentHash,
+		UncleHash:   POAHeader.UncleHash,
+		Coinbase:    POAHeader.Coinbase,
+		Root:        POAHeader.Root,
+		TxHash:      POAHeader.TxHash,
+		ReceiptHash: POAHeader.ReceiptHash,
+		Bloom:       POAHeader.Bloom,
+		Difficulty:  POAHeader.Difficulty.ToInt(),
+		Number:      POAHeader.Number.ToInt(),
+		GasLimit:    uint64(POAHeader.GasLimit),
+		GasUsed:     uint64(POAHeader.GasUsed),
+		Time:        uint64(POAHeader.Time),
+		Extra:       POAHeader.Extra,
+	}, POAHeader.Hash.String())
+	if fetcher.fetchTxHashes {
+		header.TransactionHashes = make([]string, len(POAHeader.Transactions))
+		for i, hash := range POAHeader.Transactions {
+			header.TransactionHashes[i] = hash.Hex()
+		}
+	}
+	return header
+}
+
 func (fetcher *Fetcher) getPOWHeader(blockNumber int64) (header core.Header, err error) {
-	gethHeader, err := fetcher.ethClient.HeaderByNumber(context.Background(), big.NewInt(blockNumber))
+	// The uncle and transaction hashes come from the same response as the header, so they belong to the same block
+	header, block, err := fetcher.getPOWBlock(blockNumber)
 	if err != nil {
 		return header, err
 	}
-	return fetcher.headerConverter.Convert(gethHeader, gethHeader.Hash().String()), nil
+	if fetcher.fetchUncles {
+		headers := []core.Header{header}
+		if err := fetcher.getUncles(headers, [][]common.Hash{block.Uncles}); err != nil {
+			return header, err
+		}
+		header = headers[0]
+	}
+	if fetcher.fetchTxHashes {
+		header.TransactionHashes = block.transactionHashes()
+	}
+	return header, err
+}
+
+// getPOWBlock fetches the block's header along with the hashes of its uncles and transactions
+func (fetcher *Fetcher) getPOWBlock(blockNumber int64) (core.Header, rpcBlock, error) {
+	var rawBlock json.RawMessage
+	blockNumberArg := hexutil.EncodeBig(big.NewInt(blockNumber))
+	err := fetcher.callContext(&rawBlock, "eth_getBlockByNumber", blockNumberArg, false)
+	if err != nil {
+		return core.Header{}, rpcBlock{}, err
+	}
+	if len(rawBlock) == 0 || string(rawBlock) == "null" {
+		return core.Header{}, rpcBlock{}, ErrEmptyHeader
+	}
+	return fetcher.convertPOWBlock(rawBlock)
+}
+
+// convertPOWBlock converts the header in an eth_getBlockByNumber response, decoding the block's other fields alongside it
+// The header is encoded from the response itself so it keeps the fields go-ethereum's header type does not have, and
+// a header which does not hash to the returned hash is rejected
+func (fetcher *Fetcher) convertPOWBlock(rawBlock json.RawMessage) (core.Header, rpcBlock, error) {
+	header, err := fetcher.headerConverter.ConvertJSON(rawBlock)
+	if err != nil {
+		return core.Header{}, rpcBlock{}, err
+	}
+	var block rpcBlock
+	if err := json.Unmarshal(rawBlock, &block); err != nil {
+		return core.Header{}, rpcBlock{}, err
+	}
+	return header, block, nil
+}
+
+func (block rpcBlock) transactionHashes() []string {
+	hashes := make([]string, len(block.Transactions))
+	for i, hash := range block.Transactions {
+		hashes[i] = hash.Hex()
+	}
+	return hashes
 }
 
 func (blockChain *Fetcher) getPOWHeaders(blockNumbers []int64) (headers []core.Header, err error) {
 	var batch []client.BatchElem
-	var POWHeaders [MAX_BATCH_SIZE]types.Header
+	var rawBlocks [MAX_BATCH_SIZE]json.RawMessage
 
 	for index, blockNumber := range blockNumbers {
 
@@ -190,24 +297,90 @@ func (blockChain *Fetcher) getPOWHeaders(blockNumbers []int64) (headers []core.H
 
 		batchElem := client.BatchElem{
 			Method: "eth_getBlockByNumber",
-			Result: &POWHeaders[index],
+			Result: &rawBlocks[index],
 			Args:   []interface{}{blockNumberArg, false},
 		}
 
 		batch = append(batch, batchElem)
 	}
 
-	err = blockChain.rpcClient.BatchCall(batch)
+	err = blockChain.batchCall(batch)
 	if err != nil {
 		return headers, err
 	}
 
-	for _, POWHeader := range POWHeaders {
-		if POWHeader.Number != nil {
-			header := blockChain.headerConverter.Convert(&POWHeader, POWHeader.Hash().String())
-			headers = append(headers, header)
+	var uncleHashes [][]common.Hash
+	for _, rawBlock := range rawBlocks {
+		// Blocks beyond the head of the chain are returned as null
+		if len(rawBlock) == 0 || string(rawBlock) == "null" {
+			continue
+		}
+		header, block, err := blockChain.convertPOWBlock(rawBlock)
+		if err != nil {
+			return headers, err
+		}
+		if blockChain.fetchTxHashes {
+			header.TransactionHashes = block.transactionHashes()
 		}
+		headers = append(headers, header)
+		uncleHashes = append(uncleHashes, block.Uncles)
 	}
 
+	if blockChain.fetchUncles {
+		err = blockChain.getUncles(headers, uncleHashes)
+	}
 	return headers, err
 }
+
+// getUncles batch fetches the uncles included by each header, uncleHashes holds the hashes of each header's uncles
+// as returned with the header
+// The uncles are requested by the hash of the including block, so a reorg in between cannot swap in another block's
+// uncles, and each must hash to the hash listed for it
+func (blockChain *Fetcher) getUncles(headers []core.Header, uncleHashes [][]common.Hash) error {
+	type uncleRef struct {
+		header int
+		index  int
+	}
+	var refs []uncleRef
+	for i, hashes := range uncleHashes {
+		for index := range hashes {
+			refs = append(refs, uncleRef{header: i, index: index})
+		}
+	}
+	for start := 0; start < len(refs); start += MAX_BATCH_SIZE {
+		end := start + MAX_BATCH_SIZE
+		if end > len(refs) {
+			end = len(refs)
+		}
+		uncles := make([]json.RawMessage, end-start)
+		batch := make([]client.BatchElem, end-start)
+		for i, ref := range refs[start:end] {
+			batch[i] = client.BatchElem{
+				Method: "eth_getUncleByBlockHashAndIndex",
+				Result: &uncles[i],
+				Args:   []interface{}{headers[ref.header].Hash, hexutil.Uint(ref.index)},
+			}
+		}
+		if err := blockChain.batchCall(batch); err != nil {
+			return err
+		}
+		for i, ref := range refs[start:end] {
+			if batch[i].Error != nil {
+				return batch[i].Error
+			}
+			if len(uncles[i]) == 0 || string(uncles[i]) == "null" {
+				return ErrEmptyUncle
+			}
+			uncle, err := blockChain.headerConverter.ConvertUncleJSON(uncles[i], ref.index)
+			if err != nil {
+				return err
+			}
+			if expected := uncleHashes[ref.header][ref.index].Hex(); uncle.Hash != expected {
+				return fmt.Errorf("%w: uncle %d of block %d is %s, the block lists %s",
+					ErrUncleMismatch, ref.index, headers[ref.header].BlockNumber, uncle.Hash, expected)
+			}
+			headers[ref.header].Uncles = append(headers[ref.header].Uncles, uncle)
+		}
+	}
+	return nil
+}
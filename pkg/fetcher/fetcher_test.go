@@ -17,18 +17,31 @@
 package fetcher_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"math/big"
+	"strconv"
+	"strings"
 
+	"github.com/vulcanize/eth-header-sync/pkg/client"
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
 	"github.com/vulcanize/eth-header-sync/pkg/fetcher"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	vulcCore "github.com/vulcanize/eth-header-sync/pkg/core"
 	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
 )
 
 var _ = Describe("Geth blockchain", func() {
@@ -48,18 +61,16 @@ var _ = Describe("Geth blockchain", func() {
 
 	Describe("getting a header", func() {
 		Describe("default/mainnet", func() {
-			It("fetches header from ethClient", func() {
-				blockNumber := int64(100)
-				mockClient.SetHeaderByNumberReturnHeader(&types.Header{Number: big.NewInt(blockNumber)})
-
-				_, err := fetch.GetHeaderByNumber(blockNumber)
+			It("fetches the header's JSON from rpcClient", func() {
+				header, err := fetch.GetHeaderByNumber(100)
 
 				Expect(err).NotTo(HaveOccurred())
-				mockClient.AssertHeaderByNumberCalledWith(context.Background(), big.NewInt(blockNumber))
+				Expect(header.BlockNumber).To(Equal(int64(100)))
+				mockRpcClient.AssertCallContextCalledWith(context.Background(), &json.RawMessage{}, "eth_getBlockByNumber")
 			})
 
-			It("returns err if ethClient returns err", func() {
-				mockClient.SetHeaderByNumberErr(fakes.FakeError)
+			It("returns err if rpcClient returns err", func() {
+				mockRpcClient.SetCallContextErr(fakes.FakeError)
 
 				_, err := fetch.GetHeaderByNumber(100)
 
@@ -68,16 +79,224 @@ var _ = Describe("Geth blockchain", func() {
 			})
 
 			It("fetches headers with multiple blocks", func() {
-				_, err := fetch.GetHeadersByNumbers([]int64{100, 99})
+				headers, err := fetch.GetHeadersByNumbers([]int64{100, 99})
 
 				Expect(err).NotTo(HaveOccurred())
 				mockRpcClient.AssertBatchCalledWith("eth_getBlockByNumber", 2)
+				Expect(headers).To(HaveLen(2))
+				Expect(headers[0].BlockNumber).To(Equal(int64(100)))
+				Expect(headers[1].BlockNumber).To(Equal(int64(99)))
+			})
+
+			It("keeps the consensus encoding and hash of a post-London header", func() {
+				mockRpcClient.SetReturnRawBlock(fakes.HoleskyGenesisJSON)
+				fetch.SetRawEncoding(converter.JSONAndRLP)
+
+				header, err := fetch.GetHeaderByNumber(0)
+				Expect(err).NotTo(HaveOccurred())
+				headers, err := fetch.GetHeadersByNumbers([]int64{0})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(header.Hash).To(Equal(fakes.HoleskyGenesisHash.Hex()))
+				Expect(crypto.Keccak256Hash(header.RLP)).To(Equal(fakes.HoleskyGenesisHash))
+				Expect(headers).To(Equal([]vulcCore.Header{header}))
+			})
+
+			It("rejects a header which does not hash to the returned hash", func() {
+				mockRpcClient.SetReturnRawBlock(json.RawMessage(strings.Replace(string(fakes.HoleskyGenesisJSON), `"gasUsed":"0x0"`, `"gasUsed":"0x1"`, 1)))
+
+				_, err := fetch.GetHeaderByNumber(0)
+				Expect(errors.Is(err, converter.ErrHashMismatch)).To(BeTrue())
+				_, err = fetch.GetHeadersByNumbers([]int64{0})
+				Expect(errors.Is(err, converter.ErrHashMismatch)).To(BeTrue())
+			})
+
+			It("records the requests and their errors in the metrics", func() {
+				calls := metrics.RPCCalls.WithLabelValues("eth_getBlockByNumber")
+				errs := metrics.RPCErrors.WithLabelValues("eth_getBlockByNumber")
+				callsBefore, errsBefore := testutil.ToFloat64(calls), testutil.ToFloat64(errs)
+
+				_, err := fetch.GetHeadersByNumbers([]int64{100, 99})
+				Expect(err).NotTo(HaveOccurred())
+				mockRpcClient.SetCallContextErr(fakes.FakeError)
+				_, err = fetch.GetHeaderByNumber(100)
+				Expect(err).To(HaveOccurred())
+
+				Expect(testutil.ToFloat64(calls) - callsBefore).To(Equal(float64(3)))
+				Expect(testutil.ToFloat64(errs) - errsBefore).To(Equal(float64(1)))
+			})
+		})
+
+		Describe("uncles", func() {
+			var uncles []*types.Header
+
+			BeforeEach(func() {
+				uncles = []*types.Header{
+					{Number: big.NewInt(98), Difficulty: big.NewInt(1), Coinbase: common.Address{1}},
+					{Number: big.NewInt(99), Difficulty: big.NewInt(1), Coinbase: common.Address{2}},
+				}
+				mockRpcClient.SetReturnUncles(uncles)
+			})
+
+			It("does not fetch uncles unless enabled", func() {
+				headers, err := fetch.GetHeadersByNumbers([]int64{100})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(headers[0].Uncles).To(BeEmpty())
+				mockRpcClient.AssertBatchCallCount(1)
+			})
+
+			It("batch fetches the uncles included by each header", func() {
+				fetch.SetFetchUncles(true)
+
+				headers, err := fetch.GetHeadersByNumbers([]int64{100, 99})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(len(headers)).To(Equal(2))
+				Expect(len(headers[0].Uncles)).To(Equal(2))
+				Expect(headers[0].Uncles[1].Index).To(Equal(int64(1)))
+				Expect(headers[0].Uncles[1].Hash).To(Equal(uncles[1].Hash().Hex()))
+				Expect(headers[0].Uncles[1].Miner).To(Equal(uncles[1].Coinbase.Hex()))
+				mockRpcClient.AssertBatchCallCount(2)
+				mockRpcClient.AssertBatchCalledWith("eth_getUncleByBlockHashAndIndex", 4)
+			})
+
+			It("fetches the uncles by the hash of the including header", func() {
+				fetch.SetFetchUncles(true)
+
+				header, err := fetch.GetHeaderByNumber(100)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(len(header.Uncles)).To(Equal(2))
+				mockRpcClient.AssertBatchCalledWith("eth_getUncleByBlockHashAndIndex", 2)
+				mockRpcClient.AssertBatchElemCalledWith(1, []interface{}{header.Hash, hexutil.Uint(1)})
+			})
+
+			It("does not fetch uncles for a header without uncles", func() {
+				fetch.SetFetchUncles(true)
+				mockRpcClient.SetReturnUncles(nil)
+
+				header, err := fetch.GetHeaderByNumber(100)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(header.Uncles).To(BeEmpty())
+				mockRpcClient.AssertBatchCallCount(0)
+			})
+
+			It("rejects an uncle which is not the one listed by the including header", func() {
+				fetch.SetFetchUncles(true)
+				rawHeader, err := json.Marshal(&types.Header{Number: big.NewInt(100), Difficulty: big.NewInt(0)})
+				Expect(err).NotTo(HaveOccurred())
+				var block map[string]interface{}
+				Expect(json.Unmarshal(rawHeader, &block)).To(Succeed())
+				block["uncles"] = []common.Hash{uncles[1].Hash()}
+				rawBlock, err := json.Marshal(block)
+				Expect(err).NotTo(HaveOccurred())
+				mockRpcClient.SetReturnRawBlock(rawBlock)
+
+				_, err = fetch.GetHeaderByNumber(100)
+
+				Expect(errors.Is(err, fetcher.ErrUncleMismatch)).To(BeTrue())
+			})
+		})
+
+		Describe("transaction hashes", func() {
+			var txHashes []common.Hash
+
+			BeforeEach(func() {
+				txHashes = []common.Hash{{1}, {2}}
+				mockRpcClient.SetReturnTransactionHashes(txHashes)
+			})
+
+			It("does not keep transaction hashes unless enabled", func() {
+				headers, err := fetch.GetHeadersByNumbers([]int64{100})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(headers[0].TransactionHashes).To(BeEmpty())
+			})
+
+			It("keeps the transaction hashes returned with each batched header", func() {
+				fetch.SetFetchTransactionHashes(true)
+
+				headers, err := fetch.GetHeadersByNumbers([]int64{100, 99})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(headers[1].TransactionHashes).To(Equal([]string{txHashes[0].Hex(), txHashes[1].Hex()}))
+				mockRpcClient.AssertBatchCallCount(1)
+			})
+
+			It("fetches the transaction hashes for a single header", func() {
+				fetch.SetFetchTransactionHashes(true)
+
+				header, err := fetch.GetHeaderByNumber(100)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(header.TransactionHashes).To(Equal([]string{txHashes[0].Hex(), txHashes[1].Hex()}))
+				mockRpcClient.AssertCallContextCalledWith(context.Background(), &json.RawMessage{}, "eth_getBlockByNumber")
+			})
+
+			It("takes the header of a single block from the same response as its transaction hashes", func() {
+				fetch.SetFetchTransactionHashes(true)
+				mockClient.SetHeaderByNumberErr(fakes.FakeError)
+
+				header, err := fetch.GetHeaderByNumber(100)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(header.BlockNumber).To(Equal(int64(100)))
+				Expect(header.TransactionHashes).To(Equal([]string{txHashes[0].Hex(), txHashes[1].Hex()}))
+			})
+		})
+
+		Describe("recorded POA/Kovan traffic", func() {
+			It("replays the headers recorded from a node through the POA path", func() {
+				chain := simulated.NewChain(20)
+				chain.SetMissing(13, true)
+				server, err := simulated.NewServer(chain, "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+				defer server.Close()
+				rawClient, err := rpc.Dial(server.URL())
+				Expect(err).NotTo(HaveOccurred())
+				defer rawClient.Close()
+				fixture := new(bytes.Buffer)
+				recorder := client.NewRecordingRPCClient(client.NewRPCClient(rawClient, server.URL()), fixture)
+				node.NetworkID = strconv.Itoa(vulcCore.KOVAN_NETWORK_ID)
+				_, err = fetcher.NewFetcher(client.NewEthClient(recorder), recorder, node).GetHeadersByNumbers([]int64{10, 11, 12, 13})
+				Expect(err).NotTo(HaveOccurred())
+				replayClient, err := client.ReadReplayClient(fixture)
+				Expect(err).NotTo(HaveOccurred())
+				fetch = fetcher.NewFetcher(replayClient, replayClient, node)
+
+				header, err := fetch.GetHeaderByNumber(10)
+				Expect(err).NotTo(HaveOccurred())
+				headers, err := fetch.GetHeadersByNumbers([]int64{11, 12, 13})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(header.Hash).To(Equal(chain.Header(10).Hash().Hex()))
+				Expect(headers).To(HaveLen(2))
+				Expect(headers[0].BlockNumber).To(Equal(int64(11)))
+				Expect(headers[1].Hash).To(Equal(chain.Header(12).Hash().Hex()))
+				var raw types.Header
+				Expect(json.Unmarshal(headers[0].Raw, &raw)).To(Succeed())
+				Expect(raw.ParentHash.Hex()).To(Equal(header.Hash))
 			})
 		})
 
 		Describe("POA/Kovan", func() {
+			It("takes the POA path for a node reporting the decimal Kovan network id", func() {
+				node.NetworkID = "42"
+				blockNumber := hexutil.Big(*big.NewInt(100))
+				mockRpcClient.SetReturnPOAHeader(vulcCore.POAHeader{Number: &blockNumber})
+				fetch = fetcher.NewFetcher(mockClient, mockRpcClient, node)
+
+				header, err := fetch.GetHeaderByNumber(100)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(header.BlockNumber).To(Equal(int64(100)))
+				mockRpcClient.AssertCallContextCalledWith(context.Background(), &vulcCore.POAHeader{}, "eth_getBlockByNumber")
+			})
+
 			It("fetches header from rpcClient", func() {
-				node.NetworkID = string(vulcCore.KOVAN_NETWORK_ID)
+				node.NetworkID = strconv.Itoa(vulcCore.KOVAN_NETWORK_ID)
 				blockNumber := hexutil.Big(*big.NewInt(100))
 				mockRpcClient.SetReturnPOAHeader(vulcCore.POAHeader{Number: &blockNumber})
 				fetch = fetcher.NewFetcher(mockClient, mockRpcClient, node)
@@ -89,7 +308,7 @@ var _ = Describe("Geth blockchain", func() {
 			})
 
 			It("returns err if rpcClient returns err", func() {
-				node.NetworkID = string(vulcCore.KOVAN_NETWORK_ID)
+				node.NetworkID = strconv.Itoa(vulcCore.KOVAN_NETWORK_ID)
 				mockRpcClient.SetCallContextErr(fakes.FakeError)
 				fetch = fetcher.NewFetcher(mockClient, mockRpcClient, node)
 
@@ -100,7 +319,7 @@ var _ = Describe("Geth blockchain", func() {
 			})
 
 			It("returns error if returned header is empty", func() {
-				node.NetworkID = string(vulcCore.KOVAN_NETWORK_ID)
+				node.NetworkID = strconv.Itoa(vulcCore.KOVAN_NETWORK_ID)
 				fetch = fetcher.NewFetcher(mockClient, mockRpcClient, node)
 
 				_, err := fetch.GetHeaderByNumber(100)
@@ -109,8 +328,41 @@ var _ = Describe("Geth blockchain", func() {
 				Expect(err).To(MatchError(fetcher.ErrEmptyHeader))
 			})
 
+			It("keeps the transaction hashes returned with the header", func() {
+				node.NetworkID = strconv.Itoa(vulcCore.KOVAN_NETWORK_ID)
+				blockNumber := hexutil.Big(*big.NewInt(100))
+				txHashes := []common.Hash{{1}, {2}}
+				mockRpcClient.SetReturnPOAHeader(vulcCore.POAHeader{Number: &blockNumber, Transactions: txHashes})
+				fetch = fetcher.NewFetcher(mockClient, mockRpcClient, node)
+				fetch.SetFetchTransactionHashes(true)
+
+				header, err := fetch.GetHeaderByNumber(100)
+				Expect(err).NotTo(HaveOccurred())
+				headers, err := fetch.GetHeadersByNumbers([]int64{100})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(header.TransactionHashes).To(Equal([]string{txHashes[0].Hex(), txHashes[1].Hex()}))
+				Expect(headers[0].TransactionHashes).To(Equal(header.TransactionHashes))
+			})
+
+			It("fetches the uncles included by the header", func() {
+				node.NetworkID = strconv.Itoa(vulcCore.KOVAN_NETWORK_ID)
+				blockNumber := hexutil.Big(*big.NewInt(100))
+				uncle := &types.Header{Number: big.NewInt(99), Difficulty: big.NewInt(1)}
+				mockRpcClient.SetReturnUncles([]*types.Header{uncle})
+				mockRpcClient.SetReturnPOAHeader(vulcCore.POAHeader{Number: &blockNumber, Uncles: []common.Hash{uncle.Hash()}})
+				fetch = fetcher.NewFetcher(mockClient, mockRpcClient, node)
+				fetch.SetFetchUncles(true)
+
+				header, err := fetch.GetHeaderByNumber(100)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(header.Uncles).To(HaveLen(1))
+				mockRpcClient.AssertBatchCalledWith("eth_getUncleByBlockHashAndIndex", 1)
+			})
+
 			It("returns multiple headers with multiple blocknumbers", func() {
-				node.NetworkID = string(vulcCore.KOVAN_NETWORK_ID)
+				node.NetworkID = strconv.Itoa(vulcCore.KOVAN_NETWORK_ID)
 				blockNumber := hexutil.Big(*big.NewInt(100))
 				mockRpcClient.SetReturnPOAHeaders([]vulcCore.POAHeader{{Number: &blockNumber}})
 
@@ -0,0 +1,224 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Messages of the graphql-ws subprotocol used by subscriptions-transport-ws clients
+const (
+	wsProtocol            = "graphql-ws"
+	wsConnectionInit      = "connection_init"
+	wsConnectionAck       = "connection_ack"
+	wsConnectionTerminate = "connection_terminate"
+	wsStart               = "start"
+	wsStop                = "stop"
+	wsData                = "data"
+	wsError               = "error"
+	wsComplete            = "complete"
+)
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Handler serves the schema over HTTP, for queries, and over websockets using the graphql-ws subprotocol,
+// for queries and subscriptions
+type Handler struct {
+	schema   *graphqlgo.Schema
+	upgrader websocket.Upgrader
+}
+
+// NewHandler returns a Handler for the schema, allowedOrigins are the websocket origins accepted, "*" accepts any,
+// websocket requests without an Origin are only accepted when any origin is
+func NewHandler(schema *graphqlgo.Schema, allowedOrigins []string) *Handler {
+	return &Handler{
+		schema: schema,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{wsProtocol},
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				for _, allowed := range allowedOrigins {
+					if allowed == "*" || (origin != "" && strings.EqualFold(allowed, origin)) {
+						return true
+					}
+				}
+				return false
+			},
+		},
+	}
+}
+
+// ServeHTTP executes a GET or POST request, or upgrades the connection to a websocket
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		handler.serveWebsocket(w, r)
+		return
+	}
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	response := handler.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error("graphql: error writing response: ", err)
+	}
+}
+
+func (handler *Handler) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := handler.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("graphql: error upgrading connection: ", err)
+		return
+	}
+	session := &wsSession{conn: conn, schema: handler.schema, operations: make(map[string]*wsOperation)}
+	session.serve(r.Context())
+}
+
+// wsSession runs the operations started on a single websocket connection
+type wsSession struct {
+	conn       *websocket.Conn
+	schema     *graphqlgo.Schema
+	writeLock  sync.Mutex
+	lock       sync.Mutex
+	operations map[string]*wsOperation
+}
+
+type wsOperation struct {
+	cancel context.CancelFunc
+}
+
+func (session *wsSession) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer session.conn.Close()
+	for {
+		var message wsMessage
+		if err := session.conn.ReadJSON(&message); err != nil {
+			return
+		}
+		switch message.Type {
+		case wsConnectionInit:
+			session.write(wsMessage{Type: wsConnectionAck})
+		case wsStart:
+			var req request
+			if err := json.Unmarshal(message.Payload, &req); err != nil {
+				session.writePayload(message.ID, wsError, map[string]string{"message": err.Error()})
+				continue
+			}
+			session.start(ctx, message.ID, req)
+		case wsStop:
+			session.stop(message.ID)
+		case wsConnectionTerminate:
+			return
+		}
+	}
+}
+
+func (session *wsSession) start(ctx context.Context, id string, req request) {
+	ctx, cancel := context.WithCancel(ctx)
+	responses, err := session.schema.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		cancel()
+		session.writePayload(id, wsError, map[string]string{"message": err.Error()})
+		return
+	}
+	operation := &wsOperation{cancel: cancel}
+	session.lock.Lock()
+	if previous, ok := session.operations[id]; ok {
+		previous.cancel()
+	}
+	session.operations[id] = operation
+	session.lock.Unlock()
+	go func() {
+		// The responses channel must be drained until it is closed, even once the operation is stopped
+		for response := range responses {
+			if ctx.Err() == nil {
+				session.writePayload(id, wsData, response)
+			}
+		}
+		if ctx.Err() == nil {
+			session.write(wsMessage{ID: id, Type: wsComplete})
+		}
+		session.lock.Lock()
+		if session.operations[id] == operation {
+			delete(session.operations, id)
+		}
+		session.lock.Unlock()
+		cancel()
+	}()
+}
+
+func (session *wsSession) stop(id string) {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	if operation, ok := session.operations[id]; ok {
+		operation.cancel()
+		delete(session.operations, id)
+	}
+}
+
+func (session *wsSession) writePayload(id, messageType string, payload interface{}) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("graphql: error encoding payload: ", err)
+		return
+	}
+	session.write(wsMessage{ID: id, Type: messageType, Payload: encoded})
+}
+
+func (session *wsSession) write(message wsMessage) {
+	session.writeLock.Lock()
+	defer session.writeLock.Unlock()
+	if err := session.conn.WriteJSON(message); err != nil {
+		log.Debug("graphql: error writing message: ", err)
+	}
+}
@@ -0,0 +1,164 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphql_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/graphql"
+	"github.com/vulcanize/eth-header-sync/pkg/listener"
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+var _ = Describe("GraphQL handler", func() {
+	var (
+		chain      = makeChain(3)
+		repository *fakes.MockHeaderRepository
+		events     chan core.HeaderEvent
+		server     *httptest.Server
+	)
+
+	BeforeEach(func() {
+		repository = fakes.NewMockHeaderRepository()
+		repository.SetStoredHeaders(storedHeaders(chain[:2])...)
+		events = make(chan core.HeaderEvent)
+		resolver := graphql.NewResolver(func(string) core.HeaderRepository { return repository }, "x123", listener.NewHeaderBroadcaster(events))
+		schema, err := graphql.NewSchema(resolver)
+		Expect(err).NotTo(HaveOccurred())
+		server = httptest.NewServer(graphql.NewHandler(schema, []string{"*"}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		close(events)
+	})
+
+	It("executes queries posted over HTTP", func() {
+		body, err := json.Marshal(map[string]interface{}{"query": `query($n: Long!) { header(number: $n) { hash } }`, "variables": map[string]interface{}{"n": 2}})
+		Expect(err).NotTo(HaveOccurred())
+
+		res, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		var response struct {
+			Data struct{ Header struct{ Hash string } }
+		}
+		Expect(json.NewDecoder(res.Body).Decode(&response)).To(Succeed())
+		Expect(response.Data.Header.Hash).To(Equal(chain[1].Hash().Hex()))
+	})
+
+	It("accepts websockets only from allowed origins", func() {
+		schema, err := graphql.NewSchema(graphql.NewResolver(func(string) core.HeaderRepository { return repository }, "x123", nil))
+		Expect(err).NotTo(HaveOccurred())
+		restricted := httptest.NewServer(graphql.NewHandler(schema, []string{"https://example.com"}))
+		defer restricted.Close()
+		dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+		url := "ws" + strings.TrimPrefix(restricted.URL, "http")
+
+		conn, _, err := dialer.Dial(url, http.Header{"Origin": []string{"https://example.com"}})
+		Expect(err).NotTo(HaveOccurred())
+		conn.Close()
+		_, _, err = dialer.Dial(url, http.Header{"Origin": []string{"https://other.com"}})
+		Expect(err).To(HaveOccurred())
+		_, _, err = dialer.Dial(url, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("subscriptions", func() {
+		var conn *websocket.Conn
+
+		BeforeEach(func() {
+			dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+			var err error
+			conn, _, err = dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.WriteJSON(wsMessage{Type: "connection_init"})).To(Succeed())
+			Expect(read(conn).Type).To(Equal("connection_ack"))
+		})
+
+		AfterEach(func() {
+			conn.Close()
+		})
+
+		start := func(id, query string) {
+			payload, err := json.Marshal(map[string]string{"query": query})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.WriteJSON(wsMessage{ID: id, Type: "start", Payload: payload})).To(Succeed())
+			// Give the subscription time to register with the broadcaster
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		It("sends new heads", func() {
+			start("1", `subscription { newHeads { number hash } }`)
+			repository.SetStoredHeaders(storedHeaders(chain)...)
+
+			events <- core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 3, Hash: chain[2].Hash().Hex(), Fingerprint: "x123"}
+			events <- core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 1, Hash: chain[0].Hash().Hex(), Fingerprint: "x123"}
+			events <- core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 3, Hash: chain[2].Hash().Hex(), Fingerprint: "other"}
+
+			message := read(conn)
+			Expect(message.ID).To(Equal("1"))
+			Expect(message.Type).To(Equal("data"))
+			Expect(message.Payload).To(MatchJSON(`{"data":{"newHeads":{"number":3,"hash":"` + chain[2].Hash().Hex() + `"}}}`))
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			_, _, err := conn.ReadMessage()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("sends reorgs", func() {
+			start("2", `subscription { reorgs { type number hash previousHash header { number } } }`)
+
+			events <- core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 2, Hash: chain[1].Hash().Hex(), Fingerprint: "x123"}
+			events <- core.HeaderEvent{Type: core.HeaderReplaced, BlockNumber: 2, Hash: chain[1].Hash().Hex(), PreviousHash: "0xold", Fingerprint: "x123"}
+
+			message := read(conn)
+			Expect(message.Type).To(Equal("data"))
+			Expect(message.Payload).To(MatchJSON(`{"data":{"reorgs":{"type":"replace","number":2,"hash":"` + chain[1].Hash().Hex() + `","previousHash":"0xold","header":{"number":2}}}}`))
+		})
+
+		It("completes queries", func() {
+			start("3", `{ head { number } }`)
+
+			Expect(read(conn).Payload).To(MatchJSON(`{"data":{"head":{"number":2}}}`))
+			Expect(read(conn)).To(Equal(wsMessage{ID: "3", Type: "complete"}))
+		})
+	})
+})
+
+func read(conn *websocket.Conn) wsMessage {
+	var message wsMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	Expect(conn.ReadJSON(&message)).To(Succeed())
+	return message
+}
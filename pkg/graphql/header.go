@@ -0,0 +1,267 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// Header resolves the fields of a stored header, decoding its raw header on first use
+type Header struct {
+	header      core.Header
+	repository  core.HeaderRepository
+	fingerprint string
+
+	once       sync.Once
+	gethHeader *types.Header
+	extensions map[string]interface{}
+	err        error
+}
+
+func newHeader(header core.Header, repository core.HeaderRepository, fingerprint string) *Header {
+	return &Header{header: header, repository: repository, fingerprint: fingerprint}
+}
+
+func (header *Header) decode() (*types.Header, error) {
+	header.once.Do(func() {
+		header.gethHeader, header.err = converter.DecodeHeader(header.header)
+		if header.err == nil {
+			header.extensions, header.err = converter.HeaderExtensions(header.header)
+		}
+	})
+	return header.gethHeader, header.err
+}
+
+func (header *Header) Number() Long {
+	return Long(header.header.BlockNumber)
+}
+
+func (header *Header) Hash() string {
+	return header.header.Hash
+}
+
+func (header *Header) Fingerprint() string {
+	return header.fingerprint
+}
+
+func (header *Header) ParentHash() (string, error) {
+	gethHeader, err := header.decode()
+	if err != nil {
+		return "", err
+	}
+	return gethHeader.ParentHash.Hex(), nil
+}
+
+// Parent resolves the stored header with this header's parent hash
+func (header *Header) Parent() (*Header, error) {
+	parentHash, err := header.ParentHash()
+	if err != nil {
+		return nil, err
+	}
+	parent, err := header.repository.GetHeaderByHash(parentHash)
+	return storedHeader(parent, err, header.repository, header.fingerprint)
+}
+
+func (header *Header) Timestamp() (Long, error) {
+	gethHeader, err := header.decode()
+	if err != nil {
+		return 0, err
+	}
+	return Long(gethHeader.Time), nil
+}
+
+func (header *Header) Nonce() (string, error) {
+	return header.hex(func(gethHeader *types.Header) []byte { return gethHeader.Nonce[:] })
+}
+
+func (header *Header) MixHash() (string, error) {
+	return header.hex(func(gethHeader *types.Header) []byte { return gethHeader.MixDigest.Bytes() })
+}
+
+func (header *Header) UnclesHash() (string, error) {
+	return header.hex(func(gethHeader *types.Header) []byte { return gethHeader.UncleHash.Bytes() })
+}
+
+func (header *Header) LogsBloom() (string, error) {
+	return header.hex(func(gethHeader *types.Header) []byte { return gethHeader.Bloom.Bytes() })
+}
+
+func (header *Header) StateRoot() (string, error) {
+	return header.hex(func(gethHeader *types.Header) []byte { return gethHeader.Root.Bytes() })
+}
+
+func (header *Header) TransactionsRoot() (string, error) {
+	return header.hex(func(gethHeader *types.Header) []byte { return gethHeader.TxHash.Bytes() })
+}
+
+func (header *Header) ReceiptsRoot() (string, error) {
+	return header.hex(func(gethHeader *types.Header) []byte { return gethHeader.ReceiptHash.Bytes() })
+}
+
+func (header *Header) Miner() (string, error) {
+	gethHeader, err := header.decode()
+	if err != nil {
+		return "", err
+	}
+	return gethHeader.Coinbase.Hex(), nil
+}
+
+func (header *Header) Difficulty() (string, error) {
+	gethHeader, err := header.decode()
+	if err != nil || gethHeader.Difficulty == nil {
+		return "0", err
+	}
+	return gethHeader.Difficulty.String(), nil
+}
+
+func (header *Header) ExtraData() (string, error) {
+	return header.hex(func(gethHeader *types.Header) []byte { return gethHeader.Extra })
+}
+
+func (header *Header) GasLimit() (Long, error) {
+	gethHeader, err := header.decode()
+	if err != nil {
+		return 0, err
+	}
+	return Long(gethHeader.GasLimit), nil
+}
+
+func (header *Header) GasUsed() (Long, error) {
+	gethHeader, err := header.decode()
+	if err != nil {
+		return 0, err
+	}
+	return Long(gethHeader.GasUsed), nil
+}
+
+// BaseFeePerGas resolves the base fee as a decimal string, which is null for headers before London
+func (header *Header) BaseFeePerGas() (*string, error) {
+	baseFee, err := header.quantity("baseFeePerGas")
+	if err != nil || baseFee == nil {
+		return nil, err
+	}
+	decimal := baseFee.ToInt().String()
+	return &decimal, nil
+}
+
+// WithdrawalsRoot resolves the withdrawals root, which is null for headers before Shanghai
+func (header *Header) WithdrawalsRoot() (*string, error) {
+	return header.hash("withdrawalsRoot")
+}
+
+// BlobGasUsed resolves the blob gas used, which is null for headers before Cancun
+func (header *Header) BlobGasUsed() (*Long, error) {
+	return header.long("blobGasUsed")
+}
+
+// ExcessBlobGas resolves the excess blob gas, which is null for headers before Cancun
+func (header *Header) ExcessBlobGas() (*Long, error) {
+	return header.long("excessBlobGas")
+}
+
+// ParentBeaconBlockRoot resolves the parent beacon block root, which is null for headers before Cancun
+func (header *Header) ParentBeaconBlockRoot() (*string, error) {
+	return header.hash("parentBeaconBlockRoot")
+}
+
+// Raw resolves the stored JSON header, which is null when only the RLP encoding is stored
+func (header *Header) Raw() *string {
+	if len(header.header.Raw) == 0 {
+		return nil
+	}
+	raw := string(header.header.Raw)
+	return &raw
+}
+
+func (header *Header) hex(field func(*types.Header) []byte) (string, error) {
+	gethHeader, err := header.decode()
+	if err != nil {
+		return "", err
+	}
+	return hexutil.Encode(field(gethHeader)), nil
+}
+
+// quantity returns the field added after go-ethereum's header type with the JSON name, or nil if the header has none
+func (header *Header) quantity(name string) (*hexutil.Big, error) {
+	if _, err := header.decode(); err != nil {
+		return nil, err
+	}
+	value, _ := header.extensions[name].(*hexutil.Big)
+	return value, nil
+}
+
+func (header *Header) long(name string) (*Long, error) {
+	value, err := header.quantity(name)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	long := Long(value.ToInt().Int64())
+	return &long, nil
+}
+
+func (header *Header) hash(name string) (*string, error) {
+	if _, err := header.decode(); err != nil {
+		return nil, err
+	}
+	value, ok := header.extensions[name].(hexutil.Bytes)
+	if !ok {
+		return nil, nil
+	}
+	encoded := value.String()
+	return &encoded, nil
+}
+
+// HeaderEvent resolves the fields of a header event
+type HeaderEvent struct {
+	event      core.HeaderEvent
+	repository core.HeaderRepository
+}
+
+func (event *HeaderEvent) Type() string {
+	return string(event.event.Type)
+}
+
+func (event *HeaderEvent) Number() Long {
+	return Long(event.event.BlockNumber)
+}
+
+func (event *HeaderEvent) Hash() string {
+	return event.event.Hash
+}
+
+func (event *HeaderEvent) PreviousHash() *string {
+	if event.event.PreviousHash == "" {
+		return nil
+	}
+	return &event.event.PreviousHash
+}
+
+func (event *HeaderEvent) Fingerprint() string {
+	return event.event.Fingerprint
+}
+
+// Header resolves the stored header with the event's hash, which is null if it has since been replaced
+func (event *HeaderEvent) Header() (*Header, error) {
+	header, err := event.repository.GetHeaderByHash(event.event.Hash)
+	return storedHeader(header, err, event.repository, event.event.Fingerprint)
+}
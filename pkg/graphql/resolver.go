@@ -0,0 +1,229 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/listener"
+)
+
+const maxLimit = 1000
+
+var (
+	ErrSubscriptionsUnavailable = errors.New("subscriptions are not available without header events")
+	ErrInvalidLimit             = errors.New("limit must be positive")
+)
+
+// RepositoryFactory returns the header repository for the node with the provided fingerprint
+type RepositoryFactory func(fingerprint string) core.HeaderRepository
+
+// Resolver is the root resolver of the headers schema
+type Resolver struct {
+	repositories RepositoryFactory
+	fingerprint  string
+	events       *listener.HeaderBroadcaster
+}
+
+// NewResolver returns a Resolver reading headers from the repositories, defaulting to the node with the provided fingerprint
+// Subscriptions are fed by the events broadcaster and are unavailable if it is nil
+func NewResolver(repositories RepositoryFactory, fingerprint string, events *listener.HeaderBroadcaster) *Resolver {
+	return &Resolver{repositories: repositories, fingerprint: fingerprint, events: events}
+}
+
+// NewSchema returns the headers schema resolved by the resolver
+func NewSchema(resolver *Resolver) (*graphqlgo.Schema, error) {
+	return graphqlgo.ParseSchema(schema, resolver)
+}
+
+func (resolver *Resolver) repository(fingerprint *string) (core.HeaderRepository, string) {
+	if fingerprint == nil || *fingerprint == "" {
+		return resolver.repositories(resolver.fingerprint), resolver.fingerprint
+	}
+	return resolver.repositories(*fingerprint), *fingerprint
+}
+
+type headerArgs struct {
+	Number      *Long
+	Hash        *string
+	Fingerprint *string
+}
+
+// Header resolves a single header by number or hash
+func (resolver *Resolver) Header(args headerArgs) (*Header, error) {
+	repository, fingerprint := resolver.repository(args.Fingerprint)
+	var header core.Header
+	var err error
+	switch {
+	case args.Hash != nil:
+		header, err = repository.GetHeaderByHash(*args.Hash)
+	case args.Number != nil:
+		header, err = repository.GetHeader(int64(*args.Number))
+	default:
+		return nil, errors.New("header requires a number or a hash")
+	}
+	return storedHeader(header, err, repository, fingerprint)
+}
+
+// Head resolves the highest stored header
+func (resolver *Resolver) Head(args struct{ Fingerprint *string }) (*Header, error) {
+	repository, fingerprint := resolver.repository(args.Fingerprint)
+	blockNumber, err := repository.GetLastBlockNumber()
+	if err != nil {
+		return storedHeader(core.Header{}, err, repository, fingerprint)
+	}
+	header, err := repository.GetHeader(blockNumber)
+	return storedHeader(header, err, repository, fingerprint)
+}
+
+type rangeArgs struct {
+	From        Long
+	To          Long
+	Limit       int32
+	Fingerprint *string
+}
+
+// limit returns the limit of the range, at most maxLimit, or ErrInvalidLimit if it is not positive
+func (args rangeArgs) limit() (int64, error) {
+	if args.Limit <= 0 {
+		return 0, ErrInvalidLimit
+	}
+	if args.Limit > maxLimit {
+		return maxLimit, nil
+	}
+	return int64(args.Limit), nil
+}
+
+// Headers resolves the headers in a block number range
+func (resolver *Resolver) Headers(args rangeArgs) ([]*Header, error) {
+	limit, err := args.limit()
+	if err != nil {
+		return nil, err
+	}
+	repository, fingerprint := resolver.repository(args.Fingerprint)
+	from, to := int64(args.From), int64(args.To)
+	if to > from+limit-1 {
+		to = from + limit - 1
+	}
+	if to < from {
+		return []*Header{}, nil
+	}
+	headers, err := repository.GetHeadersInRange(from, to)
+	return newHeaders(headers, repository, fingerprint), err
+}
+
+// HeadersByTime resolves the headers in a timestamp range
+func (resolver *Resolver) HeadersByTime(args rangeArgs) ([]*Header, error) {
+	limit, err := args.limit()
+	if err != nil {
+		return nil, err
+	}
+	repository, fingerprint := resolver.repository(args.Fingerprint)
+	headers, err := repository.GetHeadersInTimeRange(int64(args.From), int64(args.To), int(limit))
+	return newHeaders(headers, repository, fingerprint), err
+}
+
+// NewHeads resolves a subscription to the headers which extend or replace the highest header seen by the subscription
+func (resolver *Resolver) NewHeads(ctx context.Context, args struct{ Fingerprint *string }) (<-chan *Header, error) {
+	repository, fingerprint := resolver.repository(args.Fingerprint)
+	heads := make(chan *Header)
+	var head int64 = -1
+	err := resolver.subscribe(ctx, fingerprint, func(event core.HeaderEvent) {
+		if event.Type == core.HeaderConfirmed || event.BlockNumber < head {
+			return
+		}
+		header, err := repository.GetHeaderByHash(event.Hash)
+		if err != nil {
+			// The header may have been replaced since the event was sent
+			log.Debug("NewHeads: error getting header: ", err)
+			return
+		}
+		head = event.BlockNumber
+		select {
+		case heads <- newHeader(header, repository, fingerprint):
+		case <-ctx.Done():
+		}
+	}, func() { close(heads) })
+	return heads, err
+}
+
+// Reorgs resolves a subscription to the replacements of stored headers
+func (resolver *Resolver) Reorgs(ctx context.Context, args struct{ Fingerprint *string }) (<-chan *HeaderEvent, error) {
+	repository, fingerprint := resolver.repository(args.Fingerprint)
+	reorgs := make(chan *HeaderEvent)
+	err := resolver.subscribe(ctx, fingerprint, func(event core.HeaderEvent) {
+		if event.Type != core.HeaderReplaced {
+			return
+		}
+		select {
+		case reorgs <- &HeaderEvent{event: event, repository: repository}:
+		case <-ctx.Done():
+		}
+	}, func() { close(reorgs) })
+	return reorgs, err
+}
+
+// subscribe passes the fingerprint's events to handle until the context is done, then calls done
+func (resolver *Resolver) subscribe(ctx context.Context, fingerprint string, handle func(core.HeaderEvent), done func()) error {
+	if resolver.events == nil {
+		return ErrSubscriptionsUnavailable
+	}
+	events, unsubscribe := resolver.events.Subscribe()
+	go func() {
+		defer done()
+		defer unsubscribe()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Fingerprint == fingerprint {
+					handle(event)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// storedHeader returns the resolver of a header read from the repository, a header which is not stored resolves to null
+func storedHeader(header core.Header, err error, repository core.HeaderRepository, fingerprint string) (*Header, error) {
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newHeader(header, repository, fingerprint), nil
+}
+
+func newHeaders(headers []core.Header, repository core.HeaderRepository, fingerprint string) []*Header {
+	resolvers := make([]*Header, len(headers))
+	for i, header := range headers {
+		resolvers[i] = newHeader(header, repository, fingerprint)
+	}
+	return resolvers
+}
@@ -0,0 +1,192 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/graphql"
+)
+
+// makeChain returns n linked headers starting at block 1, one every 15 seconds from timestamp 1000
+func makeChain(n int) []*types.Header {
+	var chain []*types.Header
+	for i := 1; i <= n; i++ {
+		header := &types.Header{Number: big.NewInt(int64(i)), Difficulty: big.NewInt(10), Time: uint64(1000 + 15*(i-1)), Extra: []byte{}}
+		if i > 1 {
+			header.ParentHash = chain[i-2].Hash()
+		}
+		chain = append(chain, header)
+	}
+	return chain
+}
+
+func storedHeader(gethHeader *types.Header) core.Header {
+	raw, err := json.Marshal(gethHeader)
+	Expect(err).NotTo(HaveOccurred())
+	return core.Header{
+		BlockNumber: gethHeader.Number.Int64(),
+		Hash:        gethHeader.Hash().Hex(),
+		Raw:         raw,
+		Timestamp:   strconv.FormatUint(gethHeader.Time, 10),
+	}
+}
+
+func storedHeaders(chain []*types.Header) []core.Header {
+	var headers []core.Header
+	for _, header := range chain {
+		headers = append(headers, storedHeader(header))
+	}
+	return headers
+}
+
+func exec(schema *graphqlgo.Schema, query string, variables map[string]interface{}) map[string]interface{} {
+	response := schema.Exec(context.Background(), query, "", variables)
+	Expect(response.Errors).To(BeEmpty())
+	var data map[string]interface{}
+	Expect(json.Unmarshal(response.Data, &data)).To(Succeed())
+	return data
+}
+
+var _ = Describe("GraphQL resolver", func() {
+	var (
+		chain        = makeChain(5)
+		repository   *fakes.MockHeaderRepository
+		otherNode    *fakes.MockHeaderRepository
+		repositories graphql.RepositoryFactory
+		schema       *graphqlgo.Schema
+	)
+
+	BeforeEach(func() {
+		repository = fakes.NewMockHeaderRepository()
+		repository.SetStoredHeaders(storedHeaders(chain)...)
+		otherNode = fakes.NewMockHeaderRepository()
+		otherNode.SetStoredHeaders(storedHeaders(chain[:2])...)
+		repositories = func(fingerprint string) core.HeaderRepository {
+			if fingerprint == "other" {
+				return otherNode
+			}
+			return repository
+		}
+		var err error
+		schema, err = graphql.NewSchema(graphql.NewResolver(repositories, "x123", nil))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns a header by number", func() {
+		data := exec(schema, `{ header(number: 3) { number hash timestamp difficulty fingerprint } }`, nil)
+
+		Expect(data["header"]).To(Equal(map[string]interface{}{
+			"number":      float64(3),
+			"hash":        chain[2].Hash().Hex(),
+			"timestamp":   float64(1030),
+			"difficulty":  "10",
+			"fingerprint": "x123",
+		}))
+	})
+
+	It("returns a header by hash and follows parent links", func() {
+		data := exec(schema, `query($hash: String!) { header(hash: $hash) { number parent { number parent { hash } } } }`,
+			map[string]interface{}{"hash": chain[4].Hash().Hex()})
+
+		header := data["header"].(map[string]interface{})
+		Expect(header["number"]).To(Equal(float64(5)))
+		parent := header["parent"].(map[string]interface{})
+		Expect(parent["number"]).To(Equal(float64(4)))
+		Expect(parent["parent"]).To(Equal(map[string]interface{}{"hash": chain[2].Hash().Hex()}))
+	})
+
+	It("returns the fields added after go-ethereum's header type", func() {
+		holesky, err := converter.HeaderConverter{}.ConvertJSON(fakes.HoleskyGenesisJSON)
+		Expect(err).NotTo(HaveOccurred())
+		repository.SetStoredHeaders(holesky)
+
+		data := exec(schema, `{ header(number: 0) { hash baseFeePerGas withdrawalsRoot blobGasUsed } }`, nil)
+
+		Expect(data["header"]).To(Equal(map[string]interface{}{
+			"hash":            fakes.HoleskyGenesisHash.Hex(),
+			"baseFeePerGas":   "1000000000",
+			"withdrawalsRoot": nil,
+			"blobGasUsed":     nil,
+		}))
+	})
+
+	It("returns null for a header which is not stored", func() {
+		data := exec(schema, `{ header(number: 9) { number } first: header(number: 1) { parent { number } } }`, nil)
+
+		Expect(data["header"]).To(BeNil())
+		Expect(data["first"]).To(Equal(map[string]interface{}{"parent": nil}))
+	})
+
+	It("returns the head", func() {
+		data := exec(schema, `{ head { number } }`, nil)
+
+		Expect(data["head"]).To(Equal(map[string]interface{}{"number": float64(5)}))
+	})
+
+	It("returns a range of headers up to the limit", func() {
+		data := exec(schema, `{ headers(from: "0x2", to: 5, limit: 2) { number } }`, nil)
+
+		Expect(data["headers"]).To(Equal([]interface{}{
+			map[string]interface{}{"number": float64(2)},
+			map[string]interface{}{"number": float64(3)},
+		}))
+	})
+
+	It("rejects a limit which is not positive", func() {
+		response := schema.Exec(context.Background(), `{ headers(from: 1, to: 5, limit: 0) { number } }`, "", nil)
+
+		Expect(response.Errors).NotTo(BeEmpty())
+		Expect(response.Errors[0].Message).To(ContainSubstring(graphql.ErrInvalidLimit.Error()))
+	})
+
+	It("returns the headers in a timestamp range", func() {
+		data := exec(schema, `{ headersByTime(from: 1010, to: 1045) { number } }`, nil)
+
+		Expect(data["headersByTime"]).To(Equal([]interface{}{
+			map[string]interface{}{"number": float64(2)},
+			map[string]interface{}{"number": float64(3)},
+			map[string]interface{}{"number": float64(4)},
+		}))
+	})
+
+	It("filters by fingerprint", func() {
+		data := exec(schema, `{ head(fingerprint: "other") { number fingerprint } }`, nil)
+
+		Expect(data["head"]).To(Equal(map[string]interface{}{"number": float64(2), "fingerprint": "other"}))
+	})
+
+	It("returns repository errors", func() {
+		repository.SetGetHeaderError(fakes.FakeError)
+
+		response := schema.Exec(context.Background(), `{ header(number: 1) { number } }`, "", nil)
+
+		Expect(response.Errors).NotTo(BeEmpty())
+		Expect(response.Errors[0].Message).To(ContainSubstring(fakes.FakeError.Error()))
+	})
+})
@@ -0,0 +1,89 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+// schema is the GraphQL schema served for the synced headers
+// Hashes, addresses and byte arrays are hex encoded strings, fingerprint arguments default to the served node
+const schema = `
+schema {
+    query: Query
+    subscription: Subscription
+}
+
+# Long is a 64 bit integer, it accepts decimal or 0x prefixed hex strings as input
+scalar Long
+
+type Header {
+    number: Long!
+    hash: String!
+    parentHash: String!
+    # parent is the stored header this header builds on, if there is one
+    parent: Header
+    fingerprint: String!
+    timestamp: Long!
+    nonce: String!
+    mixHash: String!
+    unclesHash: String!
+    logsBloom: String!
+    stateRoot: String!
+    transactionsRoot: String!
+    receiptsRoot: String!
+    miner: String!
+    # difficulty is a decimal string
+    difficulty: String!
+    extraData: String!
+    gasLimit: Long!
+    gasUsed: Long!
+    # baseFeePerGas is a decimal string, it and the following fields are null for headers from before their fork
+    baseFeePerGas: String
+    withdrawalsRoot: String
+    blobGasUsed: Long
+    excessBlobGas: Long
+    parentBeaconBlockRoot: String
+    # raw is the stored JSON encoding of the header
+    raw: String
+}
+
+type HeaderEvent {
+    # type is insert, replace or confirm
+    type: String!
+    number: Long!
+    hash: String!
+    # previousHash is the hash of the header replaced by a reorg
+    previousHash: String
+    fingerprint: String!
+    header: Header
+}
+
+type Query {
+    # header returns the header with the number or the hash
+    header(number: Long, hash: String, fingerprint: String): Header
+    # head returns the highest stored header
+    head(fingerprint: String): Header
+    # headers returns the headers between the block numbers (inclusive), up to limit of them
+    headers(from: Long!, to: Long!, limit: Int = 100, fingerprint: String): [Header!]!
+    # headersByTime returns the headers with timestamps between the unix times (inclusive), up to limit of them
+    headersByTime(from: Long!, to: Long!, limit: Int = 100, fingerprint: String): [Header!]!
+}
+
+type Subscription {
+    # newHeads sends each header which extends or replaces the stored head
+    newHeads(fingerprint: String): Header!
+    # reorgs sends an event each time a stored header is replaced
+    reorgs(fingerprint: String): HeaderEvent!
+}
+`
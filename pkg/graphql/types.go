@@ -0,0 +1,56 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Long is a GraphQL scalar for 64 bit integers, which do not fit in the 32 bit Int scalar
+type Long int64
+
+// ImplementsGraphQLType returns whether Long implements the named GraphQL type
+func (Long) ImplementsGraphQLType(name string) bool {
+	return name == "Long"
+}
+
+// UnmarshalGraphQL decodes a Long from a GraphQL number or a decimal or 0x prefixed hex string
+func (long *Long) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case int32:
+		*long = Long(input)
+	case int64:
+		*long = Long(input)
+	case float64:
+		*long = Long(input)
+	case string:
+		base := 10
+		if strings.HasPrefix(input, "0x") {
+			input, base = input[2:], 16
+		}
+		value, err := strconv.ParseInt(input, base, 64)
+		if err != nil {
+			return err
+		}
+		*long = Long(value)
+	default:
+		return fmt.Errorf("unexpected type %T for Long", input)
+	}
+	return nil
+}
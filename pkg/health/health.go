@@ -0,0 +1,115 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package health serves the liveness and readiness endpoints of the sync
+package health
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+var (
+	ErrNodeNotSynced   = errors.New("node has not finished its initial state sync")
+	ErrNoHeadersSynced = errors.New("no headers have been synced")
+)
+
+// Check is a named condition which must hold for the sync to be ready
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// Status is the body of a health response, with the outcome of each check
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Pinger is satisfied by database connections which can be checked for reachability
+type Pinger interface {
+	Ping() error
+}
+
+// NewHandler returns a handler which responds 200 when every check passes and 503 otherwise
+// A handler without checks reports liveness: it responds 200 as long as the process is serving
+func NewHandler(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := Status{Status: "ok", Checks: make(map[string]string)}
+		code := http.StatusOK
+		for _, check := range checks {
+			if err := check.Check(); err != nil {
+				status.Checks[check.Name] = err.Error()
+				status.Status = "unavailable"
+				code = http.StatusServiceUnavailable
+			} else {
+				status.Checks[check.Name] = "ok"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Error("health: error writing response: ", err)
+		}
+	})
+}
+
+// DatabaseCheck checks that the database is reachable
+func DatabaseCheck(db Pinger) Check {
+	return Check{Name: "database", Check: db.Ping}
+}
+
+// NodeCheck checks that the node is reachable and has finished its initial state sync
+func NodeCheck(fetcher core.Fetcher) Check {
+	return Check{Name: "node", Check: func() error {
+		lastBlock, err := fetcher.LastBlock()
+		if err != nil {
+			return err
+		}
+		if lastBlock.Int64() == 0 {
+			return ErrNodeNotSynced
+		}
+		return nil
+	}}
+}
+
+// LagCheck checks that the highest stored header is at most maxLag blocks behind the head of the chain
+func LagCheck(fetcher core.Fetcher, headerRepository core.HeaderRepository, maxLag int64) Check {
+	return Check{Name: "lag", Check: func() error {
+		lastBlock, err := fetcher.LastBlock()
+		if err != nil {
+			return err
+		}
+		syncedHead, err := headerRepository.GetLastBlockNumber()
+		if err == sql.ErrNoRows {
+			return ErrNoHeadersSynced
+		}
+		if err != nil {
+			return err
+		}
+		if lag := lastBlock.Int64() - syncedHead; lag > maxLag {
+			return fmt.Errorf("synced headers are %d blocks behind the chain head, at most %d allowed", lag, maxLag)
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,118 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package health_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/health"
+)
+
+type mockPinger struct {
+	err error
+}
+
+func (pinger mockPinger) Ping() error {
+	return pinger.err
+}
+
+var _ = Describe("Health", func() {
+	var (
+		fetcher    *fakes.MockFetcher
+		repository *fakes.MockHeaderRepository
+	)
+
+	BeforeEach(func() {
+		fetcher = fakes.NewMockFetcher()
+		fetcher.SetLastBlock(big.NewInt(100))
+		repository = fakes.NewMockHeaderRepository()
+		repository.SetStoredHeaders(core.Header{BlockNumber: 95})
+	})
+
+	get := func(handler http.Handler) (int, health.Status) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var status health.Status
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &status)).To(Succeed())
+		return recorder.Code, status
+	}
+
+	It("reports liveness without checks", func() {
+		code, status := get(health.NewHandler())
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(status.Status).To(Equal("ok"))
+	})
+
+	It("is ready when every check passes", func() {
+		code, status := get(health.NewHandler(
+			health.DatabaseCheck(mockPinger{}),
+			health.NodeCheck(fetcher),
+			health.LagCheck(fetcher, repository, 10),
+		))
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(status.Checks).To(Equal(map[string]string{"database": "ok", "node": "ok", "lag": "ok"}))
+	})
+
+	It("is not ready when the database is unreachable", func() {
+		code, status := get(health.NewHandler(health.DatabaseCheck(mockPinger{err: fakes.FakeError}), health.NodeCheck(fetcher)))
+
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Status).To(Equal("unavailable"))
+		Expect(status.Checks["database"]).To(Equal(fakes.FakeError.Error()))
+		Expect(status.Checks["node"]).To(Equal("ok"))
+	})
+
+	It("is not ready when the node is unreachable or still syncing", func() {
+		fetcher.SetLastBlock(big.NewInt(0))
+		code, status := get(health.NewHandler(health.NodeCheck(fetcher)))
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Checks["node"]).To(Equal(health.ErrNodeNotSynced.Error()))
+
+		fetcher.SetLastBlockErr(fakes.FakeError)
+		code, status = get(health.NewHandler(health.NodeCheck(fetcher)))
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Checks["node"]).To(Equal(fakes.FakeError.Error()))
+	})
+
+	It("is not ready when the synced headers lag too far behind the chain head", func() {
+		code, _ := get(health.NewHandler(health.LagCheck(fetcher, repository, 5)))
+		Expect(code).To(Equal(http.StatusOK))
+
+		code, status := get(health.NewHandler(health.LagCheck(fetcher, repository, 4)))
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Checks["lag"]).To(ContainSubstring("5 blocks behind"))
+	})
+
+	It("is not ready before any header is synced", func() {
+		repository.SetStoredHeaders()
+
+		code, status := get(health.NewHandler(health.LagCheck(fetcher, repository, 10)))
+
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Checks["lag"]).To(Equal(health.ErrNoHeadersSynced.Error()))
+	})
+})
@@ -18,7 +18,9 @@ package history
 
 import (
 	"github.com/sirupsen/logrus"
+
 	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
 )
 
 // HeaderValidator is the type reponsible for validating headers
@@ -26,29 +28,61 @@ type HeaderValidator struct {
 	fetcher          core.Fetcher
 	headerRepository core.HeaderRepository
 	windowSize       int
+	sink             core.HeaderSink
+	lastConfirmed    int64
 }
 
 // NewHeaderValidator returns a new HeaderValidator
-func NewHeaderValidator(fetcher core.Fetcher, repository core.HeaderRepository, windowSize int) HeaderValidator {
-	return HeaderValidator{
+// The sink, if not nil, is notified of headers inserted or replaced in the window and of headers confirmed by leaving it
+func NewHeaderValidator(fetcher core.Fetcher, repository core.HeaderRepository, windowSize int, sink core.HeaderSink) *HeaderValidator {
+	return &HeaderValidator{
 		fetcher:          fetcher,
 		headerRepository: repository,
 		windowSize:       windowSize,
+		sink:             sink,
+		lastConfirmed:    -1,
 	}
 }
 
 // ValidateHeaders validates headers at the head, returning the validation window used
-func (validator HeaderValidator) ValidateHeaders() (ValidationWindow, error) {
+func (validator *HeaderValidator) ValidateHeaders() (ValidationWindow, error) {
 	window, err := MakeValidationWindow(validator.fetcher, validator.windowSize)
 	if err != nil {
 		logrus.Error("ValidateHeaders: error creating validation window: ", err)
 		return ValidationWindow{}, err
 	}
+	metrics.ValidationWindowLowerBound.Set(float64(window.LowerBound))
+	metrics.ValidationWindowUpperBound.Set(float64(window.UpperBound))
 	blockNumbers := MakeRange(window.LowerBound, window.UpperBound)
-	_, err = RetrieveAndUpdateHeaders(validator.fetcher, validator.headerRepository, blockNumbers)
+	_, err = RetrieveAndUpdateHeaders(validator.fetcher, validator.headerRepository, blockNumbers, validator.sink)
 	if err != nil {
 		logrus.Error("ValidateHeaders: error getting/updating headers: ", err)
 		return ValidationWindow{}, err
 	}
+	validator.confirmHeaders(window)
 	return window, nil
 }
+
+// confirmHeaders notifies the sink of the stored headers which have left the window since the last validation
+// Nothing is confirmed on the first validation, as headers below the window then were confirmed by a previous run
+func (validator *HeaderValidator) confirmHeaders(window ValidationWindow) {
+	if validator.sink == nil {
+		return
+	}
+	if validator.lastConfirmed < 0 {
+		validator.lastConfirmed = window.LowerBound - 1
+		return
+	}
+	if window.LowerBound-1 <= validator.lastConfirmed {
+		return
+	}
+	headers, err := validator.headerRepository.GetHeadersInRange(validator.lastConfirmed+1, window.LowerBound-1)
+	if err != nil {
+		logrus.Error("confirmHeaders: error getting confirmed headers: ", err)
+		return
+	}
+	for _, header := range headers {
+		sendHeaderEvent(validator.sink, core.HeaderEvent{Type: core.HeaderConfirmed}, header, validator.fetcher.Node().ID)
+	}
+	validator.lastConfirmed = window.LowerBound - 1
+}
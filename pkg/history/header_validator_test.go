@@ -17,14 +17,18 @@
 package history_test
 
 import (
+	"database/sql"
 	"errors"
 	"math/big"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/vulcanize/eth-header-sync/pkg/core"
 	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	ethfetcher "github.com/vulcanize/eth-header-sync/pkg/fetcher"
 	"github.com/vulcanize/eth-header-sync/pkg/history"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
 )
 
 var _ = Describe("Header validator", func() {
@@ -41,7 +45,7 @@ var _ = Describe("Header validator", func() {
 	It("attempts to create every header in the validation window", func() {
 		headerRepository.SetMissingBlockNumbers([]int64{})
 		fetcher.SetLastBlock(big.NewInt(3))
-		validator := history.NewHeaderValidator(fetcher, headerRepository, 2)
+		validator := history.NewHeaderValidator(fetcher, headerRepository, 2, nil)
 
 		_, err := validator.ValidateHeaders()
 		Expect(err).NotTo(HaveOccurred())
@@ -53,9 +57,98 @@ var _ = Describe("Header validator", func() {
 		fetcher.SetLastBlock(big.NewInt(3))
 		headerRepositoryError := errors.New("CreateOrUpdate")
 		headerRepository.SetCreateOrUpdateHeaderReturnErr(headerRepositoryError)
-		validator := history.NewHeaderValidator(fetcher, headerRepository, 2)
+		validator := history.NewHeaderValidator(fetcher, headerRepository, 2, nil)
 
 		_, err := validator.ValidateHeaders()
 		Expect(err).To(MatchError(headerRepositoryError))
 	})
+
+	It("notifies the sink of headers which leave the validation window", func() {
+		sink := fakes.NewMockHeaderSink()
+		fetcher.SetLastBlock(big.NewInt(3))
+		validator := history.NewHeaderValidator(fetcher, headerRepository, 2, sink)
+		_, err := validator.ValidateHeaders()
+		Expect(err).NotTo(HaveOccurred())
+		sink.Events = nil
+
+		fetcher.SetLastBlock(big.NewInt(5))
+		headerRepository.SetGetHeadersInRangeReturnHeaders([]core.Header{{BlockNumber: 1, Hash: "0x1"}, {BlockNumber: 2, Hash: "0x2"}})
+		_, err = validator.ValidateHeaders()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(headerRepository.GetHeadersInRangePassedRange).To(Equal([2]int64{1, 2}))
+		Expect(sink.Events).To(ContainElement(core.HeaderEvent{Type: core.HeaderConfirmed, BlockNumber: 1, Hash: "0x1", Fingerprint: "x123"}))
+		Expect(sink.Events).To(ContainElement(core.HeaderEvent{Type: core.HeaderConfirmed, BlockNumber: 2, Hash: "0x2", Fingerprint: "x123"}))
+	})
+
+	Describe("on a simulated chain", func() {
+		var (
+			chain *simulated.Chain
+			sink  *fakes.MockHeaderSink
+		)
+
+		BeforeEach(func() {
+			chain = simulated.NewChain(30)
+			sink = fakes.NewMockHeaderSink()
+			headerRepository.SetStoredHeaders()
+		})
+
+		eventsOfType := func(eventType core.HeaderEventType) []int64 {
+			var blockNumbers []int64
+			for _, event := range sink.Events {
+				if event.Type == eventType {
+					blockNumbers = append(blockNumbers, event.BlockNumber)
+				}
+			}
+			return blockNumbers
+		}
+
+		It("replaces the headers of a reorg within the window", func() {
+			chainFetcher := ethfetcher.NewFetcher(chain, chain, core.Node{})
+			validator := history.NewHeaderValidator(chainFetcher, headerRepository, 10, sink)
+			_, err := validator.ValidateHeaders()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eventsOfType(core.HeaderInserted)).To(Equal(history.MakeRange(20, 30)))
+			sink.Events = nil
+
+			Expect(chain.Reorg(3, 4)).To(Succeed())
+			_, err = validator.ValidateHeaders()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(eventsOfType(core.HeaderReplaced)).To(Equal([]int64{28, 29, 30}))
+			Expect(eventsOfType(core.HeaderInserted)).To(Equal([]int64{31}))
+			for number := int64(20); number <= 31; number++ {
+				stored, err := headerRepository.GetHeader(number)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stored.Hash).To(Equal(chain.Header(number).Hash().Hex()))
+			}
+		})
+
+		It("leaves headers missing from the node to a later validation", func() {
+			chain.SetMissing(25, true)
+			chainFetcher := ethfetcher.NewFetcher(chain, chain, core.Node{})
+			validator := history.NewHeaderValidator(chainFetcher, headerRepository, 10, sink)
+
+			_, err := validator.ValidateHeaders()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = headerRepository.GetHeader(25)
+			Expect(err).To(MatchError(sql.ErrNoRows))
+
+			chain.SetMissing(25, false)
+			_, err = validator.ValidateHeaders()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = headerRepository.GetHeader(25)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns node errors", func() {
+			chain.SetError("", fakes.FakeError)
+			validator := history.NewHeaderValidator(ethfetcher.NewFetcher(chain, chain, core.Node{}), headerRepository, 10, sink)
+
+			_, err := validator.ValidateHeaders()
+
+			Expect(err).To(MatchError(fakes.FakeError))
+			Expect(sink.Events).To(BeEmpty())
+		})
+	})
 })
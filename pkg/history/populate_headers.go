@@ -17,16 +17,20 @@
 package history
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
 	"github.com/vulcanize/eth-header-sync/pkg/repository"
 )
 
 // PopulateMissingHeaders populates missing headers in the database, it does so by finding block numbers where no header record exists
-func PopulateMissingHeaders(fetcher core.Fetcher, headerRepository core.HeaderRepository, startingBlockNumber int64) (int, error) {
+// It returns the number of headers retrieved
+// The sink, if not nil, is notified of every header inserted
+func PopulateMissingHeaders(fetcher core.Fetcher, headerRepository core.HeaderRepository, startingBlockNumber int64, sink core.HeaderSink) (int, error) {
 	lastBlock, err := fetcher.LastBlock()
 	if err != nil {
 		logrus.Error("PopulateMissingHeaders: Error getting last block: ", err)
@@ -37,34 +41,101 @@ func PopulateMissingHeaders(fetcher core.Fetcher, headerRepository core.HeaderRe
 	if err != nil {
 		logrus.Error("PopulateMissingHeaders: Error getting missing block numbers: ", err)
 		return 0, err
-	} else if len(blockNumbers) == 0 {
+	}
+	metrics.MissingHeaders.Set(float64(len(blockNumbers)))
+	if len(blockNumbers) == 0 {
 		return 0, nil
 	}
 
 	logrus.Debug(getBlockRangeString(blockNumbers))
-	_, err = RetrieveAndUpdateHeaders(fetcher, headerRepository, blockNumbers)
+	// Fetchers may return fewer headers than requested, such as those reading a batch at a time, the rest are left
+	// for the next call
+	// The block numbers are missing, so no stored hashes are looked up and every header is an insert
+	populated, err := retrieveAndUpdateHeaders(fetcher, headerRepository, blockNumbers, sink, false)
 	if err != nil {
 		logrus.Error("PopulateMissingHeaders: Error getting/updating headers: ", err)
 		return 0, err
 	}
-	return len(blockNumbers), nil
+	return populated, nil
 }
 
 // RetrieveAndUpdateHeaders fetches the headers for the provided block numbers and upserts them into the Postgres database
-func RetrieveAndUpdateHeaders(fetcher core.Fetcher, headerRepository core.HeaderRepository, blockNumbers []int64) (int, error) {
+// The sink, if not nil, is notified of every header inserted or replaced
+func RetrieveAndUpdateHeaders(fetcher core.Fetcher, headerRepository core.HeaderRepository, blockNumbers []int64, sink core.HeaderSink) (int, error) {
+	return retrieveAndUpdateHeaders(fetcher, headerRepository, blockNumbers, sink, true)
+}
+
+func retrieveAndUpdateHeaders(fetcher core.Fetcher, headerRepository core.HeaderRepository, blockNumbers []int64, sink core.HeaderSink, lookupStored bool) (int, error) {
 	headers, err := fetcher.GetHeadersByNumbers(blockNumbers)
+	var storedHashes map[int64]string
+	if lookupStored {
+		storedHashes = getStoredHashes(headerRepository, headers, sink)
+	}
 	for _, header := range headers {
-		_, err = headerRepository.CreateOrUpdateHeader(header)
-		if err != nil {
-			if err == repository.ErrValidHeaderExists {
+		if _, createErr := headerRepository.CreateOrUpdateHeader(header); createErr != nil {
+			if createErr == repository.ErrValidHeaderExists {
 				continue
 			}
-			return 0, err
+			return 0, createErr
+		}
+		if previousHash, ok := storedHashes[header.BlockNumber]; ok {
+			sendHeaderEvent(sink, core.HeaderEvent{Type: core.HeaderReplaced, PreviousHash: previousHash}, header, fetcher.Node().ID)
+		} else {
+			sendHeaderEvent(sink, core.HeaderEvent{Type: core.HeaderInserted}, header, fetcher.Node().ID)
 		}
 	}
 	return len(headers), err
 }
 
+// getStoredHashes returns the hashes of the headers already stored at the block numbers of the fetched headers, keyed by
+// block number
+// They are only looked up when there is a sink to tell inserted headers apart from replaced ones, with a single range
+// query over the fetched block numbers; block numbers which are not stored are simply absent from the map
+func getStoredHashes(headerRepository core.HeaderRepository, headers []core.Header, sink core.HeaderSink) map[int64]string {
+	storedHashes := make(map[int64]string)
+	if sink == nil || len(headers) == 0 {
+		return storedHashes
+	}
+	fetched := make(map[int64]bool, len(headers))
+	first, last := headers[0].BlockNumber, headers[0].BlockNumber
+	for _, header := range headers {
+		fetched[header.BlockNumber] = true
+		if header.BlockNumber < first {
+			first = header.BlockNumber
+		}
+		if header.BlockNumber > last {
+			last = header.BlockNumber
+		}
+	}
+	stored, err := headerRepository.GetHeadersInRange(first, last)
+	if err != nil {
+		logrus.Errorf("getStoredHashes: Error getting stored headers for blocks %d to %d, events will be sent as inserts: %s", first, last, err.Error())
+		return storedHashes
+	}
+	for _, header := range stored {
+		if fetched[header.BlockNumber] {
+			storedHashes[header.BlockNumber] = header.Hash
+		}
+	}
+	return storedHashes
+}
+
+// sendHeaderEvent notifies the sink of the event for the header, sink errors are logged rather than interrupting the sync
+func sendHeaderEvent(sink core.HeaderSink, event core.HeaderEvent, header core.Header, fingerprint string) {
+	if sink == nil {
+		return
+	}
+	event.BlockNumber = header.BlockNumber
+	event.Hash = header.Hash
+	event.Fingerprint = fingerprint
+	if json.Valid(header.Raw) {
+		event.Raw = header.Raw
+	}
+	if err := sink.Send(event); err != nil {
+		logrus.Errorf("sendHeaderEvent: Error sending %s event for block %d: %s", event.Type, header.BlockNumber, err.Error())
+	}
+}
+
 func getBlockRangeString(blockRange []int64) string {
 	return fmt.Sprintf("Backfilling |%v| blocks", len(blockRange))
 }
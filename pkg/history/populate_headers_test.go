@@ -22,8 +22,12 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/vulcanize/eth-header-sync/pkg/core"
 	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	ethfetcher "github.com/vulcanize/eth-header-sync/pkg/fetcher"
 	"github.com/vulcanize/eth-header-sync/pkg/history"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
 )
 
 var _ = Describe("Populating headers", func() {
@@ -39,7 +43,7 @@ var _ = Describe("Populating headers", func() {
 		fetcher.SetLastBlock(big.NewInt(2))
 		headerRepository.SetMissingBlockNumbers([]int64{2})
 
-		headersAdded, err := history.PopulateMissingHeaders(fetcher, headerRepository, 1)
+		headersAdded, err := history.PopulateMissingHeaders(fetcher, headerRepository, 1, nil)
 
 		Expect(err).NotTo(HaveOccurred())
 		Expect(headersAdded).To(Equal(1))
@@ -50,7 +54,7 @@ var _ = Describe("Populating headers", func() {
 		fetcher.SetLastBlock(big.NewInt(2))
 		headerRepository.SetMissingBlockNumbers([]int64{2})
 
-		_, err := history.PopulateMissingHeaders(fetcher, headerRepository, 1)
+		_, err := history.PopulateMissingHeaders(fetcher, headerRepository, 1, nil)
 
 		Expect(err).NotTo(HaveOccurred())
 		headerRepository.AssertCreateOrUpdateHeaderCallCountAndPassedBlockNumbers(1, []int64{2})
@@ -59,9 +63,85 @@ var _ = Describe("Populating headers", func() {
 	It("returns early if the db is already synced up to the head of the chain", func() {
 		fetcher := fakes.NewMockFetcher()
 		fetcher.SetLastBlock(big.NewInt(2))
-		headersAdded, err := history.PopulateMissingHeaders(fetcher, headerRepository, 2)
+		headersAdded, err := history.PopulateMissingHeaders(fetcher, headerRepository, 2, nil)
 
 		Expect(err).NotTo(HaveOccurred())
 		Expect(headersAdded).To(Equal(0))
 	})
+
+	It("notifies the sink of inserted and replaced headers", func() {
+		fetcher := fakes.NewMockFetcher()
+		sink := fakes.NewMockHeaderSink()
+		headerRepository.SetStoredHeaders(core.Header{BlockNumber: 2, Hash: "0xold"}, core.Header{BlockNumber: 3, Hash: "0x3"})
+
+		_, err := history.RetrieveAndUpdateHeaders(fetcher, headerRepository, []int64{1, 2}, sink)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headerRepository.GetHeaderPassedBlockNumber).To(BeZero())
+		Expect(headerRepository.GetHeadersInRangePassedRange).To(Equal([2]int64{1, 2}))
+		Expect(sink.Events).To(Equal([]core.HeaderEvent{
+			{Type: core.HeaderInserted, BlockNumber: 1, Fingerprint: "x123"},
+			{Type: core.HeaderReplaced, BlockNumber: 2, PreviousHash: "0xold", Fingerprint: "x123"},
+		}))
+	})
+
+	It("sends inserts when the stored headers cannot be looked up", func() {
+		fetcher := fakes.NewMockFetcher()
+		sink := fakes.NewMockHeaderSink()
+		headerRepository.SetGetHeaderError(fakes.FakeError)
+
+		_, err := history.RetrieveAndUpdateHeaders(fetcher, headerRepository, []int64{1, 2}, sink)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sink.Events).To(Equal([]core.HeaderEvent{
+			{Type: core.HeaderInserted, BlockNumber: 1, Fingerprint: "x123"},
+			{Type: core.HeaderInserted, BlockNumber: 2, Fingerprint: "x123"},
+		}))
+	})
+
+	It("does not look up stored headers for the missing block numbers it backfills", func() {
+		fetcher := fakes.NewMockFetcher()
+		fetcher.SetLastBlock(big.NewInt(2))
+		headerRepository.SetMissingBlockNumbers([]int64{1, 2})
+		sink := fakes.NewMockHeaderSink()
+
+		_, err := history.PopulateMissingHeaders(fetcher, headerRepository, 1, sink)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headerRepository.GetHeaderPassedBlockNumber).To(BeZero())
+		Expect(headerRepository.GetHeadersInRangePassedRange).To(Equal([2]int64{}))
+		Expect(sink.Events).To(Equal([]core.HeaderEvent{
+			{Type: core.HeaderInserted, BlockNumber: 1, Fingerprint: "x123"},
+			{Type: core.HeaderInserted, BlockNumber: 2, Fingerprint: "x123"},
+		}))
+	})
+
+	It("does not notify the sink of headers which are already valid", func() {
+		fetcher := fakes.NewMockFetcher()
+		sink := fakes.NewMockHeaderSink()
+		headerRepository.SetCreateOrUpdateHeaderReturnErr(repository.ErrValidHeaderExists)
+
+		history.RetrieveAndUpdateHeaders(fetcher, headerRepository, []int64{1}, sink)
+
+		Expect(sink.Events).To(BeEmpty())
+	})
+
+	It("backfills the headers of a simulated chain into a memory repository", func() {
+		chain := simulated.NewChain(20)
+		node := core.Node{ID: "simulated"}
+		memoryRepository := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), node.ID)
+		_, err := memoryRepository.CreateOrUpdateHeader(core.Header{BlockNumber: 12, Hash: chain.Header(12).Hash().Hex()})
+		Expect(err).NotTo(HaveOccurred())
+
+		headersAdded, err := history.PopulateMissingHeaders(ethfetcher.NewFetcher(chain, chain, node), memoryRepository, 10, nil)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headersAdded).To(Equal(10))
+		missing, err := memoryRepository.MissingBlockNumbers(10, 20, node.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(BeEmpty())
+		stored, err := memoryRepository.GetHeader(20)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Hash).To(Equal(chain.Header(20).Hash().Hex()))
+	})
 })
@@ -0,0 +1,95 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// RetentionPolicy describes which headers are kept when pruning, a zero value field is not enforced
+type RetentionPolicy struct {
+	// Blocks is the number of most recent blocks to keep headers for
+	Blocks int64
+	// Timestamp is the unix time from which headers are kept
+	Timestamp int64
+}
+
+// Enabled returns whether the policy prunes any headers
+func (policy RetentionPolicy) Enabled() bool {
+	return policy.Blocks > 0 || policy.Timestamp > 0
+}
+
+// PruneHeaders deletes the headers which fall outside of the retention policy, returning the number of headers deleted
+// The timestamp is resolved to the first block of the chain at or after it, rather than of the stored headers, so that
+// unsynced blocks within the retention window are still backfilled
+func PruneHeaders(fetcher core.Fetcher, headerRepository core.HeaderRepository, policy RetentionPolicy) (int64, error) {
+	lastBlock, err := fetcher.LastBlock()
+	if err != nil {
+		logrus.Error("PruneHeaders: Error getting last block: ", err)
+		return 0, err
+	}
+	var cutoff int64
+	if policy.Blocks > 0 {
+		cutoff = lastBlock.Int64() - policy.Blocks + 1
+	}
+	if policy.Timestamp > 0 {
+		blockNumber, err := firstBlockAtOrAfter(fetcher, policy.Timestamp, lastBlock.Int64())
+		if err != nil {
+			logrus.Error("PruneHeaders: Error getting the first block at the retention timestamp: ", err)
+			return 0, err
+		}
+		if blockNumber > lastBlock.Int64() {
+			logrus.Warnf("PruneHeaders: the head of the chain is before the retention timestamp %d, not pruning by timestamp", policy.Timestamp)
+		} else if blockNumber > cutoff {
+			cutoff = blockNumber
+		}
+	}
+	if cutoff <= 0 {
+		return 0, nil
+	}
+	pruned, err := headerRepository.PruneHeaders(cutoff)
+	if err != nil {
+		logrus.Error("PruneHeaders: Error pruning headers: ", err)
+		return 0, err
+	}
+	return pruned, nil
+}
+
+// firstBlockAtOrAfter searches the chain's headers up to the last block for the first one with a timestamp at or after
+// the provided one, returning the block after the last block if there is none
+func firstBlockAtOrAfter(fetcher core.Fetcher, timestamp, lastBlock int64) (int64, error) {
+	low, high := int64(0), lastBlock+1
+	for low < high {
+		middle := low + (high-low)/2
+		header, err := fetcher.GetHeaderByNumber(middle)
+		if err != nil {
+			return 0, err
+		}
+		headerTimestamp, err := header.UnixTimestamp()
+		if err != nil {
+			return 0, err
+		}
+		if headerTimestamp >= timestamp {
+			high = middle
+		} else {
+			low = middle + 1
+		}
+	}
+	return low, nil
+}
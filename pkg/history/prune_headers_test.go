@@ -0,0 +1,139 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package history_test
+
+import (
+	"math/big"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	ethfetcher "github.com/vulcanize/eth-header-sync/pkg/fetcher"
+	"github.com/vulcanize/eth-header-sync/pkg/history"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+var _ = Describe("Pruning headers", func() {
+	var (
+		headerRepository *fakes.MockHeaderRepository
+		fetcher          *fakes.MockFetcher
+	)
+
+	BeforeEach(func() {
+		headerRepository = fakes.NewMockHeaderRepository()
+		fetcher = fakes.NewMockFetcher()
+		fetcher.SetLastBlock(big.NewInt(100))
+	})
+
+	It("is disabled for an empty policy", func() {
+		Expect(history.RetentionPolicy{}.Enabled()).To(BeFalse())
+		Expect(history.RetentionPolicy{Blocks: 1}.Enabled()).To(BeTrue())
+		Expect(history.RetentionPolicy{Timestamp: 1}.Enabled()).To(BeTrue())
+	})
+
+	It("prunes headers below the last N blocks", func() {
+		headerRepository.SetPruneHeadersReturnCount(3)
+
+		pruned, err := history.PruneHeaders(fetcher, headerRepository, history.RetentionPolicy{Blocks: 10})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pruned).To(Equal(int64(3)))
+		Expect(headerRepository.PruneHeadersPassedBlockNumber).To(Equal(int64(91)))
+	})
+
+	Describe("by timestamp", func() {
+		var (
+			chain *simulated.Chain
+			repo  core.HeaderRepository
+		)
+
+		BeforeEach(func() {
+			chain = simulated.NewChain(20)
+			repo = repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+		})
+
+		chainFetcher := func() core.Fetcher {
+			return ethfetcher.NewFetcher(chain, chain, core.Node{ID: "fingerprint"})
+		}
+
+		store := func(blockNumbers ...int64) {
+			for _, blockNumber := range blockNumbers {
+				header := chain.Header(blockNumber)
+				_, err := repo.CreateOrUpdateHeader(converter.HeaderConverter{}.Convert(header, header.Hash().Hex()))
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+
+		It("prunes the headers before the first block of the chain at the timestamp", func() {
+			store(0, 1, 2, 3, 4, 5, 6)
+
+			pruned, err := history.PruneHeaders(chainFetcher(), repo, history.RetentionPolicy{Timestamp: int64(chain.Header(4).Time) - 1})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(Equal(int64(4)))
+			_, err = repo.GetHeader(3)
+			Expect(err).To(HaveOccurred())
+			_, err = repo.GetHeader(4)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("keeps reporting unsynced blocks within the retention window as missing", func() {
+			store(0, 1, 2, 8, 9, 10)
+
+			_, err := history.PruneHeaders(chainFetcher(), repo, history.RetentionPolicy{Timestamp: int64(chain.Header(5).Time)})
+
+			Expect(err).NotTo(HaveOccurred())
+			missing, err := repo.MissingBlockNumbers(0, 10, "fingerprint")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(Equal([]int64{5, 6, 7}))
+		})
+
+		It("does not prune when the head of the chain is before the timestamp", func() {
+			store(0, 1, 2)
+
+			pruned, err := history.PruneHeaders(chainFetcher(), repo, history.RetentionPolicy{Timestamp: int64(chain.Header(20).Time) + 1})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(BeZero())
+			missing, err := repo.MissingBlockNumbers(0, 20, "fingerprint")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(HaveLen(18))
+		})
+
+		It("prunes up to the later of the block and timestamp cutoffs", func() {
+			store(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+			pruned, err := history.PruneHeaders(chainFetcher(), repo,
+				history.RetentionPolicy{Blocks: 15, Timestamp: int64(chain.Header(8).Time)})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(Equal(int64(8)))
+		})
+	})
+
+	It("propagates header repository errors", func() {
+		headerRepository.SetPruneHeadersErr(fakes.FakeError)
+
+		_, err := history.PruneHeaders(fetcher, headerRepository, history.RetentionPolicy{Blocks: 10})
+
+		Expect(err).To(MatchError(fakes.FakeError))
+	})
+})
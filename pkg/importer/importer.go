@@ -0,0 +1,239 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+)
+
+// batchSize is the number of headers read from a source repository, and written, at a time
+const batchSize = 1000
+
+// VerificationError reports a header which failed verification, it and the headers after it are not imported
+type VerificationError struct {
+	BlockNumber int64
+	Reason      string
+}
+
+func (err VerificationError) Error() string {
+	return fmt.Sprintf("block %d: %s", err.BlockNumber, err.Reason)
+}
+
+// Result counts the headers of an import
+type Result struct {
+	// Imported is the number of headers inserted or updated
+	Imported int64
+	// Existing is the number of headers which were already stored
+	Existing int64
+}
+
+// BatchWriter is implemented by repositories which write a batch of headers in one transaction, returning the number
+// of headers inserted or replaced
+type BatchWriter interface {
+	CreateOrUpdateHeaders(headers []core.Header) (int64, error)
+}
+
+// Importer verifies the headers of a Source and inserts them through a repository
+type Importer struct {
+	repository   core.HeaderRepository
+	converter    converter.HeaderConverter
+	verifyHashes bool
+}
+
+// NewImporter returns an Importer inserting headers into the repository with the converter's encodings
+// With verifyHashes set a hash claimed by the source must match the hash computed from the header, which fails for POA
+// headers whose seal fields the source does not have, such as those stored from JSON-RPC
+// Without it the claimed hashes are trusted, so this is warned about, along with every claimed hash which does not match
+func NewImporter(repository core.HeaderRepository, headerConverter converter.HeaderConverter, verifyHashes bool) *Importer {
+	if !verifyHashes {
+		log.Warn("NewImporter: hash verification is off, the hashes claimed for headers are stored without being checked")
+	}
+	return &Importer{
+		repository:   repository,
+		converter:    headerConverter,
+		verifyHashes: verifyHashes,
+	}
+}
+
+// Import inserts the headers of the source until it is exhausted, verifying each one before inserting it
+// A header must have a higher block number than the one before it, and its parent hash must be the hash of the
+// header before it, or of the stored header, if any, when the source skips the parent's block number
+// Headers are written in batches, through the repository's CreateOrUpdateHeaders if it is a BatchWriter, and the
+// headers verified before an error are written before it is returned
+func (importer *Importer) Import(source Source) (Result, error) {
+	var (
+		result       Result
+		pending      []core.Header
+		previous     *types.Header
+		previousHash string
+	)
+	finish := func(err error) (Result, error) {
+		if writeErr := importer.write(pending, &result); writeErr != nil {
+			return result, writeErr
+		}
+		return result, err
+	}
+	for {
+		header, err := source.Next()
+		if err == io.EOF {
+			return finish(nil)
+		}
+		if err != nil {
+			return finish(err)
+		}
+		gethHeader, encoded, err := importer.decode(header)
+		if err != nil {
+			return finish(err)
+		}
+		hash, err := importer.verify(gethHeader, previous, crypto.Keccak256Hash(encoded).Hex(), header.Hash, previousHash)
+		if err != nil {
+			return finish(err)
+		}
+		if header, err = importer.encode(header, encoded); err != nil {
+			return finish(err)
+		}
+		header.Hash = hash
+		pending = append(pending, header)
+		if len(pending) == batchSize {
+			if err := importer.write(pending, &result); err != nil {
+				return result, err
+			}
+			pending = pending[:0]
+		}
+		previous, previousHash = gethHeader, hash
+	}
+}
+
+// decode returns the header decoded into go-ethereum's header type, and its RLP encoding with any fields added after
+// that type
+func (importer *Importer) decode(header core.Header) (*types.Header, []byte, error) {
+	encoded, err := converter.HeaderRLP(header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %s", header.BlockNumber, err.Error())
+	}
+	gethHeader, _, err := converter.DecodeHeaderRLP(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %s", header.BlockNumber, err.Error())
+	}
+	return gethHeader, encoded, nil
+}
+
+// encode returns the header with the configured encodings, keeping those the source has for it and converting the
+// others from its RLP encoding
+func (importer *Importer) encode(header core.Header, encoded []byte) (core.Header, error) {
+	if importer.converter.Encoding == converter.JSON {
+		header.RLP = nil
+	} else if len(header.RLP) == 0 {
+		header.RLP = encoded
+	}
+	if importer.converter.Encoding == converter.RLP {
+		header.Raw = nil
+	} else if len(header.Raw) == 0 {
+		converted, err := importer.converter.ConvertRLP(encoded)
+		if err != nil {
+			return header, err
+		}
+		header.Raw = converted.Raw
+	}
+	return header, nil
+}
+
+// write inserts the headers and counts them in the result
+func (importer *Importer) write(headers []core.Header, result *Result) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	if writer, ok := importer.repository.(BatchWriter); ok {
+		written, err := writer.CreateOrUpdateHeaders(headers)
+		if err != nil {
+			return err
+		}
+		result.Imported += written
+		result.Existing += int64(len(headers)) - written
+	} else {
+		for _, header := range headers {
+			_, err := importer.repository.CreateOrUpdateHeader(header)
+			switch err {
+			case nil:
+				result.Imported++
+			case repository.ErrValidHeaderExists:
+				result.Existing++
+			default:
+				return err
+			}
+		}
+	}
+	log.Infof("Import: imported %d and skipped %d existing headers, up to block %d",
+		result.Imported, result.Existing, headers[len(headers)-1].BlockNumber)
+	return nil
+}
+
+// verify checks the header against the one before it and returns the hash to store it with, the claimed hash if
+// there is one or else the computed hash
+func (importer *Importer) verify(gethHeader, previous *types.Header, computedHash, claimedHash, previousHash string) (string, error) {
+	number := gethHeader.Number.Int64()
+	hash := computedHash
+	if claimedHash != "" {
+		if common.HexToHash(claimedHash).Hex() != hash {
+			if importer.verifyHashes {
+				return "", VerificationError{BlockNumber: number,
+					Reason: fmt.Sprintf("claimed hash %s does not match the header's hash %s", claimedHash, hash)}
+			}
+			log.Warnf("Import: storing block %d with its claimed hash %s, which does not match the header's hash %s",
+				number, claimedHash, hash)
+		}
+		hash = common.HexToHash(claimedHash).Hex()
+	}
+
+	if previous != nil && number <= previous.Number.Int64() {
+		return "", VerificationError{BlockNumber: number,
+			Reason: fmt.Sprintf("out of order, it follows block %d", previous.Number.Int64())}
+	}
+	if previous != nil && number == previous.Number.Int64()+1 {
+		if gethHeader.ParentHash.Hex() != common.HexToHash(previousHash).Hex() {
+			return "", VerificationError{BlockNumber: number,
+				Reason: fmt.Sprintf("parent hash %s does not match the previous header's hash %s", gethHeader.ParentHash.Hex(), previousHash)}
+		}
+		return hash, nil
+	}
+	if number == 0 {
+		return hash, nil
+	}
+	parent, err := importer.repository.GetHeader(number - 1)
+	if err == sql.ErrNoRows {
+		return hash, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if gethHeader.ParentHash.Hex() != common.HexToHash(parent.Hash).Hex() {
+		return "", VerificationError{BlockNumber: number,
+			Reason: fmt.Sprintf("parent hash %s does not match the stored header's hash %s", gethHeader.ParentHash.Hex(), parent.Hash)}
+	}
+	return hash, nil
+}
@@ -0,0 +1,323 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer_test
+
+import (
+	"bytes"
+	"database/sql"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/importer"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+var _ = Describe("Importer", func() {
+	var (
+		chain          *simulated.Chain
+		repo           core.HeaderRepository
+		headerImporter *importer.Importer
+	)
+
+	BeforeEach(func() {
+		chain = simulated.NewChain(10)
+		repo = repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+		headerImporter = importer.NewImporter(repo, converter.HeaderConverter{}, true)
+	})
+
+	blocks := func(headers ...*types.Header) importer.Source {
+		var input bytes.Buffer
+		for _, gethHeader := range headers {
+			Expect(rlp.Encode(&input, types.NewBlockWithHeader(gethHeader))).To(Succeed())
+		}
+		source, err := importer.NewRLPSource(&input)
+		Expect(err).NotTo(HaveOccurred())
+		return source
+	}
+
+	chainHeaders := func(from, to int64) []*types.Header {
+		var headers []*types.Header
+		for number := from; number <= to; number++ {
+			headers = append(headers, chain.Header(number))
+		}
+		return headers
+	}
+
+	expectStored := func(from, to int64) {
+		for number := from; number <= to; number++ {
+			header, err := repo.GetHeader(number)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Hash).To(Equal(chain.Header(number).Hash().Hex()))
+		}
+	}
+
+	expectVerificationError := func(err error, blockNumber int64, reason string) {
+		Expect(err).To(HaveOccurred())
+		verificationErr, ok := err.(importer.VerificationError)
+		Expect(ok).To(BeTrue(), err.Error())
+		Expect(verificationErr.BlockNumber).To(Equal(blockNumber))
+		Expect(verificationErr.Reason).To(ContainSubstring(reason))
+	}
+
+	It("imports the headers of a geth export", func() {
+		result, err := headerImporter.Import(blocks(chainHeaders(0, 10)...))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(importer.Result{Imported: 11}))
+		expectStored(0, 10)
+		header, err := repo.GetHeader(4)
+		Expect(err).NotTo(HaveOccurred())
+		gethHeader, err := converter.DecodeHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gethHeader.Hash()).To(Equal(chain.Header(4).Hash()))
+	})
+
+	It("counts the headers which are already stored", func() {
+		_, err := headerImporter.Import(blocks(chainHeaders(0, 5)...))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := headerImporter.Import(blocks(chainHeaders(3, 10)...))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(importer.Result{Imported: 5, Existing: 3}))
+		expectStored(0, 10)
+	})
+
+	It("rejects a header whose claimed hash does not match it", func() {
+		var input strings.Builder
+		for number := int64(0); number <= 4; number++ {
+			gethHeader := chain.Header(number)
+			hash := gethHeader.Hash().Hex()
+			if number == 3 {
+				hash = chain.Header(9).Hash().Hex()
+			}
+			line, err := gethHeader.MarshalJSON()
+			Expect(err).NotTo(HaveOccurred())
+			input.WriteString(strings.Replace(string(line), gethHeader.Hash().Hex(), hash, 1) + "\n")
+		}
+
+		result, err := headerImporter.Import(ndjson(strings.NewReader(input.String())))
+
+		expectVerificationError(err, 3, "does not match the header's hash")
+		Expect(result.Imported).To(Equal(int64(3)))
+		_, err = repo.GetHeader(3)
+		Expect(err).To(Equal(sql.ErrNoRows))
+	})
+
+	It("stores the claimed hashes without verifying them when hash verification is off, warning about them", func() {
+		line, err := chain.Header(0).MarshalJSON()
+		Expect(err).NotTo(HaveOccurred())
+		claimed := chain.Header(9).Hash().Hex()
+		input := strings.Replace(string(line), chain.Header(0).Hash().Hex(), claimed, 1)
+		hook := test.NewGlobal()
+		defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+		result, err := importer.NewImporter(repo, converter.HeaderConverter{}, false).Import(ndjson(strings.NewReader(input)))
+
+		Expect(err).NotTo(HaveOccurred())
+		var warnings []string
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == log.WarnLevel {
+				warnings = append(warnings, entry.Message)
+			}
+		}
+		Expect(warnings).To(HaveLen(2))
+		Expect(warnings[0]).To(ContainSubstring("hash verification is off"))
+		Expect(warnings[1]).To(ContainSubstring("block 0 with its claimed hash " + claimed))
+		Expect(result.Imported).To(Equal(int64(1)))
+		header, err := repo.GetHeader(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal(claimed))
+	})
+
+	It("rejects a header which does not link to the header before it", func() {
+		headers := chainHeaders(0, 6)
+		fork := simulated.NewChain(10)
+		Expect(fork.Reorg(6, 6)).To(Succeed())
+		headers[6] = fork.Header(6)
+
+		result, err := headerImporter.Import(blocks(headers...))
+
+		expectVerificationError(err, 6, "does not match the previous header's hash")
+		Expect(result.Imported).To(Equal(int64(6)))
+		_, err = repo.GetHeader(6)
+		Expect(err).To(Equal(sql.ErrNoRows))
+	})
+
+	It("verifies the first header against the stored parent", func() {
+		fork := simulated.NewChain(10)
+		Expect(fork.Reorg(6, 6)).To(Succeed())
+		_, err := repo.CreateOrUpdateHeader(converter.HeaderConverter{}.Convert(fork.Header(5), fork.Header(5).Hash().Hex()))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = headerImporter.Import(blocks(chainHeaders(6, 10)...))
+
+		expectVerificationError(err, 6, "does not match the stored header's hash")
+	})
+
+	It("links headers across a gap in the source through the stored headers", func() {
+		_, err := repo.CreateOrUpdateHeader(converter.HeaderConverter{}.Convert(chain.Header(4), chain.Header(4).Hash().Hex()))
+		Expect(err).NotTo(HaveOccurred())
+		headers := append(chainHeaders(0, 3), chainHeaders(5, 10)...)
+
+		result, err := headerImporter.Import(blocks(headers...))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Imported).To(Equal(int64(10)))
+		expectStored(0, 10)
+	})
+
+	It("rejects headers out of order", func() {
+		_, err := headerImporter.Import(blocks(chain.Header(2), chain.Header(1)))
+
+		expectVerificationError(err, 1, "out of order, it follows block 2")
+	})
+
+	It("imports the headers of another repository as they are stored", func() {
+		source := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "other")
+		for number := int64(0); number <= 10; number++ {
+			header := converter.HeaderConverter{Encoding: converter.JSONAndRLP}.Convert(chain.Header(number), chain.Header(number).Hash().Hex())
+			header.Uncles = []core.Uncle{{BlockNumber: number, Hash: "0xuncle", Miner: "0xminer"}}
+			header.TransactionHashes = []string{"0xtx"}
+			_, err := source.CreateOrUpdateHeader(header)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		repo = repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+
+		result, err := importer.NewImporter(repo, converter.HeaderConverter{Encoding: converter.JSONAndRLP}, true).
+			Import(importer.NewRepositorySource(source, 2, 8))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Imported).To(Equal(int64(7)))
+		for number := int64(2); number <= 8; number++ {
+			stored, err := source.GetHeader(number)
+			Expect(err).NotTo(HaveOccurred())
+			imported, err := repo.GetHeader(number)
+			Expect(err).NotTo(HaveOccurred())
+			stored.ID, imported.ID = 0, 0
+			Expect(imported).To(Equal(stored))
+		}
+		_, err = repo.GetHeader(9)
+		Expect(err).To(Equal(sql.ErrNoRows))
+	})
+
+	It("keeps the fields added to the header after go-ethereum's header type", func() {
+		londonRLP := fakes.LondonHeaderRLP(chain.Header(0), big.NewInt(1000000000))
+		londonHeader, err := converter.HeaderConverter{}.ConvertRLP(londonRLP)
+		Expect(err).NotTo(HaveOccurred())
+		repo = repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+
+		result, err := importer.NewImporter(repo, converter.HeaderConverter{Encoding: converter.RLP}, true).
+			Import(ndjson(bytes.NewReader(londonHeader.Raw)))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Imported).To(Equal(int64(1)))
+		header, err := repo.GetHeader(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal(crypto.Keccak256Hash(londonRLP).Hex()))
+		Expect(header.RLP).To(Equal(londonRLP))
+		Expect(header.Raw).To(BeNil())
+	})
+
+	It("verifies the post-London headers of a repository synced over JSON-RPC", func() {
+		source := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "other")
+		var parentHash common.Hash
+		for number := int64(0); number <= 5; number++ {
+			gethHeader := chain.Header(number)
+			gethHeader.ParentHash = parentHash
+			raw, hash := fakes.ShanghaiHeaderJSON(gethHeader, big.NewInt(1000000000), common.HexToHash("0x1234"))
+			header, err := converter.HeaderConverter{}.ConvertJSON(raw)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Hash).To(Equal(hash.Hex()))
+			_, err = source.CreateOrUpdateHeader(header)
+			Expect(err).NotTo(HaveOccurred())
+			parentHash = hash
+		}
+
+		result, err := headerImporter.Import(importer.NewRepositorySource(source, 0, 5))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Imported).To(Equal(int64(6)))
+		header, err := repo.GetHeader(5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal(parentHash.Hex()))
+	})
+
+	It("writes batches of headers through a batch writer", func() {
+		writer := &batchWriter{HeaderRepository: repo}
+		headerImporter = importer.NewImporter(writer, converter.HeaderConverter{}, true)
+		_, err := headerImporter.Import(blocks(chainHeaders(0, 2)...))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := headerImporter.Import(blocks(chainHeaders(0, 10)...))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(importer.Result{Imported: 8, Existing: 3}))
+		Expect(writer.batches).To(Equal([]int{3, 11}))
+		expectStored(0, 10)
+	})
+
+	It("writes the headers verified before a header failing verification", func() {
+		writer := &batchWriter{HeaderRepository: repo}
+		headerImporter = importer.NewImporter(writer, converter.HeaderConverter{}, true)
+		fork := simulated.NewChain(10)
+		Expect(fork.Reorg(6, 6)).To(Succeed())
+		headers := chainHeaders(0, 10)
+		headers[6] = fork.Header(6)
+
+		result, err := headerImporter.Import(blocks(headers...))
+
+		expectVerificationError(err, 6, "does not match the previous header's hash")
+		Expect(result.Imported).To(Equal(int64(6)))
+		Expect(writer.batches).To(Equal([]int{6}))
+	})
+})
+
+// batchWriter writes batches of headers through a repository one header at a time, recording the size of each batch
+type batchWriter struct {
+	core.HeaderRepository
+	batches []int
+}
+
+func (writer *batchWriter) CreateOrUpdateHeaders(headers []core.Header) (int64, error) {
+	writer.batches = append(writer.batches, len(headers))
+	var written int64
+	for _, header := range headers {
+		_, err := writer.CreateOrUpdateHeader(header)
+		if err == repository.ErrValidHeaderExists {
+			continue
+		}
+		if err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
@@ -0,0 +1,236 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// Source yields the headers to import in ascending block number order
+type Source interface {
+	// Next returns the next header with the encodings the source has for it, whose hash is the hash the source claims
+	// for it, which is empty if the source has none, or io.EOF after the last header
+	Next() (core.Header, error)
+}
+
+// maxLineSize is the longest NDJSON line read, enough for blocks with their full transactions
+const maxLineSize = 64 * 1024 * 1024
+
+// sourceConverter converts the headers read from files with every encoding, the importer keeps the configured ones
+var sourceConverter = converter.HeaderConverter{Encoding: converter.JSONAndRLP}
+
+// NDJSONSource reads headers from newline delimited JSON, one header per line in the form eth_getBlockByNumber
+// returns it, as also stored in the raw header column
+// A hash field, if present, is the claimed hash of the header
+type NDJSONSource struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewNDJSONSource returns a Source reading headers from the newline delimited JSON, which is decompressed first if it
+// is gzipped
+func NewNDJSONSource(reader io.Reader) (*NDJSONSource, error) {
+	input, err := decompress(reader)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &NDJSONSource{scanner: scanner}, nil
+}
+
+// Next returns the header on the next non-empty line
+// The fields added to the header after go-ethereum's header type, such as the base fee, are kept
+func (source *NDJSONSource) Next() (core.Header, error) {
+	for source.scanner.Scan() {
+		source.line++
+		line := bytes.TrimSpace(source.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		encoded, err := converter.EncodeHeaderJSON(line)
+		if err != nil {
+			return core.Header{}, fmt.Errorf("line %d: %s", source.line, err.Error())
+		}
+		header, err := sourceConverter.ConvertRLP(encoded)
+		if err != nil {
+			return core.Header{}, fmt.Errorf("line %d: %s", source.line, err.Error())
+		}
+		var claimed struct {
+			Hash *common.Hash `json:"hash"`
+		}
+		if err := json.Unmarshal(line, &claimed); err != nil {
+			return core.Header{}, fmt.Errorf("line %d: %s", source.line, err.Error())
+		}
+		header.Hash = ""
+		if claimed.Hash != nil {
+			header.Hash = claimed.Hash.Hex()
+		}
+		return header, nil
+	}
+	if err := source.scanner.Err(); err != nil {
+		return core.Header{}, err
+	}
+	return core.Header{}, io.EOF
+}
+
+// RLPSource reads headers from a stream of RLP encoded blocks or headers, such as the files written by geth export
+// The hash of each header is computed from it, so only its parent linkage can be verified
+type RLPSource struct {
+	stream *rlp.Stream
+	item   int
+}
+
+// NewRLPSource returns a Source reading the RLP stream, which is decompressed first if it is gzipped
+func NewRLPSource(reader io.Reader) (*RLPSource, error) {
+	input, err := decompress(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &RLPSource{stream: rlp.NewStream(input, 0)}, nil
+}
+
+// Next decodes the next item of the stream as a block, or as a header if it is not one
+// The header keeps its encoding in the stream, with any fields added after go-ethereum's header type
+func (source *RLPSource) Next() (core.Header, error) {
+	raw, err := source.stream.Raw()
+	if err == io.EOF {
+		return core.Header{}, io.EOF
+	}
+	if err != nil {
+		return core.Header{}, fmt.Errorf("item %d: %s", source.item, err.Error())
+	}
+	source.item++
+	var block struct {
+		Header rlp.RawValue
+		Rest   []rlp.RawValue `rlp:"tail"`
+	}
+	if rlp.DecodeBytes(raw, &block) == nil {
+		if header, err := sourceConverter.ConvertRLP(block.Header); err == nil {
+			header.Hash = ""
+			return header, nil
+		}
+	}
+	header, err := sourceConverter.ConvertRLP(raw)
+	if err != nil {
+		return core.Header{}, fmt.Errorf("item %d is neither an RLP encoded block nor header: %s", source.item-1, err.Error())
+	}
+	header.Hash = ""
+	return header, nil
+}
+
+// decompress returns a reader of the decompressed input if it starts with the gzip magic number, or of the input itself
+func decompress(reader io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+	magic, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(buffered)
+	}
+	return buffered, nil
+}
+
+// UncleReader reads the uncles stored alongside a repository's headers
+type UncleReader interface {
+	GetUncles(blockNumber int64) ([]core.Uncle, error)
+}
+
+// TransactionHashReader reads the transaction hashes stored alongside a repository's headers
+type TransactionHashReader interface {
+	GetTransactionHashes(blockNumber int64) ([]string, error)
+}
+
+// RepositorySource reads the headers of a block range from another repository, such as the database of another
+// eth-header-sync deployment
+// The stored headers are copied as they are, with their stored hash as the claimed hash
+type RepositorySource struct {
+	repository   core.HeaderRepository
+	uncles       UncleReader
+	transactions TransactionHashReader
+	next         int64
+	end          int64
+	headers      []core.Header
+}
+
+// NewRepositorySource returns a Source reading the repository's headers between the block numbers (inclusive)
+func NewRepositorySource(repository core.HeaderRepository, startingBlockNumber, endingBlockNumber int64) *RepositorySource {
+	return &RepositorySource{
+		repository: repository,
+		next:       startingBlockNumber,
+		end:        endingBlockNumber,
+	}
+}
+
+// SetUncleReader sets the reader of the uncles stored alongside the headers, for repositories which do not return
+// them with the headers
+func (source *RepositorySource) SetUncleReader(reader UncleReader) {
+	source.uncles = reader
+}
+
+// SetTransactionHashReader sets the reader of the transaction hashes stored alongside the headers, for repositories
+// which do not return them with the headers
+func (source *RepositorySource) SetTransactionHashReader(reader TransactionHashReader) {
+	source.transactions = reader
+}
+
+// Next returns the next stored header, reading them from the repository in batches
+func (source *RepositorySource) Next() (core.Header, error) {
+	for len(source.headers) == 0 {
+		if source.next > source.end {
+			return core.Header{}, io.EOF
+		}
+		end := source.next + batchSize - 1
+		if end > source.end {
+			end = source.end
+		}
+		headers, err := source.repository.GetHeadersInRange(source.next, end)
+		if err != nil && err != sql.ErrNoRows {
+			return core.Header{}, err
+		}
+		source.headers = headers
+		source.next = end + 1
+	}
+	header := source.headers[0]
+	source.headers = source.headers[1:]
+	header.ID = 0
+	var err error
+	if source.uncles != nil && len(header.Uncles) == 0 {
+		if header.Uncles, err = source.uncles.GetUncles(header.BlockNumber); err != nil {
+			return core.Header{}, fmt.Errorf("block %d: %s", header.BlockNumber, err.Error())
+		}
+	}
+	if source.transactions != nil && len(header.TransactionHashes) == 0 {
+		if header.TransactionHashes, err = source.transactions.GetTransactionHashes(header.BlockNumber); err != nil {
+			return core.Header{}, fmt.Errorf("block %d: %s", header.BlockNumber, err.Error())
+		}
+	}
+	return header, nil
+}
@@ -0,0 +1,238 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/importer"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+// readAll drains the source, returning the headers, whose hashes are those claimed for them
+func readAll(source importer.Source) []core.Header {
+	var headers []core.Header
+	for {
+		header, err := source.Next()
+		if err == io.EOF {
+			return headers
+		}
+		Expect(err).NotTo(HaveOccurred())
+		headers = append(headers, header)
+	}
+}
+
+// ndjson returns an NDJSONSource reading the input
+func ndjson(input io.Reader) *importer.NDJSONSource {
+	source, err := importer.NewNDJSONSource(input)
+	Expect(err).NotTo(HaveOccurred())
+	return source
+}
+
+var _ = Describe("Sources", func() {
+	var chain *simulated.Chain
+
+	BeforeEach(func() {
+		chain = simulated.NewChain(5)
+	})
+
+	Describe("NDJSONSource", func() {
+		It("reads a header per line with its claimed hash", func() {
+			var input bytes.Buffer
+			for number := int64(0); number <= 5; number++ {
+				line, err := json.Marshal(chain.Header(number))
+				Expect(err).NotTo(HaveOccurred())
+				input.Write(line)
+				input.WriteString("\n\n")
+			}
+
+			headers := readAll(ndjson(&input))
+
+			Expect(headers).To(HaveLen(6))
+			for number, header := range headers {
+				Expect(header.Hash).To(Equal(chain.Header(int64(number)).Hash().Hex()))
+				Expect(header.BlockNumber).To(Equal(int64(number)))
+				Expect(header.RLP).To(Equal(encode(chain.Header(int64(number)))))
+			}
+		})
+
+		It("keeps the fields added to the header after go-ethereum's header type", func() {
+			londonRLP := fakes.LondonHeaderRLP(chain.Header(1), big.NewInt(1000000000))
+			londonHeader, err := converter.HeaderConverter{}.ConvertRLP(londonRLP)
+			Expect(err).NotTo(HaveOccurred())
+
+			headers := readAll(ndjson(bytes.NewReader(londonHeader.Raw)))
+
+			Expect(headers).To(HaveLen(1))
+			Expect(headers[0].Hash).To(Equal(crypto.Keccak256Hash(londonRLP).Hex()))
+			Expect(headers[0].RLP).To(Equal(londonRLP))
+		})
+
+		It("claims no hash when the line has none", func() {
+			line, err := json.Marshal(chain.Header(1))
+			Expect(err).NotTo(HaveOccurred())
+			var fields map[string]interface{}
+			Expect(json.Unmarshal(line, &fields)).To(Succeed())
+			delete(fields, "hash")
+			line, err = json.Marshal(fields)
+			Expect(err).NotTo(HaveOccurred())
+
+			headers := readAll(ndjson(bytes.NewReader(line)))
+
+			Expect(headers).To(HaveLen(1))
+			Expect(headers[0].Hash).To(BeEmpty())
+		})
+
+		It("reports the line of an invalid header", func() {
+			source := ndjson(strings.NewReader("\n{\"number\": \"0x1\"}\n"))
+
+			_, err := source.Next()
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("line 2:"))
+		})
+	})
+
+	Describe("RLPSource", func() {
+		It("reads the blocks written by geth export", func() {
+			var input bytes.Buffer
+			for number := int64(0); number <= 5; number++ {
+				Expect(rlp.Encode(&input, types.NewBlockWithHeader(chain.Header(number)))).To(Succeed())
+			}
+
+			source, err := importer.NewRLPSource(&input)
+			Expect(err).NotTo(HaveOccurred())
+			headers := readAll(source)
+
+			Expect(headers).To(HaveLen(6))
+			for number, header := range headers {
+				Expect(header.RLP).To(Equal(encode(chain.Header(int64(number)))))
+				Expect(header.Hash).To(BeEmpty())
+			}
+		})
+
+		It("reads gzipped headers", func() {
+			var input bytes.Buffer
+			compressed := gzip.NewWriter(&input)
+			for number := int64(0); number <= 5; number++ {
+				Expect(rlp.Encode(compressed, chain.Header(number))).To(Succeed())
+			}
+			Expect(compressed.Close()).To(Succeed())
+
+			source, err := importer.NewRLPSource(&input)
+			Expect(err).NotTo(HaveOccurred())
+			headers := readAll(source)
+
+			Expect(headers).To(HaveLen(6))
+			Expect(headers[5].RLP).To(Equal(encode(chain.Header(5))))
+		})
+
+		It("rejects items which are neither blocks nor headers", func() {
+			var input bytes.Buffer
+			Expect(rlp.Encode(&input, []uint64{1, 2, 3})).To(Succeed())
+
+			source, err := importer.NewRLPSource(&input)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = source.Next()
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("item 0 is neither"))
+		})
+	})
+
+	Describe("RepositorySource", func() {
+		It("reads the stored headers of the range as they are stored", func() {
+			repo := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+			for _, number := range []int64{0, 1, 3, 4, 5} {
+				header := converter.HeaderConverter{Encoding: converter.RLP}.Convert(chain.Header(number), chain.Header(number).Hash().Hex())
+				header.RLP = append(header.RLP, 0x5a)
+				header.TransactionHashes = []string{"0xtx"}
+				_, err := repo.CreateOrUpdateHeader(header)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			headers := readAll(importer.NewRepositorySource(repo, 1, 4))
+
+			Expect(headers).To(HaveLen(3))
+			for i, number := range []int64{1, 3, 4} {
+				stored, err := repo.GetHeader(number)
+				Expect(err).NotTo(HaveOccurred())
+				stored.ID = 0
+				Expect(headers[i]).To(Equal(stored))
+			}
+		})
+
+		It("reads the uncles and transaction hashes stored alongside the headers", func() {
+			repo := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), "fingerprint")
+			_, err := repo.CreateOrUpdateHeader(converter.HeaderConverter{}.Convert(chain.Header(1), chain.Header(1).Hash().Hex()))
+			Expect(err).NotTo(HaveOccurred())
+			children := &childReader{
+				uncles:       []core.Uncle{{BlockNumber: 0, Hash: "0xuncle"}},
+				transactions: []string{"0xtx1", "0xtx2"},
+			}
+			source := importer.NewRepositorySource(repo, 1, 1)
+			source.SetUncleReader(children)
+			source.SetTransactionHashReader(children)
+
+			headers := readAll(source)
+
+			Expect(headers).To(HaveLen(1))
+			Expect(headers[0].Uncles).To(Equal(children.uncles))
+			Expect(headers[0].TransactionHashes).To(Equal(children.transactions))
+			Expect(children.numbers).To(Equal([]int64{1, 1}))
+		})
+	})
+})
+
+// childReader returns the same uncles and transaction hashes for every block number, recording the numbers read
+type childReader struct {
+	uncles       []core.Uncle
+	transactions []string
+	numbers      []int64
+}
+
+func (reader *childReader) GetUncles(blockNumber int64) ([]core.Uncle, error) {
+	reader.numbers = append(reader.numbers, blockNumber)
+	return reader.uncles, nil
+}
+
+func (reader *childReader) GetTransactionHashes(blockNumber int64) ([]string, error) {
+	reader.numbers = append(reader.numbers, blockNumber)
+	return reader.transactions, nil
+}
+
+// encode returns the RLP encoding of the header
+func encode(gethHeader *types.Header) []byte {
+	encoded, err := rlp.EncodeToBytes(gethHeader)
+	Expect(err).NotTo(HaveOccurred())
+	return encoded
+}
@@ -0,0 +1,481 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package kvstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+)
+
+// The repository package is aliased here as the receivers of this package, named repository as there, shadow it
+var (
+	// ErrValidHeaderExists is returned for a header which is already stored, as by repository.HeaderRepository
+	ErrValidHeaderExists        = repository.ErrValidHeaderExists
+	getHeaderClosestToTimestamp = repository.GetHeaderClosestToTimestamp
+)
+
+// pruneBatchSize is the number of headers deleted by each write when pruning
+const pruneBatchSize = 1000
+
+// sequenceKey holds the last header id assigned, ids are shared by every fingerprint as in the headers table
+var sequenceKey = []byte("sequence")
+
+// HeaderRepository satisfies the core.HeaderRepository interface with an embedded key-value store
+// The block numbers missing below the highest stored header are kept as gaps, which are updated as headers are written
+// and pruned, so that MissingBlockNumbers reads the gaps instead of scanning the stored headers
+type HeaderRepository struct {
+	db          *DB
+	fingerprint string
+}
+
+// NewHeaderRepository returns a HeaderRepository for the headers of the node with the provided fingerprint
+func NewHeaderRepository(db *DB, fingerprint string) HeaderRepository {
+	return HeaderRepository{db: db, fingerprint: fingerprint}
+}
+
+// CreateOrUpdateHeader stores the header
+// If there is already a header at the height, it is replaced if the hash is not the expected value
+func (repository HeaderRepository) CreateOrUpdateHeader(header core.Header) (int64, error) {
+	timestamp, err := header.UnixTimestamp()
+	if err != nil {
+		return 0, err
+	}
+	repository.db.mutex.Lock()
+	defer repository.db.mutex.Unlock()
+	batch := repository.db.db.NewBatch()
+	defer batch.Close()
+	stored, err := repository.GetHeader(header.BlockNumber)
+	replace := err == nil
+	switch {
+	case replace && stored.Hash == header.Hash:
+		return 0, ErrValidHeaderExists
+	case replace:
+		defer metrics.ObserveDBWrite("replace", time.Now())
+		if err := repository.deleteHeader(batch, stored); err != nil {
+			return 0, err
+		}
+	case err == sql.ErrNoRows:
+		defer metrics.ObserveDBWrite("insert", time.Now())
+		if err := repository.fillGap(batch, header.BlockNumber); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, err
+	}
+	header.ID, err = repository.nextID(batch)
+	if err != nil {
+		return 0, err
+	}
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return 0, err
+	}
+	number := encodeNumber(header.BlockNumber)
+	batch.Set(key(headerPrefix, repository.fingerprint, number), encoded, nil)
+	batch.Set(key(hashPrefix, repository.fingerprint, []byte(header.Hash)), number, nil)
+	batch.Set(key(timestampPrefix, repository.fingerprint, encodeNumber(timestamp), number), nil, nil)
+	if err := repository.db.write(batch); err != nil {
+		log.Error("CreateOrUpdateHeader: error writing header: ", err)
+		return 0, err
+	}
+	if replace {
+		metrics.Reorgs.Inc()
+	}
+	return header.ID, nil
+}
+
+// GetHeader returns this node's header at the provided height
+func (repository HeaderRepository) GetHeader(blockNumber int64) (core.Header, error) {
+	var header core.Header
+	encoded, err := repository.db.get(key(headerPrefix, repository.fingerprint, encodeNumber(blockNumber)))
+	if err != nil {
+		return header, notFound(err)
+	}
+	err = json.Unmarshal(encoded, &header)
+	return header, err
+}
+
+// GetHeaderByHash returns this node's header with the provided hash
+func (repository HeaderRepository) GetHeaderByHash(hash string) (core.Header, error) {
+	number, err := repository.db.get(key(hashPrefix, repository.fingerprint, []byte(hash)))
+	if err != nil {
+		return core.Header{}, notFound(err)
+	}
+	return repository.GetHeader(decodeNumber(number))
+}
+
+// GetHeaderAtOrBeforeTimestamp returns this node's latest header with a timestamp at or before the provided unix time
+func (repository HeaderRepository) GetHeaderAtOrBeforeTimestamp(timestamp int64) (core.Header, error) {
+	it, err := repository.db.newIterator(timestampPrefix, repository.fingerprint, nil, encodeNumber(timestamp+1))
+	if err != nil {
+		return core.Header{}, err
+	}
+	defer it.Close()
+	if !it.Last() {
+		return core.Header{}, iteratorErr(it)
+	}
+	return repository.GetHeader(decodeNumber(it.Key()[len(it.Key())-8:]))
+}
+
+// GetHeaderAtOrAfterTimestamp returns this node's earliest header with a timestamp at or after the provided unix time
+func (repository HeaderRepository) GetHeaderAtOrAfterTimestamp(timestamp int64) (core.Header, error) {
+	it, err := repository.db.newIterator(timestampPrefix, repository.fingerprint, encodeNumber(timestamp), nil)
+	if err != nil {
+		return core.Header{}, err
+	}
+	defer it.Close()
+	if !it.First() {
+		return core.Header{}, iteratorErr(it)
+	}
+	return repository.GetHeader(decodeNumber(it.Key()[len(it.Key())-8:]))
+}
+
+// GetHeaderClosestToTimestamp returns this node's header with the timestamp nearest to the provided unix time
+// When a header before and a header after the time are equally near, the header before is returned
+func (repository HeaderRepository) GetHeaderClosestToTimestamp(timestamp int64) (core.Header, error) {
+	return getHeaderClosestToTimestamp(repository, timestamp)
+}
+
+// GetLastBlockNumber returns the highest block number this node has a header for, or sql.ErrNoRows if there are none
+func (repository HeaderRepository) GetLastBlockNumber() (int64, error) {
+	it, err := repository.db.newIterator(headerPrefix, repository.fingerprint, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	if !it.Last() {
+		return 0, iteratorErr(it)
+	}
+	return decodeNumber(it.Key()[len(it.Key())-8:]), nil
+}
+
+// GetHeadersInRange returns this node's headers between the provided block numbers (inclusive) in ascending order
+func (repository HeaderRepository) GetHeadersInRange(startingBlockNumber, endingBlockNumber int64) ([]core.Header, error) {
+	headers := make([]core.Header, 0)
+	if startingBlockNumber < 0 {
+		startingBlockNumber = 0
+	}
+	if endingBlockNumber < startingBlockNumber {
+		return headers, nil
+	}
+	it, err := repository.db.newIterator(headerPrefix, repository.fingerprint,
+		encodeNumber(startingBlockNumber), encodeNumber(endingBlockNumber+1))
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for it.First(); it.Valid(); it.Next() {
+		var header core.Header
+		if err := json.Unmarshal(it.Value(), &header); err != nil {
+			return nil, err
+		}
+		headers = append(headers, header)
+	}
+	return headers, it.Error()
+}
+
+// GetHeadersInTimeRange returns up to limit of this node's headers with timestamps between the provided ones (inclusive),
+// in ascending block number order
+// The timestamp index is read in order and left once limit headers are found, headers' timestamps increasing with their
+// block numbers, so that a long time range does not read every header in it
+func (repository HeaderRepository) GetHeadersInTimeRange(startingTimestamp, endingTimestamp int64, limit int) ([]core.Header, error) {
+	headers := make([]core.Header, 0)
+	if limit == 0 {
+		return headers, nil
+	}
+	it, err := repository.db.newIterator(timestampPrefix, repository.fingerprint,
+		encodeNumber(startingTimestamp), encodeNumber(endingTimestamp+1))
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for it.First(); it.Valid(); it.Next() {
+		header, err := repository.GetHeader(decodeNumber(it.Key()[len(it.Key())-8:]))
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, header)
+		if len(headers) == limit {
+			break
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	// Headers with the same timestamp are already in block number order, this only orders any which are not
+	sort.SliceStable(headers, func(i, j int) bool {
+		return headers[i].BlockNumber < headers[j].BlockNumber
+	})
+	return headers, nil
+}
+
+// MissingBlockNumbers returns the block numbers between the provided ones (inclusive) which the node with the provided
+// fingerprint has no header for, leaving out block numbers it has pruned
+// Below the block number the gaps cover, they are read from the gaps, above it every block number is missing
+func (repository HeaderRepository) MissingBlockNumbers(startingBlockNumber, endingBlockNumber int64, nodeID string) ([]int64, error) {
+	numbers := make([]int64, 0)
+	pruned, isPruned, err := repository.getNumber(prunedPrefix, nodeID)
+	if err != nil {
+		return numbers, err
+	}
+	if isPruned && pruned > startingBlockNumber {
+		startingBlockNumber = pruned
+	}
+	if startingBlockNumber < 0 {
+		startingBlockNumber = 0
+	}
+	covered, isCovered, err := repository.getNumber(coveredPrefix, nodeID)
+	if err != nil {
+		return numbers, err
+	}
+	next := startingBlockNumber
+	if isCovered && covered >= startingBlockNumber {
+		it, err := repository.db.newIterator(gapPrefix, nodeID, nil, encodeNumber(covered+1))
+		if err != nil {
+			return numbers, err
+		}
+		defer it.Close()
+		// The gap starting at or before the starting block number may reach into the range
+		found := it.SeekLT(key(gapPrefix, nodeID, encodeNumber(startingBlockNumber+1))) || it.First()
+		for ; found; found = it.Next() {
+			first, last := decodeNumber(it.Key()[len(it.Key())-8:]), decodeNumber(it.Value())
+			if first > endingBlockNumber {
+				break
+			}
+			for number := max(first, startingBlockNumber); number <= last && number <= endingBlockNumber; number++ {
+				numbers = append(numbers, number)
+			}
+		}
+		if err := it.Error(); err != nil {
+			return []int64{}, err
+		}
+		next = covered + 1
+	}
+	for number := next; number <= endingBlockNumber; number++ {
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+// PruneHeaders deletes all headers below the provided block number
+// The block number is recorded so that MissingBlockNumbers does not report the pruned range as missing
+func (repository HeaderRepository) PruneHeaders(blockNumber int64) (int64, error) {
+	repository.db.mutex.Lock()
+	defer repository.db.mutex.Unlock()
+	batch := repository.db.db.NewBatch()
+	defer batch.Close()
+	pruned, isPruned, err := repository.getNumber(prunedPrefix, repository.fingerprint)
+	if err != nil {
+		return 0, err
+	}
+	if !isPruned || blockNumber > pruned {
+		batch.Set(key(prunedPrefix, repository.fingerprint), encodeNumber(blockNumber), nil)
+	}
+	covered, isCovered, err := repository.getNumber(coveredPrefix, repository.fingerprint)
+	if err != nil {
+		return 0, err
+	}
+	if !isCovered || covered < blockNumber-1 {
+		batch.Set(key(coveredPrefix, repository.fingerprint), encodeNumber(blockNumber-1), nil)
+	}
+	it, err := repository.db.newIterator(gapPrefix, repository.fingerprint, nil, encodeNumber(blockNumber))
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	for it.First(); it.Valid(); it.Next() {
+		batch.Delete(it.Key(), nil)
+		if last := decodeNumber(it.Value()); last >= blockNumber {
+			batch.Set(key(gapPrefix, repository.fingerprint, encodeNumber(blockNumber)), encodeNumber(last), nil)
+		}
+	}
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	// The pruned block number is written before the headers are deleted, so that headers left below it by a failed
+	// prune are not counted as stored and are deleted by the next one
+	if err := repository.db.write(batch); err != nil {
+		log.Error("PruneHeaders: error recording pruned block number: ", err)
+		return 0, err
+	}
+	deleted, err := repository.deleteHeadersBelow(blockNumber)
+	if err != nil {
+		log.Error("PruneHeaders: error deleting headers: ", err)
+	}
+	return deleted, err
+}
+
+// deleteHeadersBelow deletes this node's headers below the block number along with their indexes, pruneBatchSize
+// headers at a time, reading only the fields the indexes are keyed by
+func (repository HeaderRepository) deleteHeadersBelow(blockNumber int64) (int64, error) {
+	it, err := repository.db.newIterator(headerPrefix, repository.fingerprint, nil, encodeNumber(blockNumber))
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	batch := repository.db.db.NewBatch()
+	defer batch.Close()
+	var deleted, batched int64
+	for it.First(); it.Valid(); it.Next() {
+		var header struct {
+			BlockNumber int64
+			Hash        string
+			Timestamp   string
+		}
+		if err := json.Unmarshal(it.Value(), &header); err != nil {
+			return deleted, err
+		}
+		err := repository.deleteHeader(batch, core.Header{BlockNumber: header.BlockNumber, Hash: header.Hash, Timestamp: header.Timestamp})
+		if err != nil {
+			return deleted, err
+		}
+		batch.Delete(it.Key(), nil)
+		if batched++; batched == pruneBatchSize {
+			if err := repository.db.write(batch); err != nil {
+				return deleted, err
+			}
+			deleted += batched
+			batched = 0
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return deleted, err
+	}
+	if err := repository.db.write(batch); err != nil {
+		return deleted, err
+	}
+	return deleted + batched, nil
+}
+
+// fillGap records that a header is now stored at the block number, which was missing
+// A block number above the covered ones opens a gap between them, one below them closes it in the gap holding it
+func (repository HeaderRepository) fillGap(batch *pebble.Batch, blockNumber int64) error {
+	covered, isCovered, err := repository.getNumber(coveredPrefix, repository.fingerprint)
+	if err != nil {
+		return err
+	}
+	if !isCovered || blockNumber > covered {
+		first := covered + 1
+		if !isCovered {
+			first = 0
+		}
+		pruned, isPruned, err := repository.getNumber(prunedPrefix, repository.fingerprint)
+		if err != nil {
+			return err
+		}
+		if isPruned && pruned > first {
+			first = pruned
+		}
+		if first < blockNumber {
+			batch.Set(key(gapPrefix, repository.fingerprint, encodeNumber(first)), encodeNumber(blockNumber-1), nil)
+		}
+		batch.Set(key(coveredPrefix, repository.fingerprint), encodeNumber(blockNumber), nil)
+		return nil
+	}
+	it, err := repository.db.newIterator(gapPrefix, repository.fingerprint, nil, encodeNumber(blockNumber+1))
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	if !it.Last() {
+		// Below the pruned block number, there is no gap to close
+		return it.Error()
+	}
+	first, last := decodeNumber(it.Key()[len(it.Key())-8:]), decodeNumber(it.Value())
+	if last < blockNumber {
+		return nil
+	}
+	batch.Delete(key(gapPrefix, repository.fingerprint, encodeNumber(first)), nil)
+	if first < blockNumber {
+		batch.Set(key(gapPrefix, repository.fingerprint, encodeNumber(first)), encodeNumber(blockNumber-1), nil)
+	}
+	if blockNumber < last {
+		batch.Set(key(gapPrefix, repository.fingerprint, encodeNumber(blockNumber+1)), encodeNumber(last), nil)
+	}
+	return nil
+}
+
+// deleteHeader deletes the indexes of the stored header, the header itself is overwritten or deleted by the caller
+func (repository HeaderRepository) deleteHeader(batch *pebble.Batch, header core.Header) error {
+	timestamp, err := header.UnixTimestamp()
+	if err != nil {
+		return err
+	}
+	number := encodeNumber(header.BlockNumber)
+	batch.Delete(key(hashPrefix, repository.fingerprint, []byte(header.Hash)), nil)
+	batch.Delete(key(timestampPrefix, repository.fingerprint, encodeNumber(timestamp), number), nil)
+	return nil
+}
+
+// nextID reserves the next header id in the batch
+func (repository HeaderRepository) nextID(batch *pebble.Batch) (int64, error) {
+	var id int64
+	last, err := repository.db.get(sequenceKey)
+	if err == nil {
+		id = decodeNumber(last)
+	} else if err != pebble.ErrNotFound {
+		return 0, err
+	}
+	id++
+	batch.Set(sequenceKey, encodeNumber(id), nil)
+	return id, nil
+}
+
+// getNumber returns the block number stored for the fingerprint under the prefix, and whether there is one
+func (repository HeaderRepository) getNumber(prefix byte, fingerprint string) (int64, bool, error) {
+	encoded, err := repository.db.get(key(prefix, fingerprint))
+	if err == pebble.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return decodeNumber(encoded), true, nil
+}
+
+// notFound translates the store's not found error to sql.ErrNoRows, which the other repositories return
+func notFound(err error) error {
+	if err == pebble.ErrNotFound {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// iteratorErr returns the error of an iterator which found no key, or sql.ErrNoRows if there was none
+func iteratorErr(it *pebble.Iterator) error {
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return sql.ErrNoRows
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
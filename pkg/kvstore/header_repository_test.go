@@ -0,0 +1,176 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package kvstore_test
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/kvstore"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+)
+
+var _ = Describe("Key-value store header repository", func() {
+	const fingerprint = "fingerprint"
+	var (
+		dir  string
+		db   *kvstore.DB
+		repo kvstore.HeaderRepository
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "headers")
+		Expect(err).NotTo(HaveOccurred())
+		db, err = kvstore.NewDB(dir)
+		Expect(err).NotTo(HaveOccurred())
+		repo = kvstore.NewHeaderRepository(db, fingerprint)
+	})
+
+	AfterEach(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	makeHeader := func(blockNumber int64) core.Header {
+		return core.Header{BlockNumber: blockNumber, Hash: strconv.FormatInt(blockNumber, 10), Timestamp: strconv.FormatInt(blockNumber*15, 10)}
+	}
+
+	It("keeps headers and gaps when reopened", func() {
+		for _, blockNumber := range []int64{2, 5} {
+			_, err := repo.CreateOrUpdateHeader(makeHeader(blockNumber))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(db.Close()).To(Succeed())
+
+		reopened, err := kvstore.NewDB(dir)
+		Expect(err).NotTo(HaveOccurred())
+		db = reopened
+		repo = kvstore.NewHeaderRepository(db, fingerprint)
+
+		missing, err := repo.MissingBlockNumbers(0, 6, fingerprint)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(Equal([]int64{0, 1, 3, 4, 6}))
+		header, err := repo.GetHeaderByHash("5")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.BlockNumber).To(Equal(int64(5)))
+	})
+
+	It("reads headers from a store opened read only", func() {
+		_, err := repo.CreateOrUpdateHeader(makeHeader(2))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(db.Close()).To(Succeed())
+
+		readOnly, err := kvstore.NewReadOnlyDB(dir)
+		Expect(err).NotTo(HaveOccurred())
+		db = readOnly
+		repo = kvstore.NewHeaderRepository(db, fingerprint)
+
+		header, err := repo.GetHeader(2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal("2"))
+		_, err = repo.CreateOrUpdateHeader(makeHeader(3))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("does not create a store opened read only", func() {
+		_, err := kvstore.NewReadOnlyDB(filepath.Join(dir, "missing"))
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("prunes more headers than are deleted at once, along with their indexes", func() {
+		for blockNumber := int64(0); blockNumber < 2500; blockNumber++ {
+			_, err := repo.CreateOrUpdateHeader(makeHeader(blockNumber))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		pruned, err := repo.PruneHeaders(2400)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pruned).To(Equal(int64(2400)))
+		headers, err := repo.GetHeadersInRange(0, 2499)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(100))
+		_, err = repo.GetHeaderByHash("1234")
+		Expect(err).To(HaveOccurred())
+		timestamped, err := repo.GetHeadersInTimeRange(0, 2400*15, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(timestamped).To(Equal([]core.Header{headers[0]}))
+		missing, err := repo.MissingBlockNumbers(0, 2499, fingerprint)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(BeEmpty())
+	})
+
+	It("returns the first headers of a time range up to the limit", func() {
+		for blockNumber := int64(0); blockNumber < 100; blockNumber++ {
+			_, err := repo.CreateOrUpdateHeader(makeHeader(blockNumber))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		headers, err := repo.GetHeadersInTimeRange(15, 99*15, 3)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(3))
+		Expect([]int64{headers[0].BlockNumber, headers[1].BlockNumber, headers[2].BlockNumber}).To(Equal([]int64{1, 2, 3}))
+	})
+
+	It("reports the closed store as unhealthy", func() {
+		Expect(db.Ping()).To(Succeed())
+		Expect(db.Close()).To(Succeed())
+
+		Expect(db.Ping()).To(HaveOccurred())
+	})
+
+	It("tracks the same missing block numbers as a full scan", func() {
+		memoryRepository := repository.NewMemoryHeaderRepository(repository.NewMemoryStore(), fingerprint)
+		random := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		for i := 0; i < 300; i++ {
+			if random.Intn(20) == 0 {
+				blockNumber := random.Int63n(100)
+				_, err := repo.PruneHeaders(blockNumber)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = memoryRepository.PruneHeaders(blockNumber)
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				header := makeHeader(random.Int63n(150))
+				_, err := repo.CreateOrUpdateHeader(header)
+				_, memoryErr := memoryRepository.CreateOrUpdateHeader(header)
+				if memoryErr == nil {
+					Expect(err).NotTo(HaveOccurred())
+				} else {
+					Expect(err).To(MatchError(memoryErr))
+				}
+			}
+
+			start := random.Int63n(160)
+			end := start + random.Int63n(40)
+			missing, err := repo.MissingBlockNumbers(start, end, fingerprint)
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := memoryRepository.MissingBlockNumbers(start, end, fingerprint)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(Equal(expected), "missing block numbers between %d and %d", start, end)
+		}
+	})
+})
@@ -0,0 +1,131 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package kvstore
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Key prefixes, every key is the prefix, the node fingerprint, a zero byte and then the prefix's suffix
+const (
+	// headerPrefix keys a header by its big endian block number
+	headerPrefix = 'h'
+	// hashPrefix keys the block number of a header by its hash
+	hashPrefix = 'x'
+	// timestampPrefix keys an empty value by the big endian timestamp and block number of a header
+	timestampPrefix = 't'
+	// gapPrefix keys the big endian last block number of a range of missing headers by its first
+	gapPrefix = 'g'
+	// coveredPrefix keys the block number below which every header is stored, pruned or in a gap
+	coveredPrefix = 'c'
+	// prunedPrefix keys the block number below which headers have been pruned
+	prunedPrefix = 'p'
+)
+
+// DB is an embedded Pebble key-value store of headers
+type DB struct {
+	db *pebble.DB
+	// mutex serializes writes, which read the gaps they update
+	mutex sync.Mutex
+	// closed is set once the store is closed, Pebble panicking on use of a closed store
+	closed int32
+}
+
+// NewDB opens, creating it if needed, the store in the directory at the provided path
+func NewDB(path string) (*DB, error) {
+	db, err := pebble.Open(path, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+// NewReadOnlyDB opens the existing store in the directory at the provided path for reading
+func NewReadOnlyDB(path string) (*DB, error) {
+	db, err := pebble.Open(path, &pebble.Options{ReadOnly: true, ErrorIfNotExists: true})
+	if err != nil {
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+// Ping returns an error if the store is closed
+func (db *DB) Ping() error {
+	if atomic.LoadInt32(&db.closed) == 1 {
+		return pebble.ErrClosed
+	}
+	return nil
+}
+
+// Close closes the store, closing it again returns an error
+func (db *DB) Close() error {
+	if !atomic.CompareAndSwapInt32(&db.closed, 0, 1) {
+		return pebble.ErrClosed
+	}
+	return db.db.Close()
+}
+
+// get returns a copy of the value of the key, which Pebble only keeps valid until the value is closed
+func (db *DB) get(key []byte) ([]byte, error) {
+	value, closer, err := db.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return append([]byte(nil), value...), nil
+}
+
+// write commits the batch to disk
+func (db *DB) write(batch *pebble.Batch) error {
+	return db.db.Apply(batch, pebble.Sync)
+}
+
+// newIterator returns an iterator over the keys with the prefix for the fingerprint, with suffixes from start until limit
+// A nil limit iterates over every key after start
+func (db *DB) newIterator(prefix byte, fingerprint string, start, limit []byte) (*pebble.Iterator, error) {
+	upperBound := key(prefix, fingerprint)
+	if limit != nil {
+		upperBound = key(prefix, fingerprint, limit)
+	} else {
+		// The fingerprint is followed by a zero byte, so raising it bounds every suffix
+		upperBound[len(upperBound)-1] = 1
+	}
+	return db.db.NewIter(&pebble.IterOptions{LowerBound: key(prefix, fingerprint, start), UpperBound: upperBound})
+}
+
+func key(prefix byte, fingerprint string, suffix ...[]byte) []byte {
+	k := append([]byte{prefix}, fingerprint...)
+	k = append(k, 0)
+	for _, part := range suffix {
+		k = append(k, part...)
+	}
+	return k
+}
+
+func encodeNumber(number int64) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, uint64(number))
+	return encoded
+}
+
+func decodeNumber(encoded []byte) int64 {
+	return int64(binary.BigEndian.Uint64(encoded))
+}
@@ -0,0 +1,180 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package leader elects a single active sync process among the replicas syncing for a node
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+)
+
+// lockNamespace is the first key of the advisory locks taken, so that they do not collide with those of other applications
+const lockNamespace = 0x65686473
+
+// fenceNamespace is the first key of the advisory lock the leader's write transactions share, which a new leader takes
+// exclusively once elected so that it only starts writing after the writes of the previous leader have ended
+const fenceNamespace = 0x65686466
+
+var ErrNotLeader = errors.New("leadership is not held")
+
+// Elector elects a leader among the processes syncing for a node fingerprint using a Postgres session-level advisory lock
+// The lock is held by a dedicated connection, so it is released as soon as the leader's session dies
+// Writes go through other connections of the pool, so they are fenced with CheckTx rather than by the Monitor, which
+// only notices a lost session on its next check
+type Elector struct {
+	db          *postgres.DB
+	fingerprint string
+	conn        *sql.Conn
+	pid         int
+}
+
+// NewElector returns a new Elector for the node fingerprint
+func NewElector(db *postgres.DB, fingerprint string) *Elector {
+	return &Elector{db: db, fingerprint: fingerprint}
+}
+
+// TryAcquire attempts to take the lock without waiting, returning whether this process is now the leader
+func (elector *Elector) TryAcquire() (bool, error) {
+	if elector.conn != nil {
+		return true, nil
+	}
+	conn, err := elector.db.Conn(context.Background())
+	if err != nil {
+		return false, err
+	}
+	var acquired bool
+	err = conn.QueryRowContext(context.Background(), `SELECT pg_try_advisory_lock($1, hashtext($2))`,
+		lockNamespace, elector.fingerprint).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Close()
+		return false, err
+	}
+	err = conn.QueryRowContext(context.Background(), `SELECT pg_backend_pid()`).Scan(&elector.pid)
+	if err == nil {
+		err = awaitFence(conn, elector.fingerprint)
+	}
+	if err != nil {
+		conn.Close()
+		return false, err
+	}
+	elector.conn = conn
+	return true, nil
+}
+
+// awaitFence waits for the write transactions of a previous leader, which share the fence lock, to end
+func awaitFence(conn *sql.Conn, fingerprint string) error {
+	_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_lock($1, hashtext($2))`, fenceNamespace, fingerprint)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, hashtext($2))`, fenceNamespace, fingerprint)
+	return err
+}
+
+// CheckTx checks, within a write transaction, that the leader lock is still held by this process's session
+// It is meant to be run first in every transaction the leader writes in, see repository.HeaderRepository.SetLeaderCheck
+// The transaction shares the fence lock until it ends, so a process elected after the check passed waits for it
+func (elector *Elector) CheckTx(tx *sqlx.Tx) error {
+	if elector.pid == 0 {
+		return ErrNotLeader
+	}
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock_shared($1, hashtext($2))`, fenceNamespace, elector.fingerprint)
+	if err != nil {
+		return err
+	}
+	var held bool
+	err = tx.Get(&held, `SELECT EXISTS (SELECT 1 FROM pg_locks
+			WHERE locktype = 'advisory' AND classid = $1 AND objid = hashtext($2)::oid AND objsubid = 2
+			AND granted AND pid = $3)`,
+		lockNamespace, elector.fingerprint, elector.pid)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+// Acquire waits for the lock, retrying every interval, until it is taken or quit is closed
+// It returns whether this process is now the leader
+func (elector *Elector) Acquire(interval time.Duration, quit <-chan struct{}) bool {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		acquired, err := elector.TryAcquire()
+		if err != nil {
+			log.Error("Acquire: error taking leader lock: ", err)
+		}
+		if acquired {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return false
+		}
+	}
+}
+
+// CheckLeadership checks that the session holding the lock is still alive
+func (elector *Elector) CheckLeadership() error {
+	if elector.conn == nil {
+		return ErrNotLeader
+	}
+	return elector.conn.PingContext(context.Background())
+}
+
+// Monitor checks the leader's session every interval, the returned channel is closed once leadership is lost
+func (elector *Elector) Monitor(interval time.Duration) <-chan struct{} {
+	lost := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := elector.CheckLeadership(); err != nil {
+				log.Error("Monitor: leadership lost: ", err)
+				close(lost)
+				return
+			}
+		}
+	}()
+	return lost
+}
+
+// Release gives up leadership, letting another process take the lock
+func (elector *Elector) Release() error {
+	if elector.conn == nil {
+		return nil
+	}
+	_, err := elector.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, hashtext($2))`,
+		lockNamespace, elector.fingerprint)
+	closeErr := elector.conn.Close()
+	elector.conn = nil
+	elector.pid = 0
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
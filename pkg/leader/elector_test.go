@@ -0,0 +1,144 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package leader_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/leader"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+	"github.com/vulcanize/eth-header-sync/test_config"
+)
+
+var _ = Describe("Elector", func() {
+	var (
+		leaderDB, standbyDB *postgres.DB
+		elector, standby    *leader.Elector
+		fingerprint         string
+	)
+
+	BeforeEach(func() {
+		node := test_config.NewTestNode()
+		fingerprint = node.ID
+		leaderDB = test_config.NewTestDB(node)
+		standbyDB = test_config.NewTestDB(node)
+		elector = leader.NewElector(leaderDB, fingerprint)
+		standby = leader.NewElector(standbyDB, fingerprint)
+	})
+
+	AfterEach(func() {
+		// Releasing a lock whose session was terminated fails, the lock is already gone then
+		elector.Release()
+		standby.Release()
+		leaderDB.Close()
+		standbyDB.Close()
+	})
+
+	It("elects a single leader per fingerprint", func() {
+		acquired, err := elector.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+
+		acquired, err = standby.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeFalse())
+		Expect(standby.CheckLeadership()).To(MatchError(leader.ErrNotLeader))
+		Expect(elector.CheckLeadership()).To(Succeed())
+	})
+
+	It("does not contend with other fingerprints", func() {
+		other := leader.NewElector(standbyDB, "other-node")
+		defer other.Release()
+		_, err := elector.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+
+		acquired, err := other.TryAcquire()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+	})
+
+	It("hands leadership over once it is released", func() {
+		_, err := elector.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		quit := make(chan struct{})
+		acquired := make(chan bool)
+		go func() {
+			acquired <- standby.Acquire(10*time.Millisecond, quit)
+		}()
+		Consistently(acquired, 50*time.Millisecond).ShouldNot(Receive())
+
+		Expect(elector.Release()).To(Succeed())
+
+		Eventually(acquired).Should(Receive(BeTrue()))
+	})
+
+	It("hands leadership over when the leader's session dies", func() {
+		_, err := elector.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		lost := elector.Monitor(10 * time.Millisecond)
+
+		standbyDB.MustExec(`SELECT pg_terminate_backend(pid) FROM pg_locks WHERE locktype = 'advisory' AND pid <> pg_backend_pid()`)
+
+		Eventually(lost).Should(BeClosed())
+		acquired, err := standby.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+	})
+
+	It("fails the leader's write transactions once its session has died", func() {
+		_, err := elector.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		tx, err := leaderDB.Beginx()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(elector.CheckTx(tx)).To(Succeed())
+		Expect(tx.Commit()).To(Succeed())
+
+		standbyDB.MustExec(`SELECT pg_terminate_backend(pid) FROM pg_locks
+			WHERE locktype = 'advisory' AND classid = $1 AND pid <> pg_backend_pid()`, 0x65686473)
+		acquired, err := standby.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(BeTrue())
+
+		tx, err = leaderDB.Beginx()
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback()
+		Expect(elector.CheckTx(tx)).To(MatchError(leader.ErrNotLeader))
+	})
+
+	It("does not let a standby pass the check", func() {
+		_, err := elector.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		tx, err := standbyDB.Beginx()
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback()
+
+		Expect(standby.CheckTx(tx)).To(MatchError(leader.ErrNotLeader))
+	})
+
+	It("stops waiting for leadership when quit is closed", func() {
+		_, err := elector.TryAcquire()
+		Expect(err).NotTo(HaveOccurred())
+		quit := make(chan struct{})
+		close(quit)
+
+		Expect(standby.Acquire(10*time.Millisecond, quit)).To(BeFalse())
+	})
+})
@@ -0,0 +1,83 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package listener
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+const subscriberBufferSize = 64
+
+// HeaderBroadcaster fans the header events of a single source, such as a HeaderListener, out to many subscribers
+// Events are dropped for a subscriber whose buffer is full rather than holding up the others
+type HeaderBroadcaster struct {
+	lock        sync.Mutex
+	subscribers map[chan core.HeaderEvent]struct{}
+	closed      bool
+}
+
+// NewHeaderBroadcaster returns a HeaderBroadcaster for the events, subscriber channels are closed when the events channel is
+func NewHeaderBroadcaster(events <-chan core.HeaderEvent) *HeaderBroadcaster {
+	broadcaster := &HeaderBroadcaster{subscribers: make(map[chan core.HeaderEvent]struct{})}
+	go broadcaster.broadcast(events)
+	return broadcaster
+}
+
+// Subscribe returns a channel receiving every following event and a function to unsubscribe
+func (broadcaster *HeaderBroadcaster) Subscribe() (<-chan core.HeaderEvent, func()) {
+	subscriber := make(chan core.HeaderEvent, subscriberBufferSize)
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+	if broadcaster.closed {
+		close(subscriber)
+		return subscriber, func() {}
+	}
+	broadcaster.subscribers[subscriber] = struct{}{}
+	return subscriber, func() {
+		broadcaster.lock.Lock()
+		defer broadcaster.lock.Unlock()
+		if _, ok := broadcaster.subscribers[subscriber]; ok {
+			delete(broadcaster.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+func (broadcaster *HeaderBroadcaster) broadcast(events <-chan core.HeaderEvent) {
+	for event := range events {
+		broadcaster.lock.Lock()
+		for subscriber := range broadcaster.subscribers {
+			select {
+			case subscriber <- event:
+			default:
+				log.Warnf("HeaderBroadcaster: subscriber is not keeping up, dropping %s event for block %d", event.Type, event.BlockNumber)
+			}
+		}
+		broadcaster.lock.Unlock()
+	}
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+	broadcaster.closed = true
+	for subscriber := range broadcaster.subscribers {
+		delete(broadcaster.subscribers, subscriber)
+		close(subscriber)
+	}
+}
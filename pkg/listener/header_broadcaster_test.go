@@ -0,0 +1,70 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package listener_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/listener"
+)
+
+var _ = Describe("Header broadcaster", func() {
+	var (
+		events      chan core.HeaderEvent
+		broadcaster *listener.HeaderBroadcaster
+		event       = core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 100, Hash: "0x100"}
+	)
+
+	BeforeEach(func() {
+		events = make(chan core.HeaderEvent)
+		broadcaster = listener.NewHeaderBroadcaster(events)
+	})
+
+	It("sends each event to every subscriber", func() {
+		first, unsubscribeFirst := broadcaster.Subscribe()
+		defer unsubscribeFirst()
+		second, unsubscribeSecond := broadcaster.Subscribe()
+		defer unsubscribeSecond()
+
+		events <- event
+
+		Eventually(first).Should(Receive(Equal(event)))
+		Eventually(second).Should(Receive(Equal(event)))
+	})
+
+	It("closes the channel of a subscriber which unsubscribes", func() {
+		subscriber, unsubscribe := broadcaster.Subscribe()
+
+		unsubscribe()
+
+		Eventually(subscriber).Should(BeClosed())
+		events <- event
+	})
+
+	It("closes subscriber channels when the events channel is closed", func() {
+		subscriber, unsubscribe := broadcaster.Subscribe()
+		defer unsubscribe()
+
+		close(events)
+
+		Eventually(subscriber).Should(BeClosed())
+		late, _ := broadcaster.Subscribe()
+		Eventually(late).Should(BeClosed())
+	})
+})
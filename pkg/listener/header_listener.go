@@ -0,0 +1,106 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package listener
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/config"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+	eventBufferSize      = 1024
+)
+
+// HeaderListener subscribes to the header events the header repository publishes with pg_notify
+// Notifications are not persisted, so events published while the connection is down are missed
+type HeaderListener struct {
+	listener    *pq.Listener
+	fingerprint string
+	events      chan core.HeaderEvent
+	quit        chan struct{}
+}
+
+// NewHeaderListener returns a HeaderListener for the events of the node with the provided fingerprint
+// An empty fingerprint subscribes to the events of every node
+func NewHeaderListener(databaseConfig config.Database, fingerprint string) (*HeaderListener, error) {
+	listener := pq.NewListener(config.DbConnectionString(databaseConfig), minReconnectInterval, maxReconnectInterval,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Error("HeaderListener: connection error: ", err)
+			}
+		})
+	if err := listener.Listen(core.HeaderEventsChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	headerListener := &HeaderListener{
+		listener:    listener,
+		fingerprint: fingerprint,
+		events:      make(chan core.HeaderEvent, eventBufferSize),
+		quit:        make(chan struct{}),
+	}
+	go headerListener.listen()
+	return headerListener, nil
+}
+
+// Events returns the channel header events are delivered on, it is closed when the listener is closed
+func (headerListener *HeaderListener) Events() <-chan core.HeaderEvent {
+	return headerListener.events
+}
+
+// Close stops listening and closes the events channel
+func (headerListener *HeaderListener) Close() error {
+	close(headerListener.quit)
+	return headerListener.listener.Close()
+}
+
+func (headerListener *HeaderListener) listen() {
+	defer close(headerListener.events)
+	for {
+		select {
+		case notification := <-headerListener.listener.Notify:
+			// A nil notification is sent after the connection is re-established
+			if notification == nil {
+				log.Warn("HeaderListener: reconnected, header events may have been missed")
+				continue
+			}
+			var event core.HeaderEvent
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				log.Error("HeaderListener: error decoding header event: ", err)
+				continue
+			}
+			if headerListener.fingerprint != "" && event.Fingerprint != headerListener.fingerprint {
+				continue
+			}
+			select {
+			case headerListener.events <- event:
+			case <-headerListener.quit:
+				return
+			}
+		case <-headerListener.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package listener_test
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/listener"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/test_config"
+)
+
+var _ = Describe("Header listener", func() {
+	var (
+		db             *postgres.DB
+		repo           repository.HeaderRepository
+		headerListener *listener.HeaderListener
+		header         core.Header
+	)
+
+	BeforeEach(func() {
+		rawHeader, err := json.Marshal(types.Header{})
+		Expect(err).NotTo(HaveOccurred())
+		db = test_config.NewTestDB(test_config.NewTestNode())
+		test_config.CleanTestDB(db)
+		repo = repository.NewHeaderRepository(db)
+		headerListener, err = listener.NewHeaderListener(test_config.DBConfig, db.Node.ID)
+		Expect(err).NotTo(HaveOccurred())
+		header = core.Header{BlockNumber: 100, Hash: "0x100", Raw: rawHeader, Timestamp: "1000"}
+	})
+
+	AfterEach(func() {
+		Expect(headerListener.Close()).To(Succeed())
+	})
+
+	It("receives an insert event when a header is created", func() {
+		_, err := repo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(headerListener.Events()).Should(Receive(Equal(core.HeaderEvent{
+			Type:        core.HeaderInserted,
+			BlockNumber: header.BlockNumber,
+			Hash:        header.Hash,
+			Fingerprint: db.Node.ID,
+		})))
+	})
+
+	It("receives a replace event when a header is replaced", func() {
+		_, err := repo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(headerListener.Events()).Should(Receive())
+		header.Hash = "0x100b"
+
+		_, err = repo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		var event core.HeaderEvent
+		Eventually(headerListener.Events()).Should(Receive(&event))
+		Expect(event.Type).To(Equal(core.HeaderReplaced))
+		Expect(event.Hash).To(Equal("0x100b"))
+	})
+
+	It("does not receive events for other node fingerprints", func() {
+		dbTwo, err := postgres.NewDB(test_config.DBConfig, core.Node{ID: "FingerprintTwo"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = repository.NewHeaderRepository(dbTwo).CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		Consistently(headerListener.Events()).ShouldNot(Receive())
+	})
+
+	It("does not receive events for rolled back writes", func() {
+		_, err := repo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(headerListener.Events()).Should(Receive())
+
+		_, err = repo.InternalInsertHeader(header)
+		Expect(err).To(MatchError(repository.ErrValidHeaderExists))
+
+		Consistently(headerListener.Events()).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,147 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package metrics holds the Prometheus metrics describing the progress of the sync and the health of its node
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "eth_header_sync"
+
+var (
+	// ChainHead is the block number of the head of the chain according to the node
+	ChainHead = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "chain_head_block",
+		Help:      "Block number of the head of the chain according to the node",
+	})
+	// SyncedHead is the highest block number a header is stored for
+	SyncedHead = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "synced_head_block",
+		Help:      "Highest block number a header is stored for",
+	})
+	// SyncLag is the number of blocks the stored headers are behind the head of the chain
+	SyncLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_lag_blocks",
+		Help:      "Number of blocks the stored headers are behind the head of the chain",
+	})
+	// MissingHeaders is the number of headers found missing by the last backfill round
+	MissingHeaders = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "missing_headers",
+		Help:      "Number of headers found missing by the last backfill round",
+	})
+	// ValidationWindowLowerBound is the lowest block number of the last validation window
+	ValidationWindowLowerBound = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "validation_window_lower_block",
+		Help:      "Lowest block number of the last validation window",
+	})
+	// ValidationWindowUpperBound is the highest block number of the last validation window
+	ValidationWindowUpperBound = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "validation_window_upper_block",
+		Help:      "Highest block number of the last validation window",
+	})
+	// RPCCalls counts the requests made to the node, batches count as one call per element
+	RPCCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_calls_total",
+		Help:      "Number of requests made to the node, by method",
+	}, []string{"method"})
+	// RPCErrors counts the requests to the node which failed
+	RPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Number of requests to the node which failed, by method",
+	}, []string{"method"})
+	// RPCBatchSize observes the number of requests in each batch sent to the node
+	RPCBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_batch_size",
+		Help:      "Number of requests in each batch sent to the node",
+		Buckets:   []float64{1, 5, 10, 25, 50, 100, 250},
+	})
+	// DBWriteDuration observes how long header writes take, by operation
+	DBWriteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_write_duration_seconds",
+		Help:      "Duration of header writes to the database, by operation",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+	// Reorgs counts the stored headers replaced by a header with a different hash
+	Reorgs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reorgs_total",
+		Help:      "Number of stored headers replaced by a header with a different hash",
+	})
+	// DroppedHeaderEvents counts the header events dropped because the webhook's queue stayed full
+	DroppedHeaderEvents = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_header_events_total",
+		Help:      "Number of header events dropped because the webhook's queue stayed full",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		ChainHead,
+		SyncedHead,
+		SyncLag,
+		MissingHeaders,
+		ValidationWindowLowerBound,
+		ValidationWindowUpperBound,
+		RPCCalls,
+		RPCErrors,
+		RPCBatchSize,
+		DBWriteDuration,
+		Reorgs,
+		DroppedHeaderEvents,
+	)
+}
+
+// ObserveRPCCall records a request of the method to the node and whether it failed
+func ObserveRPCCall(method string, err error) {
+	RPCCalls.WithLabelValues(method).Inc()
+	if err != nil {
+		RPCErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// ObserveDBWrite records the duration of a header write which began at start
+func ObserveDBWrite(operation string, start time.Time) {
+	DBWriteDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// SetHeads records the head of the chain and the highest stored header, and the lag between them
+func SetHeads(chainHead, syncedHead int64) {
+	ChainHead.Set(float64(chainHead))
+	SyncedHead.Set(float64(syncedHead))
+	SyncLag.Set(float64(chainHead - syncedHead))
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,67 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metrics_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
+)
+
+var _ = Describe("Metrics", func() {
+	It("records the heads and the lag between them", func() {
+		metrics.SetHeads(120, 100)
+
+		Expect(testutil.ToFloat64(metrics.ChainHead)).To(Equal(float64(120)))
+		Expect(testutil.ToFloat64(metrics.SyncedHead)).To(Equal(float64(100)))
+		Expect(testutil.ToFloat64(metrics.SyncLag)).To(Equal(float64(20)))
+	})
+
+	It("counts failed RPC calls as errors", func() {
+		calls := metrics.RPCCalls.WithLabelValues("eth_test")
+		errs := metrics.RPCErrors.WithLabelValues("eth_test")
+
+		metrics.ObserveRPCCall("eth_test", nil)
+		metrics.ObserveRPCCall("eth_test", errors.New("failed"))
+
+		Expect(testutil.ToFloat64(calls)).To(Equal(float64(2)))
+		Expect(testutil.ToFloat64(errs)).To(Equal(float64(1)))
+	})
+
+	It("serves the metrics", func() {
+		metrics.ObserveDBWrite("insert", time.Now())
+		server := httptest.NewServer(metrics.Handler())
+		defer server.Close()
+
+		res, err := http.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("eth_header_sync_sync_lag_blocks"))
+		Expect(string(body)).To(ContainSubstring(`eth_header_sync_db_write_duration_seconds_count{operation="insert"} 1`))
+	})
+})
@@ -57,6 +57,16 @@ func NewDB(databaseConfig config.Database, node core.Node) (*DB, error) {
 	return &pg, nil
 }
 
+// NewReadOnlyDB returns a new DB for the provided database config whose transactions are read only
+// It records no node info, so it is only meant for reading headers by the fingerprint of the node which synced them
+func NewReadOnlyDB(databaseConfig config.Database) (*DB, error) {
+	db, connectErr := sqlx.Connect("postgres", config.DbConnectionString(databaseConfig)+"&default_transaction_read_only=on")
+	if connectErr != nil {
+		return &DB{}, ErrDBConnectionFailed(connectErr)
+	}
+	return &DB{DB: db}, nil
+}
+
 // CreateNode inserts the node info into the database
 func (db *DB) CreateNode(node *core.Node) error {
 	var nodeID int64
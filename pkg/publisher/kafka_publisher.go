@@ -0,0 +1,71 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package publisher
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+const kafkaBatchTimeout = 10 * time.Millisecond
+
+// KafkaWriter writes messages to a Kafka topic, it is satisfied by *kafka.Writer
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// KafkaPublisher publishes header events to a Kafka topic
+// Messages are keyed by node fingerprint so that the events of a chain land on a single partition in order,
+// and Publish waits for every in-sync replica to acknowledge them
+type KafkaPublisher struct {
+	writer KafkaWriter
+}
+
+// NewKafkaPublisher returns a KafkaPublisher writing to the topic on the provided brokers
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return NewKafkaWriterPublisher(kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      brokers,
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: -1,
+		BatchTimeout: kafkaBatchTimeout,
+	}))
+}
+
+// NewKafkaWriterPublisher returns a KafkaPublisher writing with the provided writer
+func NewKafkaWriterPublisher(writer KafkaWriter) *KafkaPublisher {
+	return &KafkaPublisher{writer: writer}
+}
+
+// Publish writes each event's payload as a message on the topic
+func (publisher *KafkaPublisher) Publish(events []core.OutboxEvent) error {
+	messages := make([]kafka.Message, len(events))
+	for i, event := range events {
+		messages[i] = kafka.Message{Key: []byte(event.Fingerprint), Value: event.Payload}
+	}
+	return publisher.writer.WriteMessages(context.Background(), messages...)
+}
+
+// Close flushes pending messages and closes the writer
+func (publisher *KafkaPublisher) Close() error {
+	return publisher.writer.Close()
+}
@@ -0,0 +1,70 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package publisher_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/publisher"
+)
+
+var _ = Describe("Kafka publisher", func() {
+	var (
+		writer         *fakes.MockKafkaWriter
+		kafkaPublisher *publisher.KafkaPublisher
+	)
+
+	BeforeEach(func() {
+		writer = fakes.NewMockKafkaWriter()
+		kafkaPublisher = publisher.NewKafkaWriterPublisher(writer)
+	})
+
+	It("writes each event in order, keyed by its node fingerprint", func() {
+		err := kafkaPublisher.Publish([]core.OutboxEvent{
+			{ID: 1, Fingerprint: "x123", Payload: []byte(`{"blockNumber":1}`)},
+			{ID: 2, Fingerprint: "x456", Payload: []byte(`{"blockNumber":1}`)},
+			{ID: 3, Fingerprint: "x123", Payload: []byte(`{"blockNumber":2}`)},
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Messages).To(Equal([]kafka.Message{
+			{Key: []byte("x123"), Value: []byte(`{"blockNumber":1}`)},
+			{Key: []byte("x456"), Value: []byte(`{"blockNumber":1}`)},
+			{Key: []byte("x123"), Value: []byte(`{"blockNumber":2}`)},
+		}))
+	})
+
+	It("returns the error of a failed write, so the relay keeps the events in the outbox", func() {
+		writer.SetWriteMessagesErr(fakes.FakeError)
+		outbox := fakes.NewMockHeaderOutboxRepository(core.OutboxEvent{ID: 1, Fingerprint: "x123", Payload: []byte(`{}`)})
+
+		_, err := publisher.NewRelay(outbox, kafkaPublisher).PublishOutbox()
+
+		Expect(err).To(MatchError(fakes.FakeError))
+		Expect(outbox.Events).To(HaveLen(1))
+	})
+
+	It("closes the writer", func() {
+		Expect(kafkaPublisher.Close()).To(Succeed())
+
+		Expect(writer.Closed).To(BeTrue())
+	})
+})
@@ -0,0 +1,59 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package publisher
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+const natsFlushTimeout = 10 * time.Second
+
+// NATSPublisher publishes header events to a NATS subject
+// Publish flushes the connection, so events have been received by the server when it returns
+type NATSPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// NewNATSPublisher connects to the NATS server at the provided url
+func NewNATSPublisher(url, subject string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("eth-header-sync"))
+	if err != nil {
+		return nil, err
+	}
+	return &NATSPublisher{conn: conn, subject: subject}, nil
+}
+
+// Publish publishes each event's payload as a message on the subject
+func (publisher *NATSPublisher) Publish(events []core.OutboxEvent) error {
+	for _, event := range events {
+		if err := publisher.conn.Publish(publisher.subject, event.Payload); err != nil {
+			return err
+		}
+	}
+	return publisher.conn.FlushTimeout(natsFlushTimeout)
+}
+
+// Close closes the connection to the server
+func (publisher *NATSPublisher) Close() error {
+	publisher.conn.Close()
+	return nil
+}
@@ -0,0 +1,66 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package publisher_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/publisher"
+)
+
+var _ = Describe("NATS publisher", func() {
+	var server *fakes.NATSServer
+
+	BeforeEach(func() {
+		var err error
+		server, err = fakes.NewNATSServer()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("publishes each event to the subject", func() {
+		natsPublisher, err := publisher.NewNATSPublisher(server.URL(), "headers")
+		Expect(err).NotTo(HaveOccurred())
+		defer natsPublisher.Close()
+
+		err = natsPublisher.Publish([]core.OutboxEvent{
+			{ID: 1, Payload: []byte(`{"blockNumber":1}`)},
+			{ID: 2, Payload: []byte(`{"blockNumber":2}`)},
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.Messages()).To(Equal([]fakes.NATSMessage{
+			{Subject: "headers", Data: []byte(`{"blockNumber":1}`)},
+			{Subject: "headers", Data: []byte(`{"blockNumber":2}`)},
+		}))
+	})
+
+	It("returns an error when it cannot connect", func() {
+		url := server.URL()
+		server.Close()
+
+		_, err := publisher.NewNATSPublisher(url, "headers")
+
+		Expect(err).To(HaveOccurred())
+	})
+})
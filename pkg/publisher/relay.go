@@ -0,0 +1,89 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package publisher
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+const defaultBatchSize = 100
+
+// Relay moves header events from the outbox to a message queue
+// Events are only deleted from the outbox once the publisher has returned, so delivery is at-least-once:
+// an event can be published again if the relay stops between publishing it and deleting it
+// Events are read in id order, which is their commit order as the HeaderRepository serializes the transactions
+// recording them
+type Relay struct {
+	outbox    core.HeaderOutboxRepository
+	publisher core.HeaderPublisher
+	batchSize int
+}
+
+// NewRelay returns a Relay publishing the events in the outbox with the publisher
+func NewRelay(outbox core.HeaderOutboxRepository, publisher core.HeaderPublisher) *Relay {
+	return &Relay{outbox: outbox, publisher: publisher, batchSize: defaultBatchSize}
+}
+
+// SetBatchSize sets the maximum number of events published at once
+func (relay *Relay) SetBatchSize(batchSize int) {
+	relay.batchSize = batchSize
+}
+
+// PublishOutbox publishes the events in the outbox in order until it is empty, returning the number published
+func (relay *Relay) PublishOutbox() (int, error) {
+	published := 0
+	for {
+		events, err := relay.outbox.GetOutboxEvents(relay.batchSize)
+		if err != nil || len(events) == 0 {
+			return published, err
+		}
+		if err := relay.publisher.Publish(events); err != nil {
+			log.Error("PublishOutbox: error publishing header events: ", err)
+			return published, err
+		}
+		ids := make([]int64, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		if err := relay.outbox.DeleteOutboxEvents(ids); err != nil {
+			return published, err
+		}
+		published += len(events)
+	}
+}
+
+// Run publishes the outbox every interval until quit is closed
+func (relay *Relay) Run(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if published, err := relay.PublishOutbox(); err != nil {
+				log.Error("Relay: error publishing outbox: ", err)
+			} else if published > 0 {
+				log.Debugf("Relay: published %d header events", published)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
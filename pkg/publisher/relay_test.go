@@ -0,0 +1,76 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package publisher_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/publisher"
+)
+
+var _ = Describe("Relay", func() {
+	var (
+		events          []core.OutboxEvent
+		outbox          *fakes.MockHeaderOutboxRepository
+		headerPublisher *fakes.MockHeaderPublisher
+	)
+
+	BeforeEach(func() {
+		events = []core.OutboxEvent{
+			{ID: 1, Fingerprint: "x123", Payload: []byte(`{"blockNumber":1}`)},
+			{ID: 2, Fingerprint: "x123", Payload: []byte(`{"blockNumber":2}`)},
+			{ID: 3, Fingerprint: "x123", Payload: []byte(`{"blockNumber":3}`)},
+		}
+		outbox = fakes.NewMockHeaderOutboxRepository(events...)
+		headerPublisher = fakes.NewMockHeaderPublisher()
+	})
+
+	It("publishes every event in the outbox in order", func() {
+		relay := publisher.NewRelay(outbox, headerPublisher)
+		relay.SetBatchSize(2)
+
+		published, err := relay.PublishOutbox()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(published).To(Equal(3))
+		Expect(headerPublisher.Published).To(Equal(events))
+		Expect(outbox.Events).To(BeEmpty())
+	})
+
+	It("keeps events in the outbox when publishing fails", func() {
+		headerPublisher.SetPublishErr(fakes.FakeError)
+		relay := publisher.NewRelay(outbox, headerPublisher)
+
+		_, err := relay.PublishOutbox()
+
+		Expect(err).To(MatchError(fakes.FakeError))
+		Expect(outbox.Events).To(Equal(events))
+	})
+
+	It("propagates outbox errors", func() {
+		outbox.SetDeleteOutboxEventsErr(fakes.FakeError)
+		relay := publisher.NewRelay(outbox, headerPublisher)
+
+		_, err := relay.PublishOutbox()
+
+		Expect(err).To(MatchError(fakes.FakeError))
+		Expect(outbox.Events).To(Equal(events))
+	})
+})
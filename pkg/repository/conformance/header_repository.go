@@ -0,0 +1,253 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package conformance holds the specs every header repository backend is expected to pass
+// It depends on nothing but the repository interfaces, so that backends which do not need Postgres run it with plain
+// go test
+package conformance
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+)
+
+// DescribeHeaderRepository describes the behaviour every core.HeaderRepository shares, for the test suites of each backend
+// newRepository returns a repository for the headers of the node with the fingerprint, all of a spec's repositories share their storage
+func DescribeHeaderRepository(newRepository func(fingerprint string) core.HeaderRepository) {
+	const (
+		fingerprint      = "conformanceFingerprint"
+		otherFingerprint = "otherConformanceFingerprint"
+	)
+	var (
+		repo      core.HeaderRepository
+		otherRepo core.HeaderRepository
+		rawHeader []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		rawHeader, err = json.Marshal(types.Header{})
+		Expect(err).NotTo(HaveOccurred())
+		repo = newRepository(fingerprint)
+		otherRepo = newRepository(otherFingerprint)
+	})
+
+	makeHeader := func(blockNumber int64, hash string) core.Header {
+		return core.Header{
+			BlockNumber: blockNumber,
+			Hash:        hash,
+			Raw:         rawHeader,
+			Timestamp:   strconv.FormatInt(1000+blockNumber*15, 10),
+		}
+	}
+
+	createHeaders := func(repo core.HeaderRepository, blockNumbers ...int64) {
+		for _, blockNumber := range blockNumbers {
+			_, err := repo.CreateOrUpdateHeader(makeHeader(blockNumber, strconv.FormatInt(blockNumber, 10)))
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	Describe("creating or updating a header", func() {
+		It("adds a header", func() {
+			header := makeHeader(100, "0x1")
+
+			_, err := repo.CreateOrUpdateHeader(header)
+
+			Expect(err).NotTo(HaveOccurred())
+			stored, err := repo.GetHeader(100)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Hash).To(Equal(header.Hash))
+			Expect(stored.Timestamp).To(Equal(header.Timestamp))
+			Expect(stored.Raw).To(MatchJSON(header.Raw))
+		})
+
+		It("returns valid header exists error for a header with the stored hash", func() {
+			createHeaders(repo, 100)
+
+			_, err := repo.CreateOrUpdateHeader(makeHeader(100, "100"))
+
+			Expect(err).To(MatchError(repository.ErrValidHeaderExists))
+		})
+
+		It("replaces a header with a different hash", func() {
+			createHeaders(repo, 100)
+
+			_, err := repo.CreateOrUpdateHeader(makeHeader(100, "0xreorged"))
+
+			Expect(err).NotTo(HaveOccurred())
+			stored, err := repo.GetHeader(100)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Hash).To(Equal("0xreorged"))
+			_, err = repo.GetHeaderByHash("100")
+			Expect(err).To(MatchError(sql.ErrNoRows))
+		})
+
+		It("keeps the headers of each node fingerprint apart", func() {
+			createHeaders(repo, 100)
+
+			_, err := otherRepo.CreateOrUpdateHeader(makeHeader(100, "0xother"))
+
+			Expect(err).NotTo(HaveOccurred())
+			stored, err := repo.GetHeader(100)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Hash).To(Equal("100"))
+			otherStored, err := otherRepo.GetHeader(100)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(otherStored.Hash).To(Equal("0xother"))
+		})
+	})
+
+	Describe("getting headers", func() {
+		It("returns sql.ErrNoRows for a header which is not stored", func() {
+			createHeaders(otherRepo, 1)
+
+			_, err := repo.GetHeader(1)
+			Expect(err).To(MatchError(sql.ErrNoRows))
+			_, err = repo.GetHeaderByHash("1")
+			Expect(err).To(MatchError(sql.ErrNoRows))
+			_, err = repo.GetLastBlockNumber()
+			Expect(err).To(MatchError(sql.ErrNoRows))
+		})
+
+		It("returns the header with a hash", func() {
+			createHeaders(repo, 1, 2)
+
+			stored, err := repo.GetHeaderByHash("2")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.BlockNumber).To(Equal(int64(2)))
+		})
+
+		It("returns the last block number", func() {
+			createHeaders(repo, 3, 7, 5)
+			createHeaders(otherRepo, 9)
+
+			lastBlockNumber, err := repo.GetLastBlockNumber()
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lastBlockNumber).To(Equal(int64(7)))
+		})
+
+		It("returns headers in a range in ascending order", func() {
+			createHeaders(repo, 3, 1, 2, 5)
+
+			headers, err := repo.GetHeadersInRange(2, 5)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(headers).To(HaveLen(3))
+			Expect(headers[0].BlockNumber).To(Equal(int64(2)))
+			Expect(headers[1].BlockNumber).To(Equal(int64(3)))
+			Expect(headers[2].BlockNumber).To(Equal(int64(5)))
+		})
+
+		It("returns up to the limit of headers in a time range in ascending order", func() {
+			createHeaders(repo, 4, 1, 2, 3)
+
+			headers, err := repo.GetHeadersInTimeRange(1030, 1060, 2)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(headers).To(HaveLen(2))
+			Expect(headers[0].BlockNumber).To(Equal(int64(2)))
+			Expect(headers[1].BlockNumber).To(Equal(int64(3)))
+		})
+
+		It("returns the headers around a timestamp", func() {
+			_, err := repo.GetHeaderClosestToTimestamp(1000)
+			Expect(err).To(MatchError(sql.ErrNoRows))
+			createHeaders(repo, 1, 2, 3)
+
+			before, err := repo.GetHeaderAtOrBeforeTimestamp(1040)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(before.BlockNumber).To(Equal(int64(2)))
+			after, err := repo.GetHeaderAtOrAfterTimestamp(1016)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(after.BlockNumber).To(Equal(int64(2)))
+			closest, err := repo.GetHeaderClosestToTimestamp(1022)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(closest.BlockNumber).To(Equal(int64(1)))
+			_, err = repo.GetHeaderAtOrBeforeTimestamp(1000)
+			Expect(err).To(MatchError(sql.ErrNoRows))
+			_, err = repo.GetHeaderAtOrAfterTimestamp(1046)
+			Expect(err).To(MatchError(sql.ErrNoRows))
+		})
+	})
+
+	Describe("getting missing block numbers", func() {
+		It("returns the block numbers of the fingerprint's headers which are not stored", func() {
+			createHeaders(repo, 1, 3, 5)
+
+			missing, err := repo.MissingBlockNumbers(1, 6, fingerprint)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(ConsistOf(int64(2), int64(4), int64(6)))
+
+			otherMissing, err := repo.MissingBlockNumbers(1, 3, otherFingerprint)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(otherMissing).To(ConsistOf(int64(1), int64(2), int64(3)))
+		})
+
+		It("does not count pruned headers as missing", func() {
+			createHeaders(repo, 4)
+			_, err := repo.PruneHeaders(3)
+			Expect(err).NotTo(HaveOccurred())
+
+			missing, err := repo.MissingBlockNumbers(1, 5, fingerprint)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(ConsistOf(int64(3), int64(5)))
+		})
+	})
+
+	Describe("pruning headers", func() {
+		BeforeEach(func() {
+			createHeaders(repo, 1, 2, 3)
+			createHeaders(otherRepo, 1, 2, 3)
+		})
+
+		It("deletes the fingerprint's headers below the block number", func() {
+			pruned, err := repo.PruneHeaders(3)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(Equal(int64(2)))
+			headers, err := repo.GetHeadersInRange(1, 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(headers).To(HaveLen(1))
+			otherHeaders, err := otherRepo.GetHeadersInRange(1, 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(otherHeaders).To(HaveLen(3))
+		})
+
+		It("does not move the pruned block number backwards", func() {
+			_, err := repo.PruneHeaders(3)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = repo.PruneHeaders(2)
+			Expect(err).NotTo(HaveOccurred())
+
+			missing, err := repo.MissingBlockNumbers(1, 3, fingerprint)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(BeEmpty())
+		})
+	})
+}
@@ -0,0 +1,37 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package conformance_test
+
+import (
+	. "github.com/onsi/ginkgo"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/pkg/repository/conformance"
+)
+
+var _ = Describe("Memory header repository conformance", func() {
+	var store *repository.MemoryStore
+
+	BeforeEach(func() {
+		store = repository.NewMemoryStore()
+	})
+
+	conformance.DescribeHeaderRepository(func(fingerprint string) core.HeaderRepository {
+		return repository.NewMemoryHeaderRepository(store, fingerprint)
+	})
+})
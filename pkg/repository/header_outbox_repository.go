@@ -0,0 +1,59 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+)
+
+// HeaderOutboxRepository is the underlying type satisfying the core.HeaderOutboxRepository interface
+// Events are written by a HeaderRepository with the outbox enabled, in the same transaction as their header
+type HeaderOutboxRepository struct {
+	database *postgres.DB
+}
+
+// NewHeaderOutboxRepository returns a new HeaderOutboxRepository
+func NewHeaderOutboxRepository(database *postgres.DB) HeaderOutboxRepository {
+	return HeaderOutboxRepository{database: database}
+}
+
+// GetOutboxEvents returns up to limit of this node's unpublished events, oldest first
+func (repository HeaderOutboxRepository) GetOutboxEvents(limit int) ([]core.OutboxEvent, error) {
+	events := make([]core.OutboxEvent, 0)
+	err := repository.database.Select(&events,
+		`SELECT id, eth_node_fingerprint, payload FROM header_outbox
+			WHERE eth_node_fingerprint = $1
+			ORDER BY id LIMIT $2`,
+		repository.database.Node.ID, limit)
+	if err != nil {
+		log.Error("GetOutboxEvents: error getting outbox events: ", err)
+	}
+	return events, err
+}
+
+// DeleteOutboxEvents deletes the events with the provided ids once they have been published
+func (repository HeaderOutboxRepository) DeleteOutboxEvents(ids []int64) error {
+	_, err := repository.database.Exec(`DELETE FROM header_outbox WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		log.Error("DeleteOutboxEvents: error deleting outbox events: ", err)
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository_test
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/test_config"
+)
+
+var _ = Describe("Header outbox repository", func() {
+	var (
+		db         *postgres.DB
+		headerRepo repository.HeaderRepository
+		outboxRepo repository.HeaderOutboxRepository
+		header     core.Header
+	)
+
+	BeforeEach(func() {
+		rawHeader, err := json.Marshal(types.Header{})
+		Expect(err).NotTo(HaveOccurred())
+		db = test_config.NewTestDB(test_config.NewTestNode())
+		test_config.CleanTestDB(db)
+		headerRepo = repository.NewHeaderRepository(db)
+		headerRepo.SetOutbox(true)
+		outboxRepo = repository.NewHeaderOutboxRepository(db)
+		header = core.Header{BlockNumber: 100, Hash: "0x100", Raw: rawHeader, Timestamp: "1000"}
+	})
+
+	decode := func(event core.OutboxEvent) core.HeaderEvent {
+		var headerEvent core.HeaderEvent
+		Expect(json.Unmarshal(event.Payload, &headerEvent)).To(Succeed())
+		return headerEvent
+	}
+
+	It("records inserted and replaced headers in order", func() {
+		_, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+		replacement := header
+		replacement.Hash = "0x101"
+		_, err = headerRepo.CreateOrUpdateHeader(replacement)
+		Expect(err).NotTo(HaveOccurred())
+
+		events, err := outboxRepo.GetOutboxEvents(10)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(events)).To(Equal(2))
+		Expect(events[0].Fingerprint).To(Equal(db.Node.ID))
+		Expect(decode(events[0])).To(Equal(core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 100, Hash: "0x100", Fingerprint: db.Node.ID}))
+		Expect(decode(events[1])).To(Equal(core.HeaderEvent{Type: core.HeaderReplaced, BlockNumber: 100, Hash: "0x101", PreviousHash: "0x100", Fingerprint: db.Node.ID}))
+	})
+
+	It("limits the number of events returned", func() {
+		for i := int64(0); i < 3; i++ {
+			header.BlockNumber = i
+			_, err := headerRepo.CreateOrUpdateHeader(header)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		events, err := outboxRepo.GetOutboxEvents(2)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(events)).To(Equal(2))
+		Expect(decode(events[0]).BlockNumber).To(Equal(int64(0)))
+	})
+
+	It("deletes published events", func() {
+		_, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+		events, err := outboxRepo.GetOutboxEvents(10)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = outboxRepo.DeleteOutboxEvents([]int64{events[0].ID})
+
+		Expect(err).NotTo(HaveOccurred())
+		events, err = outboxRepo.GetOutboxEvents(10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+
+	It("waits for other transactions recording events to commit, so ids are committed in order", func() {
+		tx, err := db.Beginx()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, 0x65686f62, db.Node.ID)
+		Expect(err).NotTo(HaveOccurred())
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := headerRepo.CreateOrUpdateHeader(header)
+			done <- err
+		}()
+
+		Consistently(done, "200ms").ShouldNot(Receive())
+		Expect(tx.Commit()).To(Succeed())
+		Eventually(done, "5s").Should(Receive(BeNil()))
+	})
+
+	It("does not record events when the outbox is disabled", func() {
+		headerRepo.SetOutbox(false)
+		_, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		events, err := outboxRepo.GetOutboxEvents(10)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+})
@@ -0,0 +1,219 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+)
+
+// maxPartitions is the most range partitions the headers table is split into, each partition is a table of its own so
+// a partition size needing more is too small for the chain
+const maxPartitions = 1000
+
+var (
+	ErrInvalidPartitionSize = errors.New("partition size must be greater than zero")
+	ErrTooManyPartitions    = errors.New("partition size is too small for the chain")
+)
+
+// HeaderPartitioner manages the block number range partitions of the headers table
+// Rows which fall outside of every range partition are kept in the headers_default partition
+// until a range partition covering them is created
+type HeaderPartitioner struct {
+	database      *postgres.DB
+	partitionSize int64
+	lowerBound    int64
+	upperBound    int64
+}
+
+// NewHeaderPartitioner returns a new HeaderPartitioner which creates partitions spanning partitionSize blocks
+// If the table has no range partitions yet they start from the one containing startingBlockNumber, the headers of
+// lower blocks are kept in the default partition
+func NewHeaderPartitioner(database *postgres.DB, partitionSize, startingBlockNumber int64) (*HeaderPartitioner, error) {
+	if partitionSize <= 0 {
+		return nil, ErrInvalidPartitionSize
+	}
+	if startingBlockNumber < 0 {
+		startingBlockNumber = 0
+	}
+	return &HeaderPartitioner{
+		database:      database,
+		partitionSize: partitionSize,
+		lowerBound:    startingBlockNumber - startingBlockNumber%partitionSize,
+		upperBound:    -1,
+	}, nil
+}
+
+// IsPartitioned returns whether the headers table is a partitioned table
+func (partitioner *HeaderPartitioner) IsPartitioned() (bool, error) {
+	var partitioned bool
+	err := partitioner.database.Get(&partitioned,
+		`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'public.headers'::REGCLASS)`)
+	return partitioned, err
+}
+
+// PartitionHeaders converts the headers table into a table partitioned by block number range
+// All existing rows are moved into the default partition, range partitions are then created by EnsurePartitions
+// The indexes of the table are kept, the primary key becomes (id, block_number) since it must include the partition key
+// It is a no-op if the headers table is already partitioned
+func (partitioner *HeaderPartitioner) PartitionHeaders() error {
+	partitioned, err := partitioner.IsPartitioned()
+	if err != nil || partitioned {
+		return err
+	}
+	tx, err := partitioner.database.Beginx()
+	if err != nil {
+		return err
+	}
+	// Index and constraint names are schema wide, so the old ones need to be moved out of the way first
+	statements := []string{
+		`ALTER TABLE public.headers RENAME TO headers_unpartitioned`,
+		`ALTER TABLE public.headers_unpartitioned RENAME CONSTRAINT headers_pkey TO headers_unpartitioned_pkey`,
+		`ALTER TABLE public.headers_unpartitioned RENAME CONSTRAINT headers_block_number_hash_eth_node_fingerprint_key
+			TO headers_unpartitioned_block_number_hash_eth_node_fingerprint_key`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			log.Error("PartitionHeaders: error partitioning headers table: ", err)
+			rollback(tx)
+			return err
+		}
+	}
+	// Every index which does not back a constraint is recreated on the partitioned table, including those added by
+	// later migrations
+	var indexes []struct {
+		Name       string `db:"indexname"`
+		Definition string `db:"indexdef"`
+	}
+	err = tx.Select(&indexes, `SELECT indexname, indexdef FROM pg_indexes
+		WHERE schemaname = 'public' AND tablename = 'headers_unpartitioned'
+		AND indexname NOT IN (SELECT conname FROM pg_constraint WHERE conrelid = 'public.headers_unpartitioned'::REGCLASS)
+		ORDER BY indexname`)
+	if err != nil {
+		log.Error("PartitionHeaders: error reading headers indexes: ", err)
+		rollback(tx)
+		return err
+	}
+	statements = nil
+	for _, index := range indexes {
+		statements = append(statements, fmt.Sprintf(`DROP INDEX public.%s`, index.Name))
+	}
+	statements = append(statements,
+		`CREATE TABLE public.headers (LIKE public.headers_unpartitioned INCLUDING DEFAULTS INCLUDING STORAGE)
+			PARTITION BY RANGE (block_number)`,
+		`ALTER TABLE public.headers ADD PRIMARY KEY (id, block_number)`,
+		`ALTER TABLE public.headers ADD UNIQUE (block_number, hash, eth_node_fingerprint)`,
+		`ALTER TABLE public.headers ADD FOREIGN KEY (node_id) REFERENCES public.nodes (id) ON DELETE CASCADE`,
+	)
+	for _, index := range indexes {
+		statements = append(statements,
+			strings.Replace(index.Definition, " ON public.headers_unpartitioned ", " ON public.headers ", 1))
+	}
+	statements = append(statements,
+		`ALTER SEQUENCE public.headers_id_seq OWNED BY public.headers.id`,
+		`CREATE TABLE public.headers_default PARTITION OF public.headers DEFAULT`,
+		`INSERT INTO public.headers SELECT * FROM public.headers_unpartitioned`,
+		`DROP TABLE public.headers_unpartitioned`,
+	)
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			log.Error("PartitionHeaders: error partitioning headers table: ", err)
+			rollback(tx)
+			return err
+		}
+	}
+	partitioner.upperBound = partitioner.lowerBound
+	return tx.Commit()
+}
+
+// EnsurePartitions creates range partitions up to and including the one after the partition containing blockNumber
+// Headers for the new ranges which are sitting in the default partition are moved into the new partitions
+// ErrTooManyPartitions is returned, without creating any, if the range partitions would number more than maxPartitions
+func (partitioner *HeaderPartitioner) EnsurePartitions(blockNumber int64) error {
+	if partitioner.upperBound < 0 {
+		if err := partitioner.readBounds(); err != nil {
+			return err
+		}
+	}
+	target := (blockNumber/partitioner.partitionSize + 2) * partitioner.partitionSize
+	if count := (target - partitioner.lowerBound) / partitioner.partitionSize; count > maxPartitions {
+		return fmt.Errorf("%w: blocks %d to %d need %d partitions of %d blocks, more than %d", ErrTooManyPartitions,
+			partitioner.lowerBound, target-1, count, partitioner.partitionSize, maxPartitions)
+	}
+	for partitioner.upperBound < target {
+		from := partitioner.upperBound
+		to := from + partitioner.partitionSize
+		if err := partitioner.createPartition(from, to); err != nil {
+			log.Errorf("EnsurePartitions: error creating partition for blocks %d - %d: %s", from, to, err.Error())
+			return err
+		}
+		partitioner.upperBound = to
+	}
+	return nil
+}
+
+func (partitioner *HeaderPartitioner) createPartition(from, to int64) error {
+	name := fmt.Sprintf("public.headers_%d", from)
+	tx, err := partitioner.database.Beginx()
+	if err != nil {
+		return err
+	}
+	// A partition cannot be attached while the default partition holds rows belonging to it
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE %s (LIKE public.headers INCLUDING DEFAULTS INCLUDING STORAGE)`, name),
+		fmt.Sprintf(`WITH moved AS (DELETE FROM public.headers_default WHERE block_number >= %d AND block_number < %d RETURNING *)
+			INSERT INTO %s SELECT * FROM moved`, from, to, name),
+		fmt.Sprintf(`ALTER TABLE public.headers ATTACH PARTITION %s FOR VALUES FROM (%d) TO (%d)`, name, from, to),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			rollback(tx)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// readBounds reads the range covered by the existing range partitions, if there are none the partitions start from
+// the configured lower bound
+func (partitioner *HeaderPartitioner) readBounds() error {
+	var bounds struct {
+		Lower sql.NullInt64 `db:"lower_bound"`
+		Upper sql.NullInt64 `db:"upper_bound"`
+	}
+	err := partitioner.database.Get(&bounds,
+		`SELECT MIN(SUBSTRING(pg_get_expr(child.relpartbound, child.oid) FROM 'FROM \(''?(\d+)''?\)')::BIGINT) AS lower_bound,
+				MAX(SUBSTRING(pg_get_expr(child.relpartbound, child.oid) FROM 'TO \(''?(\d+)''?\)')::BIGINT) AS upper_bound
+			FROM pg_inherits
+			JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+			WHERE pg_inherits.inhparent = 'public.headers'::REGCLASS`)
+	if err != nil {
+		return err
+	}
+	if bounds.Lower.Valid && bounds.Upper.Valid {
+		partitioner.lowerBound, partitioner.upperBound = bounds.Lower.Int64, bounds.Upper.Int64
+	} else {
+		partitioner.upperBound = partitioner.lowerBound
+	}
+	return nil
+}
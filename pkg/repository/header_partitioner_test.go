@@ -0,0 +1,173 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/test_config"
+)
+
+var _ = Describe("Header partitioner", func() {
+	var (
+		db          *postgres.DB
+		repo        repository.HeaderRepository
+		partitioner *repository.HeaderPartitioner
+		rawHeader   []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		rawHeader, err = json.Marshal(types.Header{})
+		Expect(err).NotTo(HaveOccurred())
+		db = test_config.NewTestDB(test_config.NewTestNode())
+		test_config.CleanTestDB(db)
+		repo = repository.NewHeaderRepository(db)
+		partitioner, err = repository.NewHeaderPartitioner(db, 10, 0)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("requires a positive partition size", func() {
+		_, err := repository.NewHeaderPartitioner(db, 0, 0)
+		Expect(err).To(MatchError(repository.ErrInvalidPartitionSize))
+	})
+
+	It("converts the headers table into a partitioned table", func() {
+		err := partitioner.PartitionHeaders()
+		Expect(err).NotTo(HaveOccurred())
+
+		partitioned, err := partitioner.IsPartitioned()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(partitioned).To(BeTrue())
+	})
+
+	It("keeps the indexes of the headers table", func() {
+		indexes := func() []string {
+			var definitions []string
+			// Indexes of a partitioned table may be described as ON ONLY the table
+			err := db.Select(&definitions, `SELECT REPLACE(indexdef, ' ON ONLY ', ' ON ') FROM pg_indexes
+				WHERE schemaname = 'public' AND tablename = 'headers'
+				AND indexname NOT IN (SELECT conname FROM pg_constraint WHERE conrelid = 'public.headers'::REGCLASS)
+				ORDER BY indexname`)
+			Expect(err).NotTo(HaveOccurred())
+			return definitions
+		}
+		before := indexes()
+		Expect(before).To(ContainElement(ContainSubstring("headers_hash_fingerprint")))
+
+		err := partitioner.PartitionHeaders()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(indexes()).To(Equal(before))
+	})
+
+	It("moves headers out of the default partition when their range partition is created", func() {
+		err := partitioner.PartitionHeaders()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: 5, Hash: "0x5", Raw: rawHeader, Timestamp: "5"})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = partitioner.EnsurePartitions(5)
+		Expect(err).NotTo(HaveOccurred())
+
+		var partitionCount int
+		err = db.Get(&partitionCount, `SELECT COUNT(*) FROM public.headers_0 WHERE block_number = 5`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(partitionCount).To(Equal(1))
+		var defaultCount int
+		err = db.Get(&defaultCount, `SELECT COUNT(*) FROM public.headers_default WHERE block_number = 5`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(defaultCount).To(BeZero())
+	})
+
+	It("starts the range partitions from the partition containing the starting block", func() {
+		partitioner, err := repository.NewHeaderPartitioner(db, 10, 1234)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(partitioner.PartitionHeaders()).To(Succeed())
+		_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: 5, Hash: "0x5", Raw: rawHeader, Timestamp: "5"})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = partitioner.EnsurePartitions(1255)
+
+		Expect(err).NotTo(HaveOccurred())
+		var partitions []string
+		err = db.Select(&partitions, `SELECT child.relname FROM pg_inherits
+			JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+			WHERE pg_inherits.inhparent = 'public.headers'::REGCLASS ORDER BY child.relname`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(partitions).To(Equal([]string{"headers_1230", "headers_1240", "headers_1250", "headers_1260", "headers_default"}))
+		var defaultCount int
+		err = db.Get(&defaultCount, `SELECT COUNT(*) FROM public.headers_default WHERE block_number = 5`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(defaultCount).To(Equal(1))
+	})
+
+	It("continues from the existing range partitions", func() {
+		Expect(partitioner.PartitionHeaders()).To(Succeed())
+		Expect(partitioner.EnsurePartitions(5)).To(Succeed())
+		restarted, err := repository.NewHeaderPartitioner(db, 10, 100)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(restarted.EnsurePartitions(25)).To(Succeed())
+
+		var count int
+		err = db.Get(&count, `SELECT COUNT(*) FROM pg_inherits WHERE inhparent = 'public.headers'::REGCLASS`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(5))
+	})
+
+	It("rejects a partition size which would need too many partitions", func() {
+		Expect(partitioner.PartitionHeaders()).To(Succeed())
+
+		err := partitioner.EnsurePartitions(20000000)
+
+		Expect(errors.Is(err, repository.ErrTooManyPartitions)).To(BeTrue())
+		var count int
+		err = db.Get(&count, `SELECT COUNT(*) FROM pg_inherits WHERE inhparent = 'public.headers'::REGCLASS`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(1))
+	})
+
+	It("keeps repository semantics on the partitioned table", func() {
+		err := partitioner.PartitionHeaders()
+		Expect(err).NotTo(HaveOccurred())
+		err = partitioner.EnsurePartitions(25)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, blockNumber := range []int64{9, 11, 25} {
+			_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: blockNumber, Raw: rawHeader, Timestamp: "1"})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: 11, Hash: "0x11", Raw: rawHeader, Timestamp: "1"})
+		Expect(err).NotTo(HaveOccurred())
+
+		header, err := repo.GetHeader(11)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal("0x11"))
+		missing, err := repo.MissingBlockNumbers(9, 12, db.Node.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(ConsistOf(int64(10), int64(12)))
+	})
+})
@@ -18,11 +18,19 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/vulcanize/eth-header-sync/pkg/converter"
 	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
 	"github.com/vulcanize/eth-header-sync/pkg/postgres"
 )
 
@@ -30,7 +38,9 @@ var ErrValidHeaderExists = errors.New("valid header already exists")
 
 // HeaderRepository is the underlying type satisfying the core.HeaderRepository interface
 type HeaderRepository struct {
-	database *postgres.DB
+	database    *postgres.DB
+	outbox      bool
+	leaderCheck func(tx *sqlx.Tx) error
 }
 
 // NewHeaderRepository returns a new HeaderRepository
@@ -38,26 +48,100 @@ func NewHeaderRepository(database *postgres.DB) HeaderRepository {
 	return HeaderRepository{database: database}
 }
 
+// NewHeaderRepositoryForFingerprint returns a HeaderRepository for the headers synced by the node with the provided fingerprint
+// It shares the connection pool of the database and is meant for reading, headers it writes are recorded against the database's node
+func NewHeaderRepositoryForFingerprint(database *postgres.DB, fingerprint string) HeaderRepository {
+	nodeDatabase := *database
+	nodeDatabase.Node.ID = fingerprint
+	return HeaderRepository{database: &nodeDatabase}
+}
+
+// SetOutbox sets whether header events are also recorded in the header_outbox table, for a Relay to publish
+func (repository *HeaderRepository) SetOutbox(enabled bool) {
+	repository.outbox = enabled
+}
+
+// SetLeaderCheck sets a check run at the start of every write transaction, such as leader.Elector's CheckTx, whose error
+// fails the write, so that a process which has lost leadership cannot write alongside the new leader
+func (repository *HeaderRepository) SetLeaderCheck(check func(tx *sqlx.Tx) error) {
+	repository.leaderCheck = check
+}
+
 // CreateOrUpdateHeader inserts a header model into the db
 // If there is already a header at the height, it is replaced if the hash is not the expected value
 func (repository HeaderRepository) CreateOrUpdateHeader(header core.Header) (int64, error) {
 	hash, err := repository.getHeaderHash(header)
 	if err != nil {
 		if headerDoesNotExist(err) {
+			defer metrics.ObserveDBWrite("insert", time.Now())
 			return repository.InternalInsertHeader(header)
 		}
 		log.Error("CreateOrUpdateHeader: error getting header hash: ", err)
 		return 0, err
 	}
 	if headerMustBeReplaced(hash, header) {
-		return repository.replaceHeader(header)
+		defer metrics.ObserveDBWrite("replace", time.Now())
+		return repository.replaceHeader(header, hash)
 	}
 	return 0, ErrValidHeaderExists
 }
 
+// CreateOrUpdateHeaders inserts the headers in one transaction, replacing stored headers whose hash is not the
+// expected value, and returns the number of headers inserted or replaced
+// Headers which are already stored are skipped
+func (repository HeaderRepository) CreateOrUpdateHeaders(headers []core.Header) (int64, error) {
+	if len(headers) == 0 {
+		return 0, nil
+	}
+	defer metrics.ObserveDBWrite("batch", time.Now())
+	stored, err := repository.getHeaderHashes(headers)
+	if err != nil {
+		log.Error("CreateOrUpdateHeaders: error getting header hashes: ", err)
+		return 0, err
+	}
+	tx, err := repository.begin()
+	if err != nil {
+		return 0, err
+	}
+	var written, replaced int64
+	for _, header := range headers {
+		event := core.HeaderEvent{Type: core.HeaderInserted}
+		hash, exists := stored[header.BlockNumber]
+		if exists && !headerMustBeReplaced(hash, header) {
+			continue
+		}
+		if exists {
+			if _, err = repository.deleteHeaders(tx, "=", header.BlockNumber); err != nil {
+				log.Error("CreateOrUpdateHeaders: error deleting headers: ", err)
+				rollback(tx)
+				return 0, err
+			}
+			event = core.HeaderEvent{Type: core.HeaderReplaced, PreviousHash: hash}
+			replaced++
+		}
+		_, err = repository.insertHeader(tx, header)
+		if err == ErrValidHeaderExists {
+			continue
+		}
+		if err == nil {
+			err = repository.notify(tx, event, header)
+		}
+		if err != nil {
+			rollback(tx)
+			return 0, err
+		}
+		written++
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	metrics.Reorgs.Add(float64(replaced))
+	return written, nil
+}
+
 func (repository HeaderRepository) GetHeader(blockNumber int64) (core.Header, error) {
 	var header core.Header
-	err := repository.database.Get(&header, `SELECT id, block_number, hash, raw, block_timestamp FROM headers WHERE block_number = $1 AND eth_node_fingerprint = $2`,
+	err := repository.database.Get(&header, `SELECT id, block_number, hash, raw, raw_rlp, block_timestamp FROM headers WHERE block_number = $1 AND eth_node_fingerprint = $2`,
 		blockNumber, repository.database.Node.ID)
 	if err != nil {
 		log.Error("GetHeader: error getting headers: ", err)
@@ -65,13 +149,154 @@ func (repository HeaderRepository) GetHeader(blockNumber int64) (core.Header, er
 	return header, err
 }
 
+// GetHeaderByHash returns this node's header with the provided hash
+func (repository HeaderRepository) GetHeaderByHash(hash string) (core.Header, error) {
+	var header core.Header
+	err := repository.database.Get(&header, `SELECT id, block_number, hash, raw, raw_rlp, block_timestamp FROM headers WHERE hash = $1 AND eth_node_fingerprint = $2`,
+		hash, repository.database.Node.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error("GetHeaderByHash: error getting header: ", err)
+	}
+	return header, err
+}
+
+// GetHeaderAtOrBeforeTimestamp returns this node's latest header with a timestamp at or before the provided unix time
+func (repository HeaderRepository) GetHeaderAtOrBeforeTimestamp(timestamp int64) (core.Header, error) {
+	var header core.Header
+	err := repository.database.Get(&header,
+		`SELECT id, block_number, hash, raw, raw_rlp, block_timestamp FROM headers
+			WHERE block_timestamp <= $1 AND eth_node_fingerprint = $2
+			ORDER BY block_timestamp DESC, block_number DESC LIMIT 1`,
+		timestamp, repository.database.Node.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error("GetHeaderAtOrBeforeTimestamp: error getting header: ", err)
+	}
+	return header, err
+}
+
+// GetHeaderAtOrAfterTimestamp returns this node's earliest header with a timestamp at or after the provided unix time
+func (repository HeaderRepository) GetHeaderAtOrAfterTimestamp(timestamp int64) (core.Header, error) {
+	var header core.Header
+	err := repository.database.Get(&header,
+		`SELECT id, block_number, hash, raw, raw_rlp, block_timestamp FROM headers
+			WHERE block_timestamp >= $1 AND eth_node_fingerprint = $2
+			ORDER BY block_timestamp ASC, block_number ASC LIMIT 1`,
+		timestamp, repository.database.Node.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error("GetHeaderAtOrAfterTimestamp: error getting header: ", err)
+	}
+	return header, err
+}
+
+// GetHeaderClosestToTimestamp returns this node's header with the timestamp nearest to the provided unix time
+// When a header before and a header after the time are equally near, the header before is returned
+func (repository HeaderRepository) GetHeaderClosestToTimestamp(timestamp int64) (core.Header, error) {
+	return GetHeaderClosestToTimestamp(repository, timestamp)
+}
+
+// TimestampLookup is the part of core.HeaderRepository which GetHeaderClosestToTimestamp is built on
+type TimestampLookup interface {
+	GetHeaderAtOrBeforeTimestamp(timestamp int64) (core.Header, error)
+	GetHeaderAtOrAfterTimestamp(timestamp int64) (core.Header, error)
+}
+
+// GetHeaderClosestToTimestamp returns the header with the timestamp nearest to the provided unix time, preferring the
+// header before the time when two are equally near, for core.HeaderRepository implementations to share
+func GetHeaderClosestToTimestamp(repository TimestampLookup, timestamp int64) (core.Header, error) {
+	before, beforeErr := repository.GetHeaderAtOrBeforeTimestamp(timestamp)
+	if beforeErr != nil && beforeErr != sql.ErrNoRows {
+		return core.Header{}, beforeErr
+	}
+	after, afterErr := repository.GetHeaderAtOrAfterTimestamp(timestamp)
+	if afterErr != nil && afterErr != sql.ErrNoRows {
+		return core.Header{}, afterErr
+	}
+	if beforeErr == sql.ErrNoRows {
+		return after, afterErr
+	}
+	if afterErr == sql.ErrNoRows {
+		return before, nil
+	}
+	return closestHeader(timestamp, before, after)
+}
+
+func closestHeader(timestamp int64, before, after core.Header) (core.Header, error) {
+	beforeTimestamp, err := before.UnixTimestamp()
+	if err != nil {
+		return core.Header{}, err
+	}
+	afterTimestamp, err := after.UnixTimestamp()
+	if err != nil {
+		return core.Header{}, err
+	}
+	if afterTimestamp-timestamp < timestamp-beforeTimestamp {
+		return after, nil
+	}
+	return before, nil
+}
+
+// GetLastBlockNumber returns the highest block number this node has a header for, or sql.ErrNoRows if there are none
+func (repository HeaderRepository) GetLastBlockNumber() (int64, error) {
+	var blockNumber sql.NullInt64
+	err := repository.database.Get(&blockNumber, `SELECT MAX(block_number) FROM headers WHERE eth_node_fingerprint = $1`,
+		repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetLastBlockNumber: error getting last block number: ", err)
+		return 0, err
+	}
+	if !blockNumber.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return blockNumber.Int64, nil
+}
+
+// GetHeadersInRange returns this node's headers between the provided block numbers (inclusive) in ascending order
+func (repository HeaderRepository) GetHeadersInRange(startingBlockNumber, endingBlockNumber int64) ([]core.Header, error) {
+	headers := make([]core.Header, 0)
+	err := repository.database.Select(&headers,
+		`SELECT id, block_number, hash, raw, raw_rlp, block_timestamp FROM headers
+			WHERE block_number BETWEEN $1 AND $2 AND eth_node_fingerprint = $3
+			ORDER BY block_number`,
+		startingBlockNumber, endingBlockNumber, repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetHeadersInRange: error getting headers: ", err)
+	}
+	return headers, err
+}
+
+// GetHeadersInTimeRange returns up to limit of this node's headers with timestamps between the provided ones (inclusive),
+// in ascending block number order
+func (repository HeaderRepository) GetHeadersInTimeRange(startingTimestamp, endingTimestamp int64, limit int) ([]core.Header, error) {
+	headers := make([]core.Header, 0)
+	err := repository.database.Select(&headers,
+		`SELECT id, block_number, hash, raw, raw_rlp, block_timestamp FROM headers
+			WHERE block_timestamp BETWEEN $1 AND $2 AND eth_node_fingerprint = $3
+			ORDER BY block_number LIMIT $4`,
+		startingTimestamp, endingTimestamp, repository.database.Node.ID, limit)
+	if err != nil {
+		log.Error("GetHeadersInTimeRange: error getting headers: ", err)
+	}
+	return headers, err
+}
+
+// GetGethHeader returns the go-ethereum header decoded from the raw header stored at the provided height
+func (repository HeaderRepository) GetGethHeader(blockNumber int64) (*types.Header, error) {
+	header, err := repository.GetHeader(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return converter.DecodeHeader(header)
+}
+
 func (repository HeaderRepository) MissingBlockNumbers(startingBlockNumber, endingBlockNumber int64, nodeID string) ([]int64, error) {
 	numbers := make([]int64, 0)
 	err := repository.database.Select(&numbers,
 		`SELECT series.block_number
-			FROM (SELECT generate_series($1::INT, $2::INT) AS block_number) AS series
+			FROM (SELECT generate_series(GREATEST($1::INT, (SELECT block_number FROM pruned_headers
+				WHERE eth_node_fingerprint = $3)::INT), $2::INT) AS block_number) AS series
 			LEFT OUTER JOIN (SELECT block_number FROM headers
-				WHERE eth_node_fingerprint = $3) AS synced
+				WHERE block_number BETWEEN $1 AND $2
+				AND eth_node_fingerprint = $3) AS synced
 			USING (block_number)
 			WHERE  synced.block_number IS NULL`,
 		startingBlockNumber, endingBlockNumber, nodeID)
@@ -83,6 +308,31 @@ func (repository HeaderRepository) MissingBlockNumbers(startingBlockNumber, endi
 	return numbers, nil
 }
 
+// PruneHeaders deletes all headers below the provided block number
+// The block number is recorded so that MissingBlockNumbers does not report the pruned range as missing
+func (repository HeaderRepository) PruneHeaders(blockNumber int64) (int64, error) {
+	tx, err := repository.begin()
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := repository.deleteHeaders(tx, "<", blockNumber)
+	if err != nil {
+		log.Error("PruneHeaders: error deleting headers: ", err)
+		rollback(tx)
+		return 0, err
+	}
+	_, err = tx.Exec(`INSERT INTO pruned_headers (eth_node_fingerprint, block_number) VALUES ($1, $2)
+		ON CONFLICT (eth_node_fingerprint) DO UPDATE
+			SET block_number = GREATEST(pruned_headers.block_number, excluded.block_number)`,
+		repository.database.Node.ID, blockNumber)
+	if err != nil {
+		log.Error("PruneHeaders: error recording pruned block number: ", err)
+		rollback(tx)
+		return 0, err
+	}
+	return pruned, tx.Commit()
+}
+
 func headerMustBeReplaced(hash string, header core.Header) bool {
 	return hash != header.Hash
 }
@@ -98,32 +348,182 @@ func (repository HeaderRepository) getHeaderHash(header core.Header) (string, er
 	return hash, err
 }
 
+// getHeaderHashes returns the hashes of this node's stored headers at the heights of the provided headers by block number
+func (repository HeaderRepository) getHeaderHashes(headers []core.Header) (map[int64]string, error) {
+	numbers := make([]int64, len(headers))
+	for i, header := range headers {
+		numbers[i] = header.BlockNumber
+	}
+	var rows []struct {
+		BlockNumber int64 `db:"block_number"`
+		Hash        string
+	}
+	err := repository.database.Select(&rows,
+		`SELECT block_number, hash FROM headers WHERE block_number = ANY($1) AND eth_node_fingerprint = $2`,
+		pq.Array(numbers), repository.database.Node.ID)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		hashes[row.BlockNumber] = row.Hash
+	}
+	return hashes, nil
+}
+
 // InternalInsertHeader inserts the provided header and returns its row id
 // Function is public so we can test insert being called for the same header
-// Can happen when concurrent processes are inserting headers
+// Can happen when concurrent processes are inserting headers, which sync's leader election prevents
 // Otherwise should not occur since only called in CreateOrUpdateHeader
 func (repository HeaderRepository) InternalInsertHeader(header core.Header) (int64, error) {
+	tx, err := repository.begin()
+	if err != nil {
+		return 0, err
+	}
+	headerID, err := repository.insertHeader(tx, header)
+	if err == nil {
+		err = repository.notify(tx, core.HeaderEvent{Type: core.HeaderInserted}, header)
+	}
+	if err != nil {
+		rollback(tx)
+		return 0, err
+	}
+	return headerID, tx.Commit()
+}
+
+func (repository HeaderRepository) insertHeader(tx *sqlx.Tx, header core.Header) (int64, error) {
 	var headerID int64
-	row := repository.database.QueryRowx(
-		`INSERT INTO public.headers (block_number, hash, block_timestamp, raw, node_id, eth_node_fingerprint)
-		VALUES ($1, $2, $3::NUMERIC, $4, $5, $6) ON CONFLICT DO NOTHING RETURNING id`,
-		header.BlockNumber, header.Hash, header.Timestamp, header.Raw, repository.database.NodeID, repository.database.Node.ID)
+	row := tx.QueryRowx(
+		`INSERT INTO public.headers (block_number, hash, block_timestamp, raw, raw_rlp, node_id, eth_node_fingerprint)
+		VALUES ($1, $2, $3::NUMERIC, $4, $5, $6, $7) ON CONFLICT DO NOTHING RETURNING id`,
+		header.BlockNumber, header.Hash, header.Timestamp, header.Raw, header.RLP, repository.database.NodeID, repository.database.Node.ID)
 	err := row.Scan(&headerID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, ErrValidHeaderExists
 		}
-		log.Error("InternalInsertHeader: error inserting header: ", err)
+		log.Error("insertHeader: error inserting header: ", err)
+		return 0, err
+	}
+	err = insertUncles(tx, headerID, header.Uncles)
+	if err != nil {
+		log.Error("insertHeader: error inserting uncles: ", err)
+		return 0, err
+	}
+	err = insertTransactionHashes(tx, headerID, header.TransactionHashes)
+	if err != nil {
+		log.Error("insertHeader: error inserting transaction hashes: ", err)
 	}
 	return headerID, err
 }
 
-func (repository HeaderRepository) replaceHeader(header core.Header) (int64, error) {
-	_, err := repository.database.Exec(`DELETE FROM headers WHERE block_number = $1 AND eth_node_fingerprint = $2`,
-		header.BlockNumber, repository.database.Node.ID)
+// headerChildTables are the tables holding rows which belong to a header through their header_id
+// They do not use foreign keys so that the headers table can be partitioned
+var headerChildTables = []string{"uncles", "header_transactions"}
+
+// deleteHeaders deletes this node's headers whose block number compares to the provided one using the operator,
+// along with their child rows, and returns the number of headers deleted
+func (repository HeaderRepository) deleteHeaders(tx *sqlx.Tx, operator string, blockNumber int64) (int64, error) {
+	condition := fmt.Sprintf("block_number %s $1 AND eth_node_fingerprint = $2", operator)
+	for _, table := range headerChildTables {
+		_, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE header_id IN (SELECT id FROM headers WHERE %s)`, table, condition),
+			blockNumber, repository.database.Node.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM headers WHERE `+condition, blockNumber, repository.database.Node.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func rollback(tx *sqlx.Tx) {
+	if err := tx.Rollback(); err != nil {
+		log.Error("failed to rollback transaction: ", err)
+	}
+}
+
+func (repository HeaderRepository) replaceHeader(header core.Header, previousHash string) (int64, error) {
+	tx, err := repository.begin()
+	if err != nil {
+		return 0, err
+	}
+	_, err = repository.deleteHeaders(tx, "=", header.BlockNumber)
 	if err != nil {
 		log.Error("replaceHeader: error deleting headers: ", err)
+		rollback(tx)
 		return 0, err
 	}
-	return repository.InternalInsertHeader(header)
+	headerID, err := repository.insertHeader(tx, header)
+	if err == nil {
+		err = repository.notify(tx, core.HeaderEvent{Type: core.HeaderReplaced, PreviousHash: previousHash}, header)
+	}
+	if err != nil {
+		rollback(tx)
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	metrics.Reorgs.Inc()
+	return headerID, nil
+}
+
+// outboxLockNamespace is the first key of the advisory lock serializing the transactions which record events in the outbox
+const outboxLockNamespace = 0x65686f62
+
+// begin starts a transaction writing headers
+// With a leader check set, the transaction fails unless the check passes
+// With the outbox enabled, it first takes a transaction-level advisory lock for the node, so that the outbox ids are
+// committed in the order they are allocated and a Relay reading in id order never passes over an uncommitted event
+func (repository HeaderRepository) begin() (*sqlx.Tx, error) {
+	tx, err := repository.database.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	if repository.leaderCheck != nil {
+		if err := repository.leaderCheck(tx); err != nil {
+			log.Error("begin: leadership check failed: ", err)
+			rollback(tx)
+			return nil, err
+		}
+	}
+	if !repository.outbox {
+		return tx, nil
+	}
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, outboxLockNamespace, repository.database.Node.ID)
+	if err != nil {
+		log.Error("begin: error locking the outbox: ", err)
+		rollback(tx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// notify publishes the header event on the header events channel and, if enabled, records it in the outbox
+// Both only take effect when the transaction commits
+func (repository HeaderRepository) notify(tx *sqlx.Tx, event core.HeaderEvent, header core.Header) error {
+	event.BlockNumber = header.BlockNumber
+	event.Hash = header.Hash
+	event.Fingerprint = repository.database.Node.ID
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`SELECT pg_notify($1, $2)`, core.HeaderEventsChannel, string(payload))
+	if err != nil {
+		log.Error("notify: error publishing header event: ", err)
+		return err
+	}
+	if !repository.outbox {
+		return nil
+	}
+	_, err = tx.Exec(`INSERT INTO public.header_outbox (eth_node_fingerprint, payload) VALUES ($1, $2)`,
+		repository.database.Node.ID, payload)
+	if err != nil {
+		log.Error("notify: error recording header event in outbox: ", err)
+	}
+	return err
 }
@@ -20,13 +20,17 @@ import (
 	"database/sql"
 	"encoding/json"
 	"math/big"
+	"strconv"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/jmoiron/sqlx"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
 	"github.com/vulcanize/eth-header-sync/pkg/postgres"
 	"github.com/vulcanize/eth-header-sync/pkg/repository"
 	"github.com/vulcanize/eth-header-sync/test_config"
@@ -71,6 +75,19 @@ var _ = Describe("Block header repository", func() {
 			Expect(dbHeader.Timestamp).To(Equal(header.Timestamp))
 		})
 
+		It("does not write when the leader check fails", func() {
+			repo.SetLeaderCheck(func(tx *sqlx.Tx) error { return fakes.FakeError })
+
+			_, err = repo.CreateOrUpdateHeader(header)
+			Expect(err).To(MatchError(fakes.FakeError))
+			_, err = repo.PruneHeaders(1000)
+			Expect(err).To(MatchError(fakes.FakeError))
+
+			var count int
+			Expect(db.Get(&count, `SELECT COUNT(*) FROM public.headers`)).To(Succeed())
+			Expect(count).To(BeZero())
+		})
+
 		It("adds node data to header", func() {
 			_, err = repo.CreateOrUpdateHeader(header)
 			Expect(err).NotTo(HaveOccurred())
@@ -193,6 +210,32 @@ var _ = Describe("Block header repository", func() {
 			Expect(dbHeaders[0].Raw).To(Or(MatchJSON(header.Raw), MatchJSON(headerThree.Raw)))
 			Expect(dbHeaders[1].Raw).To(Or(MatchJSON(header.Raw), MatchJSON(headerThree.Raw)))
 		})
+
+		It("writes a batch of headers, replacing those with another hash and skipping stored ones", func() {
+			_, err = repo.CreateOrUpdateHeader(header)
+			Expect(err).NotTo(HaveOccurred())
+			replaced := header
+			replaced.BlockNumber, replaced.Hash = 101, common.BytesToHash([]byte{1, 0, 1}).Hex()
+			_, err = repo.CreateOrUpdateHeader(replaced)
+			Expect(err).NotTo(HaveOccurred())
+			replacement := replaced
+			replacement.Hash = common.BytesToHash([]byte{1, 0, 2}).Hex()
+			replacement.TransactionHashes = []string{common.BytesToHash([]byte{9}).Hex()}
+			inserted := header
+			inserted.BlockNumber, inserted.Hash = 102, common.BytesToHash([]byte{1, 0, 3}).Hex()
+
+			written, err := repo.CreateOrUpdateHeaders([]core.Header{header, replacement, inserted})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(written).To(Equal(int64(2)))
+			headers, err := repo.GetHeadersInRange(100, 102)
+			Expect(err).NotTo(HaveOccurred())
+			Expect([]string{headers[0].Hash, headers[1].Hash, headers[2].Hash}).To(Equal(
+				[]string{header.Hash, replacement.Hash, inserted.Hash}))
+			txHashes, err := repository.NewHeaderTransactionRepository(db).GetTransactionHashes(101)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(txHashes).To(Equal(replacement.TransactionHashes))
+		})
 	})
 
 	Describe("Getting a header", func() {
@@ -210,6 +253,24 @@ var _ = Describe("Block header repository", func() {
 			Expect(dbHeader.Timestamp).To(Equal(header.Timestamp))
 		})
 
+		It("returns the RLP encoded header", func() {
+			gethHeader := types.Header{Number: big.NewInt(header.BlockNumber), Difficulty: big.NewInt(1)}
+			header.RLP, err = rlp.EncodeToBytes(&gethHeader)
+			Expect(err).NotTo(HaveOccurred())
+			header.Raw = nil
+			_, err = repo.CreateOrUpdateHeader(header)
+			Expect(err).NotTo(HaveOccurred())
+
+			dbHeader, err := repo.GetHeader(header.BlockNumber)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dbHeader.RLP).To(Equal(header.RLP))
+			Expect(dbHeader.Raw).To(BeNil())
+
+			decoded, err := repo.GetGethHeader(header.BlockNumber)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.Hash()).To(Equal(gethHeader.Hash()))
+		})
+
 		It("does not return header for a different node fingerprint", func() {
 			_, err = repo.CreateOrUpdateHeader(header)
 			Expect(err).NotTo(HaveOccurred())
@@ -224,6 +285,99 @@ var _ = Describe("Block header repository", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err).To(MatchError(sql.ErrNoRows))
 		})
+
+		It("returns the header with a hash", func() {
+			_, err = repo.CreateOrUpdateHeader(header)
+			Expect(err).NotTo(HaveOccurred())
+
+			dbHeader, err := repo.GetHeaderByHash(header.Hash)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dbHeader.BlockNumber).To(Equal(header.BlockNumber))
+			Expect(dbHeader.Raw).To(MatchJSON(header.Raw))
+		})
+
+		It("returns headers in a range in ascending order", func() {
+			for _, blockNumber := range []int64{3, 1, 2, 5} {
+				_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: blockNumber, Hash: strconv.FormatInt(blockNumber, 10), Raw: rawHeader, Timestamp: timestamp})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			headers, err := repo.GetHeadersInRange(2, 5)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(headers)).To(Equal(3))
+			Expect(headers[0].BlockNumber).To(Equal(int64(2)))
+			Expect(headers[2].BlockNumber).To(Equal(int64(5)))
+		})
+
+		It("returns the header at or before a timestamp", func() {
+			for _, blockNumber := range []int64{1, 2, 3} {
+				_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: blockNumber, Hash: strconv.FormatInt(blockNumber, 10),
+					Raw: rawHeader, Timestamp: strconv.FormatInt(1000+blockNumber*15, 10)})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			dbHeader, err := repo.GetHeaderAtOrBeforeTimestamp(1040)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dbHeader.BlockNumber).To(Equal(int64(2)))
+
+			_, err = repo.GetHeaderAtOrBeforeTimestamp(1000)
+			Expect(err).To(MatchError(sql.ErrNoRows))
+		})
+
+		It("returns the header at or after a timestamp", func() {
+			for blockNumber := int64(1); blockNumber <= 3; blockNumber++ {
+				_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: blockNumber, Hash: strconv.FormatInt(blockNumber, 10),
+					Raw: rawHeader, Timestamp: strconv.FormatInt(1000+blockNumber*15, 10)})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			dbHeader, err := repo.GetHeaderAtOrAfterTimestamp(1016)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dbHeader.BlockNumber).To(Equal(int64(2)))
+
+			dbHeader, err = repo.GetHeaderAtOrAfterTimestamp(1030)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dbHeader.BlockNumber).To(Equal(int64(2)))
+
+			_, err = repo.GetHeaderAtOrAfterTimestamp(1046)
+			Expect(err).To(MatchError(sql.ErrNoRows))
+		})
+
+		It("returns the header closest to a timestamp", func() {
+			_, err = repo.GetHeaderClosestToTimestamp(1000)
+			Expect(err).To(MatchError(sql.ErrNoRows))
+			for blockNumber := int64(1); blockNumber <= 3; blockNumber++ {
+				_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: blockNumber, Hash: strconv.FormatInt(blockNumber, 10),
+					Raw: rawHeader, Timestamp: strconv.FormatInt(1000+blockNumber*15, 10)})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			closest := func(timestamp int64) int64 {
+				dbHeader, err := repo.GetHeaderClosestToTimestamp(timestamp)
+				Expect(err).NotTo(HaveOccurred())
+				return dbHeader.BlockNumber
+			}
+			Expect(closest(1000)).To(Equal(int64(1)))
+			Expect(closest(1021)).To(Equal(int64(1)))
+			Expect(closest(1022)).To(Equal(int64(1)))
+			Expect(closest(1023)).To(Equal(int64(2)))
+			Expect(closest(1045)).To(Equal(int64(3)))
+			Expect(closest(2000)).To(Equal(int64(3)))
+		})
+
+		It("returns the last block number", func() {
+			_, err = repo.GetLastBlockNumber()
+			Expect(err).To(MatchError(sql.ErrNoRows))
+			_, err = repo.CreateOrUpdateHeader(header)
+			Expect(err).NotTo(HaveOccurred())
+
+			lastBlockNumber, err := repo.GetLastBlockNumber()
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lastBlockNumber).To(Equal(header.BlockNumber))
+		})
 	})
 
 	Describe("Getting missing headers", func() {
@@ -287,5 +441,68 @@ var _ = Describe("Block header repository", func() {
 
 			Expect(missingBlockNumbers).To(ConsistOf([]int64{1, 2, 3, 4, 5}))
 		})
+
+		It("does not count pruned headers as missing", func() {
+			_, err = repo.CreateOrUpdateHeader(core.Header{
+				BlockNumber: 4,
+				Raw:         rawHeader,
+				Timestamp:   timestamp,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = repo.PruneHeaders(3)
+			Expect(err).NotTo(HaveOccurred())
+
+			missingBlockNumbers, err := repo.MissingBlockNumbers(1, 5, db.Node.ID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(missingBlockNumbers).To(ConsistOf([]int64{3, 5}))
+		})
+	})
+
+	Describe("Pruning headers", func() {
+		BeforeEach(func() {
+			for _, blockNumber := range []int64{1, 2, 3} {
+				_, err = repo.CreateOrUpdateHeader(core.Header{
+					BlockNumber: blockNumber,
+					Raw:         rawHeader,
+					Timestamp:   big.NewInt(blockNumber * 10).String(),
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("deletes headers below the block number", func() {
+			pruned, err := repo.PruneHeaders(3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(Equal(int64(2)))
+
+			var blockNumbers []int64
+			err = db.Select(&blockNumbers, `SELECT block_number FROM headers`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blockNumbers).To(ConsistOf(int64(3)))
+		})
+
+		It("does not move the pruned block number backwards", func() {
+			_, err = repo.PruneHeaders(3)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = repo.PruneHeaders(2)
+			Expect(err).NotTo(HaveOccurred())
+
+			var prunedBlockNumber int64
+			err = db.Get(&prunedBlockNumber, `SELECT block_number FROM pruned_headers WHERE eth_node_fingerprint = $1`, db.Node.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prunedBlockNumber).To(Equal(int64(3)))
+		})
+
+		It("does not delete headers for a different node fingerprint", func() {
+			nodeTwo := core.Node{ID: "FingerprintTwo"}
+			dbTwo, err := postgres.NewDB(test_config.DBConfig, nodeTwo)
+			Expect(err).NotTo(HaveOccurred())
+			repoTwo := repository.NewHeaderRepository(dbTwo)
+
+			pruned, err := repoTwo.PruneHeaders(3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(BeZero())
+		})
 	})
 })
@@ -0,0 +1,80 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+)
+
+// HeaderTransactionRepository reads the transaction hashes stored alongside their headers
+// Transaction hashes are written by the HeaderRepository in the same transaction as their header
+type HeaderTransactionRepository struct {
+	database *postgres.DB
+}
+
+// NewHeaderTransactionRepository returns a new HeaderTransactionRepository
+func NewHeaderTransactionRepository(database *postgres.DB) HeaderTransactionRepository {
+	return HeaderTransactionRepository{database: database}
+}
+
+// GetTransactionHashes returns the hashes of the transactions in this node's header at the provided height, in block order
+func (repository HeaderTransactionRepository) GetTransactionHashes(blockNumber int64) ([]string, error) {
+	hashes := make([]string, 0)
+	err := repository.database.Select(&hashes,
+		`SELECT header_transactions.tx_hash
+			FROM header_transactions
+			INNER JOIN headers ON header_transactions.header_id = headers.id
+			WHERE headers.block_number = $1 AND headers.eth_node_fingerprint = $2
+			ORDER BY header_transactions.tx_index`,
+		blockNumber, repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetTransactionHashes: error getting transaction hashes: ", err)
+	}
+	return hashes, err
+}
+
+// GetHeaderForTransaction returns this node's header which includes the transaction with the provided hash
+func (repository HeaderTransactionRepository) GetHeaderForTransaction(txHash string) (core.Header, error) {
+	var header core.Header
+	err := repository.database.Get(&header,
+		`SELECT headers.id, headers.block_number, headers.hash, headers.raw, headers.raw_rlp, headers.block_timestamp
+			FROM headers
+			INNER JOIN header_transactions ON header_transactions.header_id = headers.id
+			WHERE header_transactions.tx_hash = $1 AND headers.eth_node_fingerprint = $2`,
+		txHash, repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetHeaderForTransaction: error getting header: ", err)
+	}
+	return header, err
+}
+
+func insertTransactionHashes(tx *sqlx.Tx, headerID int64, hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(
+		`INSERT INTO public.header_transactions (header_id, tx_hash, tx_index)
+		SELECT $1, hashes.tx_hash, hashes.tx_index - 1
+		FROM UNNEST($2::VARCHAR(66)[]) WITH ORDINALITY AS hashes (tx_hash, tx_index)`,
+		headerID, pq.Array(hashes))
+	return err
+}
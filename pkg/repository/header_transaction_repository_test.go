@@ -0,0 +1,93 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository_test
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/test_config"
+)
+
+var _ = Describe("Header transaction repository", func() {
+	var (
+		db         *postgres.DB
+		headerRepo repository.HeaderRepository
+		txRepo     repository.HeaderTransactionRepository
+		header     core.Header
+	)
+
+	BeforeEach(func() {
+		rawHeader, err := json.Marshal(types.Header{})
+		Expect(err).NotTo(HaveOccurred())
+		db = test_config.NewTestDB(test_config.NewTestNode())
+		test_config.CleanTestDB(db)
+		headerRepo = repository.NewHeaderRepository(db)
+		txRepo = repository.NewHeaderTransactionRepository(db)
+		header = core.Header{
+			BlockNumber:       100,
+			Hash:              "0x100",
+			Raw:               rawHeader,
+			Timestamp:         "1000",
+			TransactionHashes: []string{"0xTxOne", "0xTxTwo", "0xTxThree"},
+		}
+	})
+
+	It("persists transaction hashes in block order", func() {
+		_, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		hashes, err := txRepo.GetTransactionHashes(header.BlockNumber)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hashes).To(Equal(header.TransactionHashes))
+	})
+
+	It("returns the header including a transaction", func() {
+		headerID, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		dbHeader, err := txRepo.GetHeaderForTransaction("0xTxTwo")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dbHeader.ID).To(Equal(headerID))
+		Expect(dbHeader.Hash).To(Equal(header.Hash))
+	})
+
+	It("removes transaction hashes of a replaced header", func() {
+		_, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+		header.Hash = "0x100b"
+		header.TransactionHashes = []string{"0xTxFour"}
+		_, err = headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = txRepo.GetHeaderForTransaction("0xTxOne")
+
+		Expect(err).To(MatchError(sql.ErrNoRows))
+		hashes, err := txRepo.GetTransactionHashes(header.BlockNumber)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hashes).To(Equal([]string{"0xTxFour"}))
+	})
+})
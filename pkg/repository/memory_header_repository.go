@@ -0,0 +1,251 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
+)
+
+// MemoryStore holds the headers of MemoryHeaderRepositories, as the database does for HeaderRepositories
+// It is lost when the process exits
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	lastID  int64
+	headers map[string]map[int64]core.Header
+	pruned  map[string]int64
+}
+
+// NewMemoryStore returns a new, empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		headers: make(map[string]map[int64]core.Header),
+		pruned:  make(map[string]int64),
+	}
+}
+
+// MemoryHeaderRepository satisfies the core.HeaderRepository interface by keeping headers in a MemoryStore
+// It is meant for tests and dry runs, which should not need a database
+type MemoryHeaderRepository struct {
+	store       *MemoryStore
+	fingerprint string
+}
+
+// NewMemoryHeaderRepository returns a MemoryHeaderRepository for the headers of the node with the provided fingerprint
+func NewMemoryHeaderRepository(store *MemoryStore, fingerprint string) MemoryHeaderRepository {
+	return MemoryHeaderRepository{store: store, fingerprint: fingerprint}
+}
+
+// CreateOrUpdateHeader stores the header
+// If there is already a header at the height, it is replaced if the hash is not the expected value
+func (repository MemoryHeaderRepository) CreateOrUpdateHeader(header core.Header) (int64, error) {
+	repository.store.mutex.Lock()
+	defer repository.store.mutex.Unlock()
+	headers, ok := repository.store.headers[repository.fingerprint]
+	if !ok {
+		headers = make(map[int64]core.Header)
+		repository.store.headers[repository.fingerprint] = headers
+	}
+	stored, exists := headers[header.BlockNumber]
+	if exists && !headerMustBeReplaced(stored.Hash, header) {
+		return 0, ErrValidHeaderExists
+	}
+	repository.store.lastID++
+	header.ID = repository.store.lastID
+	headers[header.BlockNumber] = header
+	if exists {
+		metrics.Reorgs.Inc()
+	}
+	return header.ID, nil
+}
+
+// GetHeader returns this node's header at the provided height
+func (repository MemoryHeaderRepository) GetHeader(blockNumber int64) (core.Header, error) {
+	repository.store.mutex.RLock()
+	defer repository.store.mutex.RUnlock()
+	header, ok := repository.store.headers[repository.fingerprint][blockNumber]
+	if !ok {
+		return core.Header{}, sql.ErrNoRows
+	}
+	return header, nil
+}
+
+// GetHeaderByHash returns this node's header with the provided hash
+func (repository MemoryHeaderRepository) GetHeaderByHash(hash string) (core.Header, error) {
+	return repository.findHeader(func(header core.Header) bool {
+		return header.Hash == hash
+	}, func(header, found core.Header) bool {
+		return false
+	})
+}
+
+// GetHeaderAtOrBeforeTimestamp returns this node's latest header with a timestamp at or before the provided unix time
+func (repository MemoryHeaderRepository) GetHeaderAtOrBeforeTimestamp(timestamp int64) (core.Header, error) {
+	return repository.findHeaderByTimestamp(func(headerTimestamp int64) bool {
+		return headerTimestamp <= timestamp
+	}, func(headerTimestamp, foundTimestamp int64, header, found core.Header) bool {
+		return headerTimestamp > foundTimestamp || (headerTimestamp == foundTimestamp && header.BlockNumber > found.BlockNumber)
+	})
+}
+
+// GetHeaderAtOrAfterTimestamp returns this node's earliest header with a timestamp at or after the provided unix time
+func (repository MemoryHeaderRepository) GetHeaderAtOrAfterTimestamp(timestamp int64) (core.Header, error) {
+	return repository.findHeaderByTimestamp(func(headerTimestamp int64) bool {
+		return headerTimestamp >= timestamp
+	}, func(headerTimestamp, foundTimestamp int64, header, found core.Header) bool {
+		return headerTimestamp < foundTimestamp || (headerTimestamp == foundTimestamp && header.BlockNumber < found.BlockNumber)
+	})
+}
+
+// GetHeaderClosestToTimestamp returns this node's header with the timestamp nearest to the provided unix time
+// When a header before and a header after the time are equally near, the header before is returned
+func (repository MemoryHeaderRepository) GetHeaderClosestToTimestamp(timestamp int64) (core.Header, error) {
+	return GetHeaderClosestToTimestamp(repository, timestamp)
+}
+
+// GetLastBlockNumber returns the highest block number this node has a header for, or sql.ErrNoRows if there are none
+func (repository MemoryHeaderRepository) GetLastBlockNumber() (int64, error) {
+	header, err := repository.findHeader(func(header core.Header) bool {
+		return true
+	}, func(header, found core.Header) bool {
+		return header.BlockNumber > found.BlockNumber
+	})
+	return header.BlockNumber, err
+}
+
+// GetHeadersInRange returns this node's headers between the provided block numbers (inclusive) in ascending order
+func (repository MemoryHeaderRepository) GetHeadersInRange(startingBlockNumber, endingBlockNumber int64) ([]core.Header, error) {
+	return repository.selectHeaders(func(header core.Header) (bool, error) {
+		return header.BlockNumber >= startingBlockNumber && header.BlockNumber <= endingBlockNumber, nil
+	}, -1)
+}
+
+// GetHeadersInTimeRange returns up to limit of this node's headers with timestamps between the provided ones (inclusive),
+// in ascending block number order
+func (repository MemoryHeaderRepository) GetHeadersInTimeRange(startingTimestamp, endingTimestamp int64, limit int) ([]core.Header, error) {
+	return repository.selectHeaders(func(header core.Header) (bool, error) {
+		timestamp, err := header.UnixTimestamp()
+		return timestamp >= startingTimestamp && timestamp <= endingTimestamp, err
+	}, limit)
+}
+
+// MissingBlockNumbers returns the block numbers between the provided ones (inclusive) which the node with the provided
+// fingerprint has no header for, leaving out block numbers it has pruned
+func (repository MemoryHeaderRepository) MissingBlockNumbers(startingBlockNumber, endingBlockNumber int64, nodeID string) ([]int64, error) {
+	repository.store.mutex.RLock()
+	defer repository.store.mutex.RUnlock()
+	if pruned, ok := repository.store.pruned[nodeID]; ok && pruned > startingBlockNumber {
+		startingBlockNumber = pruned
+	}
+	numbers := make([]int64, 0)
+	for blockNumber := startingBlockNumber; blockNumber <= endingBlockNumber; blockNumber++ {
+		if _, ok := repository.store.headers[nodeID][blockNumber]; !ok {
+			numbers = append(numbers, blockNumber)
+		}
+	}
+	return numbers, nil
+}
+
+// PruneHeaders deletes all headers below the provided block number
+// The block number is recorded so that MissingBlockNumbers does not report the pruned range as missing
+func (repository MemoryHeaderRepository) PruneHeaders(blockNumber int64) (int64, error) {
+	repository.store.mutex.Lock()
+	defer repository.store.mutex.Unlock()
+	return repository.pruneHeaders(blockNumber), nil
+}
+
+// pruneHeaders deletes this node's headers below the block number and records it, the caller holds the store's lock
+func (repository MemoryHeaderRepository) pruneHeaders(blockNumber int64) int64 {
+	var pruned int64
+	for storedBlockNumber := range repository.store.headers[repository.fingerprint] {
+		if storedBlockNumber < blockNumber {
+			delete(repository.store.headers[repository.fingerprint], storedBlockNumber)
+			pruned++
+		}
+	}
+	if previous, ok := repository.store.pruned[repository.fingerprint]; !ok || blockNumber > previous {
+		repository.store.pruned[repository.fingerprint] = blockNumber
+	}
+	return pruned
+}
+
+// findHeader returns the header matching the filter which is preferred over every other match, or sql.ErrNoRows
+func (repository MemoryHeaderRepository) findHeader(matches func(header core.Header) bool, preferred func(header, found core.Header) bool) (core.Header, error) {
+	repository.store.mutex.RLock()
+	defer repository.store.mutex.RUnlock()
+	var found core.Header
+	ok := false
+	for _, header := range repository.store.headers[repository.fingerprint] {
+		if matches(header) && (!ok || preferred(header, found)) {
+			found = header
+			ok = true
+		}
+	}
+	if !ok {
+		return core.Header{}, sql.ErrNoRows
+	}
+	return found, nil
+}
+
+// findHeaderByTimestamp is findHeader for filters and preferences on the headers' unix timestamps
+func (repository MemoryHeaderRepository) findHeaderByTimestamp(matches func(headerTimestamp int64) bool, preferred func(headerTimestamp, foundTimestamp int64, header, found core.Header) bool) (core.Header, error) {
+	var err error
+	header, findErr := repository.findHeader(func(header core.Header) bool {
+		headerTimestamp, parseErr := header.UnixTimestamp()
+		if parseErr != nil {
+			err = parseErr
+			return false
+		}
+		return matches(headerTimestamp)
+	}, func(header, found core.Header) bool {
+		headerTimestamp, _ := header.UnixTimestamp()
+		foundTimestamp, _ := found.UnixTimestamp()
+		return preferred(headerTimestamp, foundTimestamp, header, found)
+	})
+	if err != nil {
+		return core.Header{}, err
+	}
+	return header, findErr
+}
+
+// selectHeaders returns up to limit of this node's headers matching the filter in ascending block number order,
+// a negative limit returns every match
+func (repository MemoryHeaderRepository) selectHeaders(matches func(header core.Header) (bool, error), limit int) ([]core.Header, error) {
+	repository.store.mutex.RLock()
+	defer repository.store.mutex.RUnlock()
+	headers := make([]core.Header, 0)
+	for _, header := range repository.store.headers[repository.fingerprint] {
+		match, err := matches(header)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			headers = append(headers, header)
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].BlockNumber < headers[j].BlockNumber
+	})
+	if limit >= 0 && len(headers) > limit {
+		headers = headers[:limit]
+	}
+	return headers, nil
+}
@@ -0,0 +1,66 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+)
+
+// UncleRepository reads the uncles stored alongside their including headers
+// Uncles are written by the HeaderRepository in the same transaction as their header
+type UncleRepository struct {
+	database *postgres.DB
+}
+
+// NewUncleRepository returns a new UncleRepository
+func NewUncleRepository(database *postgres.DB) UncleRepository {
+	return UncleRepository{database: database}
+}
+
+// GetUncles returns the uncles included by this node's header at the provided height
+func (repository UncleRepository) GetUncles(blockNumber int64) ([]core.Uncle, error) {
+	uncles := make([]core.Uncle, 0)
+	err := repository.database.Select(&uncles,
+		`SELECT uncles.id, uncles.header_id, uncles.block_number, uncles.hash, uncles.uncle_index, uncles.miner,
+			uncles.raw, uncles.raw_rlp, uncles.block_timestamp
+			FROM uncles
+			INNER JOIN headers ON uncles.header_id = headers.id
+			WHERE headers.block_number = $1 AND headers.eth_node_fingerprint = $2
+			ORDER BY uncles.uncle_index`,
+		blockNumber, repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetUncles: error getting uncles: ", err)
+	}
+	return uncles, err
+}
+
+func insertUncles(tx *sqlx.Tx, headerID int64, uncles []core.Uncle) error {
+	for _, uncle := range uncles {
+		_, err := tx.Exec(
+			`INSERT INTO public.uncles (header_id, block_number, hash, uncle_index, miner, raw, raw_rlp, block_timestamp)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8::NUMERIC)`,
+			headerID, uncle.BlockNumber, uncle.Hash, uncle.Index, uncle.Miner, uncle.Raw, uncle.RLP, uncle.Timestamp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package repository_test
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/postgres"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+	"github.com/vulcanize/eth-header-sync/test_config"
+)
+
+var _ = Describe("Uncle repository", func() {
+	var (
+		db         *postgres.DB
+		headerRepo repository.HeaderRepository
+		uncleRepo  repository.UncleRepository
+		header     core.Header
+	)
+
+	BeforeEach(func() {
+		rawHeader, err := json.Marshal(types.Header{})
+		Expect(err).NotTo(HaveOccurred())
+		db = test_config.NewTestDB(test_config.NewTestNode())
+		test_config.CleanTestDB(db)
+		headerRepo = repository.NewHeaderRepository(db)
+		uncleRepo = repository.NewUncleRepository(db)
+		header = core.Header{
+			BlockNumber: 100,
+			Hash:        "0x100",
+			Raw:         rawHeader,
+			Timestamp:   "1000",
+			Uncles: []core.Uncle{
+				{BlockNumber: 99, Hash: "0x99a", Index: 0, Miner: "0xMinerOne", Raw: rawHeader, Timestamp: "990"},
+				{BlockNumber: 98, Hash: "0x98a", Index: 1, Miner: "0xMinerTwo", Raw: rawHeader, Timestamp: "980"},
+			},
+		}
+	})
+
+	It("persists uncles alongside their header", func() {
+		headerID, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		uncles, err := uncleRepo.GetUncles(header.BlockNumber)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(uncles)).To(Equal(2))
+		Expect(uncles[0].HeaderID).To(Equal(headerID))
+		Expect(uncles[0].BlockNumber).To(Equal(int64(99)))
+		Expect(uncles[0].Miner).To(Equal("0xMinerOne"))
+		Expect(uncles[1].Index).To(Equal(int64(1)))
+		Expect(uncles[1].Timestamp).To(Equal("980"))
+	})
+
+	It("replaces uncles when their header is replaced", func() {
+		_, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+		header.Hash = "0x100b"
+		header.Uncles = header.Uncles[1:]
+
+		_, err = headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		uncles, err := uncleRepo.GetUncles(header.BlockNumber)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(uncles)).To(Equal(1))
+		Expect(uncles[0].Hash).To(Equal("0x98a"))
+		var uncleCount int
+		err = db.Get(&uncleCount, `SELECT COUNT(*) FROM uncles`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uncleCount).To(Equal(1))
+	})
+
+	It("deletes uncles when their header is pruned", func() {
+		_, err := headerRepo.CreateOrUpdateHeader(header)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = headerRepo.PruneHeaders(header.BlockNumber + 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		var uncleCount int
+		err = db.Get(&uncleCount, `SELECT COUNT(*) FROM uncles`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uncleCount).To(BeZero())
+	})
+})
@@ -0,0 +1,337 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rest
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/api"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+const (
+	// PathPrefix is the path the handler serves headers under
+	PathPrefix = "/headers"
+
+	defaultLimit = 100
+	maxLimit     = 1000
+
+	// finalizedCacheControl lets clients and proxies cache finalized headers, which no longer change
+	finalizedCacheControl = "public, max-age=86400"
+	// chainHeadTTL is how long the head of the chain is reused for, rather than asking the node on every request
+	// A stale head only makes fewer headers finalized
+	chainHeadTTL = time.Second
+)
+
+var errNotFound = errors.New("header not found")
+
+// ChainHead reports the block number of the head of the chain, it is satisfied by a core.Fetcher
+type ChainHead interface {
+	LastBlock() (*big.Int, error)
+}
+
+// Handler serves read-only header lookups from the header repository
+// Headers at least finalityDepth blocks below the head of the chain are considered finalized, and are served with an
+// ETag and cache headers; without a chain head nothing is considered finalized
+type Handler struct {
+	headerRepository core.HeaderRepository
+	chainHead        ChainHead
+	finalityDepth    int64
+
+	headMutex  sync.Mutex
+	head       int64
+	headExpiry time.Time
+}
+
+// HeaderPage is a page of headers in a range, NextCursor is set when there are more headers in the range
+type HeaderPage struct {
+	Headers    []map[string]interface{} `json:"headers"`
+	NextCursor string                   `json:"nextCursor,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns a Handler reading from the header repository, the chain head may be nil
+func NewHandler(headerRepository core.HeaderRepository, chainHead ChainHead, finalityDepth int64) *Handler {
+	return &Handler{headerRepository: headerRepository, chainHead: chainHead, finalityDepth: finalityDepth}
+}
+
+// ServeHTTP routes GET requests for:
+//
+//	/headers/{number}
+//	/headers/by-hash/{hash}
+//	/headers/at-time/{unix}
+//	/headers?from=&to=&limit=&cursor=
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+	segments := strings.Split(path, "/")
+	switch {
+	case path == "":
+		handler.serveRange(w, r)
+	case len(segments) == 1:
+		number, err := strconv.ParseInt(segments[0], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid block number %q", segments[0]))
+			return
+		}
+		handler.serveHeader(w, r, func() (core.Header, error) { return handler.headerRepository.GetHeader(number) }, handler.isHeaderFinalized)
+	case len(segments) == 2 && segments[0] == "by-hash":
+		hash := strings.ToLower(segments[1])
+		handler.serveHeader(w, r, func() (core.Header, error) { return handler.headerRepository.GetHeaderByHash(hash) }, handler.isHeaderFinalized)
+	case len(segments) == 2 && segments[0] == "at-time":
+		timestamp, err := strconv.ParseInt(segments[1], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid unix time %q", segments[1]))
+			return
+		}
+		handler.serveHeader(w, r, func() (core.Header, error) {
+			return handler.headerRepository.GetHeaderAtOrBeforeTimestamp(timestamp)
+		}, handler.isNextHeaderFinalized)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// serveHeader writes the header returned by getHeader, with cache headers if isCacheable reports that the response can
+// no longer change
+func (handler *Handler) serveHeader(w http.ResponseWriter, r *http.Request, getHeader func() (core.Header, error),
+	isCacheable func(core.Header) (bool, error)) {
+	header, err := getHeader()
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	body, err := api.MarshalHeader(header)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cacheable, err := isCacheable(header)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if cacheable && writeCacheHeaders(w, r, header.Hash) {
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// isHeaderFinalized returns whether the header is finalized, so that a lookup returning it no longer changes
+func (handler *Handler) isHeaderFinalized(header core.Header) (bool, error) {
+	return handler.isFinalized(header.BlockNumber)
+}
+
+// isNextHeaderFinalized returns whether the header following the one returned for a time is stored and finalized
+// Until then a header at a later block number, which may still be synced or reorged, could be the one at the time
+func (handler *Handler) isNextHeaderFinalized(header core.Header) (bool, error) {
+	finalized, err := handler.isFinalized(header.BlockNumber + 1)
+	if err != nil || !finalized {
+		return false, err
+	}
+	_, err = handler.headerRepository.GetHeader(header.BlockNumber + 1)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (handler *Handler) serveRange(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := parseOptionalInt(query.Get("from"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid from: %s", err.Error()))
+		return
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		from, err = decodeCursor(cursor)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid cursor: %s", err.Error()))
+			return
+		}
+	}
+	limit, err := parseOptionalInt(query.Get("limit"), defaultLimit)
+	if err != nil || limit <= 0 || limit > maxLimit {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxLimit))
+		return
+	}
+	lastBlockNumber, err := handler.headerRepository.GetLastBlockNumber()
+	if err == sql.ErrNoRows {
+		writeJSON(w, http.StatusOK, HeaderPage{Headers: []map[string]interface{}{}})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	to, err := parseOptionalInt(query.Get("to"), lastBlockNumber)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid to: %s", err.Error()))
+		return
+	}
+	if to > lastBlockNumber {
+		to = lastBlockNumber
+	}
+
+	// The page covers up to limit block numbers, it holds fewer headers if some of them are not stored
+	end := from + limit - 1
+	if end > to {
+		end = to
+	}
+	page := HeaderPage{Headers: []map[string]interface{}{}}
+	var hashes []string
+	if end >= from {
+		headers, err := handler.headerRepository.GetHeadersInRange(from, end)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, header := range headers {
+			body, err := api.MarshalHeader(header)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			page.Headers = append(page.Headers, body)
+			hashes = append(hashes, header.Hash)
+		}
+	}
+	if end < to {
+		page.NextCursor = encodeCursor(end + 1)
+	}
+	// A page missing headers changes once they are synced, so only complete pages are cacheable
+	complete := end >= from && int64(len(hashes)) == end-from+1
+	if complete {
+		finalized, err := handler.isFinalized(end)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if finalized && writeCacheHeaders(w, r, pageTag(from, end, hashes, page.NextCursor)) {
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// isFinalized returns whether the block number is at least finalityDepth blocks below the head of the chain
+func (handler *Handler) isFinalized(blockNumber int64) (bool, error) {
+	if handler.chainHead == nil {
+		return false, nil
+	}
+	chainHead, err := handler.getChainHead()
+	if err != nil {
+		log.Error("isFinalized: error getting the chain head: ", err)
+		return false, err
+	}
+	return blockNumber <= chainHead-handler.finalityDepth, nil
+}
+
+// getChainHead returns the block number of the head of the chain, asking the node at most once every chainHeadTTL
+func (handler *Handler) getChainHead() (int64, error) {
+	handler.headMutex.Lock()
+	defer handler.headMutex.Unlock()
+	if time.Now().Before(handler.headExpiry) {
+		return handler.head, nil
+	}
+	chainHead, err := handler.chainHead.LastBlock()
+	if err != nil {
+		return 0, err
+	}
+	handler.head = chainHead.Int64()
+	handler.headExpiry = time.Now().Add(chainHeadTTL)
+	return handler.head, nil
+}
+
+// writeCacheHeaders sets the ETag and cache headers for a finalized response
+// It returns true, having written a 304 response, if the request's If-None-Match matches the ETag
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, tag string) bool {
+	etag := `"` + tag + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", finalizedCacheControl)
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(match) == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// pageTag identifies a range page by its range, the hashes of its headers and its next cursor
+func pageTag(from, to int64, hashes []string, nextCursor string) string {
+	digest := sha256.New()
+	fmt.Fprintf(digest, "%d-%d-%s", from, to, nextCursor)
+	for _, hash := range hashes {
+		digest.Write([]byte(hash))
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// Cursors are the block number a page starts at, they are opaque to clients so that the encoding can change
+func encodeCursor(blockNumber int64) string {
+	return strconv.FormatInt(blockNumber, 36)
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	return strconv.ParseInt(cursor, 36, 64)
+}
+
+func parseOptionalInt(value string, defaultValue int64) (int64, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error("rest: error writing response: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Error("rest: error serving request: ", err)
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,250 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rest_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/rest"
+)
+
+func storedHeader(number int64) core.Header {
+	gethHeader := &types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(10), Time: uint64(1000 + 15*number), Extra: []byte{}}
+	raw, err := json.Marshal(gethHeader)
+	Expect(err).NotTo(HaveOccurred())
+	return core.Header{
+		BlockNumber: number,
+		Hash:        gethHeader.Hash().Hex(),
+		Raw:         raw,
+		Timestamp:   strconv.FormatUint(gethHeader.Time, 10),
+	}
+}
+
+// countingChainHead counts the requests for the head of the chain
+type countingChainHead struct {
+	calls int
+}
+
+func (chainHead *countingChainHead) LastBlock() (*big.Int, error) {
+	chainHead.calls++
+	return big.NewInt(20), nil
+}
+
+var _ = Describe("REST handler", func() {
+	var (
+		headers    []core.Header
+		repository *fakes.MockHeaderRepository
+		chainHead  *fakes.MockFetcher
+		handler    *rest.Handler
+	)
+
+	BeforeEach(func() {
+		headers = nil
+		for number := int64(0); number <= 20; number++ {
+			if number != 5 {
+				headers = append(headers, storedHeader(number))
+			}
+		}
+		repository = fakes.NewMockHeaderRepository()
+		repository.SetStoredHeaders(headers...)
+		chainHead = fakes.NewMockFetcher()
+		chainHead.SetLastBlock(big.NewInt(20))
+		handler = rest.NewHandler(repository, chainHead, 10)
+	})
+
+	get := func(path string, requestHeaders ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(requestHeaders); i += 2 {
+			req.Header.Set(requestHeaders[i], requestHeaders[i+1])
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	decode := func(recorder *httptest.ResponseRecorder, body interface{}) {
+		Expect(json.Unmarshal(recorder.Body.Bytes(), body)).To(Succeed())
+	}
+
+	It("returns a header by number", func() {
+		recorder := get("/headers/3")
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var body map[string]interface{}
+		decode(recorder, &body)
+		Expect(body["hash"]).To(Equal(headers[3].Hash))
+		Expect(body["number"]).To(Equal("0x3"))
+	})
+
+	It("returns a header by hash", func() {
+		recorder := get("/headers/by-hash/" + headers[7].Hash)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var body map[string]interface{}
+		decode(recorder, &body)
+		Expect(body["number"]).To(Equal("0x8"))
+	})
+
+	It("returns the header at or before a unix time", func() {
+		recorder := get("/headers/at-time/1079")
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var body map[string]interface{}
+		decode(recorder, &body)
+		Expect(body["number"]).To(Equal("0x4"))
+	})
+
+	It("returns not found for headers which are not stored", func() {
+		Expect(get("/headers/5").Code).To(Equal(http.StatusNotFound))
+		Expect(get("/headers/at-time/999").Code).To(Equal(http.StatusNotFound))
+		Expect(get("/headers/by-hash/0x00").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects invalid requests", func() {
+		Expect(get("/headers/abc").Code).To(Equal(http.StatusBadRequest))
+		Expect(get("/headers?limit=5000").Code).To(Equal(http.StatusBadRequest))
+		Expect(get("/headers/a/b/c").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns repository errors", func() {
+		repository.SetGetHeaderError(fakes.FakeError)
+
+		Expect(get("/headers/1").Code).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("sets an ETag on finalized headers and honours If-None-Match", func() {
+		recorder := get("/headers/3")
+		etag := recorder.Header().Get("ETag")
+		Expect(etag).To(Equal(`"` + headers[3].Hash + `"`))
+		Expect(recorder.Header().Get("Cache-Control")).NotTo(BeEmpty())
+
+		Expect(get("/headers/3", "If-None-Match", etag).Code).To(Equal(http.StatusNotModified))
+	})
+
+	It("does not set an ETag on headers which are not finalized", func() {
+		recorder := get("/headers/15")
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("ETag")).To(BeEmpty())
+	})
+
+	It("considers headers finalized relative to the head of the chain rather than the highest stored header", func() {
+		chainHead.SetLastBlock(big.NewInt(25))
+
+		Expect(get("/headers/15").Header().Get("ETag")).NotTo(BeEmpty())
+		Expect(get("/headers/16").Header().Get("ETag")).To(BeEmpty())
+	})
+
+	It("only sets an ETag on the header at a time once the header after it is stored and finalized", func() {
+		Expect(get("/headers/at-time/1050").Header().Get("ETag")).To(Equal(`"` + headers[3].Hash + `"`))
+		// Block 5 is not stored, a header synced for it later could be the one at the time
+		Expect(get("/headers/at-time/1079").Header().Get("ETag")).To(BeEmpty())
+		Expect(get("/headers/at-time/1149").Header().Get("ETag")).NotTo(BeEmpty())
+		// Block 11 is not finalized
+		Expect(get("/headers/at-time/1150").Header().Get("ETag")).To(BeEmpty())
+	})
+
+	It("reuses the head of the chain for a short interval", func() {
+		counting := &countingChainHead{}
+		handler = rest.NewHandler(repository, counting, 10)
+
+		Expect(get("/headers/3").Header().Get("ETag")).NotTo(BeEmpty())
+		Expect(get("/headers/4").Header().Get("ETag")).NotTo(BeEmpty())
+		Expect(get("/headers?from=6&to=9").Code).To(Equal(http.StatusOK))
+
+		Expect(counting.calls).To(Equal(1))
+	})
+
+	It("does not consider headers finalized without a chain head", func() {
+		handler = rest.NewHandler(repository, nil, 10)
+
+		Expect(get("/headers/3").Header().Get("ETag")).To(BeEmpty())
+		Expect(get("/headers?from=6&to=9").Header().Get("ETag")).To(BeEmpty())
+	})
+
+	It("returns chain head errors", func() {
+		chainHead.SetLastBlockErr(fakes.FakeError)
+
+		Expect(get("/headers/3").Code).To(Equal(http.StatusInternalServerError))
+	})
+
+	Describe("ranges", func() {
+		numbers := func(page rest.HeaderPage) []string {
+			var result []string
+			for _, header := range page.Headers {
+				result = append(result, header["number"].(string))
+			}
+			return result
+		}
+
+		It("pages through a range with cursors", func() {
+			var page rest.HeaderPage
+			decode(get("/headers?from=2&to=9&limit=4"), &page)
+			Expect(numbers(page)).To(Equal([]string{"0x2", "0x3", "0x4"}))
+			Expect(page.NextCursor).NotTo(BeEmpty())
+
+			var nextPage rest.HeaderPage
+			decode(get("/headers?to=9&limit=4&cursor="+page.NextCursor), &nextPage)
+			Expect(numbers(nextPage)).To(Equal([]string{"0x6", "0x7", "0x8", "0x9"}))
+			Expect(nextPage.NextCursor).To(BeEmpty())
+		})
+
+		It("defaults to the highest stored header", func() {
+			var page rest.HeaderPage
+			decode(get("/headers?from=18"), &page)
+
+			Expect(numbers(page)).To(Equal([]string{"0x12", "0x13", "0x14"}))
+			Expect(page.NextCursor).To(BeEmpty())
+		})
+
+		It("sets an ETag on finalized pages", func() {
+			recorder := get("/headers?from=6&to=9")
+			etag := recorder.Header().Get("ETag")
+			Expect(etag).NotTo(BeEmpty())
+			Expect(get("/headers?from=6&to=9", "If-None-Match", etag).Code).To(Equal(http.StatusNotModified))
+
+			Expect(get("/headers?from=6&to=15").Header().Get("ETag")).To(BeEmpty())
+		})
+
+		It("does not set an ETag on pages missing headers", func() {
+			recorder := get("/headers?from=0&to=9")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("ETag")).To(BeEmpty())
+		})
+
+		It("returns an empty page when no headers are stored", func() {
+			repository.SetStoredHeaders()
+			var page rest.HeaderPage
+			recorder := get("/headers")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			decode(recorder, &page)
+			Expect(page.Headers).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,499 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package simulated provides a deterministic in-process chain, served through core.EthClient and core.RPCClient,
+// whose reorgs, missing blocks and node errors are scripted by tests
+// Its blocks include transactions and uncles, so that the fetcher's body paths are exercised as well as its headers
+package simulated
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/vulcanize/eth-header-sync/pkg/client"
+)
+
+const (
+	// GenesisTime is the timestamp of the genesis header, each following header is BlockTime seconds later
+	GenesisTime = 1438269973
+	BlockTime   = 15
+	difficulty  = 131072
+	gasLimit    = 8000000
+)
+
+var (
+	ErrNotSupported = errors.New("not supported by the simulated chain")
+	ErrReorgTooDeep = errors.New("reorg is deeper than the chain")
+)
+
+// Chain is a simulated chain of correctly hash-linked headers
+// Every block from block 1 includes its block number modulo 3 transactions, and every even block from block 2 includes
+// an uncle, a sibling of its parent, with the headers' transaction roots and uncle hashes derived from them
+// It is safe for concurrent use
+type Chain struct {
+	mutex       sync.Mutex
+	headers     []*types.Header
+	bodies      []body
+	forks       uint64
+	missing     map[int64]bool
+	errs        map[string]error
+	subscribers map[chan *types.Header]bool
+}
+
+// body holds the transactions and uncles of a block
+type body struct {
+	transactions types.Transactions
+	uncles       []*types.Header
+}
+
+// subscriptionBuffer is the number of new heads buffered for a subscriber, heads are dropped for slower subscribers
+const subscriptionBuffer = 64
+
+// NewChain returns a chain with headers from genesis up to the head block number
+func NewChain(head int64) *Chain {
+	chain := &Chain{missing: make(map[int64]bool), errs: make(map[string]error), subscribers: make(map[chan *types.Header]bool)}
+	chain.extend(head + 1)
+	return chain
+}
+
+// Head returns the block number of the head of the chain
+func (chain *Chain) Head() int64 {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.head()
+}
+
+// Header returns the canonical header at the block number, or nil if it is beyond the head
+// Missing blocks are still returned, they are only hidden from the clients
+func (chain *Chain) Header(blockNumber int64) *types.Header {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if blockNumber < 0 || blockNumber > chain.head() {
+		return nil
+	}
+	return types.CopyHeader(chain.headers[blockNumber])
+}
+
+// Extend mines count new headers on the head of the chain
+func (chain *Chain) Extend(count int64) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	chain.extend(count)
+}
+
+// Uncles returns the uncles included by the canonical block at the block number, or nil if it is beyond the head
+func (chain *Chain) Uncles(blockNumber int64) []*types.Header {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if blockNumber < 0 || blockNumber > chain.head() {
+		return nil
+	}
+	uncles := make([]*types.Header, len(chain.bodies[blockNumber].uncles))
+	for i, uncle := range chain.bodies[blockNumber].uncles {
+		uncles[i] = types.CopyHeader(uncle)
+	}
+	return uncles
+}
+
+// Transactions returns the transactions of the canonical block at the block number, or nil if it is beyond the head
+func (chain *Chain) Transactions(blockNumber int64) types.Transactions {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if blockNumber < 0 || blockNumber > chain.head() {
+		return nil
+	}
+	return chain.bodies[blockNumber].transactions
+}
+
+// Reorg replaces the last depth headers of the chain with length headers of a new fork
+// The new fork shares the headers below the reorged ones, every header from the fork point on has a new hash
+func (chain *Chain) Reorg(depth, length int64) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if depth < 0 || depth > chain.head() {
+		return ErrReorgTooDeep
+	}
+	chain.headers = chain.headers[:int64(len(chain.headers))-depth]
+	chain.bodies = chain.bodies[:len(chain.headers)]
+	chain.forks++
+	chain.extend(length)
+	return nil
+}
+
+// SetMissing sets whether the node behaves as if it does not have the block, answering requests for it with null
+func (chain *Chain) SetMissing(blockNumber int64, missing bool) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if missing {
+		chain.missing[blockNumber] = true
+	} else {
+		delete(chain.missing, blockNumber)
+	}
+}
+
+// SetError makes requests for the RPC method, or for every method if it is empty, fail with err until it is set to nil
+// Requests through the EthClient methods are failed as eth_getBlockByNumber requests
+func (chain *Chain) SetError(method string, err error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if err == nil {
+		delete(chain.errs, method)
+	} else {
+		chain.errs[method] = err
+	}
+}
+
+// SubscribeNewHeads returns a channel receiving every header added to the chain, including those of reorgs
+// The returned function ends the subscription
+func (chain *Chain) SubscribeNewHeads() (<-chan *types.Header, func()) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	heads := make(chan *types.Header, subscriptionBuffer)
+	chain.subscribers[heads] = true
+	return heads, func() {
+		chain.mutex.Lock()
+		defer chain.mutex.Unlock()
+		delete(chain.subscribers, heads)
+	}
+}
+
+func (chain *Chain) head() int64 {
+	return int64(len(chain.headers)) - 1
+}
+
+func (chain *Chain) extend(count int64) {
+	for i := int64(0); i < count; i++ {
+		header, body := chain.makeBlock()
+		chain.headers = append(chain.headers, header)
+		chain.bodies = append(chain.bodies, body)
+		for subscriber := range chain.subscribers {
+			select {
+			case subscriber <- types.CopyHeader(header):
+			default:
+			}
+		}
+	}
+}
+
+// makeBlock returns the block following the head of the chain, or the genesis block if the chain is empty
+// Blocks of different forks are told apart by their extra data, so they have different hashes at the same height
+func (chain *Chain) makeBlock() (*types.Header, body) {
+	var parent *types.Header
+	if len(chain.headers) > 0 {
+		parent = chain.headers[len(chain.headers)-1]
+	}
+	header := chain.makeHeader(parent, 0)
+	var block body
+	if parent == nil {
+		return header, block
+	}
+	number := header.Number.Int64()
+	for nonce := int64(0); nonce < number%3; nonce++ {
+		tx := types.NewTransaction(uint64(nonce), header.Coinbase, big.NewInt(nonce), 21000, big.NewInt(1), header.Extra)
+		block.transactions = append(block.transactions, tx)
+	}
+	if number >= 2 && number%2 == 0 {
+		block.uncles = []*types.Header{chain.makeHeader(chain.headers[number-2], 1)}
+	}
+	header.TxHash = types.DeriveSha(block.transactions)
+	header.UncleHash = types.CalcUncleHash(block.uncles)
+	return header, block
+}
+
+// makeHeader returns the header following the parent, or the genesis header if the parent is nil
+// Siblings are numbered from 1, their headers differ from the canonical one in their extra data, time and coinbase
+func (chain *Chain) makeHeader(parent *types.Header, sibling uint64) *types.Header {
+	header := &types.Header{
+		UncleHash:   types.EmptyUncleHash,
+		Root:        types.EmptyRootHash,
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  big.NewInt(difficulty),
+		Number:      big.NewInt(0),
+		GasLimit:    gasLimit,
+		Time:        GenesisTime,
+		Extra:       make([]byte, 8),
+	}
+	binary.BigEndian.PutUint64(header.Extra, chain.forks)
+	if sibling > 0 {
+		header.Extra = append(header.Extra, byte(sibling))
+	}
+	if parent != nil {
+		header.ParentHash = parent.Hash()
+		header.Number = new(big.Int).Add(parent.Number, big.NewInt(1))
+		header.Time = parent.Time + BlockTime + sibling
+		header.Coinbase = common.BigToAddress(new(big.Int).Add(header.Number, new(big.Int).SetUint64(sibling<<32)))
+	}
+	return header
+}
+
+// lookup returns the header for an RPC block number argument, or nil if the node does not have it
+func (chain *Chain) lookup(blockNumber *big.Int) *types.Header {
+	number := chain.head()
+	if blockNumber != nil {
+		number = blockNumber.Int64()
+	}
+	if number < 0 || number > chain.head() || chain.missing[number] {
+		return nil
+	}
+	return types.CopyHeader(chain.headers[number])
+}
+
+// lookupBody returns the body of the block for an RPC block number argument, or nil if the node does not have it
+func (chain *Chain) lookupBody(blockNumber *big.Int) *body {
+	header := chain.lookup(blockNumber)
+	if header == nil {
+		return nil
+	}
+	return &chain.bodies[header.Number.Int64()]
+}
+
+// lookupHash returns the body of the canonical block with the hash, or nil if the node does not have it
+func (chain *Chain) lookupHash(hash common.Hash) *body {
+	for number, header := range chain.headers {
+		if header.Hash() == hash && !chain.missing[int64(number)] {
+			return &chain.bodies[number]
+		}
+	}
+	return nil
+}
+
+func (chain *Chain) err(method string) error {
+	if err, ok := chain.errs[method]; ok {
+		return err
+	}
+	return chain.errs[""]
+}
+
+// HeaderByNumber returns the header at the block number, or the head if it is nil
+func (chain *Chain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if err := chain.err("eth_getBlockByNumber"); err != nil {
+		return nil, err
+	}
+	header := chain.lookup(number)
+	if header == nil {
+		return nil, ethereum.NotFound
+	}
+	return header, nil
+}
+
+// BlockByNumber returns the block at the block number, or the head if it is nil
+func (chain *Chain) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	header, err := chain.HeaderByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	transactions, uncles := chain.Transactions(header.Number.Int64()), chain.Uncles(header.Number.Int64())
+	return types.NewBlockWithHeader(header).WithBody(transactions, uncles), nil
+}
+
+func (chain *Chain) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+func (chain *Chain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return nil, nil
+}
+
+func (chain *Chain) TransactionSender(ctx context.Context, tx *types.Transaction, block common.Hash, index uint) (common.Address, error) {
+	return common.Address{}, ErrNotSupported
+}
+
+func (chain *Chain) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return nil, ethereum.NotFound
+}
+
+func (chain *Chain) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return big.NewInt(0), nil
+}
+
+// CallContext answers the request as a node would, decoding the JSON response into result
+func (chain *Chain) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	response, err := chain.respond(method, args...)
+	if err != nil {
+		return err
+	}
+	return decode(response, result)
+}
+
+// respond returns the JSON response to the request, or the error scripted for its method
+func (chain *Chain) respond(method string, args ...interface{}) (json.RawMessage, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if err := chain.err(method); err != nil {
+		return nil, err
+	}
+	return chain.call(method, args)
+}
+
+// BatchCall answers each request of the batch, failing the whole batch if any of its methods is set to fail
+func (chain *Chain) BatchCall(batch []client.BatchElem) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	for _, elem := range batch {
+		if err := chain.err(elem.Method); err != nil {
+			return err
+		}
+	}
+	for i := range batch {
+		response, err := chain.call(batch[i].Method, batch[i].Args)
+		if err == nil {
+			err = decode(response, batch[i].Result)
+		}
+		batch[i].Error = err
+	}
+	return nil
+}
+
+func (chain *Chain) RPCPath() string {
+	return "simulated"
+}
+
+func (chain *Chain) SupportedModules() (map[string]string, error) {
+	return map[string]string{"eth": "1.0", "net": "1.0", "web3": "1.0"}, nil
+}
+
+func (chain *Chain) Subscribe(namespace string, payloadChan interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	return nil, ErrNotSupported
+}
+
+// call returns the JSON response to the request
+func (chain *Chain) call(method string, args []interface{}) (json.RawMessage, error) {
+	switch method {
+	case "eth_blockNumber":
+		return json.Marshal(hexutil.Uint64(chain.head()))
+	case "eth_getBlockByNumber":
+		blockNumber, err := blockNumberArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return marshalBlock(chain.lookup(blockNumber), chain.lookupBody(blockNumber))
+	case "eth_getUncleCountByBlockNumber":
+		blockNumber, err := blockNumberArg(args)
+		if err != nil {
+			return nil, err
+		}
+		block := chain.lookupBody(blockNumber)
+		if block == nil {
+			return json.RawMessage("null"), nil
+		}
+		return json.Marshal(hexutil.Uint(len(block.uncles)))
+	case "eth_getUncleByBlockNumberAndIndex":
+		blockNumber, err := blockNumberArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return marshalUncle(chain.lookupBody(blockNumber), args)
+	case "eth_getUncleByBlockHashAndIndex":
+		var hash common.Hash
+		if err := decodeArg(args, 0, &hash); err != nil {
+			return nil, err
+		}
+		return marshalUncle(chain.lookupHash(hash), args)
+	default:
+		return nil, fmt.Errorf("the method %s does not exist/is not available", method)
+	}
+}
+
+// blockNumberArg parses the block number argument of a request, nil stands for the latest block
+func blockNumberArg(args []interface{}) (*big.Int, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing block number argument")
+	}
+	arg, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid block number argument %v", args[0])
+	}
+	switch arg {
+	case "latest", "pending":
+		return nil, nil
+	case "earliest":
+		return big.NewInt(0), nil
+	}
+	return hexutil.DecodeBig(arg)
+}
+
+// decodeArg decodes the argument at the index into arg, arguments are Go values when the chain is called directly and
+// JSON values when it is called through the Server
+func decodeArg(args []interface{}, index int, arg interface{}) error {
+	if len(args) <= index {
+		return fmt.Errorf("missing argument %d", index)
+	}
+	encoded, err := json.Marshal(args[index])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, arg)
+}
+
+// marshalUncle returns the response to a request for the uncle of the block at the index in its second argument
+func marshalUncle(block *body, args []interface{}) (json.RawMessage, error) {
+	var index hexutil.Uint
+	if err := decodeArg(args, 1, &index); err != nil {
+		return nil, err
+	}
+	if block == nil || int(index) >= len(block.uncles) {
+		return json.RawMessage("null"), nil
+	}
+	return json.Marshal(block.uncles[index])
+}
+
+// marshalBlock returns the eth_getBlockByNumber response for the header, listing the hashes of the body's transactions
+// and uncles
+func marshalBlock(header *types.Header, block *body) (json.RawMessage, error) {
+	if header == nil {
+		return json.RawMessage("null"), nil
+	}
+	encoded, err := header.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	transactions := make([]common.Hash, len(block.transactions))
+	for i, tx := range block.transactions {
+		transactions[i] = tx.Hash()
+	}
+	uncles := make([]common.Hash, len(block.uncles))
+	for i, uncle := range block.uncles {
+		uncles[i] = uncle.Hash()
+	}
+	fields["transactions"] = transactions
+	fields["uncles"] = uncles
+	return json.Marshal(fields)
+}
+
+func decode(response json.RawMessage, result interface{}) error {
+	if result == nil || string(response) == "null" {
+		return nil
+	}
+	return json.Unmarshal(response, result)
+}
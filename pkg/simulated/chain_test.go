@@ -0,0 +1,223 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package simulated_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/fetcher"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+var (
+	_ core.EthClient = (*simulated.Chain)(nil)
+	_ core.RPCClient = (*simulated.Chain)(nil)
+)
+
+var _ = Describe("Simulated chain", func() {
+	var (
+		chain *simulated.Chain
+		fetch *fetcher.Fetcher
+	)
+
+	BeforeEach(func() {
+		chain = simulated.NewChain(10)
+		fetch = fetcher.NewFetcher(chain, chain, core.Node{})
+	})
+
+	It("generates deterministic, hash-linked headers", func() {
+		Expect(chain.Head()).To(Equal(int64(10)))
+		for number := int64(1); number <= 10; number++ {
+			Expect(chain.Header(number).ParentHash).To(Equal(chain.Header(number - 1).Hash()))
+			Expect(chain.Header(number).Time).To(Equal(chain.Header(number-1).Time + simulated.BlockTime))
+		}
+		Expect(chain.Header(10).Hash()).To(Equal(simulated.NewChain(10).Header(10).Hash()))
+		Expect(chain.Header(11)).To(BeNil())
+	})
+
+	It("extends the chain from the head", func() {
+		head := chain.Header(10).Hash()
+
+		chain.Extend(2)
+
+		Expect(chain.Head()).To(Equal(int64(12)))
+		Expect(chain.Header(10).Hash()).To(Equal(head))
+		Expect(chain.Header(11).ParentHash).To(Equal(head))
+	})
+
+	It("replaces the reorged headers with a new fork", func() {
+		before := make(map[int64]*types.Header)
+		for number := int64(0); number <= 10; number++ {
+			before[number] = chain.Header(number)
+		}
+
+		Expect(chain.Reorg(3, 5)).To(Succeed())
+
+		Expect(chain.Head()).To(Equal(int64(12)))
+		for number := int64(0); number <= 7; number++ {
+			Expect(chain.Header(number).Hash()).To(Equal(before[number].Hash()))
+		}
+		for number := int64(8); number <= 10; number++ {
+			Expect(chain.Header(number).Hash()).NotTo(Equal(before[number].Hash()))
+		}
+		Expect(chain.Header(8).ParentHash).To(Equal(before[7].Hash()))
+		Expect(chain.Reorg(20, 1)).To(MatchError(simulated.ErrReorgTooDeep))
+	})
+
+	It("gives each fork at a height a different hash", func() {
+		Expect(chain.Reorg(1, 1)).To(Succeed())
+		first := chain.Header(10).Hash()
+
+		Expect(chain.Reorg(1, 1)).To(Succeed())
+
+		Expect(chain.Header(10).Hash()).NotTo(Equal(first))
+	})
+
+	It("serves headers to the fetcher", func() {
+		lastBlock, err := fetch.LastBlock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastBlock.Int64()).To(Equal(int64(10)))
+
+		header, err := fetch.GetHeaderByNumber(4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal(chain.Header(4).Hash().Hex()))
+
+		headers, err := fetch.GetHeadersByNumbers([]int64{3, 4, 5})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(3))
+		for i, header := range headers {
+			Expect(header.BlockNumber).To(Equal(int64(3 + i)))
+			Expect(header.Hash).To(Equal(chain.Header(header.BlockNumber).Hash().Hex()))
+		}
+	})
+
+	It("includes transactions and uncles matching the headers' roots", func() {
+		for number := int64(1); number <= 10; number++ {
+			Expect(chain.Transactions(number)).To(HaveLen(int(number % 3)))
+			Expect(types.DeriveSha(chain.Transactions(number))).To(Equal(chain.Header(number).TxHash))
+			Expect(types.CalcUncleHash(chain.Uncles(number))).To(Equal(chain.Header(number).UncleHash))
+		}
+		Expect(chain.Uncles(3)).To(BeEmpty())
+		uncle := chain.Uncles(4)[0]
+		Expect(uncle.Number.Int64()).To(Equal(int64(3)))
+		Expect(uncle.ParentHash).To(Equal(chain.Header(2).Hash()))
+		Expect(uncle.Hash()).NotTo(Equal(chain.Header(3).Hash()))
+
+		block, err := chain.BlockByNumber(context.Background(), big.NewInt(4))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(block.Hash()).To(Equal(chain.Header(4).Hash()))
+		Expect(block.Transactions()).To(HaveLen(1))
+		Expect(block.Uncles()).To(HaveLen(1))
+	})
+
+	It("serves uncles and transaction hashes to the fetcher", func() {
+		fetch.SetFetchUncles(true)
+		fetch.SetFetchTransactionHashes(true)
+
+		headers, err := fetch.GetHeadersByNumbers([]int64{4, 5})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(2))
+		Expect(headers[0].Uncles).To(HaveLen(1))
+		Expect(headers[0].Uncles[0].Hash).To(Equal(chain.Uncles(4)[0].Hash().Hex()))
+		Expect(headers[0].Uncles[0].BlockNumber).To(Equal(int64(3)))
+		Expect(headers[0].TransactionHashes).To(Equal([]string{chain.Transactions(4)[0].Hash().Hex()}))
+		Expect(headers[1].Uncles).To(BeEmpty())
+		Expect(headers[1].TransactionHashes).To(HaveLen(2))
+
+		header, err := fetch.GetHeaderByNumber(6)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Uncles).To(HaveLen(1))
+		Expect(header.Uncles[0].Hash).To(Equal(chain.Uncles(6)[0].Hash().Hex()))
+	})
+
+	It("answers uncle requests by block number and by block hash", func() {
+		var count hexutil.Uint
+		Expect(chain.CallContext(context.Background(), &count, "eth_getUncleCountByBlockNumber", "0x4")).To(Succeed())
+		Expect(count).To(Equal(hexutil.Uint(1)))
+
+		var byNumber, byHash types.Header
+		Expect(chain.CallContext(context.Background(), &byNumber, "eth_getUncleByBlockNumberAndIndex", "0x4", hexutil.Uint(0))).To(Succeed())
+		Expect(chain.CallContext(context.Background(), &byHash, "eth_getUncleByBlockHashAndIndex", chain.Header(4).Hash(), hexutil.Uint(0))).To(Succeed())
+		Expect(byNumber.Hash()).To(Equal(chain.Uncles(4)[0].Hash()))
+		Expect(byHash.Hash()).To(Equal(chain.Uncles(4)[0].Hash()))
+
+		var missing *types.Header
+		Expect(chain.CallContext(context.Background(), &missing, "eth_getUncleByBlockHashAndIndex", chain.Header(4).Hash(), hexutil.Uint(1))).To(Succeed())
+		Expect(missing).To(BeNil())
+	})
+
+	It("answers requests for blocks beyond the head and missing blocks with null", func() {
+		chain.SetMissing(4, true)
+
+		headers, err := fetch.GetHeadersByNumbers([]int64{3, 4, 5, 11})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(2))
+		_, err = chain.HeaderByNumber(context.Background(), big.NewInt(4))
+		Expect(err).To(MatchError(ethereum.NotFound))
+
+		chain.SetMissing(4, false)
+		headers, err = fetch.GetHeadersByNumbers([]int64{3, 4, 5})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(3))
+	})
+
+	It("fails requests with the scripted errors", func() {
+		chain.SetError("eth_getBlockByNumber", fakes.FakeError)
+
+		_, err := fetch.LastBlock()
+		Expect(err).To(MatchError(fakes.FakeError))
+		_, err = fetch.GetHeadersByNumbers([]int64{1, 2})
+		Expect(err).To(MatchError(fakes.FakeError))
+		var blockNumber hexutil.Uint64
+		Expect(chain.CallContext(context.Background(), &blockNumber, "eth_blockNumber")).To(Succeed())
+		Expect(uint64(blockNumber)).To(Equal(uint64(10)))
+
+		chain.SetError("eth_getBlockByNumber", nil)
+		chain.SetError("", fakes.FakeError)
+		Expect(chain.CallContext(context.Background(), &blockNumber, "eth_blockNumber")).To(MatchError(fakes.FakeError))
+
+		chain.SetError("", nil)
+		_, err = fetch.LastBlock()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns blocks with their header fields", func() {
+		var block map[string]interface{}
+		Expect(chain.CallContext(context.Background(), &block, "eth_getBlockByNumber", "0x2", false)).To(Succeed())
+		Expect(block["hash"]).To(Equal(chain.Header(2).Hash().Hex()))
+		Expect(block["transactions"]).To(Equal([]interface{}{
+			chain.Transactions(2)[0].Hash().Hex(),
+			chain.Transactions(2)[1].Hash().Hex(),
+		}))
+		Expect(block["uncles"]).To(Equal([]interface{}{chain.Uncles(2)[0].Hash().Hex()}))
+
+		var raw json.RawMessage
+		Expect(chain.CallContext(context.Background(), &raw, "eth_getBlockByNumber", "latest", false)).To(Succeed())
+		Expect(string(raw)).To(ContainSubstring(chain.Header(10).Hash().Hex()))
+	})
+})
@@ -0,0 +1,154 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package simulated
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/api"
+)
+
+// NetworkID is the network id reported by the simulated node
+const NetworkID = "1"
+
+// Server serves a Chain over HTTP and websocket JSON-RPC, answering single and batch requests as a node would
+// and notifying eth_subscribe("newHeads") subscribers of every header added to the chain
+type Server struct {
+	rpcServer  *rpc.Server
+	listener   net.Listener
+	httpServer *http.Server
+}
+
+// NewServer starts serving the chain on the address, an address with port 0 listens on a random port
+func NewServer(chain *Chain, addr string) (*Server, error) {
+	rpcServer := rpc.NewServer()
+	services := map[string]interface{}{
+		"eth":  &ethAPI{chain: chain},
+		"net":  netAPI{},
+		"web3": web3API{},
+	}
+	for namespace, service := range services {
+		if err := rpcServer.RegisterName(namespace, service); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &Server{
+		rpcServer:  rpcServer,
+		listener:   listener,
+		httpServer: &http.Server{Handler: api.NewHandler(rpcServer, []string{"*"})},
+	}
+	go func() {
+		if err := server.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("simulated: error serving: ", err)
+		}
+	}()
+	return server, nil
+}
+
+// URL returns the http:// url of the server
+func (server *Server) URL() string {
+	return "http://" + server.listener.Addr().String()
+}
+
+// WSURL returns the ws:// url of the server
+func (server *Server) WSURL() string {
+	return "ws://" + server.listener.Addr().String()
+}
+
+// Close stops the server, ending its subscriptions
+func (server *Server) Close() error {
+	server.rpcServer.Stop()
+	return server.httpServer.Close()
+}
+
+type ethAPI struct {
+	chain *Chain
+}
+
+func (api *ethAPI) BlockNumber() (json.RawMessage, error) {
+	return api.chain.respond("eth_blockNumber")
+}
+
+func (api *ethAPI) GetBlockByNumber(number string, fullTransactions bool) (json.RawMessage, error) {
+	return api.chain.respond("eth_getBlockByNumber", number, fullTransactions)
+}
+
+func (api *ethAPI) GetUncleCountByBlockNumber(number string) (json.RawMessage, error) {
+	return api.chain.respond("eth_getUncleCountByBlockNumber", number)
+}
+
+func (api *ethAPI) GetUncleByBlockNumberAndIndex(number string, index hexutil.Uint) (json.RawMessage, error) {
+	return api.chain.respond("eth_getUncleByBlockNumberAndIndex", number, index)
+}
+
+func (api *ethAPI) GetUncleByBlockHashAndIndex(hash common.Hash, index hexutil.Uint) (json.RawMessage, error) {
+	return api.chain.respond("eth_getUncleByBlockHashAndIndex", hash, index)
+}
+
+func (api *ethAPI) Syncing() bool {
+	return false
+}
+
+// NewHeads notifies the subscriber of every header added to the chain
+func (api *ethAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	heads, unsubscribe := api.chain.SubscribeNewHeads()
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case head := <-heads:
+				if err := notifier.Notify(subscription.ID, head); err != nil {
+					return
+				}
+			case <-subscription.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return subscription, nil
+}
+
+type netAPI struct{}
+
+func (netAPI) Version() string {
+	return NetworkID
+}
+
+type web3API struct{}
+
+func (web3API) ClientVersion() string {
+	return "Simulated/v1.0.0"
+}
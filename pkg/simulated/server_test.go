@@ -0,0 +1,131 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package simulated_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/client"
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/fetcher"
+	"github.com/vulcanize/eth-header-sync/pkg/simulated"
+)
+
+var _ = Describe("Simulated node server", func() {
+	var (
+		chain  *simulated.Chain
+		server *simulated.Server
+	)
+
+	BeforeEach(func() {
+		var err error
+		chain = simulated.NewChain(20)
+		server, err = simulated.NewServer(chain, "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(server.Close()).To(Succeed())
+	})
+
+	dial := func(url string) (*rpc.Client, *fetcher.Fetcher) {
+		rawClient, err := rpc.Dial(url)
+		Expect(err).NotTo(HaveOccurred())
+		fetch := fetcher.NewFetcher(ethclient.NewClient(rawClient), client.NewRPCClient(rawClient, url), core.Node{})
+		return rawClient, fetch
+	}
+
+	It("serves single and batch requests over HTTP", func() {
+		rawClient, fetch := dial(server.URL())
+		defer rawClient.Close()
+
+		lastBlock, err := fetch.LastBlock()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastBlock.Int64()).To(Equal(int64(20)))
+
+		header, err := fetch.GetHeaderByNumber(7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal(chain.Header(7).Hash().Hex()))
+
+		chain.SetMissing(9, true)
+		headers, err := fetch.GetHeadersByNumbers([]int64{8, 9, 10, 21})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(2))
+		Expect(headers[1].Hash).To(Equal(chain.Header(10).Hash().Hex()))
+
+		var version string
+		Expect(rawClient.Call(&version, "net_version")).To(Succeed())
+		Expect(version).To(Equal(simulated.NetworkID))
+	})
+
+	It("serves the uncles and transaction hashes of blocks over HTTP", func() {
+		rawClient, fetch := dial(server.URL())
+		defer rawClient.Close()
+		fetch.SetFetchUncles(true)
+		fetch.SetFetchTransactionHashes(true)
+
+		headers, err := fetch.GetHeadersByNumbers([]int64{7, 8})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(HaveLen(2))
+		Expect(headers[0].Uncles).To(BeEmpty())
+		Expect(headers[0].TransactionHashes).To(Equal([]string{chain.Transactions(7)[0].Hash().Hex()}))
+		Expect(headers[1].Uncles).To(HaveLen(1))
+		Expect(headers[1].Uncles[0].Hash).To(Equal(chain.Uncles(8)[0].Hash().Hex()))
+		Expect(headers[1].TransactionHashes).To(HaveLen(2))
+	})
+
+	It("returns scripted node errors as JSON-RPC errors", func() {
+		rawClient, fetch := dial(server.URL())
+		defer rawClient.Close()
+		chain.SetError("eth_getBlockByNumber", fakes.FakeError)
+
+		_, err := fetch.LastBlock()
+
+		Expect(err).To(MatchError(fakes.FakeError.Error()))
+	})
+
+	It("notifies websocket subscribers of new heads, including those of reorgs", func() {
+		rawClient, err := rpc.Dial(server.WSURL())
+		Expect(err).NotTo(HaveOccurred())
+		defer rawClient.Close()
+		heads := make(chan *types.Header)
+		subscription, err := ethclient.NewClient(rawClient).SubscribeNewHead(context.Background(), heads)
+		Expect(err).NotTo(HaveOccurred())
+		defer subscription.Unsubscribe()
+
+		chain.Extend(1)
+		var head *types.Header
+		Eventually(heads, time.Second).Should(Receive(&head))
+		Expect(head.Hash()).To(Equal(chain.Header(21).Hash()))
+
+		Expect(chain.Reorg(2, 2)).To(Succeed())
+		Eventually(heads, time.Second).Should(Receive(&head))
+		Expect(head.Number.Int64()).To(Equal(int64(20)))
+		Expect(head.Hash()).To(Equal(chain.Header(20).Hash()))
+		Eventually(heads, time.Second).Should(Receive(&head))
+		Expect(head.Hash()).To(Equal(chain.Header(21).Hash()))
+	})
+})
@@ -0,0 +1,35 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sink
+
+import (
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// MultiSink sends each header event to every one of its sinks
+type MultiSink []core.HeaderSink
+
+// Send sends the event to every sink, returning the first error encountered
+func (sinks MultiSink) Send(event core.HeaderEvent) error {
+	var firstErr error
+	for _, sink := range sinks {
+		if err := sink.Send(event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,202 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sink
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body, prefixed with "sha256="
+	SignatureHeader = "X-Signature-256"
+
+	defaultRetries  = 3
+	initialBackoff  = 500 * time.Millisecond
+	maxBackoff      = 30 * time.Second
+	webhookTimeout  = 10 * time.Second
+	queueSize       = 1000
+	queueTimeout    = 5 * time.Second
+	signaturePrefix = "sha256="
+	jsonContentType = "application/json"
+)
+
+var (
+	ErrSinkClosed = errors.New("webhook sink is closed")
+	ErrQueueFull  = errors.New("webhook queue stayed full, header event dropped")
+)
+
+// WebhookSink POSTs each header event as JSON to a URL
+// Events are queued and posted in order by a background goroutine, so that a slow or failing webhook does not hold up
+// the sync; once the queue is full, sending waits a while for room so that the sync slows down to the webhook's pace,
+// but an event which still finds no room is dropped so that an unreachable webhook cannot stall the sync
+// Requests which fail or receive a 5xx response are retried with exponential backoff
+type WebhookSink struct {
+	url     string
+	secret  []byte
+	retries int
+	backoff time.Duration
+	timeout time.Duration
+	client  *http.Client
+	queue   chan []byte
+	done    chan struct{}
+	mutex   sync.RWMutex
+	closed  bool
+}
+
+// NewWebhookSink returns a WebhookSink posting to the provided URL, and starts posting the events it is sent
+// If secret is not empty, each request is signed with it in the SignatureHeader
+// A negative number of retries uses the default
+func NewWebhookSink(url, secret string, retries int) *WebhookSink {
+	if retries < 0 {
+		retries = defaultRetries
+	}
+	sink := &WebhookSink{
+		url:     url,
+		secret:  []byte(secret),
+		retries: retries,
+		backoff: initialBackoff,
+		timeout: queueTimeout,
+		client:  &http.Client{Timeout: webhookTimeout},
+		queue:   make(chan []byte, queueSize),
+		done:    make(chan struct{}),
+	}
+	go sink.deliver()
+	return sink
+}
+
+// SetBackoff sets the delay before the first retry, it doubles for each following retry
+func (sink *WebhookSink) SetBackoff(backoff time.Duration) {
+	sink.backoff = backoff
+}
+
+// SetQueueTimeout sets how long sending waits for room in a full queue before dropping the event
+func (sink *WebhookSink) SetQueueTimeout(timeout time.Duration) {
+	sink.timeout = timeout
+}
+
+// Send queues the event to be posted, waiting for room if the queue is full
+// Failures to post it are logged, ErrSinkClosed is returned if the sink has been closed and ErrQueueFull if the event
+// was dropped because the queue stayed full
+func (sink *WebhookSink) Send(event core.HeaderEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// The read lock is held while waiting so that Close cannot close the queue under a pending send,
+	// the background goroutine keeps draining the queue without it
+	sink.mutex.RLock()
+	defer sink.mutex.RUnlock()
+	if sink.closed {
+		return ErrSinkClosed
+	}
+	select {
+	case sink.queue <- body:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(sink.timeout)
+	defer timer.Stop()
+	select {
+	case sink.queue <- body:
+		return nil
+	case <-timer.C:
+		metrics.DroppedHeaderEvents.Inc()
+		return fmt.Errorf("%w after %s", ErrQueueFull, sink.timeout)
+	}
+}
+
+// Close stops accepting events and waits for the queued ones to be posted
+func (sink *WebhookSink) Close() error {
+	sink.mutex.Lock()
+	if !sink.closed {
+		sink.closed = true
+		close(sink.queue)
+	}
+	sink.mutex.Unlock()
+	<-sink.done
+	return nil
+}
+
+// deliver posts the queued events until the sink is closed
+func (sink *WebhookSink) deliver() {
+	defer close(sink.done)
+	for body := range sink.queue {
+		if err := sink.send(body); err != nil {
+			log.Error("WebhookSink: giving up on header event: ", err)
+		}
+	}
+}
+
+// send posts the body, returning the last error once all retries are used up
+func (sink *WebhookSink) send(body []byte) error {
+	backoff := sink.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := sink.post(body)
+		if !retry || attempt >= sink.retries {
+			return err
+		}
+		log.Warnf("WebhookSink: attempt %d failed, retrying in %s: %s", attempt+1, backoff, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post sends a single request, returning whether it should be retried
+func (sink *WebhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", jsonContentType)
+	if len(sink.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(sink.secret, body))
+	}
+	res, err := sink.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		// Client errors will not succeed on retry
+		return res.StatusCode >= http.StatusInternalServerError, fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+	return false, nil
+}
+
+// Sign returns the SignatureHeader value for the body signed with the secret
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
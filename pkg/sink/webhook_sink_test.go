@@ -0,0 +1,184 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sink_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
+	"github.com/vulcanize/eth-header-sync/pkg/sink"
+)
+
+var _ = Describe("Webhook sink", func() {
+	var (
+		event    = core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 100, Hash: "0x100", Fingerprint: "x123"}
+		server   *httptest.Server
+		statuses []int
+		requests int32
+		bodies   chan []byte
+		sigs     chan string
+	)
+
+	BeforeEach(func() {
+		statuses = []int{http.StatusOK}
+		requests = 0
+		bodies = make(chan []byte, 10)
+		sigs = make(chan string, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&requests, 1)
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies <- body
+			sigs <- r.Header.Get(sink.SignatureHeader)
+			status := statuses[len(statuses)-1]
+			if int(n) <= len(statuses) {
+				status = statuses[n-1]
+			}
+			w.WriteHeader(status)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("posts the event as JSON signed with the secret", func() {
+		webhook := sink.NewWebhookSink(server.URL, "secret", 0)
+
+		err := webhook.Send(event)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(webhook.Close()).To(Succeed())
+		body := <-bodies
+		var received core.HeaderEvent
+		Expect(json.Unmarshal(body, &received)).To(Succeed())
+		Expect(received).To(Equal(event))
+		Expect(<-sigs).To(Equal(sink.Sign([]byte("secret"), body)))
+	})
+
+	It("does not sign requests without a secret", func() {
+		webhook := sink.NewWebhookSink(server.URL, "", 0)
+
+		Expect(webhook.Send(event)).To(Succeed())
+		Expect(webhook.Close()).To(Succeed())
+		Expect(<-sigs).To(BeEmpty())
+	})
+
+	It("retries server errors", func() {
+		statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}
+		webhook := sink.NewWebhookSink(server.URL, "", 3)
+		webhook.SetBackoff(time.Millisecond)
+
+		err := webhook.Send(event)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(webhook.Close()).To(Succeed())
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(3)))
+	})
+
+	It("gives up once retries are used up and posts the next event", func() {
+		statuses = []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK}
+		webhook := sink.NewWebhookSink(server.URL, "", 2)
+		webhook.SetBackoff(time.Millisecond)
+
+		Expect(webhook.Send(event)).To(Succeed())
+		Expect(webhook.Send(core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 101})).To(Succeed())
+
+		Expect(webhook.Close()).To(Succeed())
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(4)))
+	})
+
+	It("does not retry client errors", func() {
+		statuses = []int{http.StatusBadRequest}
+		webhook := sink.NewWebhookSink(server.URL, "", 2)
+		webhook.SetBackoff(time.Millisecond)
+
+		Expect(webhook.Send(event)).To(Succeed())
+
+		Expect(webhook.Close()).To(Succeed())
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+	})
+
+	It("waits for room in the queue rather than dropping events", func() {
+		var delivered int32
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			atomic.AddInt32(&delivered, 1)
+		}))
+		defer slow.Close()
+		webhook := sink.NewWebhookSink(slow.URL, "", 0)
+		total := 1500
+		sent := make(chan error)
+		go func() {
+			for i := 0; i < total; i++ {
+				if err := webhook.Send(event); err != nil {
+					sent <- err
+					return
+				}
+			}
+			sent <- nil
+		}()
+
+		Consistently(sent, 100*time.Millisecond).ShouldNot(Receive())
+		close(release)
+		Eventually(sent, 10*time.Second).Should(Receive(BeNil()))
+		Expect(webhook.Close()).To(Succeed())
+		Expect(atomic.LoadInt32(&delivered)).To(Equal(int32(total)))
+	})
+
+	It("drops events and counts them once the queue stays full", func() {
+		release := make(chan struct{})
+		stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer stalled.Close()
+		webhook := sink.NewWebhookSink(stalled.URL, "", 0)
+		webhook.SetQueueTimeout(10 * time.Millisecond)
+		dropped := testutil.ToFloat64(metrics.DroppedHeaderEvents)
+
+		// The queue holds queueSize events, along with the one being posted
+		var err error
+		for sent := 0; sent <= 1001 && err == nil; sent++ {
+			err = webhook.Send(event)
+		}
+
+		Expect(errors.Is(err, sink.ErrQueueFull)).To(BeTrue())
+		Expect(testutil.ToFloat64(metrics.DroppedHeaderEvents) - dropped).To(Equal(float64(1)))
+		close(release)
+		Expect(webhook.Close()).To(Succeed())
+	})
+
+	It("does not accept events once closed", func() {
+		webhook := sink.NewWebhookSink(server.URL, "", 0)
+		Expect(webhook.Close()).To(Succeed())
+
+		err := webhook.Send(event)
+
+		Expect(err).To(MatchError(sink.ErrSinkClosed))
+	})
+})
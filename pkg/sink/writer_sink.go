@@ -0,0 +1,54 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sink
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// WriterSink writes each header event to an io.Writer as a line of JSON (NDJSON)
+type WriterSink struct {
+	writer io.Writer
+	lock   sync.Mutex
+}
+
+// NewWriterSink returns a WriterSink writing to the provided writer
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{writer: writer}
+}
+
+// NewStdoutSink returns a WriterSink writing to stdout
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+// Send writes the event as a single line
+func (sink *WriterSink) Send(event core.HeaderEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	_, err = sink.writer.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,82 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sink_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/fakes"
+	"github.com/vulcanize/eth-header-sync/pkg/sink"
+)
+
+var _ = Describe("Writer sinks", func() {
+	var (
+		inserted = core.HeaderEvent{Type: core.HeaderInserted, BlockNumber: 100, Hash: "0x100", Fingerprint: "x123"}
+		replaced = core.HeaderEvent{Type: core.HeaderReplaced, BlockNumber: 100, Hash: "0x101", PreviousHash: "0x100", Fingerprint: "x123"}
+		expected = `{"type":"insert","blockNumber":100,"hash":"0x100","fingerprint":"x123"}
+{"type":"replace","blockNumber":100,"hash":"0x101","previousHash":"0x100","fingerprint":"x123"}
+`
+	)
+
+	It("writes each event as a line of JSON", func() {
+		var buffer bytes.Buffer
+		writer := sink.NewWriterSink(&buffer)
+
+		Expect(writer.Send(inserted)).To(Succeed())
+		Expect(writer.Send(replaced)).To(Succeed())
+
+		Expect(buffer.String()).To(Equal(expected))
+	})
+
+	It("appends events to a file", func() {
+		dir, err := ioutil.TempDir("", "sink")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "events.ndjson")
+
+		file, err := sink.NewFileSink(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Send(inserted)).To(Succeed())
+		Expect(file.Close()).To(Succeed())
+		file, err = sink.NewFileSink(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Send(replaced)).To(Succeed())
+		Expect(file.Close()).To(Succeed())
+
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal(expected))
+	})
+
+	It("sends events to every sink in a multi sink", func() {
+		first := fakes.NewMockHeaderSink()
+		second := fakes.NewMockHeaderSink()
+		second.SetSendErr(fakes.FakeError)
+
+		err := sink.MultiSink{second, first}.Send(inserted)
+
+		Expect(err).To(MatchError(fakes.FakeError))
+		Expect(first.Events).To(Equal([]core.HeaderEvent{inserted}))
+	})
+})
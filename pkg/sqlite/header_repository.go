@@ -0,0 +1,417 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/metrics"
+	"github.com/vulcanize/eth-header-sync/pkg/repository"
+)
+
+const headerColumns = `id, block_number, hash, raw, raw_rlp, block_timestamp`
+
+// The repository package is aliased here as the receivers of this package, named repository as there, shadow it
+var (
+	// ErrValidHeaderExists is returned for a header which is already stored, as by repository.HeaderRepository
+	ErrValidHeaderExists        = repository.ErrValidHeaderExists
+	getHeaderClosestToTimestamp = repository.GetHeaderClosestToTimestamp
+)
+
+// HeaderRepository satisfies the core.HeaderRepository interface with a SQLite database
+// It stores the same rows as the Postgres repository.HeaderRepository, but does not publish header events
+type HeaderRepository struct {
+	database *DB
+}
+
+// NewHeaderRepository returns a new HeaderRepository
+func NewHeaderRepository(database *DB) HeaderRepository {
+	return HeaderRepository{database: database}
+}
+
+// NewHeaderRepositoryForFingerprint returns a HeaderRepository for the headers synced by the node with the provided fingerprint
+func NewHeaderRepositoryForFingerprint(database *DB, fingerprint string) HeaderRepository {
+	nodeDatabase := *database
+	nodeDatabase.Node.ID = fingerprint
+	return HeaderRepository{database: &nodeDatabase}
+}
+
+// CreateOrUpdateHeader inserts a header model into the db
+// If there is already a header at the height, it is replaced if the hash is not the expected value
+func (repository HeaderRepository) CreateOrUpdateHeader(header core.Header) (int64, error) {
+	var hash string
+	err := repository.database.Get(&hash, `SELECT hash FROM headers WHERE block_number = ? AND eth_node_fingerprint = ?`,
+		header.BlockNumber, repository.database.Node.ID)
+	if err == sql.ErrNoRows {
+		defer metrics.ObserveDBWrite("insert", time.Now())
+		return repository.writeHeader(header, false)
+	}
+	if err != nil {
+		log.Error("CreateOrUpdateHeader: error getting header hash: ", err)
+		return 0, err
+	}
+	if hash == header.Hash {
+		return 0, ErrValidHeaderExists
+	}
+	defer metrics.ObserveDBWrite("replace", time.Now())
+	headerID, err := repository.writeHeader(header, true)
+	if err == nil {
+		metrics.Reorgs.Inc()
+	}
+	return headerID, err
+}
+
+// CreateOrUpdateHeaders inserts the headers in one transaction, replacing stored headers whose hash is not the
+// expected value, and returns the number of headers inserted or replaced
+// Headers which are already stored are skipped
+func (repository HeaderRepository) CreateOrUpdateHeaders(headers []core.Header) (int64, error) {
+	if len(headers) == 0 {
+		return 0, nil
+	}
+	defer metrics.ObserveDBWrite("batch", time.Now())
+	stored, err := repository.getHeaderHashes(headers)
+	if err != nil {
+		log.Error("CreateOrUpdateHeaders: error getting header hashes: ", err)
+		return 0, err
+	}
+	tx, err := repository.database.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	var written, replaced int64
+	for _, header := range headers {
+		hash, exists := stored[header.BlockNumber]
+		if exists && hash == header.Hash {
+			continue
+		}
+		if exists {
+			if _, err = repository.deleteHeaders(tx, "=", header.BlockNumber); err != nil {
+				log.Error("CreateOrUpdateHeaders: error deleting headers: ", err)
+				rollback(tx)
+				return 0, err
+			}
+			replaced++
+		}
+		_, err = repository.insertHeader(tx, header)
+		if err == ErrValidHeaderExists {
+			continue
+		}
+		if err != nil {
+			rollback(tx)
+			return 0, err
+		}
+		written++
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	metrics.Reorgs.Add(float64(replaced))
+	return written, nil
+}
+
+// getHeaderHashes returns the hashes of this node's stored headers at the heights of the provided headers by block number
+func (repository HeaderRepository) getHeaderHashes(headers []core.Header) (map[int64]string, error) {
+	numbers := make([]int64, len(headers))
+	for i, header := range headers {
+		numbers[i] = header.BlockNumber
+	}
+	query, args, err := sqlx.In(`SELECT block_number, hash FROM headers WHERE block_number IN (?) AND eth_node_fingerprint = ?`,
+		numbers, repository.database.Node.ID)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		BlockNumber int64 `db:"block_number"`
+		Hash        string
+	}
+	if err := repository.database.Select(&rows, query, args...); err != nil {
+		return nil, err
+	}
+	hashes := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		hashes[row.BlockNumber] = row.Hash
+	}
+	return hashes, nil
+}
+
+func (repository HeaderRepository) GetHeader(blockNumber int64) (core.Header, error) {
+	return repository.getHeader(`WHERE block_number = ? AND eth_node_fingerprint = ?`, blockNumber, repository.database.Node.ID)
+}
+
+// GetHeaderByHash returns this node's header with the provided hash
+func (repository HeaderRepository) GetHeaderByHash(hash string) (core.Header, error) {
+	return repository.getHeader(`WHERE hash = ? AND eth_node_fingerprint = ?`, hash, repository.database.Node.ID)
+}
+
+// GetHeaderAtOrBeforeTimestamp returns this node's latest header with a timestamp at or before the provided unix time
+func (repository HeaderRepository) GetHeaderAtOrBeforeTimestamp(timestamp int64) (core.Header, error) {
+	return repository.getHeader(`WHERE block_timestamp <= ? AND eth_node_fingerprint = ?
+			ORDER BY block_timestamp DESC, block_number DESC LIMIT 1`, timestamp, repository.database.Node.ID)
+}
+
+// GetHeaderAtOrAfterTimestamp returns this node's earliest header with a timestamp at or after the provided unix time
+func (repository HeaderRepository) GetHeaderAtOrAfterTimestamp(timestamp int64) (core.Header, error) {
+	return repository.getHeader(`WHERE block_timestamp >= ? AND eth_node_fingerprint = ?
+			ORDER BY block_timestamp ASC, block_number ASC LIMIT 1`, timestamp, repository.database.Node.ID)
+}
+
+// GetHeaderClosestToTimestamp returns this node's header with the timestamp nearest to the provided unix time
+// When a header before and a header after the time are equally near, the header before is returned
+func (repository HeaderRepository) GetHeaderClosestToTimestamp(timestamp int64) (core.Header, error) {
+	return getHeaderClosestToTimestamp(repository, timestamp)
+}
+
+// GetLastBlockNumber returns the highest block number this node has a header for, or sql.ErrNoRows if there are none
+func (repository HeaderRepository) GetLastBlockNumber() (int64, error) {
+	var blockNumber sql.NullInt64
+	err := repository.database.Get(&blockNumber, `SELECT MAX(block_number) FROM headers WHERE eth_node_fingerprint = ?`,
+		repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetLastBlockNumber: error getting last block number: ", err)
+		return 0, err
+	}
+	if !blockNumber.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return blockNumber.Int64, nil
+}
+
+// GetHeadersInRange returns this node's headers between the provided block numbers (inclusive) in ascending order
+func (repository HeaderRepository) GetHeadersInRange(startingBlockNumber, endingBlockNumber int64) ([]core.Header, error) {
+	headers := make([]core.Header, 0)
+	err := repository.database.Select(&headers,
+		`SELECT `+headerColumns+` FROM headers
+			WHERE block_number BETWEEN ? AND ? AND eth_node_fingerprint = ?
+			ORDER BY block_number`,
+		startingBlockNumber, endingBlockNumber, repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetHeadersInRange: error getting headers: ", err)
+	}
+	return headers, err
+}
+
+// GetUncles returns the uncles included by this node's header at the provided height
+func (repository HeaderRepository) GetUncles(blockNumber int64) ([]core.Uncle, error) {
+	uncles := make([]core.Uncle, 0)
+	err := repository.database.Select(&uncles,
+		`SELECT uncles.id, uncles.header_id, uncles.block_number, uncles.hash, uncles.uncle_index, uncles.miner,
+			uncles.raw, uncles.raw_rlp, uncles.block_timestamp
+			FROM uncles
+			INNER JOIN headers ON uncles.header_id = headers.id
+			WHERE headers.block_number = ? AND headers.eth_node_fingerprint = ?
+			ORDER BY uncles.uncle_index`,
+		blockNumber, repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetUncles: error getting uncles: ", err)
+	}
+	return uncles, err
+}
+
+// GetTransactionHashes returns the hashes of the transactions in this node's header at the provided height, in block order
+func (repository HeaderRepository) GetTransactionHashes(blockNumber int64) ([]string, error) {
+	hashes := make([]string, 0)
+	err := repository.database.Select(&hashes,
+		`SELECT header_transactions.tx_hash
+			FROM header_transactions
+			INNER JOIN headers ON header_transactions.header_id = headers.id
+			WHERE headers.block_number = ? AND headers.eth_node_fingerprint = ?
+			ORDER BY header_transactions.tx_index`,
+		blockNumber, repository.database.Node.ID)
+	if err != nil {
+		log.Error("GetTransactionHashes: error getting transaction hashes: ", err)
+	}
+	return hashes, err
+}
+
+// GetHeadersInTimeRange returns up to limit of this node's headers with timestamps between the provided ones (inclusive),
+// in ascending block number order
+func (repository HeaderRepository) GetHeadersInTimeRange(startingTimestamp, endingTimestamp int64, limit int) ([]core.Header, error) {
+	headers := make([]core.Header, 0)
+	err := repository.database.Select(&headers,
+		`SELECT `+headerColumns+` FROM headers
+			WHERE block_timestamp BETWEEN ? AND ? AND eth_node_fingerprint = ?
+			ORDER BY block_number LIMIT ?`,
+		startingTimestamp, endingTimestamp, repository.database.Node.ID, limit)
+	if err != nil {
+		log.Error("GetHeadersInTimeRange: error getting headers: ", err)
+	}
+	return headers, err
+}
+
+// MissingBlockNumbers returns the block numbers between the provided ones (inclusive) which the node with the provided
+// fingerprint has no header for, leaving out block numbers it has pruned
+// SQLite has no generate_series, the gaps between the stored block numbers are filled in while scanning them instead
+func (repository HeaderRepository) MissingBlockNumbers(startingBlockNumber, endingBlockNumber int64, nodeID string) ([]int64, error) {
+	var pruned sql.NullInt64
+	err := repository.database.Get(&pruned, `SELECT MAX(block_number) FROM pruned_headers WHERE eth_node_fingerprint = ?`, nodeID)
+	if err != nil {
+		log.Error("MissingBlockNumbers: error getting pruned block number: ", err)
+		return []int64{}, err
+	}
+	if pruned.Valid && pruned.Int64 > startingBlockNumber {
+		startingBlockNumber = pruned.Int64
+	}
+	rows, err := repository.database.Query(
+		`SELECT block_number FROM headers WHERE block_number BETWEEN ? AND ? AND eth_node_fingerprint = ? ORDER BY block_number`,
+		startingBlockNumber, endingBlockNumber, nodeID)
+	if err != nil {
+		log.Errorf("MissingBlockNumbers failed to get blocks between %v - %v for node %v",
+			startingBlockNumber, endingBlockNumber, nodeID)
+		return []int64{}, err
+	}
+	defer rows.Close()
+	numbers := make([]int64, 0)
+	next := startingBlockNumber
+	for rows.Next() {
+		var blockNumber int64
+		if err := rows.Scan(&blockNumber); err != nil {
+			return []int64{}, err
+		}
+		for ; next < blockNumber; next++ {
+			numbers = append(numbers, next)
+		}
+		next = blockNumber + 1
+	}
+	if err := rows.Err(); err != nil {
+		return []int64{}, err
+	}
+	for ; next <= endingBlockNumber; next++ {
+		numbers = append(numbers, next)
+	}
+	return numbers, nil
+}
+
+// PruneHeaders deletes all headers below the provided block number
+// The block number is recorded so that MissingBlockNumbers does not report the pruned range as missing
+func (repository HeaderRepository) PruneHeaders(blockNumber int64) (int64, error) {
+	tx, err := repository.database.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := repository.deleteHeaders(tx, "<", blockNumber)
+	if err != nil {
+		log.Error("PruneHeaders: error deleting headers: ", err)
+		rollback(tx)
+		return 0, err
+	}
+	_, err = tx.Exec(`INSERT INTO pruned_headers (eth_node_fingerprint, block_number) VALUES (?, ?)
+		ON CONFLICT (eth_node_fingerprint) DO UPDATE
+			SET block_number = MAX(pruned_headers.block_number, excluded.block_number)`,
+		repository.database.Node.ID, blockNumber)
+	if err != nil {
+		log.Error("PruneHeaders: error recording pruned block number: ", err)
+		rollback(tx)
+		return 0, err
+	}
+	return pruned, tx.Commit()
+}
+
+func (repository HeaderRepository) getHeader(condition string, args ...interface{}) (core.Header, error) {
+	var header core.Header
+	err := repository.database.Get(&header, `SELECT `+headerColumns+` FROM headers `+condition, args...)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error("getHeader: error getting header: ", err)
+	}
+	return header, err
+}
+
+// writeHeader inserts the header along with its uncles and transaction hashes, replacing the stored header at its height
+func (repository HeaderRepository) writeHeader(header core.Header, replace bool) (int64, error) {
+	tx, err := repository.database.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	if replace {
+		if _, err = repository.deleteHeaders(tx, "=", header.BlockNumber); err != nil {
+			log.Error("writeHeader: error deleting headers: ", err)
+			rollback(tx)
+			return 0, err
+		}
+	}
+	headerID, err := repository.insertHeader(tx, header)
+	if err != nil {
+		rollback(tx)
+		return 0, err
+	}
+	return headerID, tx.Commit()
+}
+
+func (repository HeaderRepository) insertHeader(tx *sqlx.Tx, header core.Header) (int64, error) {
+	result, err := tx.Exec(
+		`INSERT INTO headers (block_number, hash, block_timestamp, raw, raw_rlp, node_id, eth_node_fingerprint)
+			VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		header.BlockNumber, header.Hash, header.Timestamp, header.Raw, header.RLP, repository.database.NodeID, repository.database.Node.ID)
+	if err != nil {
+		log.Error("insertHeader: error inserting header: ", err)
+		return 0, err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		return 0, ErrValidHeaderExists
+	}
+	headerID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, uncle := range header.Uncles {
+		_, err = tx.Exec(
+			`INSERT INTO uncles (header_id, block_number, hash, uncle_index, miner, raw, raw_rlp, block_timestamp)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			headerID, uncle.BlockNumber, uncle.Hash, uncle.Index, uncle.Miner, uncle.Raw, uncle.RLP, uncle.Timestamp)
+		if err != nil {
+			log.Error("insertHeader: error inserting uncles: ", err)
+			return 0, err
+		}
+	}
+	for index, txHash := range header.TransactionHashes {
+		_, err = tx.Exec(`INSERT INTO header_transactions (header_id, tx_hash, tx_index) VALUES (?, ?, ?)`,
+			headerID, txHash, index)
+		if err != nil {
+			log.Error("insertHeader: error inserting transaction hashes: ", err)
+			return 0, err
+		}
+	}
+	return headerID, nil
+}
+
+// deleteHeaders deletes this node's headers whose block number compares to the provided one using the operator,
+// along with their uncles and transaction hashes, and returns the number of headers deleted
+func (repository HeaderRepository) deleteHeaders(tx *sqlx.Tx, operator string, blockNumber int64) (int64, error) {
+	condition := `block_number ` + operator + ` ? AND eth_node_fingerprint = ?`
+	for _, table := range []string{"uncles", "header_transactions"} {
+		_, err := tx.Exec(`DELETE FROM `+table+` WHERE header_id IN (SELECT id FROM headers WHERE `+condition+`)`,
+			blockNumber, repository.database.Node.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM headers WHERE `+condition, blockNumber, repository.database.Node.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func rollback(tx *sqlx.Tx) {
+	if err := tx.Rollback(); err != nil {
+		log.Error("failed to rollback transaction: ", err)
+	}
+}
@@ -0,0 +1,54 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sqlite_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/repository/conformance"
+	"github.com/vulcanize/eth-header-sync/pkg/sqlite"
+)
+
+var _ = Describe("SQLite header repository conformance", func() {
+	var (
+		dir string
+		db  *sqlite.DB
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "headers")
+		Expect(err).NotTo(HaveOccurred())
+		db, err = sqlite.NewDB(filepath.Join(dir, "headers.db"), testNode)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	conformance.DescribeHeaderRepository(func(fingerprint string) core.HeaderRepository {
+		return sqlite.NewHeaderRepositoryForFingerprint(db, fingerprint)
+	})
+})
@@ -0,0 +1,104 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrations create the SQLite equivalent of the tables of db/migrations, in the same order
+// The schema version is the number of migrations applied, it is kept in the database's user_version
+// The header_outbox table is left out as publishing requires Postgres
+var migrations = []string{
+	`CREATE TABLE nodes (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		client_name   TEXT,
+		genesis_block TEXT,
+		network_id    TEXT,
+		node_id       TEXT,
+		chain_id      INTEGER,
+		CONSTRAINT node_uc UNIQUE (genesis_block, network_id, node_id, chain_id)
+	)`,
+	`CREATE TABLE headers (
+		id                   INTEGER PRIMARY KEY AUTOINCREMENT,
+		hash                 TEXT,
+		block_number         INTEGER,
+		raw                  BLOB,
+		block_timestamp      INTEGER,
+		check_count          INTEGER NOT NULL DEFAULT 0,
+		node_id              INTEGER NOT NULL REFERENCES nodes (id) ON DELETE CASCADE,
+		eth_node_fingerprint TEXT,
+		UNIQUE (block_number, hash, eth_node_fingerprint)
+	);
+	CREATE INDEX headers_block_number ON headers (block_number);
+	CREATE INDEX headers_block_timestamp ON headers (block_timestamp)`,
+	`CREATE TABLE pruned_headers (
+		eth_node_fingerprint TEXT PRIMARY KEY,
+		block_number         INTEGER NOT NULL
+	)`,
+	`ALTER TABLE headers ADD COLUMN raw_rlp BLOB`,
+	`CREATE TABLE uncles (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		header_id       INTEGER NOT NULL,
+		block_number    INTEGER NOT NULL,
+		hash            TEXT NOT NULL,
+		uncle_index     INTEGER NOT NULL,
+		miner           TEXT NOT NULL,
+		raw             BLOB,
+		raw_rlp         BLOB,
+		block_timestamp INTEGER,
+		UNIQUE (header_id, uncle_index)
+	);
+	CREATE INDEX uncles_miner ON uncles (miner)`,
+	`CREATE TABLE header_transactions (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		header_id INTEGER NOT NULL,
+		tx_hash   TEXT NOT NULL,
+		tx_index  INTEGER NOT NULL,
+		UNIQUE (header_id, tx_index)
+	);
+	CREATE INDEX header_transactions_tx_hash ON header_transactions (tx_hash)`,
+	`CREATE INDEX headers_hash_fingerprint ON headers (hash, eth_node_fingerprint)`,
+}
+
+// migrate applies the migrations which have not been applied to the database yet
+func migrate(db *sqlx.DB) error {
+	var version int
+	if err := db.Get(&version, `PRAGMA user_version`); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(migrations[version]); err == nil {
+			// PRAGMA statements do not take parameters
+			_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
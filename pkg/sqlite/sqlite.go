@@ -0,0 +1,92 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3" //sqlite driver
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+)
+
+// DB is a wrapper around the sqlx.DB of a SQLite database file which associates node information with it
+type DB struct {
+	*sqlx.DB
+	Node   core.Node
+	NodeID int64
+}
+
+// NewDB opens, creating it if needed, the SQLite database at the provided path, migrates it and records the node info
+func NewDB(path string, node core.Node) (*DB, error) {
+	db, err := sqlx.Connect("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", path))
+	if err != nil {
+		return &DB{}, fmt.Errorf("db connection failed: %s", err.Error())
+	}
+	// SQLite allows a single writer, sharing one connection serializes writes instead of failing them as busy
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return &DB{}, fmt.Errorf("unable to migrate db: %s", err.Error())
+	}
+	sqliteDB := DB{DB: db, Node: node}
+	if err := sqliteDB.CreateNode(&node); err != nil {
+		db.Close()
+		return &DB{}, err
+	}
+	return &sqliteDB, nil
+}
+
+// NewReadOnlyDB opens the existing SQLite database at the provided path for reading, without migrating it or recording
+// node info, so it is only meant for reading headers by the fingerprint of the node which synced them
+func NewReadOnlyDB(path string) (*DB, error) {
+	db, err := sqlx.Connect("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=5000", path))
+	if err != nil {
+		return &DB{}, fmt.Errorf("db connection failed: %s", err.Error())
+	}
+	var version int
+	if err := db.Get(&version, `PRAGMA user_version`); err != nil {
+		db.Close()
+		return &DB{}, fmt.Errorf("unable to read db version: %s", err.Error())
+	}
+	// The database has no tables before its first migration
+	if version == 0 {
+		db.Close()
+		return &DB{}, fmt.Errorf("%s is not an eth-header-sync database", path)
+	}
+	return &DB{DB: db}, nil
+}
+
+// CreateNode inserts the node info into the database
+func (db *DB) CreateNode(node *core.Node) error {
+	_, err := db.Exec(
+		`INSERT INTO nodes (genesis_block, network_id, node_id, client_name, chain_id)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (genesis_block, network_id, node_id, chain_id) DO UPDATE SET client_name = excluded.client_name`,
+		node.GenesisBlock, node.NetworkID, node.ID, node.ClientName, node.ChainID)
+	if err != nil {
+		return fmt.Errorf("unable to set db node: %s", err.Error())
+	}
+	err = db.Get(&db.NodeID,
+		`SELECT id FROM nodes WHERE genesis_block = ? AND network_id = ? AND node_id = ? AND chain_id = ?`,
+		node.GenesisBlock, node.NetworkID, node.ID, node.ChainID)
+	if err != nil {
+		return fmt.Errorf("unable to set db node: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sqlite_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/eth-header-sync/pkg/core"
+	"github.com/vulcanize/eth-header-sync/pkg/sqlite"
+)
+
+var _ = Describe("SQLite DB", func() {
+	var (
+		dir  string
+		path string
+		db   *sqlite.DB
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "headers")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "headers.db")
+		db, err = sqlite.NewDB(path, testNode)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("keeps headers and the node id when reopened", func() {
+		repo := sqlite.NewHeaderRepository(db)
+		_, err := repo.CreateOrUpdateHeader(core.Header{BlockNumber: 1, Hash: "0x1", Timestamp: "10"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(db.Close()).To(Succeed())
+
+		reopened, err := sqlite.NewDB(path, testNode)
+		Expect(err).NotTo(HaveOccurred())
+		defer reopened.Close()
+
+		Expect(reopened.NodeID).To(Equal(db.NodeID))
+		header, err := sqlite.NewHeaderRepository(reopened).GetHeader(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Hash).To(Equal("0x1"))
+	})
+
+	It("replaces the uncles and transaction hashes of a replaced header", func() {
+		repo := sqlite.NewHeaderRepository(db)
+		_, err := repo.CreateOrUpdateHeader(core.Header{BlockNumber: 1, Hash: "0x1", Timestamp: "10",
+			Uncles:            []core.Uncle{{BlockNumber: 0, Hash: "0xuncle", Miner: "0xminer", Timestamp: "5"}},
+			TransactionHashes: []string{"0xtx1", "0xtx2"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		headerID, err := repo.CreateOrUpdateHeader(core.Header{BlockNumber: 1, Hash: "0x2", Timestamp: "10",
+			TransactionHashes: []string{"0xtx3"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		var uncles int
+		Expect(db.Get(&uncles, `SELECT COUNT(*) FROM uncles`)).To(Succeed())
+		Expect(uncles).To(BeZero())
+		var txHashes []string
+		Expect(db.Select(&txHashes, `SELECT tx_hash FROM header_transactions WHERE header_id = ?`, headerID)).To(Succeed())
+		Expect(txHashes).To(Equal([]string{"0xtx3"}))
+	})
+
+	It("looks headers up by hash with an index", func() {
+		var plan []struct {
+			ID      int    `db:"id"`
+			Parent  int    `db:"parent"`
+			NotUsed int    `db:"notused"`
+			Detail  string `db:"detail"`
+		}
+
+		Expect(db.Select(&plan, `EXPLAIN QUERY PLAN SELECT * FROM headers WHERE hash = ? AND eth_node_fingerprint = ?`, "0x1", "x")).To(Succeed())
+
+		Expect(plan).To(HaveLen(1))
+		Expect(plan[0].Detail).To(ContainSubstring("headers_hash_fingerprint"))
+	})
+
+	It("returns valid header exists error for a header with the stored hash", func() {
+		repo := sqlite.NewHeaderRepository(db)
+		_, err := repo.CreateOrUpdateHeader(core.Header{BlockNumber: 1, Hash: "0x1", Timestamp: "10"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: 1, Hash: "0x1", Timestamp: "10"})
+
+		Expect(err).To(MatchError(sqlite.ErrValidHeaderExists))
+	})
+
+	It("writes a batch of headers, replacing those with another hash and skipping stored ones", func() {
+		repo := sqlite.NewHeaderRepository(db)
+		_, err := repo.CreateOrUpdateHeader(core.Header{BlockNumber: 1, Hash: "0x1", Timestamp: "10"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = repo.CreateOrUpdateHeader(core.Header{BlockNumber: 2, Hash: "0x2", Timestamp: "20",
+			TransactionHashes: []string{"0xtx1"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		written, err := repo.CreateOrUpdateHeaders([]core.Header{
+			{BlockNumber: 1, Hash: "0x1", Timestamp: "10"},
+			{BlockNumber: 2, Hash: "0x2b", Timestamp: "20", TransactionHashes: []string{"0xtx2"}},
+			{BlockNumber: 3, Hash: "0x3", Timestamp: "30",
+				Uncles: []core.Uncle{{BlockNumber: 2, Hash: "0xuncle", Miner: "0xminer", Timestamp: "15"}}},
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(written).To(Equal(int64(2)))
+		headers, err := repo.GetHeadersInRange(1, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect([]string{headers[0].Hash, headers[1].Hash, headers[2].Hash}).To(Equal([]string{"0x1", "0x2b", "0x3"}))
+		txHashes, err := repo.GetTransactionHashes(2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(txHashes).To(Equal([]string{"0xtx2"}))
+		uncles, err := repo.GetUncles(3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uncles).To(HaveLen(1))
+		Expect(uncles[0].Hash).To(Equal("0xuncle"))
+	})
+
+	Describe("read only", func() {
+		It("reads the headers without recording a node", func() {
+			_, err := sqlite.NewHeaderRepository(db).CreateOrUpdateHeader(core.Header{BlockNumber: 1, Hash: "0x1", Timestamp: "10"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(db.Close()).To(Succeed())
+
+			readOnly, err := sqlite.NewReadOnlyDB(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer readOnly.Close()
+
+			header, err := sqlite.NewHeaderRepositoryForFingerprint(readOnly, testNode.ID).GetHeader(1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Hash).To(Equal("0x1"))
+			var nodes int
+			Expect(readOnly.Get(&nodes, `SELECT COUNT(*) FROM nodes`)).To(Succeed())
+			Expect(nodes).To(Equal(1))
+			_, err = readOnly.Exec(`DELETE FROM headers`)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("does not create a database", func() {
+			missing := filepath.Join(dir, "missing.db")
+
+			_, err := sqlite.NewReadOnlyDB(missing)
+
+			Expect(err).To(HaveOccurred())
+			_, err = os.Stat(missing)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
@@ -82,6 +82,10 @@ func CleanTestDB(db *postgres.DB) {
 	// can't delete from nodes since this function is called after the required node is persisted
 	db.MustExec("DELETE FROM goose_db_version")
 	db.MustExec("DELETE FROM headers")
+	db.MustExec("DELETE FROM pruned_headers")
+	db.MustExec("DELETE FROM uncles")
+	db.MustExec("DELETE FROM header_transactions")
+	db.MustExec("DELETE FROM header_outbox")
 }
 
 // NewTestNode returns a new test node, with preconfigured params